@@ -23,6 +23,16 @@ docker-run: ## Run Docker container with local kubeconfigs
 		-p 8000:8000 \
 		$(IMAGE_NAME):$(IMAGE_TAG)
 
+.PHONY: docker-doctor
+docker-doctor: ## Check the configuration in the Docker container with local kubeconfigs
+	docker run --rm \
+		--env-file $(LOCAL_CONFIG_DIR)/.env \
+		-v $(PWD)/$(LOCAL_CONFIG_DIR)/wc-kubeconfig.yaml:/k8s/wc-kubeconfig.yaml:ro \
+		-v $(PWD)/$(LOCAL_CONFIG_DIR)/mc-kubeconfig.yaml:/k8s/mc-kubeconfig.yaml:ro \
+		-e KUBECONFIG=/k8s/wc-kubeconfig.yaml \
+		-e MC_KUBECONFIG=/k8s/mc-kubeconfig.yaml \
+		$(IMAGE_NAME):$(IMAGE_TAG) python doctor.py
+
 .PHONY: local-setup
 local-setup: ## Create local_config directory with templates
 	@mkdir -p $(LOCAL_CONFIG_DIR)
@@ -103,6 +113,25 @@ local-run: local-deps ## Run locally with uvicorn using local_config/.env and ku
 		PYTHONPATH=$(PWD)/src \
 		uv run uvicorn src.main:app --reload --port 8000
 
+.PHONY: local-run-fake
+local-run-fake: local-deps ## Run locally against the fake clusters of src/fake_cluster.yaml (no cluster access needed)
+	@if [ ! -f $(LOCAL_CONFIG_DIR)/.env ]; then \
+		echo "Error: $(LOCAL_CONFIG_DIR)/.env not found. Run 'make -f Makefile.local.mk local-setup' first."; \
+		exit 1; \
+	fi
+	@set -a && . $(LOCAL_CONFIG_DIR)/.env && set +a && \
+		SHOOT_FAKE_CLUSTER=true \
+		WC_CLUSTER=demo \
+		ORG_NS=org-demo \
+		PYTHONPATH=$(PWD)/src \
+		uv run uvicorn src.main:app --reload --port 8000
+
+.PHONY: integration-test
+integration-test: local-deps ## Run the integration scenarios against a kind cluster seeded with broken workloads. Usage: make -f Makefile.local.mk integration-test [F=<name filter>]
+	@cd src && \
+		MCP_KUBERNETES_PATH=$${MCP_KUBERNETES_PATH:-$(PWD)/$(LOCAL_CONFIG_DIR)/mcp-kubernetes} \
+		uv run python integration.py ../integration/scenarios --filter "$(F)"
+
 .PHONY: local-query
 local-query: ## Send a test query to the local server. Usage: make -f Makefile.local.mk local-query [Q="your query"]
 	@tmpfile=$$(mktemp); \
@@ -129,6 +158,6 @@ local-query: ## Send a test query to the local server. Usage: make -f Makefile.l
 	if [ "$$(jq -r '.metrics.breakdown' $$tmpfile)" != "null" ]; then \
 		echo; \
 		echo "Agent Breakdown:"; \
-		jq -r '.metrics.breakdown | to_entries[] | "  \(.key):\n    Cost: $$\(.value.total_cost_usd // 0)\n    Input: \(.value.usage.input_tokens // 0), Output: \(.value.usage.output_tokens // 0)"' $$tmpfile; \
+		jq -r '.metrics.breakdown | to_entries[] | "  \(.key):\n    Calls: \(.value.calls // 0) (errors: \(.value.errors // 0))\n    Duration: \((.value.duration_ms // 0) / 1000)s"' $$tmpfile; \
 	fi; \
 	rm -f $$tmpfile
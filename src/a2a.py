@@ -0,0 +1,338 @@
+"""
+A2A (agent-to-agent) protocol endpoint.
+
+Other agents of the platform discover shoot from its agent card
+(`GET /.well-known/agent-card.json`) and call it as a remote agent over
+JSON-RPC at `POST /a2a`:
+
+- `message/send`: run an investigation of the message's text and return the
+  completed task, with the report as its `report` artifact
+- `message/stream`: the same as server-sent events: the submitted task, the
+  report text as artifact updates while it is written, progress of the agents
+  as `working` status updates, and the final status
+- `tasks/get`: a task completed by `message/send`, by ID (the investigation
+  ID); streamed tasks are not kept
+- `tasks/cancel`: tasks cannot be canceled
+
+Investigations are admitted and kept like `POST /` ones (delegation.py).
+Every message starts a new investigation; follow-ups in the same context are
+not supported.
+"""
+
+import asyncio
+import json
+import uuid
+from datetime import datetime, timezone
+from typing import Any, AsyncIterator
+
+from fastapi.responses import JSONResponse, StreamingResponse
+
+from activity import get_activity_tracker
+from app_logging import logger
+from backend import get_backend
+from config import get_settings
+from delegation import admission_refusal, run_delegated_investigation
+from progress import ProgressEvent
+from query_policy import DENIED_PATTERN_RULE, QueryPolicyViolation, check_query
+from similar_investigations import with_similar_investigations
+from store import InvestigationRecord, get_investigation_store
+from tenancy import visible_to_caller
+from telemetry import trace_operation
+from tenant_quotas import settle_reservation
+
+A2A_PROTOCOL_VERSION = "0.3.0"
+
+# JSON-RPC and A2A error codes
+PARSE_ERROR = -32700
+INVALID_REQUEST = -32600
+METHOD_NOT_FOUND = -32601
+INVALID_PARAMS = -32602
+# Implementation-defined: the investigation was refused (recursion, circuit)
+INVESTIGATION_REFUSED = -32000
+TASK_NOT_FOUND = -32001
+TASK_NOT_CANCELABLE = -32002
+
+_REPORT_ARTIFACT = "report"
+
+
+class JsonRpcError(Exception):
+    """A JSON-RPC error response."""
+
+    def __init__(self, code: int, message: str) -> None:
+        super().__init__(message)
+        self.code = code
+        self.message = message
+
+
+def agent_card(url: str, version: str) -> dict[str, Any]:
+    """A2A agent card describing shoot, served at `url`."""
+    settings = get_settings()
+    return {
+        "protocolVersion": A2A_PROTOCOL_VERSION,
+        "name": "shoot",
+        "description": (
+            "Investigates failures in a Kubernetes workload cluster and its "
+            "management cluster and writes a diagnostic report with findings "
+            "and recommendations."
+        ),
+        "url": url,
+        "preferredTransport": "JSONRPC",
+        "version": version,
+        "capabilities": {"streaming": True, "pushNotifications": False},
+        "defaultInputModes": ["text/plain"],
+        "defaultOutputModes": ["text/markdown"],
+        "skills": [
+            {
+                "id": "investigate_cluster",
+                "name": "Investigate a Kubernetes failure",
+                "description": (
+                    f"Collects data from the {settings.wc_cluster or 'workload'} "
+                    "cluster and its management cluster and reports the cause of "
+                    "a failure. Takes minutes."
+                ),
+                "tags": ["kubernetes", "debugging", "diagnostics"],
+                "examples": ["Deployment api in namespace shop is not ready"],
+            }
+        ],
+    }
+
+
+def rpc_result(request_id: Any, result: dict[str, Any]) -> dict[str, Any]:
+    return {"jsonrpc": "2.0", "id": request_id, "result": result}
+
+
+def rpc_error(request_id: Any, error: JsonRpcError) -> dict[str, Any]:
+    return {
+        "jsonrpc": "2.0",
+        "id": request_id,
+        "error": {"code": error.code, "message": error.message},
+    }
+
+
+def parse_rpc_request(body: bytes) -> tuple[Any, str, dict[str, Any]]:
+    """
+    Parse a JSON-RPC request.
+
+    Returns:
+        Tuple of (request ID, method, params)
+
+    Raises:
+        JsonRpcError: The body is not a valid JSON-RPC request
+    """
+    try:
+        data = json.loads(body)
+    except (json.JSONDecodeError, UnicodeDecodeError) as e:
+        raise JsonRpcError(PARSE_ERROR, f"Invalid JSON: {e}") from e
+    if (
+        not isinstance(data, dict)
+        or data.get("jsonrpc") != "2.0"
+        or not isinstance(data.get("method"), str)
+    ):
+        raise JsonRpcError(INVALID_REQUEST, "Not a JSON-RPC 2.0 request")
+    params = data.get("params") or {}
+    if not isinstance(params, dict):
+        raise JsonRpcError(INVALID_PARAMS, "params must be an object")
+    return data.get("id"), data["method"], params
+
+
+def message_text(params: dict[str, Any]) -> str:
+    """
+    The text of the message of a message/send or message/stream request.
+
+    Raises:
+        JsonRpcError: The message has no text, or the query policy refuses it
+    """
+    message = params.get("message")
+    parts = message.get("parts") if isinstance(message, dict) else None
+    if not isinstance(parts, list):
+        raise JsonRpcError(INVALID_PARAMS, "params.message.parts is required")
+    text = "\n".join(
+        part["text"]
+        for part in parts
+        if isinstance(part, dict)
+        and part.get("kind") == "text"
+        and isinstance(part.get("text"), str)
+    ).strip()
+    if not text:
+        raise JsonRpcError(INVALID_PARAMS, "The message has no text parts")
+    try:
+        return check_query(text)
+    except QueryPolicyViolation as e:
+        denied = e.rule == DENIED_PATTERN_RULE
+        code = INVESTIGATION_REFUSED if denied else INVALID_PARAMS
+        raise JsonRpcError(code, f"{e.rule}: {e.message}") from e
+
+
+def _context_id(params: dict[str, Any]) -> str:
+    message = params.get("message") or {}
+    context_id = message.get("contextId")
+    return context_id if isinstance(context_id, str) else str(uuid.uuid4())
+
+
+def _status(state: str, text: str | None = None) -> dict[str, Any]:
+    status: dict[str, Any] = {
+        "state": state,
+        "timestamp": datetime.now(timezone.utc).isoformat(),
+    }
+    if text is not None:
+        status["message"] = {
+            "kind": "message",
+            "role": "agent",
+            "messageId": str(uuid.uuid4()),
+            "parts": [{"kind": "text", "text": text}],
+        }
+    return status
+
+
+def _report_artifact(text: str) -> dict[str, Any]:
+    return {
+        "artifactId": _REPORT_ARTIFACT,
+        "name": _REPORT_ARTIFACT,
+        "parts": [{"kind": "text", "text": text}],
+    }
+
+
+def _task(
+    task_id: str, context_id: str, status: dict[str, Any], report: str | None = None
+) -> dict[str, Any]:
+    task: dict[str, Any] = {
+        "kind": "task",
+        "id": task_id,
+        "contextId": context_id,
+        "status": status,
+    }
+    if report is not None:
+        task["artifacts"] = [_report_artifact(report)]
+    return task
+
+
+def _completed_task(record: InvestigationRecord, context_id: str) -> dict[str, Any]:
+    task = _task(record.id, context_id, _status("completed"), record.result)
+    task["status"]["timestamp"] = record.created_at
+    task["metadata"] = {
+        "truncated": record.truncated,
+        "total_cost_usd": record.total_cost_usd,
+        "triage": record.triage,
+    }
+    return task
+
+
+async def send_message(
+    params: dict[str, Any], invocation_chain: str | None
+) -> dict[str, Any]:
+    """Handle message/send: run an investigation to completion."""
+    query = message_text(params)
+    refusal = admission_refusal(invocation_chain)
+    if refusal is not None:
+        raise JsonRpcError(INVESTIGATION_REFUSED, refusal)
+
+    task_id = str(uuid.uuid4())
+    context_id = _context_id(params)
+    with trace_operation("a2a.message_send") as span:
+        span.set_attribute("request_id", task_id)
+        try:
+            record, _ = await run_delegated_investigation(task_id, query)
+        except asyncio.TimeoutError:
+            return _task(task_id, context_id, _status("failed", "Timed out"))
+        except Exception as e:
+            logger.exception(f"A2A investigation failed request_id={task_id}")
+            return _task(task_id, context_id, _status("failed", str(e)))
+    return _completed_task(record, context_id)
+
+
+def get_task(params: dict[str, Any]) -> dict[str, Any]:
+    """
+    Handle tasks/get: a task completed by message/send.
+
+    Raises:
+        JsonRpcError: No such task
+    """
+    task_id = params.get("id")
+    record = None
+    if isinstance(task_id, str):
+        record = get_investigation_store().get(task_id)
+    if record is None or not visible_to_caller(record.tenant):
+        raise JsonRpcError(TASK_NOT_FOUND, "Task not found")
+    # The context of the original message is not kept
+    return _completed_task(record, record.id)
+
+
+async def stream_message(
+    rpc_id: Any, params: dict[str, Any]
+) -> AsyncIterator[dict[str, Any]]:
+    """
+    Handle message/stream after admission: JSON-RPC responses with the task,
+    artifact updates carrying the report text, and the final status.
+    """
+    query = message_text(params)
+    task_id = str(uuid.uuid4())
+    context_id = _context_id(params)
+    coordinator_query, _ = with_similar_investigations(query)
+    yield rpc_result(rpc_id, _task(task_id, context_id, _status("submitted")))
+
+    def event(kind: str, **fields: Any) -> dict[str, Any]:
+        return rpc_result(
+            rpc_id, {"kind": kind, "taskId": task_id, "contextId": context_id, **fields}
+        )
+
+    yield event("status-update", status=_status("working"), final=False)
+    state, note = "completed", None
+    first = True
+    try:
+        with get_activity_tracker().investigation(task_id):
+            async for chunk in get_backend().stream(coordinator_query, progress=True):
+                if isinstance(chunk, ProgressEvent):
+                    yield event(
+                        "status-update",
+                        status=_status("working", str(chunk)),
+                        final=False,
+                    )
+                    continue
+                yield event(
+                    "artifact-update",
+                    artifact=_report_artifact(chunk),
+                    append=not first,
+                    lastChunk=False,
+                )
+                first = False
+    except Exception as e:
+        logger.exception(f"A2A streaming investigation failed request_id={task_id}")
+        state, note = "failed", str(e)
+    finally:
+        settle_reservation()
+    yield event("status-update", status=_status(state, note), final=True)
+
+
+def _sse(response: dict[str, Any]) -> str:
+    return f"data: {json.dumps(response)}\n\n"
+
+
+async def handle_a2a_request(
+    body: bytes, invocation_chain: str | None
+) -> JSONResponse | StreamingResponse:
+    """Answer an A2A JSON-RPC request."""
+    rpc_id = None
+    try:
+        rpc_id, method, params = parse_rpc_request(body)
+        if method == "message/send":
+            result = await send_message(params, invocation_chain)
+        elif method == "message/stream":
+            message_text(params)
+            refusal = admission_refusal(invocation_chain)
+            if refusal is not None:
+                raise JsonRpcError(INVESTIGATION_REFUSED, refusal)
+            events = stream_message(rpc_id, params)
+            return StreamingResponse(
+                (_sse(response) async for response in events),
+                media_type="text/event-stream",
+                headers={"Cache-Control": "no-cache", "X-Accel-Buffering": "no"},
+            )
+        elif method == "tasks/get":
+            result = get_task(params)
+        elif method == "tasks/cancel":
+            raise JsonRpcError(TASK_NOT_CANCELABLE, "Investigations cannot be canceled")
+        else:
+            raise JsonRpcError(METHOD_NOT_FOUND, f"Method not found: {method}")
+    except JsonRpcError as e:
+        return JSONResponse(rpc_error(rpc_id, e))
+    return JSONResponse(rpc_result(rpc_id, result))
@@ -0,0 +1,142 @@
+"""
+Structured access log of the API.
+
+Every request is logged as one JSON object on the `shoot.access` logger,
+replacing the uvicorn access log:
+
+    {"timestamp": "...", "method": "POST", "path": "/", "status": 200,
+     "bytes": 5321, "duration_ms": 48210, "request_id": "uuid",
+     "caller": "user:jane", "tenant": "team-a", "client": "10.0.0.7",
+     "invocation_chain": ["shoot-a"], "query": "Pod api in ..."}
+
+`caller` is the authenticated identity of the request: `admin` for requests
+with the admin token, `user:<name>` for the impersonated caller
+(impersonation.py), otherwise `anonymous`. `tenant` is the caller's tenant
+(tenancy.py). `invocation_chain` is the X-Shoot-Invocation-Chain header of
+calls from other shoot instances; anyone can send it, so it is logged as
+unverified extra data, never as the caller. Handlers attach the request ID,
+tenant, user, and investigation query through `request.state`; the query is
+omitted, redacted like tool output, or logged in full
+(SHOOT_ACCESS_LOG_QUERY).
+
+Successful requests are sampled (SHOOT_ACCESS_LOG_SAMPLE_RATE); failed ones
+(status 400 and above) are always logged. Healthcheck endpoints are not
+logged.
+"""
+
+import json
+import logging
+import random
+import time
+from datetime import datetime, timezone
+from typing import Any
+
+from fastapi import FastAPI
+from starlette.types import ASGIApp, Message, Receive, Scope, Send
+
+from app_logging import HEALTHCHECK_PATHS, access_logger
+from auth import is_admin_token
+from config import get_settings
+from invocation import INVOCATION_CHAIN_HEADER, parse_invocation_chain
+from redaction import redact_tool_output
+
+# Longest investigation query kept in an access log entry
+MAX_LOGGED_QUERY_LENGTH = 500
+
+
+def _caller(headers: dict[str, str], state: dict[str, Any]) -> str:
+    """Authenticated identity of the caller of a request."""
+    if is_admin_token(headers.get("authorization")):
+        return "admin"
+    if state.get("user"):
+        return f"user:{state['user']}"
+    return "anonymous"
+
+
+def _logged_query(query: Any) -> str | None:
+    """The investigation query as configured for the access log."""
+    mode = get_settings().access_log_query
+    if mode == "omit" or not isinstance(query, str):
+        return None
+    if mode == "redact":
+        query, _ = redact_tool_output(query)
+    return query[:MAX_LOGGED_QUERY_LENGTH]
+
+
+class AccessLogMiddleware:
+    """
+    ASGI middleware writing the access log.
+
+    Counts the bytes of streamed responses as they are sent, so streaming
+    investigations are logged with their full size and duration.
+    """
+
+    def __init__(self, app: ASGIApp) -> None:
+        self.app = app
+
+    async def __call__(self, scope: Scope, receive: Receive, send: Send) -> None:
+        if scope["type"] != "http" or scope["path"] in HEALTHCHECK_PATHS:
+            await self.app(scope, receive, send)
+            return
+
+        # Shared with request.state of the handlers
+        state = scope.setdefault("state", {})
+        started = time.monotonic()
+        status = 500
+        size = 0
+
+        async def send_counting(message: Message) -> None:
+            nonlocal status, size
+            if message["type"] == "http.response.start":
+                status = message["status"]
+            elif message["type"] == "http.response.body":
+                size += len(message.get("body", b""))
+            await send(message)
+
+        try:
+            await self.app(scope, receive, send_counting)
+        finally:
+            self._log(scope, state, status, size, time.monotonic() - started)
+
+    def _log(
+        self,
+        scope: Scope,
+        state: dict[str, Any],
+        status: int,
+        size: int,
+        duration: float,
+    ) -> None:
+        settings = get_settings()
+        if status < 400 and random.random() >= settings.access_log_sample_rate:
+            return
+        headers = {
+            key.decode("latin-1"): value.decode("latin-1")
+            for key, value in scope.get("headers", [])
+        }
+        client = scope.get("client")
+        entry: dict[str, Any] = {
+            "timestamp": datetime.now(timezone.utc).isoformat(),
+            "method": scope["method"],
+            "path": scope["path"],
+            "status": status,
+            "bytes": size,
+            "duration_ms": int(duration * 1000),
+            "request_id": state.get("request_id"),
+            "caller": _caller(headers, state),
+            "tenant": state.get("tenant"),
+            "client": client[0] if client else None,
+        }
+        # Unverified: any client can send the header
+        chain = parse_invocation_chain(headers.get(INVOCATION_CHAIN_HEADER.lower()))
+        if chain:
+            entry["invocation_chain"] = chain
+        query = _logged_query(state.get("query"))
+        if query is not None:
+            entry["query"] = query
+        access_logger.info(json.dumps(entry))
+
+
+def enable_access_log(app: FastAPI) -> None:
+    """Log the requests of the app, replacing the uvicorn access log."""
+    logging.getLogger("uvicorn.access").disabled = True
+    app.add_middleware(AccessLogMiddleware)
@@ -0,0 +1,133 @@
+"""
+Runtime activity tracking for the Shoot agent system.
+
+Keeps track of in-flight investigations and the outcome of the most recent
+model provider interaction, so health and status endpoints can report on the
+service without exposing any cluster data.
+
+Investigations are bounded by their timeouts; one still in flight past the
+hard ceiling (SHOOT_INVESTIGATION_CEILING_SECONDS) means the process is
+wedged, so the liveness probe fails and Kubernetes restarts the pod. The
+in-flight count and the age of the oldest investigation are exported as
+gauges.
+"""
+
+import time
+from contextlib import contextmanager
+from functools import lru_cache
+from threading import Lock
+from typing import Generator, Iterable
+
+from opentelemetry.metrics import CallbackOptions, Observation
+
+from circuit_breaker import get_circuit_breaker
+from telemetry import get_meter
+
+# Upper bounds (inclusive) of the in-flight investigation buckets
+_QUEUE_DEPTH_BUCKETS = [(0, "0"), (4, "1-4"), (19, "5-19")]
+_QUEUE_DEPTH_OVERFLOW = "20+"
+
+
+class ActivityTracker:
+    """Tracks in-flight investigations and model provider health."""
+
+    def __init__(self) -> None:
+        self._lock = Lock()
+        # request_id -> monotonic start time
+        self._active: dict[str, float] = {}
+        self._provider_ok: bool | None = None
+        self._provider_checked_at: float | None = None
+
+    @contextmanager
+    def investigation(self, request_id: str) -> Generator[None, None, None]:
+        """Mark an investigation as in flight for the duration of the block."""
+        with self._lock:
+            self._active[request_id] = time.monotonic()
+        try:
+            yield
+        finally:
+            with self._lock:
+                self._active.pop(request_id, None)
+
+    def active_count(self) -> int:
+        """Number of investigations currently in flight."""
+        with self._lock:
+            return len(self._active)
+
+    def oldest_age_seconds(self) -> float:
+        """Age of the longest-running in-flight investigation (0 if none)."""
+        with self._lock:
+            if not self._active:
+                return 0.0
+            return time.monotonic() - min(self._active.values())
+
+    def stuck_count(self, ceiling_seconds: int) -> int:
+        """Number of in-flight investigations running longer than the ceiling."""
+        deadline = time.monotonic() - ceiling_seconds
+        with self._lock:
+            return sum(1 for started in self._active.values() if started < deadline)
+
+    def queue_depth_bucket(self) -> str:
+        """In-flight investigation count as a coarse bucket (e.g. "1-4")."""
+        count = self.active_count()
+        for upper, label in _QUEUE_DEPTH_BUCKETS:
+            if count <= upper:
+                return label
+        return _QUEUE_DEPTH_OVERFLOW
+
+    def record_provider_result(self, ok: bool) -> None:
+        """
+        Record whether the latest model provider interaction succeeded.
+
+        The outcome also feeds the model provider circuit breaker.
+        """
+        with self._lock:
+            self._provider_ok = ok
+            self._provider_checked_at = time.time()
+        get_circuit_breaker().record(ok)
+
+    def provider_status(self) -> dict[str, str | float | None]:
+        """
+        Status of the model provider based on the latest interaction.
+
+        Returns:
+            {"status": "operational" | "degraded" | "unknown", "checked_at": epoch | None}
+        """
+        with self._lock:
+            if self._provider_ok is None:
+                status = "unknown"
+            elif self._provider_ok:
+                status = "operational"
+            else:
+                status = "degraded"
+            return {"status": status, "checked_at": self._provider_checked_at}
+
+
+@lru_cache()
+def get_activity_tracker() -> ActivityTracker:
+    """Get the process-wide activity tracker."""
+    return ActivityTracker()
+
+
+def register_activity_metrics() -> None:
+    """Export the in-flight investigation count and oldest age as gauges."""
+    tracker = get_activity_tracker()
+
+    def _in_flight(options: CallbackOptions) -> Iterable[Observation]:
+        yield Observation(tracker.active_count())
+
+    def _oldest_age(options: CallbackOptions) -> Iterable[Observation]:
+        yield Observation(tracker.oldest_age_seconds())
+
+    meter = get_meter()
+    meter.create_observable_gauge(
+        "shoot.investigations.in_flight",
+        callbacks=[_in_flight],
+        description="Investigations currently in flight",
+    )
+    meter.create_observable_gauge(
+        "shoot.investigations.oldest_age",
+        callbacks=[_oldest_age],
+        unit="s",
+        description="Age of the longest-running in-flight investigation",
+    )
@@ -0,0 +1,213 @@
+"""
+Tool call limits per agent run.
+
+SHOOT_MAX_TURNS bounds the coordinator's conversation, but not how many
+collector runs it starts or how many tool calls a collector makes. Session
+hooks enforce both:
+
+- the coordinator may delegate at most SHOOT_MAX_COORDINATOR_TOOL_CALLS Task
+  calls per investigation
+- each collector run may make at most SHOOT_MAX_COLLECTOR_TOOL_CALLS MCP tool
+  calls, including the built-in shoot_tools; every collector turn but the
+  last makes tool calls, so this also bounds its turns
+
+The limits are surfaced to the model instead of cutting it off: once few
+calls remain, each tool result carries a note with the remaining calls, and
+calls beyond the limit are refused with the instruction to answer with what
+was collected.
+
+Collector runs are tracked from their SubagentStart to their SubagentStop
+hook, keyed by agent ID, so every path a run ends on releases its count and
+delegations answered from the collector cache never start one. Tool calls
+are attributed to a run by the agent ID of their hook input; calls without
+one are only attributed while a single run is in flight.
+"""
+
+from collections import Counter
+from typing import TYPE_CHECKING, Any
+
+from claude_agent_sdk import HookContext, HookMatcher
+
+from app_logging import logger
+from telemetry import add_event
+
+if TYPE_CHECKING:
+    from collectors import CollectorRegistry
+
+# Notes on the remaining calls start below this many calls
+_WARN_REMAINING = 3
+
+
+def _deny(reason: str) -> dict[str, Any]:
+    return {
+        "hookSpecificOutput": {
+            "hookEventName": "PreToolUse",
+            "permissionDecision": "deny",
+            "permissionDecisionReason": reason,
+        }
+    }
+
+
+def _note(text: str) -> dict[str, Any]:
+    return {
+        "hookSpecificOutput": {
+            "hookEventName": "PostToolUse",
+            "additionalContext": text,
+        }
+    }
+
+
+class AgentLimits:
+    """Tool call counts of the coordinator and its collector runs."""
+
+    def __init__(
+        self,
+        registry: "CollectorRegistry",
+        max_coordinator_calls: int,
+        max_collector_calls: int,
+    ) -> None:
+        self.max_coordinator_calls = max_coordinator_calls
+        self.max_collector_calls = max_collector_calls
+        self._collectors = set(registry.collectors)
+        self.coordinator_calls = 0
+        # Agent ID -> collector, for runs in flight
+        self._runs: dict[str, str] = {}
+        # Tool calls of the collector runs in flight, by agent ID
+        self._calls: Counter[str] = Counter()
+
+    def _run(self, agent_id: str | None) -> str | None:
+        """The in-flight collector run a tool call belongs to, if known."""
+        if agent_id:
+            return agent_id if agent_id in self._runs else None
+        return next(iter(self._runs)) if len(self._runs) == 1 else None
+
+    def start_run(self, agent_id: str | None, agent_type: str) -> None:
+        """Track a collector run that started."""
+        if agent_id and agent_type in self._collectors:
+            self._runs[agent_id] = agent_type
+
+    def finish_run(self, agent_id: str | None) -> None:
+        """Release the count of a collector run that ended."""
+        self._runs.pop(agent_id or "", None)
+        self._calls.pop(agent_id or "", None)
+
+    def start_task(self, collector: str) -> str | None:
+        """Count a Task delegation; returns the refusal reason over the limit."""
+        if self.max_coordinator_calls and (
+            self.coordinator_calls >= self.max_coordinator_calls
+        ):
+            return (
+                f"Collector delegation refused: all {self.max_coordinator_calls} "
+                "delegations of this investigation are used. Write the final "
+                "answer now with the evidence already collected, and name any "
+                "open questions as next steps."
+            )
+        self.coordinator_calls += 1
+        return None
+
+    def finish_task(self) -> str | None:
+        """A note on the remaining delegations, once few remain."""
+        if not self.max_coordinator_calls:
+            return None
+        remaining = self.max_coordinator_calls - self.coordinator_calls
+        if remaining >= _WARN_REMAINING:
+            return None
+        return (
+            f"[tool budget] {remaining} of {self.max_coordinator_calls} "
+            "collector delegations remain for this investigation."
+        )
+
+    def start_tool_call(self, tool_name: str, agent_id: str | None) -> str | None:
+        """Count a collector tool call; returns the refusal reason over the limit."""
+        run = self._run(agent_id)
+        if run is None or not self.max_collector_calls:
+            return None
+        if self._calls[run] >= self.max_collector_calls:
+            return (
+                f"{tool_name} was refused: all {self.max_collector_calls} tool "
+                "calls of this collector run are used. Do not call more tools: "
+                "report what you found so far and name what remains unchecked."
+            )
+        self._calls[run] += 1
+        return None
+
+    def tool_call_note(self, agent_id: str | None) -> str | None:
+        """Note on the remaining tool calls of a collector run, once few remain."""
+        run = self._run(agent_id)
+        if run is None or not self.max_collector_calls:
+            return None
+        remaining = self.max_collector_calls - self._calls[run]
+        if remaining >= _WARN_REMAINING:
+            return None
+        return (
+            f"[tool budget] {remaining} of {self.max_collector_calls} tool calls "
+            "remain for this collector run. Prioritize the data you still need."
+        )
+
+
+def create_agent_limit_hooks(
+    registry: "CollectorRegistry",
+    max_coordinator_calls: int,
+    max_collector_calls: int,
+) -> dict[str, list[HookMatcher]]:
+    """Create session hooks enforcing the tool call limits of one investigation."""
+    limits = AgentLimits(registry, max_coordinator_calls, max_collector_calls)
+
+    async def _start_task(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        collector = input_data.get("tool_input", {}).get("subagent_type", "unknown")
+        reason = limits.start_task(collector)
+        if reason is None:
+            return {}
+        logger.warning(f"Refused Task call over the limit: {collector}")
+        add_event("tool_limit_reached", {"agent": "coordinator"})
+        return _deny(reason)
+
+    async def _finish_task(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        note = limits.finish_task()
+        return _note(note) if note else {}
+
+    async def _start_run(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        limits.start_run(input_data.get("agent_id"), input_data.get("agent_type", ""))
+        return {}
+
+    async def _finish_run(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        limits.finish_run(input_data.get("agent_id"))
+        return {}
+
+    async def _start_tool_call(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        tool_name = input_data.get("tool_name", "")
+        reason = limits.start_tool_call(tool_name, input_data.get("agent_id"))
+        if reason is None:
+            return {}
+        logger.warning(f"Refused collector tool call over the limit: {tool_name}")
+        add_event("tool_limit_reached", {"agent": "collector", "tool": tool_name})
+        return _deny(reason)
+
+    async def _tool_call_note(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        note = limits.tool_call_note(input_data.get("agent_id"))
+        return _note(note) if note else {}
+
+    return {
+        "PreToolUse": [
+            HookMatcher(matcher="Task", hooks=[_start_task]),  # type: ignore[list-item]
+            HookMatcher(matcher=r"mcp__.*", hooks=[_start_tool_call]),  # type: ignore[list-item]
+        ],
+        "PostToolUse": [
+            HookMatcher(matcher="Task", hooks=[_finish_task]),  # type: ignore[list-item]
+            HookMatcher(matcher=r"mcp__.*", hooks=[_tool_call_note]),  # type: ignore[list-item]
+        ],
+        "SubagentStart": [HookMatcher(hooks=[_start_run])],  # type: ignore[list-item]
+        "SubagentStop": [HookMatcher(hooks=[_finish_run])],  # type: ignore[list-item]
+    }
@@ -0,0 +1,113 @@
+"""
+Suggested alert rules for issues nothing alerted on.
+
+When a report identifies an issue that no alert fired for, a dedicated step
+proposes the Prometheus alerting rules that would have caught it, to close
+the monitoring gap. The rules are added to the structured report
+(`alert_rules`) and kept as a `suggested-alert-rules.yaml` artifact, a
+PrometheusRule for the user to review and deploy themselves; shoot never
+deploys it. Like the patch suggester, the alert rule suggester has no tools
+and calls the Anthropic Messages API directly with a single request (llm.py).
+"""
+
+import re
+from typing import Any
+
+import yaml
+from pydantic import BaseModel, Field
+
+from app_logging import logger
+from config import get_alert_rule_suggester_prompt, get_settings
+from llm import complete, format_report_input, parse_json_answer
+from schemas import SuggestedAlertRule
+
+_MAX_OUTPUT_TOKENS = 4096
+_MAX_RULES = 3
+ALERT_RULES_ARTIFACT = "suggested-alert-rules.yaml"
+_DURATION_PATTERN = re.compile(r"(\d+(ms|[smhdwy]))+")
+
+
+class AlertRuleSuggestions(BaseModel):
+    """Answer of the alert rule suggester."""
+
+    alert_rules: list[SuggestedAlertRule] = Field(default_factory=list)
+
+
+def parse_alert_rules(text: str) -> list[SuggestedAlertRule] | None:
+    """
+    Parse the suggester's JSON answer, tolerating surrounding prose or fences.
+
+    Rules with an invalid `for` duration are dropped.
+    """
+    suggestions = parse_json_answer(text, AlertRuleSuggestions)
+    if suggestions is None:
+        return None
+    valid = []
+    for rule in suggestions.alert_rules[:_MAX_RULES]:
+        if _DURATION_PATTERN.fullmatch(rule.duration):
+            valid.append(rule)
+        else:
+            logger.warning(f"Dropped alert rule {rule.alert}: bad for {rule.duration}")
+    return valid
+
+
+def alert_rules_artifact(rules: list[SuggestedAlertRule]) -> str:
+    """PrometheusRule holding the suggested alert rules."""
+    prometheus_rule = {
+        "apiVersion": "monitoring.coreos.com/v1",
+        "kind": "PrometheusRule",
+        "metadata": {"name": "shoot-suggested-alerts"},
+        "spec": {
+            "groups": [
+                {
+                    "name": "shoot-suggested",
+                    "rules": [
+                        {
+                            "alert": rule.alert,
+                            "expr": rule.expr,
+                            "for": rule.duration,
+                            "labels": {"severity": rule.severity},
+                            "annotations": {
+                                "summary": rule.summary,
+                                "description": rule.explanation,
+                            },
+                        }
+                        for rule in rules
+                    ],
+                }
+            ]
+        },
+    }
+    header = (
+        "# Suggested by shoot; NOT deployed. Review the rules before deploying.\n"
+    )
+    return header + yaml.safe_dump(prometheus_rule, sort_keys=False)
+
+
+async def suggest_alert_rules(
+    query: str, report: str, evidence: list[tuple[str, str]]
+) -> tuple[list[SuggestedAlertRule], dict[str, Any]]:
+    """
+    Propose alert rules that would have caught the issue a report identifies.
+
+    Args:
+        query: Original failure description
+        report: Final report
+        evidence: (collector name, result text) for each collector call
+
+    Returns:
+        Tuple of (rules, empty if an alert fired, nothing is wrong, or the
+        answer could not be parsed, token usage)
+    """
+    settings = get_settings()
+    answer = await complete(
+        settings.alert_rule_suggester_model or settings.coordinator_model,
+        get_alert_rule_suggester_prompt(),
+        format_report_input(query, "Report", report, evidence),
+        _MAX_OUTPUT_TOKENS,
+    )
+    rules = parse_alert_rules(answer.text)
+    if rules is None:
+        logger.warning(f"Could not parse alert rule suggestions: {answer.text[:200]}")
+        return [], answer.usage
+    return rules, answer.usage
@@ -1,13 +1,18 @@
+import json
 import logging
+from datetime import datetime, timezone
+from typing import Any
+
+
+# Endpoints polled by probes and status pages, left out of access logs
+HEALTHCHECK_PATHS = ("/health", "/ready", "/startup", "/status")
 
 
 # Configure logging filter to suppress healthcheck endpoint logs
 class HealthcheckLogFilter(logging.Filter):
     def filter(self, record: logging.LogRecord) -> bool:
         message = record.getMessage()
-        if "/health" in message or "/ready" in message:
-            return False
-        return True
+        return not any(path in message for path in HEALTHCHECK_PATHS)
 
 
 # Apply the filter to uvicorn access logger
@@ -27,3 +32,61 @@ if not logger.handlers:
         logging.Formatter("%(asctime)s - %(name)s - %(levelname)s - %(message)s")
     )
     logger.addHandler(handler)
+
+# Levels the application logger can be set to at runtime
+LOG_LEVELS = ("DEBUG", "INFO", "WARNING", "ERROR")
+
+
+def get_log_level() -> str:
+    """Current level of the application logger."""
+    return logging.getLevelName(logger.level)
+
+
+def set_log_level(level: str) -> str:
+    """
+    Set the level of the application logger, until the next restart.
+
+    Returns:
+        The previous level
+
+    Raises:
+        ValueError: The level is not one of LOG_LEVELS
+    """
+    name = level.upper()
+    if name not in LOG_LEVELS:
+        raise ValueError(f"level must be one of {', '.join(LOG_LEVELS)}")
+    previous = get_log_level()
+    logger.setLevel(name)
+    return previous
+
+
+# Audit log of security-relevant events, one JSON object per line
+audit_logger = logging.getLogger("shoot.audit")
+audit_logger.setLevel(logging.INFO)
+audit_logger.propagate = False
+
+if not audit_logger.handlers:
+    audit_handler = logging.StreamHandler()
+    audit_handler.setFormatter(logging.Formatter("%(message)s"))
+    audit_logger.addHandler(audit_handler)
+
+
+# Access log of API requests, one JSON object per line (see access_log.py)
+access_logger = logging.getLogger("shoot.access")
+access_logger.setLevel(logging.INFO)
+access_logger.propagate = False
+
+if not access_logger.handlers:
+    access_handler = logging.StreamHandler()
+    access_handler.setFormatter(logging.Formatter("%(message)s"))
+    access_logger.addHandler(access_handler)
+
+
+def audit(event: str, **fields: Any) -> None:
+    """Write an event to the audit log."""
+    record = {
+        "timestamp": datetime.now(timezone.utc).isoformat(),
+        "audit": event,
+        **fields,
+    }
+    audit_logger.info(json.dumps(record, default=str))
@@ -0,0 +1,266 @@
+"""
+Human approval of sensitive tool calls.
+
+Tool calls matching SHOOT_APPROVAL_REQUIRED_TOOLS pause the investigation
+until an admin approves or denies them:
+
+- the PreToolUse hook registers an approval request, notifies
+  SHOOT_APPROVAL_WEBHOOK_URL (a Slack incoming webhook or any endpoint
+  accepting its JSON message), and waits
+- admins list pending requests (`GET /admin/approvals`) and decide them
+  (`POST /admin/approvals/{id}`)
+- an approved call runs; a denied call, or one left undecided for
+  SHOOT_APPROVAL_TIMEOUT_SECONDS, is refused with the reason reported to
+  the model
+
+Patterns are `tool` or `tool:resource` globs: the tool is the qualified MCP
+tool name (`mcp__kubernetes_wc__get`), the resource the call's
+resourceType/kind argument, e.g. `*__get:secret*` for reading Secrets.
+Every request and decision is written to the audit log. Pending requests are
+kept in memory by the instance running the investigation. The stall
+watchdog of a session is held while one of its calls waits (the model is
+not stalled, a human is deciding), and a request whose investigation ends
+before a decision, e.g. a retried attempt, expires.
+"""
+
+import asyncio
+import uuid
+from datetime import datetime, timezone
+from fnmatch import fnmatchcase
+from functools import lru_cache
+from typing import Any, Literal
+
+import httpx
+from claude_agent_sdk import HookContext, HookMatcher
+from pydantic import BaseModel, Field
+
+from app_logging import audit, logger
+from config import get_settings
+from telemetry import add_event
+
+ApprovalStatus = Literal["pending", "approved", "denied", "expired"]
+
+# Tool arguments naming the resource of a call
+_RESOURCE_ARGUMENTS = ("resourceType", "resource_type", "kind", "resource")
+# Decided requests kept for listing
+_MAX_DECIDED = 200
+_WEBHOOK_TIMEOUT_SECONDS = 10
+_HOOK_TIMEOUT_MARGIN_SECONDS = 30
+
+
+class ApprovalRequest(BaseModel):
+    """A tool call waiting for, or decided by, an admin."""
+
+    id: str = Field(default_factory=lambda: str(uuid.uuid4()))
+    session_id: str | None = None
+    tool: str
+    arguments: dict[str, Any] = Field(default_factory=dict)
+    rule: str
+    created_at: str = Field(
+        default_factory=lambda: datetime.now(timezone.utc).isoformat()
+    )
+    status: ApprovalStatus = "pending"
+    decided_at: str | None = None
+    reason: str | None = None
+
+
+class ApprovalQueue:
+    """Pending and recently decided approval requests of this instance."""
+
+    def __init__(self) -> None:
+        self._requests: dict[str, ApprovalRequest] = {}
+        self._decisions: dict[str, asyncio.Future[bool]] = {}
+
+    def list(self) -> list[ApprovalRequest]:
+        """Requests, newest first."""
+        return sorted(
+            self._requests.values(), key=lambda r: r.created_at, reverse=True
+        )
+
+    def get(self, approval_id: str) -> ApprovalRequest | None:
+        return self._requests.get(approval_id)
+
+    def _forget_decided(self) -> None:
+        decided = [r for r in self.list() if r.status != "pending"]
+        for request in decided[_MAX_DECIDED:]:
+            del self._requests[request.id]
+
+    def add(self, request: ApprovalRequest) -> None:
+        """Register a pending request."""
+        self._requests[request.id] = request
+        self._decisions[request.id] = asyncio.get_running_loop().create_future()
+
+    def waiting(self, session_id: str | None) -> bool:
+        """Whether a tool call of a session waits for a decision."""
+        return any(
+            request.status == "pending"
+            and (session_id is None or request.session_id in (None, session_id))
+            for request in self._requests.values()
+        )
+
+    def _expire(self, request: ApprovalRequest) -> None:
+        request.status = "expired"
+        request.decided_at = datetime.now(timezone.utc).isoformat()
+        audit("approval_expired", approval_id=request.id, tool=request.tool)
+
+    async def wait(self, request: ApprovalRequest, timeout: float) -> ApprovalRequest:
+        """Wait for the decision of a registered request or the timeout."""
+        decision = self._decisions[request.id]
+        try:
+            await asyncio.wait_for(asyncio.shield(decision), timeout)
+        except asyncio.TimeoutError:
+            self._expire(request)
+        except asyncio.CancelledError:
+            # The investigation ended; nobody waits for the decision anymore
+            self._expire(request)
+            raise
+        finally:
+            self._decisions.pop(request.id, None)
+            self._forget_decided()
+        return request
+
+    def decide(
+        self, approval_id: str, approved: bool, reason: str | None = None
+    ) -> ApprovalRequest:
+        """
+        Approve or deny a pending request.
+
+        Raises:
+            KeyError: No such request
+            ValueError: The request was already decided or expired
+        """
+        request = self._requests[approval_id]
+        decision = self._decisions.get(approval_id)
+        if request.status != "pending" or decision is None or decision.done():
+            raise ValueError(f"Approval request is {request.status}")
+        request.status = "approved" if approved else "denied"
+        request.decided_at = datetime.now(timezone.utc).isoformat()
+        request.reason = reason
+        decision.set_result(approved)
+        audit(
+            "approval_decided",
+            approval_id=approval_id,
+            tool=request.tool,
+            status=request.status,
+            reason=reason,
+        )
+        return request
+
+
+@lru_cache()
+def get_approval_queue() -> ApprovalQueue:
+    """Get the approval queue singleton."""
+    return ApprovalQueue()
+
+
+def approval_patterns() -> list[str]:
+    """Configured tool[:resource] patterns requiring approval."""
+    patterns = get_settings().approval_required_tools.split(",")
+    return [pattern.strip() for pattern in patterns if pattern.strip()]
+
+
+def matching_rule(
+    tool_name: str, tool_input: dict[str, Any], patterns: list[str]
+) -> str | None:
+    """The first pattern a tool call matches, or None."""
+    resource = next(
+        (
+            str(tool_input[argument]).lower()
+            for argument in _RESOURCE_ARGUMENTS
+            if isinstance(tool_input.get(argument), str)
+        ),
+        "",
+    )
+    for pattern in patterns:
+        tool_pattern, _, resource_pattern = pattern.partition(":")
+        if not fnmatchcase(tool_name, tool_pattern):
+            continue
+        if not resource_pattern or fnmatchcase(resource, resource_pattern.lower()):
+            return pattern
+    return None
+
+
+async def notify_approval_request(request: ApprovalRequest) -> None:
+    """Post an approval request to the webhook, if configured."""
+    url = get_settings().approval_webhook_url
+    if not url:
+        return
+    arguments = ", ".join(f"{key}={value}" for key, value in request.arguments.items())
+    message = {
+        "text": (
+            f"shoot is waiting for approval of {request.tool}({arguments}) "
+            f"(rule {request.rule}). Approve or deny with "
+            f"POST /admin/approvals/{request.id}."
+        ),
+        "approval": request.model_dump(),
+    }
+    try:
+        async with httpx.AsyncClient(timeout=_WEBHOOK_TIMEOUT_SECONDS) as client:
+            response = await client.post(url, json=message)
+            response.raise_for_status()
+    except httpx.HTTPError as e:
+        logger.warning(f"Approval webhook failed approval_id={request.id}: {e}")
+
+
+def _deny(reason: str) -> dict[str, Any]:
+    return {
+        "hookSpecificOutput": {
+            "hookEventName": "PreToolUse",
+            "permissionDecision": "deny",
+            "permissionDecisionReason": reason,
+        }
+    }
+
+
+def create_approval_hooks(patterns: list[str]) -> dict[str, list[HookMatcher]]:
+    """Create session hooks holding matching tool calls until they are approved."""
+    timeout_seconds = get_settings().approval_timeout_seconds
+
+    async def _await_approval(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        tool_name = input_data.get("tool_name", "")
+        tool_input = input_data.get("tool_input", {})
+        rule = matching_rule(tool_name, tool_input, patterns)
+        if rule is None:
+            return {}
+
+        request = ApprovalRequest(
+            session_id=input_data.get("session_id"),
+            tool=tool_name,
+            arguments=tool_input,
+            rule=rule,
+        )
+        logger.info(f"Waiting for approval approval_id={request.id} tool={tool_name}")
+        add_event("approval_requested", {"tool": tool_name, "rule": rule})
+        audit(
+            "approval_requested",
+            approval_id=request.id,
+            session_id=request.session_id,
+            tool=tool_name,
+            arguments=tool_input,
+            rule=rule,
+        )
+        queue = get_approval_queue()
+        queue.add(request)
+        await notify_approval_request(request)
+        request = await queue.wait(request, timeout_seconds)
+        if request.status == "approved":
+            return {}
+        reason = f": {request.reason}" if request.reason else ""
+        return _deny(
+            f"{tool_name} requires human approval and was {request.status}{reason}. "
+            "Continue without this data and say in the report that it was not "
+            "collected."
+        )
+
+    return {
+        "PreToolUse": [
+            HookMatcher(
+                matcher=r"mcp__.*",
+                hooks=[_await_approval],  # type: ignore[list-item]
+                # The hook outlives the default hook timeout while it waits
+                timeout=timeout_seconds + _HOOK_TIMEOUT_MARGIN_SECONDS,
+            )
+        ],
+    }
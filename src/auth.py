@@ -0,0 +1,42 @@
+"""
+Authentication helpers for administrative endpoints.
+
+Admin endpoints are protected by a static bearer token (SHOOT_ADMIN_TOKEN, or
+a secret file named by SHOOT_ADMIN_TOKEN_FILE). When no token is configured,
+admin endpoints are disabled entirely.
+"""
+
+import secrets
+
+from fastapi import Header, HTTPException
+
+from secret_files import get_secret
+
+
+def is_admin_token(authorization: str | None) -> bool:
+    """Check whether an Authorization header carries the configured admin token."""
+    admin_token = get_secret("admin_token")
+    if not admin_token or not authorization:
+        return False
+    scheme, _, token = authorization.partition(" ")
+    if scheme.lower() != "bearer":
+        return False
+    return secrets.compare_digest(token.strip(), admin_token)
+
+
+def require_admin(authorization: str | None = Header(default=None)) -> None:
+    """
+    FastAPI dependency rejecting requests without a valid admin bearer token.
+
+    Raises:
+        HTTPException: 404 if admin endpoints are disabled, 401 if the token is
+            missing or invalid
+    """
+    if not get_secret("admin_token"):
+        raise HTTPException(status_code=404, detail="Not Found")
+    if not is_admin_token(authorization):
+        raise HTTPException(
+            status_code=401,
+            detail="Invalid or missing admin token",
+            headers={"WWW-Authenticate": "Bearer"},
+        )
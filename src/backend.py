@@ -0,0 +1,202 @@
+"""
+Investigation backends for the Shoot agent system.
+
+The server runs every investigation through a Backend, selected with
+SHOOT_BACKEND:
+
+- `agent_sdk` (default): the coordinator runs in a ClaudeSDKClient session
+  (coordinator.py), with session hooks for caching, tool policy, log
+  sampling, redaction, and time budget notes, and optional recording of its
+  model and tool traffic (traffic_recording.py).
+- `scripted`: agent_sdk sessions whose model and tool calls are answered from
+  a script (scripted_model.py), for tests without network access or API keys.
+- `claude_cli`: the claude CLI runs the same coordinator prompt, collector
+  subagents, and MCP servers in print mode (claude_cli.py). The CLI cannot
+  run in-process hooks or tools, so the session hooks and built-in tools are
+  not available; only final report scrubbing applies.
+"""
+
+import contextlib
+from functools import lru_cache
+from typing import AsyncIterator, Protocol
+
+from app_logging import logger
+from claude_cli import ClaudeCliBackend
+from config import ReportFormat, get_settings
+from coordinator import (
+    InvestigationResult,
+    is_coordinator_ready,
+    run_coordinator,
+    run_coordinator_streaming,
+)
+from generation import GenerationOverrides
+from progress import ProgressEvent
+from redaction import scrub_report
+from scripted_model import ScriptedModel, get_model_script
+from traffic_recording import RECORDING_ARTIFACT, TrafficSession
+
+
+class Backend(Protocol):
+    """Runs investigations for the server."""
+
+    name: str
+
+    async def run(
+        self,
+        query_text: str,
+        timeout_seconds: int | None = None,
+        max_turns: int | None = None,
+        collector_instructions: dict[str, str] | None = None,
+        use_collector_cache: bool = True,
+        verify: bool | None = None,
+        language: str | None = None,
+        report_format: ReportFormat | None = None,
+        session_id: str | None = None,
+        debug: bool = False,
+        record: bool = False,
+        generation: GenerationOverrides | None = None,
+        instructions: str | None = None,
+        remediate: bool = False,
+        suggest_patches: bool | None = None,
+        suggest_alert_rules: bool | None = None,
+    ) -> InvestigationResult:
+        """Run an investigation to completion."""
+        ...
+
+    def stream(
+        self,
+        query_text: str,
+        timeout_seconds: int | None = None,
+        max_turns: int | None = None,
+        collector_instructions: dict[str, str] | None = None,
+        progress: bool = False,
+        generation: GenerationOverrides | None = None,
+        instructions: str | None = None,
+    ) -> AsyncIterator[str | ProgressEvent]:
+        """
+        Run an investigation, yielding report text as it is produced, and
+        with progress, progress events of the agents.
+        """
+        ...
+
+    def ready(self) -> bool:
+        """Whether investigations can be started."""
+        ...
+
+
+class AgentSdkBackend:
+    """Coordinator sessions in-process via the Claude Agent SDK."""
+
+    name = "agent_sdk"
+
+    async def run(
+        self,
+        query_text: str,
+        timeout_seconds: int | None = None,
+        max_turns: int | None = None,
+        collector_instructions: dict[str, str] | None = None,
+        use_collector_cache: bool = True,
+        verify: bool | None = None,
+        language: str | None = None,
+        report_format: ReportFormat | None = None,
+        session_id: str | None = None,
+        debug: bool = False,
+        record: bool = False,
+        generation: GenerationOverrides | None = None,
+        instructions: str | None = None,
+        remediate: bool = False,
+        suggest_patches: bool | None = None,
+        suggest_alert_rules: bool | None = None,
+    ) -> InvestigationResult:
+        traffic = self._traffic(record)
+        # The model traffic proxy runs for the whole investigation
+        async with traffic or contextlib.nullcontext():
+            result = await run_coordinator(
+                query_text,
+                timeout_seconds=timeout_seconds,
+                max_turns=max_turns,
+                collector_instructions=collector_instructions,
+                use_collector_cache=use_collector_cache,
+                verify=verify,
+                language=language,
+                report_format=report_format,
+                session_id=session_id,
+                debug=debug,
+                traffic=traffic,
+                generation=generation,
+                instructions=instructions,
+                remediate=remediate,
+                suggest_patches=suggest_patches,
+                suggest_alert_rules=suggest_alert_rules,
+            )
+        if traffic is None or not traffic.recording:
+            return result
+        # Scrubbed like the report and the other artifacts
+        result["artifacts"] = {
+            **(result["artifacts"] or {}),
+            RECORDING_ARTIFACT: scrub_report(
+                traffic.bundle(query_text).model_dump_json()
+            ),
+        }
+        return result
+
+    async def stream(
+        self,
+        query_text: str,
+        timeout_seconds: int | None = None,
+        max_turns: int | None = None,
+        collector_instructions: dict[str, str] | None = None,
+        progress: bool = False,
+        generation: GenerationOverrides | None = None,
+        instructions: str | None = None,
+    ) -> AsyncIterator[str | ProgressEvent]:
+        traffic = self._traffic(record=False)
+        async with traffic or contextlib.nullcontext():
+            async for chunk in run_coordinator_streaming(
+                query_text,
+                timeout_seconds=timeout_seconds,
+                max_turns=max_turns,
+                collector_instructions=collector_instructions,
+                traffic=traffic,
+                progress=progress,
+                generation=generation,
+                instructions=instructions,
+            ):
+                yield chunk
+
+    def ready(self) -> bool:
+        return is_coordinator_ready()
+
+    def _traffic(self, record: bool) -> TrafficSession | None:
+        """Traffic session of an investigation, if its traffic is recorded."""
+        return TrafficSession() if record else None
+
+
+class ScriptedBackend(AgentSdkBackend):
+    """Agent SDK sessions answered by the scripted model."""
+
+    name = "scripted"
+
+    def ready(self) -> bool:
+        try:
+            get_model_script()
+        except ValueError as e:
+            logger.error(f"Scripted backend not ready: {e}")
+            return False
+        return super().ready()
+
+    def _traffic(self, record: bool) -> TrafficSession | None:
+        # Scripted traffic is not recorded, there is nothing to replay
+        script = get_model_script()
+        return TrafficSession(ScriptedModel(script), script.tool_calls)
+
+
+@lru_cache()
+def get_backend() -> Backend:
+    """Get the investigation backend selected by SHOOT_BACKEND."""
+    backend = get_settings().backend
+    if backend == "claude_cli":
+        return ClaudeCliBackend()
+    if backend == "scripted":
+        return ScriptedBackend()
+    return AgentSdkBackend()
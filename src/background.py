@@ -0,0 +1,47 @@
+"""
+Background tasks outliving the request that started them.
+
+Callback investigations, Teams investigations, Jira filings, and shadow
+replays run as background tasks. The event loop only keeps weak references
+to tasks, so they are kept here until they are done. On shutdown, running
+tasks get a grace period to finish; those still running after it are
+cancelled and get a moment to report it (callback investigations post a
+failure to their callback URLs).
+"""
+
+import asyncio
+from typing import Any, Coroutine
+
+from app_logging import logger
+
+# Time running tasks get to finish on shutdown
+_SHUTDOWN_GRACE_SECONDS = 20
+# Time cancelled tasks get to report their cancellation
+_CANCEL_GRACE_SECONDS = 10
+
+# Strong references to running tasks so they are not garbage collected
+_TASKS: set[asyncio.Task[Any]] = set()
+
+
+def spawn_background(coro: Coroutine[Any, Any, Any]) -> asyncio.Task[Any]:
+    """
+    Run a coroutine as a background task, drained on shutdown.
+
+    The task runs in a copy of the current context.
+    """
+    task = asyncio.create_task(coro)
+    _TASKS.add(task)
+    task.add_done_callback(_TASKS.discard)
+    return task
+
+
+async def drain_background_tasks() -> None:
+    """Let running background tasks finish on shutdown, cancelling late ones."""
+    if not _TASKS:
+        return
+    logger.info(f"Waiting for {len(_TASKS)} background tasks")
+    _, pending = await asyncio.wait(set(_TASKS), timeout=_SHUTDOWN_GRACE_SECONDS)
+    for task in pending:
+        task.cancel()
+    if pending:
+        await asyncio.wait(pending, timeout=_CANCEL_GRACE_SECONDS)
@@ -0,0 +1,328 @@
+"""
+Cluster baselines and the deviations from them.
+
+With SHOOT_BASELINE_INTERVAL_SECONDS set, a background task
+(baseline_capture.py) periodically captures a baseline of the workload
+cluster: its nodes with their readiness, kubelet versions, and pressure
+conditions, the desired and ready replicas and images of every Deployment,
+StatefulSet, and DaemonSet, and Pod counts by phase.
+
+The coordinator gets the `compare_baseline` tool, which compares the latest
+baseline with an earlier one and lists what deviates ("Deployment
+kube-system/coredns: ready replicas dropped from 3 to 1"). Like the other
+built-in tools, it has no cluster access: it only reads captured baselines,
+so deviations are leads that collectors still have to confirm.
+
+The last SHOOT_BASELINE_RETENTION baselines are kept in memory and, with
+SHOOT_BASELINE_DIR, written there as JSON files and reloaded on startup. The
+directory may be shared: files are kept in a subdirectory per cluster and
+named after the instance (SHOOT_INSTANCE_ID) that captured them, and every
+instance prunes only its own. On startup, the baselines of the cluster are
+loaded whichever instance captured them.
+"""
+
+import re
+from collections import deque
+from datetime import datetime, timedelta, timezone
+from functools import lru_cache
+from pathlib import Path
+from threading import Lock
+from typing import Any
+
+from claude_agent_sdk import tool
+from pydantic import BaseModel, Field, ValidationError
+
+from app_logging import logger
+from config import get_settings
+from telemetry import add_event
+
+# Phases of Pods whose count changes are reported
+_REPORTED_POD_PHASES = ("Pending", "Failed", "Unknown")
+_FILE_PREFIX = "baseline-"
+
+
+class NodeState(BaseModel):
+    """Baseline state of a node."""
+
+    ready: bool = False
+    kubelet_version: str = ""
+    # Conditions other than Ready that are True (MemoryPressure, ...)
+    conditions: list[str] = Field(default_factory=list)
+
+
+class WorkloadState(BaseModel):
+    """Baseline state of a Deployment, StatefulSet, or DaemonSet."""
+
+    desired: int = 0
+    ready: int = 0
+    images: list[str] = Field(default_factory=list)
+
+
+class BaselineSnapshot(BaseModel):
+    """Structured state of the workload cluster at one point in time."""
+
+    cluster: str
+    captured_at: str = Field(
+        default_factory=lambda: datetime.now(timezone.utc).isoformat()
+    )
+    nodes: dict[str, NodeState] = Field(default_factory=dict)
+    # Keyed by kind/namespace/name
+    workloads: dict[str, WorkloadState] = Field(default_factory=dict)
+    pod_phases: dict[str, int] = Field(default_factory=dict)
+    # Resource kinds that could not be listed
+    errors: list[str] = Field(default_factory=list)
+
+    def summary(self) -> dict[str, Any]:
+        """Counts of the baseline for listings."""
+        return {
+            "cluster": self.cluster,
+            "captured_at": self.captured_at,
+            "nodes": len(self.nodes),
+            "workloads": len(self.workloads),
+            "pods": sum(self.pod_phases.values()),
+            "errors": self.errors,
+        }
+
+
+def _compare_nodes(old: dict[str, NodeState], new: dict[str, NodeState]) -> list[str]:
+    deviations = []
+    if len(old) != len(new):
+        deviations.append(f"Node count changed from {len(old)} to {len(new)}")
+    for name in sorted(old.keys() - new.keys()):
+        deviations.append(f"Node {name} is gone")
+    for name in sorted(new.keys() - old.keys()):
+        state = "" if new[name].ready else " (NotReady)"
+        deviations.append(f"Node {name} was added{state}")
+    for name in sorted(old.keys() & new.keys()):
+        before, after = old[name], new[name]
+        if before.ready and not after.ready:
+            deviations.append(f"Node {name} became NotReady")
+        elif after.ready and not before.ready:
+            deviations.append(f"Node {name} became Ready")
+        if before.kubelet_version != after.kubelet_version:
+            deviations.append(
+                f"Node {name}: kubelet version changed from "
+                f"{before.kubelet_version or 'unknown'} to "
+                f"{after.kubelet_version or 'unknown'}"
+            )
+        for condition in sorted(set(after.conditions) - set(before.conditions)):
+            deviations.append(f"Node {name}: {condition} appeared")
+    return deviations
+
+
+def _workload_name(key: str) -> str:
+    """`Deployment kube-system/coredns` for a kind/namespace/name key."""
+    kind, _, name = key.partition("/")
+    return f"{kind} {name}"
+
+
+def _compare_workloads(
+    old: dict[str, WorkloadState], new: dict[str, WorkloadState]
+) -> list[str]:
+    deviations = []
+    for key in sorted(old.keys() - new.keys()):
+        deviations.append(f"{_workload_name(key)} is gone")
+    for key in sorted(new.keys() - old.keys()):
+        workload = new[key]
+        deviations.append(
+            f"{_workload_name(key)} was added "
+            f"({workload.ready}/{workload.desired} ready)"
+        )
+    for key in sorted(old.keys() & new.keys()):
+        before, after = old[key], new[key]
+        name = _workload_name(key)
+        if before.desired != after.desired:
+            deviations.append(
+                f"{name}: desired replicas changed from {before.desired} "
+                f"to {after.desired}"
+            )
+        if after.ready < before.ready:
+            deviations.append(
+                f"{name}: ready replicas dropped from {before.ready} to {after.ready}"
+            )
+        elif after.ready > before.ready and before.ready < before.desired:
+            deviations.append(
+                f"{name}: ready replicas recovered from {before.ready} "
+                f"to {after.ready}"
+            )
+        if before.images != after.images:
+            deviations.append(
+                f"{name}: images changed from {', '.join(before.images)} "
+                f"to {', '.join(after.images)}"
+            )
+    return deviations
+
+
+def compare_snapshots(old: BaselineSnapshot, new: BaselineSnapshot) -> list[str]:
+    """Deviations of a later baseline from an earlier one, as sentences."""
+    deviations = _compare_nodes(old.nodes, new.nodes)
+    deviations.extend(_compare_workloads(old.workloads, new.workloads))
+    for phase in _REPORTED_POD_PHASES:
+        before, after = old.pod_phases.get(phase, 0), new.pod_phases.get(phase, 0)
+        if before != after:
+            deviations.append(f"{phase} Pods changed from {before} to {after}")
+    return deviations
+
+
+def _path_part(name: str) -> str:
+    """A cluster or instance name, safe to use in a file path."""
+    return re.sub(r"[^A-Za-z0-9_.-]", "_", name) or "_"
+
+
+def _file_name(snapshot: BaselineSnapshot, instance: str) -> str:
+    captured_at = datetime.fromisoformat(snapshot.captured_at)
+    return (
+        f"{_FILE_PREFIX}{_path_part(instance)}-"
+        f"{captured_at.strftime('%Y%m%dT%H%M%SZ')}.json"
+    )
+
+
+def _own_file_pattern(instance: str) -> re.Pattern[str]:
+    """Names of the baseline files an instance wrote."""
+    return re.compile(
+        rf"{_FILE_PREFIX}{re.escape(_path_part(instance))}-\d{{8}}T\d{{6}}Z\.json"
+    )
+
+
+class BaselineStore:
+    """The most recent baselines of this instance, oldest first."""
+
+    def __init__(
+        self, max_size: int, directory: str = "", instance: str = "shoot"
+    ) -> None:
+        self._snapshots: deque[BaselineSnapshot] = deque(maxlen=max_size)
+        self._directory = (
+            Path(directory) / _path_part(get_settings().wc_cluster)
+            if directory
+            else None
+        )
+        self._instance = instance
+        self._lock = Lock()
+
+    def list(self) -> list[BaselineSnapshot]:
+        with self._lock:
+            return list(self._snapshots)
+
+    def latest(self) -> BaselineSnapshot | None:
+        with self._lock:
+            return self._snapshots[-1] if self._snapshots else None
+
+    def closest_to(self, moment: datetime) -> BaselineSnapshot | None:
+        """The baseline captured closest to a point in time."""
+        snapshots = self.list()
+        if not snapshots:
+            return None
+        return min(
+            snapshots,
+            key=lambda s: abs(datetime.fromisoformat(s.captured_at) - moment),
+        )
+
+    def add(self, snapshot: BaselineSnapshot) -> None:
+        """Keep a baseline, writing it to the baseline directory if configured."""
+        with self._lock:
+            self._snapshots.append(snapshot)
+            kept = {_file_name(s, self._instance) for s in self._snapshots}
+        if self._directory is None:
+            return
+        own_file = _own_file_pattern(self._instance)
+        try:
+            self._directory.mkdir(parents=True, exist_ok=True)
+            path = self._directory / _file_name(snapshot, self._instance)
+            path.write_text(snapshot.model_dump_json())
+            # Files of other instances sharing the directory are theirs to prune
+            for old in self._directory.glob(f"{_FILE_PREFIX}*.json"):
+                if own_file.fullmatch(old.name) and old.name not in kept:
+                    old.unlink()
+        except OSError as e:
+            logger.warning(f"Failed to write baseline to {self._directory}: {e}")
+
+    def load(self) -> None:
+        """Reload the baselines of this cluster from the baseline directory."""
+        if self._directory is None or not self._directory.is_dir():
+            return
+        cluster = get_settings().wc_cluster
+        loaded = []
+        for path in sorted(self._directory.glob(f"{_FILE_PREFIX}*.json")):
+            try:
+                snapshot = BaselineSnapshot.model_validate_json(path.read_text())
+            except (OSError, ValidationError) as e:
+                logger.warning(f"Skipping unreadable baseline {path}: {e}")
+                continue
+            if snapshot.cluster == cluster:
+                loaded.append(snapshot)
+        loaded.sort(key=lambda s: s.captured_at)
+        with self._lock:
+            self._snapshots.extend(loaded)
+        logger.info(f"Loaded {len(loaded)} baselines from {self._directory}")
+
+
+@lru_cache()
+def get_baseline_store() -> BaselineStore:
+    """Get the baseline store singleton, loaded from SHOOT_BASELINE_DIR."""
+    settings = get_settings()
+    store = BaselineStore(
+        settings.baseline_retention, settings.baseline_dir, settings.instance_id
+    )
+    store.load()
+    return store
+
+
+def baselines_enabled() -> bool:
+    """Whether baselines are captured and the coordinator can compare them."""
+    return get_settings().baseline_interval_seconds > 0
+
+
+def format_deviations(
+    old: BaselineSnapshot, new: BaselineSnapshot, deviations: list[str]
+) -> str:
+    """Comparison of two baselines as text for the coordinator."""
+    header = (
+        f"Baseline of {new.captured_at} compared with the baseline of "
+        f"{old.captured_at}."
+    )
+    errors = sorted(set(old.errors) | set(new.errors))
+    if errors:
+        header += f" Not captured in both: {', '.join(errors)}."
+    if not deviations:
+        return f"{header}\nNo deviations."
+    return header + "\n" + "\n".join(f"- {deviation}" for deviation in deviations)
+
+
+@tool(
+    "compare_baseline",
+    "Compare the latest captured baseline of the workload cluster (nodes, "
+    "workload replicas and images, Pod phases) with the baseline captured about "
+    "`hours_ago` hours earlier (default 24) and list the deviations, such as "
+    "replicas that dropped, changed images, or nodes that became NotReady. "
+    "Baselines are captured periodically, so confirm deviations with collectors.",
+    {
+        "type": "object",
+        "properties": {"hours_ago": {"type": "number", "minimum": 0.1}},
+    },
+)
+async def compare_baseline(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: deviations of the latest baseline from an earlier one."""
+    try:
+        hours_ago = float(args.get("hours_ago") or 24)
+    except (TypeError, ValueError):
+        hours_ago = 24.0
+    store = get_baseline_store()
+    latest = store.latest()
+    if latest is None:
+        text = "No baseline has been captured yet."
+        return {"content": [{"type": "text", "text": text}]}
+    moment = datetime.fromisoformat(latest.captured_at) - timedelta(hours=hours_ago)
+    earlier = store.closest_to(moment)
+    if earlier is None or earlier.captured_at == latest.captured_at:
+        text = (
+            f"Only one baseline, captured {latest.captured_at}, is available; "
+            "there is nothing to compare it with yet."
+        )
+        return {"content": [{"type": "text", "text": text}]}
+    deviations = compare_snapshots(earlier, latest)
+    add_event("baseline_compared", {"deviations": len(deviations)})
+    return {
+        "content": [
+            {"type": "text", "text": format_deviations(earlier, latest, deviations)}
+        ]
+    }
@@ -0,0 +1,141 @@
+"""
+Scheduled capture of workload cluster baselines.
+
+Every SHOOT_BASELINE_INTERVAL_SECONDS, the nodes, Deployments, StatefulSets,
+DaemonSets, and Pods of the workload cluster are listed through the
+workload cluster's mcp-kubernetes server (the same server, and so the same
+read-only access, the collectors use) and reduced to a BaselineSnapshot
+(baseline.py). No model is involved.
+"""
+
+import asyncio
+from typing import Any
+
+from app_logging import logger
+from baseline import BaselineSnapshot, NodeState, WorkloadState, get_baseline_store
+from config import get_settings
+from mcp_kubernetes import (
+    call_mcp_tool,
+    connect_mcp_server,
+    get_wc_mcp_config,
+    list_result_items,
+)
+from telemetry import add_event, trace_operation
+
+# Resource types listed for a baseline, by the kind they are recorded as
+_WORKLOAD_KINDS = {
+    "Deployment": "deployments",
+    "StatefulSet": "statefulsets",
+    "DaemonSet": "daemonsets",
+}
+# Time a whole capture may take
+_CAPTURE_TIMEOUT_SECONDS = 300
+
+
+def _images(item: dict[str, Any]) -> list[str]:
+    containers = (
+        item.get("spec", {}).get("template", {}).get("spec", {}).get("containers", [])
+    )
+    return sorted({c["image"] for c in containers if c.get("image")})
+
+
+def node_state(item: dict[str, Any]) -> NodeState:
+    """Baseline state of a Node object."""
+    status = item.get("status", {})
+    conditions = {
+        c.get("type"): c.get("status") for c in status.get("conditions", [])
+    }
+    return NodeState(
+        ready=conditions.get("Ready") == "True",
+        kubelet_version=status.get("nodeInfo", {}).get("kubeletVersion", ""),
+        conditions=sorted(
+            str(kind)
+            for kind, value in conditions.items()
+            if kind != "Ready" and value == "True"
+        ),
+    )
+
+
+def workload_state(kind: str, item: dict[str, Any]) -> WorkloadState:
+    """Baseline state of a Deployment, StatefulSet, or DaemonSet object."""
+    status = item.get("status", {})
+    if kind == "DaemonSet":
+        desired = status.get("desiredNumberScheduled", 0)
+        ready = status.get("numberReady", 0)
+    else:
+        desired = item.get("spec", {}).get("replicas", 1)
+        ready = status.get("readyReplicas", 0)
+    return WorkloadState(desired=desired, ready=ready, images=_images(item))
+
+
+def _key(kind: str, item: dict[str, Any]) -> str:
+    metadata = item.get("metadata", {})
+    return f"{kind}/{metadata.get('namespace', '')}/{metadata.get('name', '')}"
+
+
+async def capture_baseline() -> BaselineSnapshot:
+    """
+    Capture a baseline of the workload cluster.
+
+    Resource types that cannot be listed are recorded in the baseline's
+    errors.
+
+    Raises:
+        Exception: The MCP server cannot be started or connected to
+    """
+    snapshot = BaselineSnapshot(cluster=get_settings().wc_cluster)
+    async with connect_mcp_server(get_wc_mcp_config()) as session:
+
+        async def list_items(resource_type: str) -> list[dict[str, Any]] | None:
+            arguments = {
+                "resourceType": resource_type,
+                "allNamespaces": True,
+                "fullOutput": True,
+            }
+            try:
+                text = await call_mcp_tool(session, "list", arguments)
+                return list_result_items(text)
+            except Exception as e:
+                logger.warning(f"Baseline could not list {resource_type}: {e}")
+                snapshot.errors.append(resource_type)
+                return None
+
+        nodes = await list_items("nodes")
+        for item in nodes or []:
+            name = item.get("metadata", {}).get("name", "")
+            snapshot.nodes[name] = node_state(item)
+        for kind, resource_type in _WORKLOAD_KINDS.items():
+            for item in await list_items(resource_type) or []:
+                snapshot.workloads[_key(kind, item)] = workload_state(kind, item)
+        for item in await list_items("pods") or []:
+            phase = item.get("status", {}).get("phase", "Unknown")
+            snapshot.pod_phases[phase] = snapshot.pod_phases.get(phase, 0) + 1
+    return snapshot
+
+
+async def capture_and_store_baseline() -> BaselineSnapshot:
+    """Capture a baseline and keep it in the baseline store."""
+    with trace_operation("baseline.capture"):
+        async with asyncio.timeout(_CAPTURE_TIMEOUT_SECONDS):
+            snapshot = await capture_baseline()
+        add_event(
+            "baseline_captured",
+            {"nodes": len(snapshot.nodes), "workloads": len(snapshot.workloads)},
+        )
+    get_baseline_store().add(snapshot)
+    logger.info(
+        f"Captured baseline nodes={len(snapshot.nodes)} "
+        f"workloads={len(snapshot.workloads)} errors={len(snapshot.errors)}"
+    )
+    return snapshot
+
+
+async def run_baseline_capture(interval_seconds: int) -> None:
+    """Capture a baseline now and then periodically, until cancelled."""
+    while True:
+        try:
+            await capture_and_store_baseline()
+        except Exception as e:
+            # Retried at the next interval
+            logger.warning(f"Failed to capture baseline: {e!r}")
+        await asyncio.sleep(interval_seconds)
@@ -0,0 +1,169 @@
+"""
+Bounded capture of subprocess output.
+
+The claude CLI prints one stream-json event per line, and a tool that dumps
+hundreds of megabytes (e.g. logs or a cluster-wide listing) produces an
+event as large, while stderr is read until the process exits. Holding
+either in memory can OOM the pod, so output is kept in memory only up to
+SHOOT_SUBPROCESS_OUTPUT_MAX_BYTES; beyond that it is spilled to a file in
+SHOOT_SUBPROCESS_SPILL_DIR, up to SHOOT_SUBPROCESS_SPILL_MAX_BYTES, and the
+rest is counted but dropped. The end of the output is always kept in
+memory, since errors are usually printed last.
+
+Spill files in the default temporary directory are deleted once the output
+is closed; files in a configured spill directory are kept for inspection.
+"""
+
+import asyncio
+import contextlib
+import os
+import tempfile
+from typing import IO, AsyncIterator
+
+from app_logging import logger
+from config import get_settings
+
+# Bytes read from a stream at a time
+_CHUNK_BYTES = 64 * 1024
+# Bytes at the end of an output kept in memory
+_TAIL_BYTES = 64 * 1024
+
+
+class SpilledOutput:
+    """Output kept in memory up to a limit and spilled to a file beyond it."""
+
+    def __init__(self, name: str) -> None:
+        settings = get_settings()
+        self.name = name
+        self.total_bytes = 0
+        self.dropped_bytes = 0
+        self.path: str | None = None
+        self._memory_limit = settings.subprocess_output_max_bytes
+        self._spill_limit = settings.subprocess_spill_max_bytes
+        self._spill_dir = settings.subprocess_spill_dir
+        self._head = bytearray()
+        self._tail = bytearray()
+        self._file: IO[bytes] | None = None
+
+    def write(self, data: bytes) -> None:
+        """Append output, spilling what does not fit in memory."""
+        self.total_bytes += len(data)
+        self._tail.extend(data)
+        del self._tail[:-_TAIL_BYTES]
+        room = self._memory_limit - len(self._head)
+        if room > 0:
+            self._head.extend(data[:room])
+            data = data[room:]
+        if not data:
+            return
+        if self._file is None and not self._open_spill_file():
+            self.dropped_bytes += len(data)
+            return
+        assert self._file is not None
+        # The spill file holds the whole output, head included
+        kept = max(0, self._spill_limit - self._file.tell())
+        self._file.write(data[:kept])
+        self.dropped_bytes += len(data) - len(data[:kept])
+
+    def _open_spill_file(self) -> bool:
+        """Start spilling to a file; False if spilling is disabled or fails."""
+        if self._spill_limit <= len(self._head):
+            return False
+        directory = self._spill_dir or None
+        try:
+            if directory:
+                os.makedirs(directory, exist_ok=True)
+            self._file = tempfile.NamedTemporaryFile(
+                prefix=f"{self.name}-",
+                suffix=".out",
+                dir=directory,
+                delete=False,
+            )
+            self._file.write(self._head)
+        except OSError as e:
+            logger.warning(f"Cannot spill {self.name} output to disk: {e}")
+            self._file = None
+            return False
+        self.path = self._file.name
+        logger.warning(
+            f"{self.name} output exceeded {self._memory_limit} bytes, "
+            f"spilling to {self.path}"
+        )
+        return True
+
+    def head(self, max_bytes: int | None = None) -> bytes:
+        """The first bytes of the output kept in memory."""
+        return bytes(self._head[:max_bytes])
+
+    def tail(self, max_bytes: int) -> bytes:
+        """The last bytes of the output, up to 64 KiB."""
+        return bytes(self._tail[-max_bytes:])
+
+    def close(self) -> None:
+        """Close the spill file, deleting it unless a spill directory is set."""
+        if self._file is None:
+            return
+        self._file.close()
+        if not self._spill_dir:
+            with contextlib.suppress(OSError):
+                os.unlink(self._file.name)
+            self.path = None
+
+    def summary(self) -> str:
+        """How much output there was and where it went."""
+        parts = [f"{self.total_bytes} bytes of {self.name} output"]
+        if self.path:
+            parts.append(f"spilled to {self.path}")
+        if self.dropped_bytes:
+            parts.append(f"{self.dropped_bytes} bytes dropped")
+        return ", ".join(parts)
+
+
+async def drain(stream: asyncio.StreamReader, output: SpilledOutput) -> SpilledOutput:
+    """Read a stream to its end into bounded output."""
+    while True:
+        chunk = await stream.read(_CHUNK_BYTES)
+        if not chunk:
+            return output
+        output.write(chunk)
+
+
+async def bounded_lines(
+    stream: asyncio.StreamReader, name: str
+) -> AsyncIterator[bytes | SpilledOutput]:
+    """
+    Yield the lines of a stream.
+
+    Lines longer than the stream's limit are not held in memory: they are
+    yielded as spilled output, which the caller must close.
+    """
+    while True:
+        try:
+            line = await stream.readuntil(b"\n")
+        except asyncio.IncompleteReadError as e:
+            # The last line has no newline
+            if e.partial:
+                yield e.partial
+            return
+        except asyncio.LimitOverrunError as e:
+            output = SpilledOutput(name)
+            await _spill_line(stream, output, e.consumed)
+            yield output
+            continue
+        yield line
+
+
+async def _spill_line(
+    stream: asyncio.StreamReader, output: SpilledOutput, consumed: int
+) -> None:
+    """Move the rest of an overlong line from a stream into spilled output."""
+    while True:
+        output.write(await stream.read(consumed))
+        try:
+            output.write(await stream.readuntil(b"\n"))
+            return
+        except asyncio.IncompleteReadError as e:
+            output.write(e.partial)
+            return
+        except asyncio.LimitOverrunError as e:
+            consumed = e.consumed
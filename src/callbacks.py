@@ -0,0 +1,214 @@
+"""
+Completion callbacks of asynchronous investigations.
+
+A `POST /` request with a `callback_url` is answered at once (202) with its
+request ID, and the investigation runs in the background. When it finishes,
+its response, or the error it failed with, is posted to the callback URL:
+
+    {"event": "investigation.completed", "status": "completed",
+     "request_id": "uuid", "result": "...", "metrics": {...}, ...}
+    {"event": "investigation.completed", "status": "failed",
+     "request_id": "uuid", "error": ...}
+
+Callbacks are signed with SHOOT_CALLBACK_SECRET, and disabled without it.
+The receiver checks `X-Shoot-Signature: sha256=<hex>`, the HMAC-SHA256 of
+`<X-Shoot-Timestamp>.<body>`, and rejects old timestamps to prevent replays.
+Callback URLs must match SHOOT_CALLBACK_ALLOWED_HOSTS if set; otherwise
+their host must resolve to public addresses only, so callbacks cannot reach
+loopback, link-local (cloud metadata), or cluster-internal addresses. The
+host is resolved and checked again before each delivery, and the delivery is
+sent to the checked address, so a host cannot be rebound to an internal
+address between the check and the connection. Failed deliveries are
+retried up to SHOOT_CALLBACK_MAX_ATTEMPTS times; the investigation is kept
+in the history either way. On shutdown, running investigations get a grace
+period to finish (background.py); those cancelled after it report a failure.
+"""
+
+import asyncio
+import hashlib
+import hmac
+import ipaddress
+import json
+import socket
+import time
+from fnmatch import fnmatchcase
+from typing import Any, Awaitable, Callable
+from urllib.parse import urlsplit
+
+import httpx
+from fastapi import HTTPException
+
+from app_logging import audit, logger
+from background import spawn_background
+from config import get_settings
+from secret_files import get_secret
+from telemetry import add_event, trace_operation
+from tenant_quotas import settle_reservation
+
+SIGNATURE_HEADER = "X-Shoot-Signature"
+TIMESTAMP_HEADER = "X-Shoot-Timestamp"
+_DELIVERY_TIMEOUT_SECONDS = 10
+_RETRY_DELAY_SECONDS = 5
+
+
+def callbacks_enabled() -> bool:
+    """Whether requests may ask for a completion callback."""
+    return bool(get_secret("callback_secret"))
+
+
+async def check_callback_host(hostname: str) -> str | None:
+    """
+    Check that callbacks may be sent to a host.
+
+    Hosts matching SHOOT_CALLBACK_ALLOWED_HOSTS are trusted; without it, the
+    host must resolve to public addresses only.
+
+    Returns:
+        A checked address of the host, None for trusted hosts
+
+    Raises:
+        ValueError: The host is not allowed
+    """
+    allowed = [
+        host.strip().lower()
+        for host in get_settings().callback_allowed_hosts.split(",")
+        if host.strip()
+    ]
+    if allowed:
+        if not any(fnmatchcase(hostname, host) for host in allowed):
+            raise ValueError(f"callback_url host {hostname} is not allowed")
+        return None
+    try:
+        infos = await asyncio.get_running_loop().getaddrinfo(hostname, None)
+    except socket.gaierror as e:
+        raise ValueError(f"callback_url host {hostname} does not resolve: {e}")
+    for info in infos:
+        address = ipaddress.ip_address(info[4][0])
+        if not address.is_global:
+            raise ValueError(
+                f"callback_url host {hostname} resolves to non-public address "
+                f"{address}; allow it with SHOOT_CALLBACK_ALLOWED_HOSTS"
+            )
+    return infos[0][4][0]
+
+
+async def validate_callback_url(url: Any) -> str:
+    """
+    Check the callback URL of a request.
+
+    Raises:
+        ValueError: Callbacks are disabled or the URL is not allowed
+    """
+    if not callbacks_enabled():
+        raise ValueError("callback_url requires SHOOT_CALLBACK_SECRET")
+    if not isinstance(url, str):
+        raise ValueError("callback_url must be a string")
+    parts = urlsplit(url)
+    if parts.scheme not in ("http", "https") or not parts.hostname:
+        raise ValueError("callback_url must be an http or https URL")
+    await check_callback_host(parts.hostname)
+    return url
+
+
+def sign_callback(body: bytes, timestamp: str) -> str:
+    """Signature header value of a callback body sent at a timestamp."""
+    message = timestamp.encode() + b"." + body
+    key = get_secret("callback_secret").encode()
+    return "sha256=" + hmac.new(key, message, hashlib.sha256).hexdigest()
+
+
+async def deliver_callback(url: str, payload: dict[str, Any]) -> bool:
+    """
+    Post a signed callback, retrying failed deliveries.
+
+    Returns:
+        Whether the receiver accepted it
+    """
+    body = json.dumps(payload, default=str).encode()
+    request_id = payload.get("request_id")
+    target = httpx.URL(url)
+    max_attempts = get_settings().callback_max_attempts
+    for attempt in range(1, max_attempts + 1):
+        # The host may resolve differently than when the URL was validated
+        try:
+            address = await check_callback_host(target.host)
+        except ValueError as e:
+            logger.warning(f"Callback refused request_id={request_id}: {e}")
+            break
+        # Signed per attempt, so retries carry a current timestamp
+        timestamp = str(int(time.time()))
+        headers = {
+            "Content-Type": "application/json",
+            TIMESTAMP_HEADER: timestamp,
+            SIGNATURE_HEADER: sign_callback(body, timestamp),
+        }
+        pinned, extensions = target, {}
+        if address is not None:
+            # Connect to the checked address; the receiver and its TLS
+            # certificate are still addressed by the host name
+            pinned = target.copy_with(host=address)
+            headers["Host"] = target.netloc.decode("ascii")
+            extensions["sni_hostname"] = target.host
+        try:
+            async with httpx.AsyncClient(timeout=_DELIVERY_TIMEOUT_SECONDS) as client:
+                response = await client.post(
+                    pinned, content=body, headers=headers, extensions=extensions
+                )
+                response.raise_for_status()
+        except httpx.HTTPError as e:
+            logger.warning(
+                f"Callback failed request_id={request_id} attempt={attempt}: {e}"
+            )
+            if attempt < max_attempts:
+                await asyncio.sleep(_RETRY_DELAY_SECONDS * attempt)
+            continue
+        audit("callback_delivered", request_id=request_id, url=url)
+        add_event("callback_delivered", {"attempts": attempt})
+        return True
+    audit("callback_failed", request_id=request_id, url=url)
+    add_event("callback_failed", {"attempts": max_attempts})
+    return False
+
+
+async def _run_with_callback(
+    request_id: str,
+    url: str,
+    investigate: Callable[[], Awaitable[dict[str, Any]]],
+) -> None:
+    """Run an investigation and post its outcome to the callback URL."""
+    payload: dict[str, Any] = {
+        "event": "investigation.completed",
+        "request_id": request_id,
+    }
+    # The request's span has ended; the investigation gets its own
+    with trace_operation("api.investigate.callback", {"request_id": request_id}):
+        try:
+            payload.update(await investigate())
+            payload["status"] = "completed"
+        except HTTPException as e:
+            payload.update(status="failed", error=e.detail)
+        except asyncio.CancelledError:
+            payload.update(status="failed", error="shoot shut down")
+            await deliver_callback(url, payload)
+            raise
+        except Exception as e:
+            logger.exception(f"Investigation failed request_id={request_id}")
+            payload.update(status="failed", error=str(e))
+        finally:
+            settle_reservation()
+        await deliver_callback(url, payload)
+
+
+def start_callback_investigation(
+    request_id: str,
+    url: str,
+    investigate: Callable[[], Awaitable[dict[str, Any]]],
+) -> None:
+    """
+    Run an investigation in the background, posting its outcome to a URL.
+
+    The investigation runs in a copy of the current context, with the
+    request's cluster, namespaces, tenant, and identity.
+    """
+    logger.info(f"Investigation request_id={request_id} will call back when done")
+    spawn_background(_run_with_callback(request_id, url, investigate))
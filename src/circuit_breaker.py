@@ -0,0 +1,197 @@
+"""
+Circuit breaker for model provider failures.
+
+While the model provider is failing, every investigation would run into its
+stall timeout or fail late. After SHOOT_CIRCUIT_BREAKER_THRESHOLD consecutive
+failed provider interactions the circuit opens: new investigations are
+refused with 503 and a Retry-After header, and /ready reports not_ready, so
+traffic moves to healthy replicas. After
+SHOOT_CIRCUIT_BREAKER_COOLDOWN_SECONDS one investigation is let through as a
+probe; its outcome closes the circuit or opens it for another cooldown. The
+probe slot is given out once a request is validated, and given back if the
+request is then refused before it reaches the provider.
+
+Provider outcomes are reported through the activity tracker (activity.py).
+"""
+
+import math
+import time
+from contextvars import ContextVar
+from functools import lru_cache
+from threading import Lock
+from typing import Any
+
+from fastapi import HTTPException
+
+from app_logging import logger
+from config import get_settings
+from telemetry import add_event
+
+# Time the probe of the current request was let through, None if it is no probe
+_probe_ctx: ContextVar[float | None] = ContextVar("model_probe", default=None)
+
+
+class CircuitBreaker:
+    """Consecutive-failure circuit breaker with a single probe after cooldown."""
+
+    def __init__(self, threshold: int, cooldown_seconds: int) -> None:
+        self._threshold = threshold
+        self._cooldown_seconds = cooldown_seconds
+        self._lock = Lock()
+        self._failures = 0
+        # Monotonic time the circuit opened at, None while closed
+        self._opened_at: float | None = None
+        # Monotonic time the probe was let through, None if there is none
+        self._probe_started: float | None = None
+
+    def record(self, ok: bool) -> None:
+        """Record the outcome of a model provider interaction."""
+        if not self._threshold:
+            return
+        with self._lock:
+            if ok:
+                if self._opened_at is not None:
+                    logger.info("Model provider recovered, closing the circuit")
+                    add_event("circuit_closed", {})
+                self._failures = 0
+                self._opened_at = None
+                self._probe_started = None
+                return
+            self._failures += 1
+            probe_failed = self._probe_started is not None
+            if probe_failed or (
+                self._opened_at is None and self._failures >= self._threshold
+            ):
+                logger.warning(
+                    f"Model provider failed {self._failures} times in a row, "
+                    f"refusing investigations for {self._cooldown_seconds}s"
+                )
+                add_event("circuit_opened", {"failures": self._failures})
+                self._opened_at = time.monotonic()
+                self._probe_started = None
+
+    def _retry_after(self, now: float) -> float | None:
+        # Caller holds the lock
+        if self._opened_at is None:
+            return None
+        remaining = self._opened_at + self._cooldown_seconds - now
+        if remaining > 0:
+            return remaining
+        probing = self._probe_started is not None and (
+            now - self._probe_started < self._cooldown_seconds
+        )
+        # While the probe runs, callers are asked to come back after a cooldown
+        return float(self._cooldown_seconds) if probing else None
+
+    def check(self) -> float | None:
+        """
+        Check whether a new investigation would be admitted, without admitting it.
+
+        Returns:
+            None if it may run, otherwise seconds until investigations are
+            expected to be admitted again
+        """
+        with self._lock:
+            return self._retry_after(time.monotonic())
+
+    def admit(self) -> float | None:
+        """
+        Admit a new investigation.
+
+        If it is let through as the probe, the probe belongs to the current
+        context until release_probe().
+
+        Returns:
+            None if it may run, otherwise seconds until investigations are
+            expected to be admitted again
+        """
+        with self._lock:
+            now = time.monotonic()
+            retry_after = self._retry_after(now)
+            if retry_after is None and self._opened_at is not None:
+                # Cooldown over: this investigation probes the provider
+                self._probe_started = now
+                _probe_ctx.set(now)
+            return retry_after
+
+    def release_probe(self) -> None:
+        """
+        Give back the probe slot of the current context, if it still holds it.
+
+        For requests refused after admit(), before they reached the provider,
+        so the next request probes instead of waiting out another cooldown.
+        """
+        started = _probe_ctx.get()
+        if started is None:
+            return
+        _probe_ctx.set(None)
+        with self._lock:
+            if self._probe_started == started:
+                self._probe_started = None
+
+    def status(self) -> dict[str, Any]:
+        """State of the circuit for the readiness probe."""
+        with self._lock:
+            now = time.monotonic()
+            retry_after = self._retry_after(now)
+            if self._opened_at is None:
+                state = "closed"
+            elif now < self._opened_at + self._cooldown_seconds:
+                state = "open"
+            else:
+                # Cooldown over, replicas take traffic again for the probe
+                state = "half_open"
+            return {
+                "state": state,
+                "consecutive_failures": self._failures,
+                "retry_after_seconds": (
+                    math.ceil(retry_after) if retry_after is not None else None
+                ),
+            }
+
+
+@lru_cache()
+def get_circuit_breaker() -> CircuitBreaker:
+    """Get the process-wide model provider circuit breaker."""
+    settings = get_settings()
+    return CircuitBreaker(
+        settings.circuit_breaker_threshold, settings.circuit_breaker_cooldown_seconds
+    )
+
+
+def _raise_unavailable(retry_after: float | None) -> None:
+    # 503 with Retry-After unless the investigation may run
+    if retry_after is None:
+        return
+    seconds = math.ceil(retry_after)
+    raise HTTPException(
+        status_code=503,
+        detail={
+            "error": "Model provider unavailable",
+            "retry_after_seconds": seconds,
+        },
+        headers={"Retry-After": str(seconds)},
+    )
+
+
+def check_model_circuit() -> None:
+    """
+    FastAPI dependency refusing new investigations while the circuit is open.
+
+    Does not give out the probe slot; endpoints call admit_model_circuit()
+    once the request is validated.
+
+    Raises:
+        HTTPException: 503 with Retry-After while the model provider is failing
+    """
+    _raise_unavailable(get_circuit_breaker().check())
+
+
+def admit_model_circuit() -> None:
+    """
+    Admit a validated investigation, as the probe if the cooldown is over.
+
+    Raises:
+        HTTPException: 503 with Retry-After while the model provider is failing
+    """
+    _raise_unavailable(get_circuit_breaker().admit())
@@ -0,0 +1,479 @@
+"""
+claude CLI backend for the Shoot agent system.
+
+Runs the coordinator with the claude CLI in print mode instead of an
+in-process Agent SDK session. The CLI gets the same coordinator prompt,
+collector subagents, and MCP servers as SDK sessions, passed as flags.
+
+The CLI prints stream-json events, which are parsed as they arrive: the
+report text of /stream is forwarded while the CLI runs, and no full stdout is
+buffered in memory. Events larger than SHOOT_SUBPROCESS_OUTPUT_MAX_BYTES
+(typically huge tool results) are spilled to disk instead of parsed, and
+their beginning is kept as a `cli-output-*.txt` artifact; stderr is bounded
+the same way (bounded_output.py).
+
+In-process MCP servers (the built-in shoot tools) and session hooks cannot
+be handed to a separate process: collectors lose their built-in tools, and
+caching, tool policy, log sampling, tool output redaction and injection
+scanning, tool call limits, and time budget notes do not apply. Final
+reports are still scrubbed. As the guards are missing, the backend is only
+accepted with SHOOT_CLAUDE_CLI_UNGUARDED. Tool call approval cannot be
+enforced either, so investigations are refused while
+SHOOT_APPROVAL_REQUIRED_TOOLS is set.
+"""
+
+import asyncio
+import contextlib
+import dataclasses
+import json
+import os
+import shlex
+import shutil
+import signal
+from pathlib import Path
+from typing import Any, AsyncIterator
+
+from app_logging import logger
+from approvals import approval_patterns
+from bounded_output import SpilledOutput, bounded_lines, drain
+from config import ReportFormat, get_settings
+from coordinator import (
+    BUDGET_EXCEEDED_SUBTYPE,
+    TRUNCATED_NOTE,
+    InvestigationResult,
+    UnsupportedOptionError,
+    create_coordinator_options,
+)
+from debug_trace import cli_trace_entries, truncate_trace
+from generation import GenerationOverrides, thinking_budget
+from process_limits import apply_limits
+from progress import ProgressEvent, ProgressTracker
+from redaction import scrub_report
+from secret_files import get_secret
+from tenant_quotas import charge_tenant
+from telemetry import add_event, trace_operation
+
+# Characters of stderr included in CLI failure errors
+_MAX_STDERR_CHARS = 2000
+# Time the CLI gets to exit after SIGTERM before it is killed
+_KILL_GRACE_SECONDS = 5
+# Pseudo event yielded for an event too large to parse
+OVERSIZED_EVENT = "oversized_output"
+# Bytes of an oversized event kept as its artifact
+_OVERSIZED_ARTIFACT_BYTES = 64 * 1024
+
+
+def _cli_mcp_servers(servers: dict[str, Any]) -> dict[str, Any]:
+    """MCP servers that can be passed to the CLI (not in-process ones)."""
+    return {
+        name: config for name, config in servers.items() if config.get("type") != "sdk"
+    }
+
+
+def build_cli_args(
+    query_text: str,
+    timeout_seconds: int | None = None,
+    max_turns: int | None = None,
+    collector_instructions: dict[str, str] | None = None,
+    session_id: str | None = None,
+    instructions: str | None = None,
+) -> list[str]:
+    """
+    Build the claude CLI invocation for an investigation.
+
+    The model, permission mode, MCP config, agents, and additional flags can
+    be set with SHOOT_CLAUDE_CLI_*; MCP servers and agents default to the
+    collector registry.
+
+    Raises:
+        OSError: The configured agents file cannot be read
+        UnsupportedOptionError: Tool call approval is configured
+    """
+    settings = get_settings()
+    if approval_patterns():
+        raise UnsupportedOptionError(
+            "Tool call approval (SHOOT_APPROVAL_REQUIRED_TOOLS) requires the "
+            "agent_sdk backend"
+        )
+    # The CLI cannot run session hooks, so the caches are never used
+    options = create_coordinator_options(
+        timeout_seconds,
+        max_turns,
+        collector_instructions,
+        use_collector_cache=False,
+        instructions=instructions,
+    )
+    servers = _cli_mcp_servers(dict(options.mcp_servers))  # type: ignore[call-overload]
+    agents = {
+        name: {
+            **dataclasses.asdict(agent),
+            # Tools of in-process servers are not available to the CLI
+            "tools": [
+                tool
+                for tool in agent.tools or []
+                if tool.split("__")[1] in servers
+            ],
+        }
+        for name, agent in (options.agents or {}).items()
+    }
+    args = [
+        settings.claude_cli_path,
+        "--print",
+        "--output-format",
+        "stream-json",
+        # Print mode only streams events with --verbose
+        "--verbose",
+        "--system-prompt",
+        str(options.system_prompt),
+        "--model",
+        settings.claude_cli_model or str(options.model),
+        "--max-turns",
+        str(options.max_turns),
+        "--allowedTools",
+        "Task",
+        "--permission-mode",
+        settings.claude_cli_permission_mode,
+        "--mcp-config",
+        settings.claude_cli_mcp_config or json.dumps({"mcpServers": servers}),
+        "--agents",
+        (
+            Path(settings.claude_cli_agents).read_text()
+            if settings.claude_cli_agents
+            else json.dumps(agents)
+        ),
+        *shlex.split(settings.claude_cli_args),
+    ]
+    if options.max_budget_usd:
+        args.extend(["--max-budget-usd", str(options.max_budget_usd)])
+    if session_id:
+        # Continue the conversation of an earlier investigation
+        args.extend(["--resume", session_id])
+    # A query starting with "-" must not be parsed as a flag
+    args.extend(["--", query_text])
+    return args
+
+
+class CliTimeoutError(Exception):
+    """The claude CLI did not finish within the investigation timeout."""
+
+    def __init__(self, timeout_seconds: int) -> None:
+        super().__init__(f"claude CLI did not finish within {timeout_seconds}s")
+        self.timeout_seconds = timeout_seconds
+
+
+async def _kill_process_group(process: asyncio.subprocess.Process) -> None:
+    """Stop the CLI and the MCP servers it started (its process group)."""
+    with contextlib.suppress(ProcessLookupError):
+        os.killpg(process.pid, signal.SIGTERM)
+    with contextlib.suppress(asyncio.TimeoutError):
+        await asyncio.wait_for(process.wait(), _KILL_GRACE_SECONDS)
+    # Children may outlive the CLI
+    with contextlib.suppress(ProcessLookupError):
+        os.killpg(process.pid, signal.SIGKILL)
+    await process.wait()
+
+
+async def cli_events(
+    args: list[str], timeout_seconds: int
+) -> AsyncIterator[dict[str, Any]]:
+    """
+    Run the claude CLI and yield its stream-json events as they arrive.
+
+    The CLI runs in its own process group, with the claude CLI resource
+    limits, and is killed together with the MCP servers it started on
+    timeout, cancellation, or early exit.
+    Events over the output size limit are yielded as OVERSIZED_EVENT events
+    with their size and beginning.
+
+    Raises:
+        CliTimeoutError: The CLI ran longer than timeout_seconds
+        RuntimeError: The CLI exited with an error
+    """
+    settings = get_settings()
+    env = dict(os.environ)
+    api_key = get_secret("anthropic_api_key")
+    if api_key:
+        env["ANTHROPIC_API_KEY"] = api_key
+    if settings.coordinator_max_output_tokens:
+        env["CLAUDE_CODE_MAX_OUTPUT_TOKENS"] = str(
+            settings.coordinator_max_output_tokens
+        )
+    thinking_tokens = thinking_budget(None, settings.coordinator_max_output_tokens)
+    if thinking_tokens:
+        env["MAX_THINKING_TOKENS"] = str(thinking_tokens)
+    process = await asyncio.create_subprocess_exec(
+        *args,
+        env=env,
+        stdout=asyncio.subprocess.PIPE,
+        stderr=asyncio.subprocess.PIPE,
+        limit=settings.subprocess_output_max_bytes,
+        start_new_session=True,
+    )
+    apply_limits(
+        process.pid,
+        settings.claude_cli_memory_limit_mb,
+        settings.claude_cli_cpu_limit_seconds,
+    )
+    assert process.stdout is not None and process.stderr is not None
+    # Drain stderr concurrently so a chatty CLI cannot block on a full pipe
+    stderr = SpilledOutput("claude-cli-stderr")
+    stderr_task = asyncio.create_task(drain(process.stderr, stderr))
+    try:
+        async with asyncio.timeout(timeout_seconds):
+            async for line in bounded_lines(process.stdout, "claude-cli-event"):
+                if isinstance(line, SpilledOutput):
+                    yield _oversized_event(line)
+                    continue
+                try:
+                    event = json.loads(line)
+                except ValueError:
+                    logger.debug(
+                        f"Skipping non-JSON claude CLI output: {line[:200]!r}"
+                    )
+                    continue
+                if isinstance(event, dict):
+                    yield event
+            await process.wait()
+    except TimeoutError as e:
+        logger.error(f"claude CLI timed out after {timeout_seconds}s, killing it")
+        add_event("claude_cli_timeout", {"timeout_seconds": timeout_seconds})
+        raise CliTimeoutError(timeout_seconds) from e
+    finally:
+        if process.returncode is None:
+            await _kill_process_group(process)
+        await stderr_task
+        stderr.close()
+
+    if process.returncode != 0:
+        error = stderr.tail(_MAX_STDERR_CHARS).decode(errors="replace")
+        raise RuntimeError(f"claude CLI exited with code {process.returncode}: {error}")
+
+
+def _oversized_event(output: SpilledOutput) -> dict[str, Any]:
+    """Pseudo event standing for an event too large to parse."""
+    output.close()
+    summary = output.summary()
+    logger.warning(f"Skipping oversized claude CLI event: {summary}")
+    add_event("claude_cli_oversized_event", {"bytes": output.total_bytes})
+    return {
+        "type": OVERSIZED_EVENT,
+        "summary": summary,
+        "head": output.head(_OVERSIZED_ARTIFACT_BYTES).decode(errors="replace"),
+    }
+
+
+def oversized_artifact(event: dict[str, Any]) -> str:
+    """Artifact text of an oversized event: its size and beginning."""
+    return scrub_report(
+        f"[Not parsed: {event['summary']}. The beginning follows.]\n{event['head']}"
+    )
+
+
+def coordinator_text(event: dict[str, Any]) -> str:
+    """Report text of a coordinator assistant event (not of a subagent)."""
+    if event.get("type") != "assistant" or event.get("parent_tool_use_id"):
+        return ""
+    content = event.get("message", {}).get("content", [])
+    return "".join(
+        block.get("text", "")
+        for block in content
+        if isinstance(block, dict) and block.get("type") == "text"
+    )
+
+
+def parse_cli_result(
+    data: dict[str, Any] | None, partial_text: str = ""
+) -> InvestigationResult:
+    """
+    Build the investigation result from the CLI's final result event.
+
+    Args:
+        data: The result event
+        partial_text: Coordinator text streamed so far, the report of a run
+            stopped at the cost ceiling
+
+    Raises:
+        RuntimeError: There is no result event or it reports an error
+    """
+    if data is None:
+        raise RuntimeError("claude CLI printed no result")
+    # Failed runs are charged too
+    charge_tenant(data.get("total_cost_usd"))
+    truncated = data.get("subtype") == BUDGET_EXCEEDED_SUBTYPE
+    if truncated:
+        logger.warning("claude CLI investigation stopped at the cost ceiling")
+        add_event("cost_ceiling_reached", {"cost_usd": data.get("total_cost_usd") or 0})
+    elif data.get("is_error"):
+        raise RuntimeError(f"claude CLI run failed: {data.get('subtype', 'error')}")
+
+    return InvestigationResult(
+        result=scrub_report(partial_text if truncated else data.get("result") or ""),
+        duration_ms=data.get("duration_ms", 0),
+        num_turns=data.get("num_turns", 0),
+        total_cost_usd=data.get("total_cost_usd"),
+        usage=data.get("usage"),
+        breakdown=None,
+        model_upgrade=None,
+        review=None,
+        findings=None,
+        validation=None,
+        session_id=data.get("session_id"),
+        debug_trace=None,
+        artifacts=None,
+        truncated=truncated,
+        triage=None,
+        alert_rules=None,
+        thinking_budget_tokens=thinking_budget(
+            None, get_settings().coordinator_max_output_tokens
+        ),
+    )
+
+
+class ClaudeCliBackend:
+    """Coordinator runs in claude CLI subprocesses."""
+
+    name = "claude_cli"
+
+    async def run(
+        self,
+        query_text: str,
+        timeout_seconds: int | None = None,
+        max_turns: int | None = None,
+        collector_instructions: dict[str, str] | None = None,
+        use_collector_cache: bool = True,
+        verify: bool | None = None,
+        language: str | None = None,
+        report_format: ReportFormat | None = None,
+        session_id: str | None = None,
+        debug: bool = False,
+        record: bool = False,
+        generation: GenerationOverrides | None = None,
+        instructions: str | None = None,
+        remediate: bool = False,
+        suggest_patches: bool | None = None,
+        suggest_alert_rules: bool | None = None,
+    ) -> InvestigationResult:
+        """
+        Run an investigation with the claude CLI.
+
+        Raises:
+            UnsupportedOptionError: verify, language, format, record,
+                generation overrides, remediation, or patch or alert rule
+                suggestions were requested
+            RuntimeError: The CLI failed or printed no result
+        """
+        if (
+            verify
+            or language
+            or report_format
+            or record
+            or generation
+            or remediate
+            or suggest_patches
+            or suggest_alert_rules
+        ):
+            raise UnsupportedOptionError(
+                "verify, language, format, record, model overrides, remediation, "
+                "and patch and alert rule suggestions are not supported by the "
+                "claude_cli backend"
+            )
+
+        args = build_cli_args(
+            query_text,
+            timeout_seconds,
+            max_turns,
+            collector_instructions,
+            session_id,
+            instructions,
+        )
+        with trace_operation(
+            "claude_cli.investigate", {"query": query_text[:200]}
+        ) as _span:  # noqa: F841
+            logger.info(f"Starting claude CLI investigation: {query_text[:100]}...")
+            add_event("investigation_started", {"query_length": len(query_text)})
+            result = None
+            text = ""
+            trace: list[dict[str, Any]] = []
+            artifacts: dict[str, str] = {}
+            async for event in cli_events(
+                args, timeout_seconds or get_settings().timeout_seconds
+            ):
+                if event.get("type") == "result":
+                    result = event
+                    continue
+                if event.get("type") == OVERSIZED_EVENT:
+                    name = f"cli-output-{len(artifacts) + 1:03d}.txt"
+                    artifacts[name] = oversized_artifact(event)
+                    continue
+                text += coordinator_text(event)
+                if debug:
+                    trace.extend(cli_trace_entries(event))
+            investigation_result = parse_cli_result(result, text)
+            investigation_result["artifacts"] = artifacts or None
+            if debug:
+                investigation_result["debug_trace"] = truncate_trace(trace)
+            return investigation_result
+
+    async def stream(
+        self,
+        query_text: str,
+        timeout_seconds: int | None = None,
+        max_turns: int | None = None,
+        collector_instructions: dict[str, str] | None = None,
+        progress: bool = False,
+        generation: GenerationOverrides | None = None,
+        instructions: str | None = None,
+    ) -> AsyncIterator[str | ProgressEvent]:
+        """
+        Run an investigation with the claude CLI, yielding report text as it arrives.
+
+        Raises:
+            UnsupportedOptionError: Generation overrides were requested
+        """
+        if generation:
+            raise UnsupportedOptionError(
+                "model overrides are not supported by the claude_cli backend"
+            )
+        args = build_cli_args(
+            query_text,
+            timeout_seconds,
+            max_turns,
+            collector_instructions,
+            instructions=instructions,
+        )
+        with trace_operation(
+            "claude_cli.investigate.streaming", {"query": query_text[:200]}
+        ) as _span:  # noqa: F841
+            logger.info(
+                f"Starting streaming claude CLI investigation: {query_text[:100]}..."
+            )
+            add_event(
+                "investigation_started",
+                {"query_length": len(query_text), "streaming": True},
+            )
+            tracker = ProgressTracker()
+            async for event in cli_events(
+                args, timeout_seconds or get_settings().timeout_seconds
+            ):
+                if progress:
+                    for progress_event in tracker.observe_event(event):
+                        yield progress_event
+                if event.get("type") == "result":
+                    charge_tenant(event.get("total_cost_usd"))
+                text = coordinator_text(event)
+                if text:
+                    yield scrub_report(text)
+                elif event.get("subtype") == BUDGET_EXCEEDED_SUBTYPE:
+                    yield TRUNCATED_NOTE
+                elif event.get("type") == "result" and event.get("is_error"):
+                    raise RuntimeError(
+                        f"claude CLI run failed: {event.get('subtype', 'error')}"
+                    )
+
+    def ready(self) -> bool:
+        """Whether the claude CLI can be found."""
+        path = get_settings().claude_cli_path
+        if shutil.which(path) is None:
+            logger.error(f"claude CLI not found: {path}")
+            return False
+        return True
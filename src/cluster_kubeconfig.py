@@ -0,0 +1,175 @@
+"""
+Kubeconfigs of workload clusters fetched from the management cluster.
+
+Cluster API keeps an admin kubeconfig of every workload cluster in the
+`<cluster>-kubeconfig` Secret (key `value`) next to the Cluster CR. With
+SHOOT_DYNAMIC_CLUSTERS_ENABLED, a request naming a cluster gets its
+kubeconfig from that Secret through the management cluster's mcp-kubernetes
+server, written to a private file that the workload cluster MCP server of
+the request is started with (cluster_target.py). The infrastructure
+provider is read from the Cluster CR at the same time.
+
+With SHOOT_WC_ACCESS=teleport, the kubeconfig is written by `tsh kube login`
+for the cluster instead (teleport_access.py), and the management cluster is
+only asked for the Cluster CR. Fetches use shoot's own credentials, also
+for requests impersonating their caller (impersonation.py).
+
+Kubeconfigs are reused for SHOOT_CLUSTER_KUBECONFIG_TTL_SECONDS, so
+consecutive requests for the same cluster do not fetch them again, and never
+leave the process: the files are only readable by shoot and are not passed
+to any model. Their directory is removed on shutdown.
+"""
+
+import asyncio
+import base64
+import binascii
+import json
+import re
+import time
+from functools import lru_cache
+from typing import Any
+
+import yaml
+from mcp import ClientSession
+
+from app_logging import audit, logger
+from cluster_provider import provider_from_cluster
+from cluster_target import ClusterTarget
+from config import get_settings
+from mcp_kubernetes import call_mcp_tool, connect_mcp_server, get_mc_mcp_config
+from private_files import PrivateDirectory
+from teleport_access import teleport_enabled, tsh_kube_login
+from telemetry import add_event
+
+# Cluster and namespace names (DNS labels)
+CLUSTER_NAME_PATTERN = re.compile(r"[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?")
+_SECRET_SUFFIX = "-kubeconfig"
+_SECRET_KEY = "value"
+# Time a fetch may take, including starting the MCP server
+_FETCH_TIMEOUT_SECONDS = 60
+
+
+class ClusterUnavailableError(Exception):
+    """The kubeconfig of a workload cluster cannot be fetched."""
+
+
+def decode_kubeconfig(secret: dict[str, Any]) -> str:
+    """
+    The kubeconfig of a `<cluster>-kubeconfig` Secret.
+
+    Raises:
+        ValueError: The Secret holds no valid kubeconfig
+    """
+    data = secret.get("data", {}).get(_SECRET_KEY)
+    if not data:
+        raise ValueError(f"Secret has no {_SECRET_KEY!r} key")
+    try:
+        kubeconfig = base64.b64decode(data).decode("utf-8")
+        parsed = yaml.safe_load(kubeconfig)
+    except (binascii.Error, UnicodeDecodeError, yaml.YAMLError) as e:
+        raise ValueError(f"Secret holds no valid kubeconfig: {e}") from e
+    if not isinstance(parsed, dict) or not parsed.get("clusters"):
+        raise ValueError("Secret holds no valid kubeconfig")
+    return kubeconfig
+
+
+async def _read_provider(session: ClientSession, namespace: str, name: str) -> str:
+    """CAPI provider of a Cluster CR, empty if it cannot be read."""
+    try:
+        cluster = await call_mcp_tool(
+            session,
+            "get",
+            {
+                "resourceType": "clusters",
+                "apiGroup": "cluster.x-k8s.io",
+                "namespace": namespace,
+                "name": name,
+            },
+        )
+        return provider_from_cluster(json.loads(cluster))
+    except ValueError as e:
+        # Prompts fall back to provider-agnostic guidance
+        logger.warning(f"Cannot read Cluster {namespace}/{name}: {e}")
+        return ""
+
+
+class KubeconfigCache:
+    """Fetched workload cluster kubeconfigs, written to a private directory."""
+
+    def __init__(self, ttl_seconds: int) -> None:
+        self._ttl_seconds = ttl_seconds
+        self._directory = PrivateDirectory("shoot-kubeconfigs-")
+        # (namespace, cluster) -> (monotonic fetch time, target)
+        self._targets: dict[tuple[str, str], tuple[float, ClusterTarget]] = {}
+        self._lock = asyncio.Lock()
+
+    def _write(self, namespace: str, name: str, kubeconfig: str) -> str:
+        # Replaced atomically, so running MCP servers of earlier requests keep
+        # a complete file
+        return self._directory.write(f"{namespace}.{name}.kubeconfig", kubeconfig)
+
+    async def _fetch(self, namespace: str, name: str) -> ClusterTarget:
+        mc_config = get_mc_mcp_config(impersonate=False)
+        if teleport_enabled():
+            path = await tsh_kube_login(name)
+            try:
+                async with connect_mcp_server(mc_config) as session:
+                    provider = await _read_provider(session, namespace, name)
+            except Exception as e:
+                logger.warning(f"Cannot read Cluster {namespace}/{name}: {e!r}")
+                provider = ""
+            return ClusterTarget(
+                name=name, namespace=namespace, kubeconfig=path, provider=provider
+            )
+        async with connect_mcp_server(mc_config) as session:
+            secret = await call_mcp_tool(
+                session,
+                "get",
+                {
+                    "resourceType": "secrets",
+                    "namespace": namespace,
+                    "name": f"{name}{_SECRET_SUFFIX}",
+                },
+            )
+            kubeconfig = decode_kubeconfig(json.loads(secret))
+            provider = await _read_provider(session, namespace, name)
+        path = self._write(namespace, name, kubeconfig)
+        return ClusterTarget(
+            name=name, namespace=namespace, kubeconfig=path, provider=provider
+        )
+
+    async def get(self, namespace: str, name: str) -> ClusterTarget:
+        """
+        The target of a workload cluster, fetching its kubeconfig if needed.
+
+        Raises:
+            ClusterUnavailableError: The kubeconfig cannot be fetched
+        """
+        key = (namespace, name)
+        async with self._lock:
+            cached = self._targets.get(key)
+            if cached and time.monotonic() - cached[0] < self._ttl_seconds:
+                return cached[1]
+            try:
+                async with asyncio.timeout(_FETCH_TIMEOUT_SECONDS):
+                    target = await self._fetch(namespace, name)
+            except Exception as e:
+                raise ClusterUnavailableError(
+                    f"Cannot fetch the kubeconfig of cluster {name} in "
+                    f"{namespace}: {e}"
+                ) from e
+            self._targets[key] = (time.monotonic(), target)
+        audit("cluster_kubeconfig_fetched", cluster=name, namespace=namespace)
+        add_event("cluster_kubeconfig_fetched", {"provider": target.provider})
+        return target
+
+    def clear(self) -> None:
+        """Forget the fetched targets and remove their kubeconfig files."""
+        self._targets.clear()
+        self._directory.remove()
+
+
+@lru_cache()
+def get_kubeconfig_cache() -> KubeconfigCache:
+    """Get the process-wide kubeconfig cache."""
+    return KubeconfigCache(get_settings().cluster_kubeconfig_ttl_seconds)
@@ -0,0 +1,76 @@
+"""
+Detection of the workload cluster's infrastructure provider.
+
+The MC collector's prompt lists the infrastructure resources of the
+cluster's CAPI provider (AWSCluster for CAPA, AzureCluster for CAPZ, ...),
+so it needs to know the provider. Unless SHOOT_CLUSTER_PROVIDER is set, it
+is read at startup from the `spec.infrastructureRef` of the workload
+cluster's Cluster CR, through the management cluster's mcp-kubernetes server,
+and used as `CLUSTER_PROVIDER` in every prompt rendered afterwards.
+Detection failures are logged and leave the provider unknown; prompts then
+fall back to provider-agnostic guidance.
+"""
+
+import asyncio
+import json
+from typing import Any
+
+from app_logging import logger
+from config import get_settings, set_detected_cluster_provider
+from mcp_kubernetes import call_mcp_tool, connect_mcp_server, get_mc_mcp_config
+
+# Infrastructure kinds referenced by Cluster CRs, by CAPI provider
+INFRASTRUCTURE_KINDS = {
+    "AWSCluster": "capa",
+    "AWSManagedCluster": "capa",
+    "AzureCluster": "capz",
+    "AzureManagedCluster": "capz",
+    "VSphereCluster": "capv",
+    "GCPCluster": "capg",
+    "GCPManagedCluster": "capg",
+}
+# Time detection may take, including starting the MCP server
+_DETECTION_TIMEOUT_SECONDS = 60
+
+
+def provider_from_cluster(cluster: dict[str, Any]) -> str:
+    """CAPI provider of a Cluster object, empty if its infrastructure is unknown."""
+    kind = cluster.get("spec", {}).get("infrastructureRef", {}).get("kind", "")
+    return INFRASTRUCTURE_KINDS.get(kind, "")
+
+
+async def detect_cluster_provider() -> str:
+    """
+    Read the infrastructure provider from the workload cluster's Cluster CR.
+
+    Raises:
+        Exception: The Cluster CR cannot be read
+    """
+    settings = get_settings()
+    async with connect_mcp_server(get_mc_mcp_config()) as session:
+        text = await call_mcp_tool(
+            session,
+            "get",
+            {
+                "resourceType": "clusters",
+                "apiGroup": "cluster.x-k8s.io",
+                "namespace": settings.org_ns,
+                "name": settings.wc_cluster,
+            },
+        )
+    return provider_from_cluster(json.loads(text))
+
+
+async def run_provider_detection() -> None:
+    """Detect the infrastructure provider once and use it for prompts."""
+    try:
+        async with asyncio.timeout(_DETECTION_TIMEOUT_SECONDS):
+            provider = await detect_cluster_provider()
+    except Exception as e:
+        logger.warning(f"Failed to detect the infrastructure provider: {e!r}")
+        return
+    if not provider:
+        logger.warning("Unknown infrastructure kind in the Cluster CR")
+        return
+    set_detected_cluster_provider(provider)
+    logger.info(f"Detected infrastructure provider {provider}")
@@ -0,0 +1,33 @@
+"""
+Workload cluster targeted by the current request.
+
+By default every investigation targets the workload cluster shoot was
+deployed for (WC_CLUSTER, reached with KUBECONFIG or MCP_KUBERNETES_WC_URL).
+With SHOOT_DYNAMIC_CLUSTERS_ENABLED, a request can name another cluster; its
+kubeconfig is fetched from the management cluster or written by Teleport
+(cluster_kubeconfig.py) and the target is set for the request's context,
+where prompts, the workload cluster MCP server config, caches, metrics, and
+the investigation record pick it up.
+"""
+
+from contextvars import ContextVar
+
+from pydantic import BaseModel
+
+
+class ClusterTarget(BaseModel):
+    """A workload cluster reached with a kubeconfig fetched for a request."""
+
+    name: str
+    # Organization namespace of the Cluster on the management cluster
+    namespace: str
+    # Path of the fetched kubeconfig file
+    kubeconfig: str
+    # CAPI infrastructure provider, empty if unknown
+    provider: str = ""
+
+
+# Cluster targeted by the current request, None for the configured cluster
+cluster_target_ctx: ContextVar[ClusterTarget | None] = ContextVar(
+    "cluster_target", default=None
+)
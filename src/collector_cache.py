@@ -0,0 +1,149 @@
+"""
+Collector result caching for the multi-agent Kubernetes debugging system.
+
+Collector results are cached per (cluster, collector, normalized query) for a
+configurable TTL, so repeated or follow-up investigations within minutes do not
+redo identical Kubernetes reads and LLM calls.
+
+Caching is implemented with Task tool hooks on the coordinator session:
+- PostToolUse stores the text returned by a collector delegation.
+- PreToolUse short-circuits a delegation whose result is cached. The SDK has no
+  way to substitute the result of a built-in tool, so the cached result is
+  returned to the coordinator as the reason of a denied tool call. Results
+  are scanned for prompt injections (injection_scan.py) before they are
+  stored, as nothing processes the deny reason.
+"""
+
+import time
+from collections import OrderedDict
+from functools import lru_cache
+from threading import Lock
+from typing import Any
+
+from claude_agent_sdk import HookContext, HookMatcher
+
+from app_logging import logger
+from compare import normalize_text
+from config import get_settings, get_wc_cluster
+from impersonation import impersonation_scope
+from injection_scan import neutralize_injections
+from namespace_scope import namespace_scope_key
+from telemetry import add_event
+
+CacheKey = tuple[str, str, str]
+
+
+class TTLResultCache:
+    """Bounded TTL cache of tool results."""
+
+    def __init__(self, ttl_seconds: int, max_entries: int) -> None:
+        self._ttl_seconds = ttl_seconds
+        self._max_entries = max_entries
+        # key -> (monotonic store time, result text)
+        self._entries: OrderedDict[CacheKey, tuple[float, str]] = OrderedDict()
+        self._lock = Lock()
+
+    def get(self, key: CacheKey) -> tuple[float, str] | None:
+        """Return (age_seconds, result) for a fresh entry, or None."""
+        with self._lock:
+            entry = self._entries.get(key)
+            if entry is None:
+                return None
+            stored_at, result = entry
+            age = time.monotonic() - stored_at
+            if age > self._ttl_seconds:
+                del self._entries[key]
+                return None
+            return age, result
+
+    def put(self, key: CacheKey, result: str) -> None:
+        """Store a result, evicting the oldest entries if over capacity."""
+        with self._lock:
+            self._entries[key] = (time.monotonic(), result)
+            self._entries.move_to_end(key)
+            while len(self._entries) > self._max_entries:
+                self._entries.popitem(last=False)
+
+
+@lru_cache()
+def get_collector_cache() -> TTLResultCache:
+    """Get the process-wide collector result cache."""
+    settings = get_settings()
+    return TTLResultCache(
+        settings.collector_cache_ttl_seconds, settings.collector_cache_max_entries
+    )
+
+
+def cache_key(subagent_type: str, prompt: str) -> CacheKey:
+    """Build the cache key for a collector delegation."""
+    cluster = f"{get_wc_cluster()}{impersonation_scope()}{namespace_scope_key()}"
+    return (cluster, subagent_type, normalize_text(prompt))
+
+
+def tool_response_text(tool_response: Any) -> str | None:
+    """Extract the text output from a Task or MCP tool response."""
+    if isinstance(tool_response, str):
+        return tool_response
+    content = (
+        tool_response.get("content")
+        if isinstance(tool_response, dict)
+        else tool_response
+    )
+    if isinstance(content, str):
+        return content
+    if isinstance(content, list):
+        texts = [
+            item.get("text", "")
+            for item in content
+            if isinstance(item, dict) and item.get("type") == "text"
+        ]
+        return "\n".join(texts) if texts else None
+    return None
+
+
+async def _serve_cached_result(
+    input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+) -> dict[str, Any]:
+    """PreToolUse hook: answer a Task delegation from the cache if possible."""
+    tool_input = input_data.get("tool_input", {})
+    key = cache_key(tool_input.get("subagent_type", ""), tool_input.get("prompt", ""))
+    cached = get_collector_cache().get(key)
+    if cached is None:
+        return {}
+
+    age, result = cached
+    logger.info(f"Serving cached result for {key[1]} (age {age:.0f}s)")
+    add_event("collector_cache_hit", {"subagent": key[1], "age_seconds": int(age)})
+    return {
+        "hookSpecificOutput": {
+            "hookEventName": "PreToolUse",
+            "permissionDecision": "deny",
+            "permissionDecisionReason": (
+                f"Not re-run: identical request was answered {age:.0f}s ago. "
+                f"Use this cached collector result as the tool output:\n\n{result}"
+            ),
+        }
+    }
+
+
+async def _store_result(
+    input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+) -> dict[str, Any]:
+    """PostToolUse hook: cache the text returned by a Task delegation."""
+    tool_input = input_data.get("tool_input", {})
+    result = tool_response_text(input_data.get("tool_response"))
+    if result:
+        result, _ = neutralize_injections(result, get_settings().injection_scan)
+        key = cache_key(
+            tool_input.get("subagent_type", ""), tool_input.get("prompt", "")
+        )
+        get_collector_cache().put(key, result)
+    return {}
+
+
+def create_collector_cache_hooks() -> dict[str, list[HookMatcher]]:
+    """Create coordinator hooks that cache Task (collector) results."""
+    return {
+        "PreToolUse": [HookMatcher(matcher="Task", hooks=[_serve_cached_result])],  # type: ignore[list-item]
+        "PostToolUse": [HookMatcher(matcher="Task", hooks=[_store_result])],  # type: ignore[list-item]
+    }
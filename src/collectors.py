@@ -2,124 +2,350 @@
 Collector configuration for the multi-agent Kubernetes debugging system.
 
 This module provides:
-- MCP server configurations for workload and management clusters
+- The collector registry (collectors.yaml or SHOOT_COLLECTORS_CONFIG)
 - AgentDefinitions for use with ClaudeSDKClient
 - Pre-flight validation for configuration
 """
 
-from typing import Any
-
-from claude_agent_sdk import AgentDefinition
-
-from config import get_settings, get_wc_collector_prompt, get_mc_collector_prompt
+import dataclasses
+import os
+from functools import lru_cache
+from pathlib import Path
+from string import Template
+from typing import Any, Literal
+
+import yaml
+from claude_agent_sdk import AgentDefinition, create_sdk_mcp_server
+from pydantic import BaseModel, ConfigDict, Field, ValidationError, model_validator
+
+from app_logging import logger
+from baseline import baselines_enabled, compare_baseline
+from cluster_target import cluster_target_ctx
+from config import get_collector_prompt, get_settings, validate_prompts
+from namespace_scope import namespace_scope_ctx
+from event_summary import summarize_events
+from helm_releases import HELM_TOOLS
+from inventory import compare_release_manifest
+from mcp_kubernetes import get_mc_mcp_config, get_wc_mcp_config
+from output_pages import fetch_more
+from runbooks import runbooks_enabled, search_runbooks
+from secret_files import get_secret
+from teleport_access import teleport_enabled, wc_kubeconfig
+from tool_policy import mutating_verb
 
 
 # =============================================================================
-# MCP Server Configurations
+# Collector Registry
 # =============================================================================
 
+# Collectors bundled with the service; replaced by SHOOT_COLLECTORS_CONFIG
+_DEFAULT_REGISTRY_PATH = Path(__file__).parent / "collectors.yaml"
 
-def get_wc_mcp_config() -> dict[str, Any]:
+# Read-only tools exposed by mcp-kubernetes in --non-destructive mode
+# Tool naming convention: mcp__<server_name>__<tool_name>
+DEFAULT_COLLECTOR_TOOLS = ["get", "list", "describe", "logs", "events"]
+
+# Tools no collector may be given, whatever the MCP server offers
+DEFAULT_DENIED_TOOLS = ["exec"]
+
+# mcp-kubernetes servers of the workload and management clusters
+KUBERNETES_SERVERS = ("kubernetes_wc", "kubernetes_mc")
+
+# In-process MCP server exposing shoot's own tools (only the Helm release tools
+# and summarize_events read the workload cluster, through its mcp-kubernetes
+# server)
+SHOOT_TOOLS_SERVER = "shoot_tools"
+BUILTIN_TOOLS = {
+    "compare_baseline": compare_baseline,
+    "compare_release_manifest": compare_release_manifest,
+    "fetch_more": fetch_more,
+    "search_runbooks": search_runbooks,
+    "summarize_events": summarize_events,
+    **HELM_TOOLS,
+}
+# Built-in tools that read the workload cluster; recorded and replayed like
+# the collectors' MCP tools
+CLUSTER_BUILTIN_TOOLS = frozenset({*HELM_TOOLS, "summarize_events"})
+
+
+def coordinator_builtin_tools() -> list[str]:
     """
-    Get MCP server configuration for workload cluster.
+    Qualified names of the built-in tools the coordinator is given.
 
-    Uses KUBECONFIG environment variable to connect to the workload cluster.
+    None of them has cluster access; cluster data still only comes from
+    collectors.
     """
-    settings = get_settings()
-    return {
-        "command": settings.mcp_kubernetes_path,
-        "args": ["serve", "--non-destructive"],
-        "env": {"KUBECONFIG": settings.kubeconfig},
-    }
+    tools = []
+    if runbooks_enabled():
+        tools.append("search_runbooks")
+    # Baselines are only captured for the configured cluster, and cover all
+    # namespaces
+    if (
+        baselines_enabled()
+        and cluster_target_ctx.get() is None
+        and namespace_scope_ctx.get() is None
+    ):
+        tools.append("compare_baseline")
+    return [f"mcp__{SHOOT_TOOLS_SERVER}__{tool}" for tool in tools]
+
+
+class McpServerSpec(BaseModel):
+    """MCP server a collector gets its tools from."""
+
+    model_config = ConfigDict(extra="forbid")
+
+    type: Literal["stdio", "sse", "http"] = "stdio"
+    command: str | None = None
+    args: list[str] = Field(default_factory=list)
+    env: dict[str, str] = Field(default_factory=dict)
+    url: str | None = None
+    headers: dict[str, str] = Field(default_factory=dict)
+
+    @model_validator(mode="after")
+    def check_transport(self) -> "McpServerSpec":
+        """Require the fields of the selected transport."""
+        if self.type == "stdio" and not self.command:
+            raise ValueError("stdio MCP servers need a command")
+        if self.type != "stdio" and not self.url:
+            raise ValueError(f"{self.type} MCP servers need a url")
+        return self
+
+    def to_sdk_config(self) -> dict[str, Any]:
+        """Build the SDK MCP server config, expanding ${VAR} from the environment."""
+
+        def expand(value: str) -> str:
+            return Template(value).safe_substitute(os.environ)
+
+        if self.type == "stdio":
+            config: dict[str, Any] = {
+                "command": expand(self.command or ""),
+                "args": [expand(arg) for arg in self.args],
+            }
+            if self.env:
+                config["env"] = {k: expand(v) for k, v in self.env.items()}
+            return config
+        return {
+            "type": self.type,
+            "url": expand(self.url or ""),
+            "headers": {k: expand(v) for k, v in self.headers.items()},
+        }
+
+
+class CollectorSpec(BaseModel):
+    """A collector subagent declared in the registry."""
+
+    model_config = ConfigDict(extra="forbid")
 
+    description: str = Field(..., min_length=1)
+    prompt_file: str = Field(..., min_length=1)
+    prompt_vars: dict[str, str] = Field(default_factory=dict)
+    mcp_server: str = Field(..., min_length=1)
+    tools: list[str] = Field(default_factory=lambda: list(DEFAULT_COLLECTOR_TOOLS))
+    builtin_tools: list[str] = Field(default_factory=list)
+    model: str | None = None
+    output_token_target: int | None = Field(default=None, ge=256, le=128000)
 
-def get_mc_mcp_config() -> dict[str, Any]:
+    def effective_output_token_target(self) -> int:
+        """
+        Result size the collector is asked to stay under, 0 if none.
+
+        Only the collector's prompt states it: the SDK cannot shorten the
+        result of a Task delegation, and the output token limit of a session
+        applies to all of its agents.
+        """
+        if self.output_token_target is not None:
+            return self.output_token_target
+        return get_settings().collector_output_token_target
+
+    def effective_builtin_tools(self) -> list[str]:
+        """Built-in tools of the collector; all can page oversized output if enabled."""
+        tools = list(self.builtin_tools)
+        paginate = get_settings().tool_output_overflow == "paginate"
+        if paginate and "fetch_more" not in tools:
+            tools.append("fetch_more")
+        return tools
+
+
+class CollectorRegistry(BaseModel):
+    """Collectors and the MCP servers they use."""
+
+    model_config = ConfigDict(extra="forbid")
+
+    mcp_servers: dict[str, McpServerSpec] = Field(default_factory=dict)
+    collectors: dict[str, CollectorSpec] = Field(..., min_length=1)
+    denied_tools: list[str] = Field(
+        default_factory=lambda: list(DEFAULT_DENIED_TOOLS)
+    )
+
+    def allowed_tools(self) -> set[str]:
+        """Qualified names of all MCP tools given to a collector or the coordinator."""
+        allowed = set(coordinator_builtin_tools())
+        for spec in self.collectors.values():
+            allowed.update(f"mcp__{spec.mcp_server}__{tool}" for tool in spec.tools)
+            allowed.update(
+                f"mcp__{SHOOT_TOOLS_SERVER}__{tool}"
+                for tool in spec.effective_builtin_tools()
+            )
+        return allowed
+
+    def server_configs(self) -> dict[str, dict[str, Any]]:
+        """SDK configs of the MCP servers used by at least one collector."""
+        builtin = {
+            "kubernetes_wc": get_wc_mcp_config,
+            "kubernetes_mc": get_mc_mcp_config,
+        }
+        configs: dict[str, dict[str, Any]] = {}
+        if coordinator_builtin_tools() or any(
+            spec.effective_builtin_tools() for spec in self.collectors.values()
+        ):
+            configs[SHOOT_TOOLS_SERVER] = create_sdk_mcp_server(  # type: ignore[assignment]
+                name=SHOOT_TOOLS_SERVER,
+                version="1.0.0",
+                tools=list(BUILTIN_TOOLS.values()),
+            )
+        for spec in self.collectors.values():
+            name = spec.mcp_server
+            if name in configs:
+                continue
+            # Declared servers take precedence over the built-in ones
+            if name in self.mcp_servers:
+                configs[name] = self.mcp_servers[name].to_sdk_config()
+            else:
+                configs[name] = builtin[name]()
+        return configs
+
+
+def load_collector_registry(path: Path) -> CollectorRegistry:
     """
-    Get MCP server configuration for management cluster.
+    Load and validate a collector registry file.
 
-    Uses MC_KUBECONFIG if set (local development),
-    otherwise uses --in-cluster mode (production).
+    Raises:
+        ValueError: The file is not a valid registry, a collector references
+            an undeclared MCP server or is given a denied or mutating tool, or
+            a prompt file does not exist
     """
+    try:
+        data = yaml.safe_load(path.read_text())
+        registry = CollectorRegistry.model_validate(data or {})
+    except (OSError, yaml.YAMLError, ValidationError) as e:
+        raise ValueError(f"Invalid collector registry {path}: {e}") from e
+
+    known_servers = {*KUBERNETES_SERVERS, *registry.mcp_servers}
+    for name, spec in registry.collectors.items():
+        if spec.mcp_server not in known_servers:
+            raise ValueError(
+                f"Collector {name} uses unknown MCP server: {spec.mcp_server}"
+            )
+        denied = sorted(set(spec.tools) & set(registry.denied_tools))
+        if denied:
+            raise ValueError(f"Collector {name} is given denied tools: {', '.join(denied)}")
+        mutating = sorted(tool for tool in spec.tools if mutating_verb(tool))
+        if mutating:
+            raise ValueError(
+                f"Collector {name} is given mutating tools: {', '.join(mutating)}"
+            )
+        unknown_tools = sorted(set(spec.builtin_tools) - BUILTIN_TOOLS.keys())
+        if unknown_tools:
+            raise ValueError(
+                f"Collector {name} uses unknown built-in tools: {', '.join(unknown_tools)}"
+            )
+        try:
+            # Loads and caches the prompt template
+            get_collector_prompt(spec.prompt_file, spec.prompt_vars)
+        except OSError as e:
+            raise ValueError(f"Collector {name} prompt file not found: {e}") from e
+        except ValueError as e:
+            raise ValueError(f"Collector {name}: {e}") from e
+    return registry
+
+
+@lru_cache()
+def get_collector_registry() -> CollectorRegistry:
+    """Get the collector registry configured by SHOOT_COLLECTORS_CONFIG."""
     settings = get_settings()
-
-    if settings.mc_kubeconfig:
-        # Local development: use kubeconfig file
-        return {
-            "command": settings.mcp_kubernetes_path,
-            "args": ["serve", "--non-destructive"],
-            "env": {"KUBECONFIG": settings.mc_kubeconfig},
-        }
-    else:
-        # Production: use in-cluster service account
-        return {
-            "command": settings.mcp_kubernetes_path,
-            "args": ["serve", "--non-destructive", "--in-cluster"],
-        }
+    path = (
+        Path(settings.collectors_config)
+        if settings.collectors_config
+        else _DEFAULT_REGISTRY_PATH
+    )
+    registry = load_collector_registry(path)
+    logger.info(
+        f"Loaded {len(registry.collectors)} collectors from {path}: "
+        f"{', '.join(registry.collectors)}"
+    )
+    return registry
 
 
 # =============================================================================
 # Agent Definitions
 # =============================================================================
 
-# MCP tool names for mcp-kubernetes server
-# These are the read-only tools exposed by mcp-kubernetes in --non-destructive mode
-# Tool naming convention: mcp__<server_name>__<tool_name>
-WC_MCP_TOOLS = [
-    "mcp__kubernetes_wc__get",
-    "mcp__kubernetes_wc__list",
-    "mcp__kubernetes_wc__describe",
-    "mcp__kubernetes_wc__logs",
-    "mcp__kubernetes_wc__events",
-]
-
-MC_MCP_TOOLS = [
-    "mcp__kubernetes_mc__get",
-    "mcp__kubernetes_mc__list",
-    "mcp__kubernetes_mc__describe",
-    "mcp__kubernetes_mc__logs",
-    "mcp__kubernetes_mc__events",
-]
-
-
-def create_agent_definitions() -> dict[str, AgentDefinition]:
+
+def output_target_note(max_tokens: int) -> str:
+    """Prompt note asking a collector to keep its result under a token target."""
+    return (
+        f"\n\n## Output Size\n\nKeep your final result to the coordinator "
+        f"under about {max_tokens} tokens (~{max_tokens * 4} characters): report "
+        "the findings and the evidence behind them, not raw tool output."
+    )
+
+
+def create_agent_definitions(
+    collector_instructions: dict[str, str] | None = None,
+) -> dict[str, AgentDefinition]:
     """
-    Create AgentDefinitions for the collector subagents.
+    Create AgentDefinitions for the registered collector subagents.
 
     These are used with ClaudeSDKClient to define specialized subagents
     that the coordinator can delegate to via the Task tool.
 
     IMPORTANT: Each collector is restricted to only its own MCP server's tools
     to maintain strict isolation between workload and management clusters.
+
+    Collectors with an output token budget are told to keep their result
+    within it. The SDK applies one output limit to every agent of a session
+    (SHOOT_COORDINATOR_MAX_OUTPUT_TOKENS), so the budget is an instruction.
+
+    Args:
+        collector_instructions: Optional replacement system prompts keyed by
+            collector name, for prompt experiments on a single run. Tool
+            restrictions are never affected by overrides.
+
+    Raises:
+        ValueError: An override names an unknown collector
     """
     settings = get_settings()
 
-    return {
-        "wc_collector": AgentDefinition(
-            description=(
-                "Use this agent to collect runtime data from the WORKLOAD CLUSTER. "
-                "The WC collector gathers information about Pods, Deployments, Services, "
-                "ReplicaSets, events, logs, and other Kubernetes resources running in the "
-                "workload cluster. Use this as your PRIMARY data source for debugging. "
-                "This agent does NOT have access to management cluster resources."
-            ),
-            prompt=get_wc_collector_prompt(),
-            tools=WC_MCP_TOOLS,  # Strict isolation: only WC MCP tools
-            model=settings.collector_model,  # type: ignore[arg-type]
-        ),
-        "mc_collector": AgentDefinition(
-            description=(
-                "Use this agent to collect data from the MANAGEMENT CLUSTER. "
-                "The MC collector gathers information about App/HelmRelease deployment status "
-                "and CAPI/CAPA resources (Cluster, AWSCluster, Machine, MachinePool) for the "
-                "workload cluster. Use this ONLY when you need to check deployment status or "
-                "cluster infrastructure. This agent does NOT have access to workload cluster resources."
-            ),
-            prompt=get_mc_collector_prompt(),
-            tools=MC_MCP_TOOLS,  # Strict isolation: only MC MCP tools
-            model=settings.collector_model,  # type: ignore[arg-type]
-        ),
+    agents = {
+        name: AgentDefinition(
+            description=spec.description,
+            prompt=get_collector_prompt(spec.prompt_file, spec.prompt_vars),
+            # Strict isolation: only the tools of the collector's MCP server,
+            # plus any built-in tools (which have no cluster access)
+            tools=[f"mcp__{spec.mcp_server}__{tool}" for tool in spec.tools]
+            + [
+                f"mcp__{SHOOT_TOOLS_SERVER}__{tool}"
+                for tool in spec.effective_builtin_tools()
+            ],
+            model=spec.model or settings.collector_model,  # type: ignore[arg-type]
+        )
+        for name, spec in get_collector_registry().collectors.items()
     }
 
+    for name, instructions in (collector_instructions or {}).items():
+        if name not in agents:
+            raise ValueError(f"Unknown collector: {name}")
+        agents[name] = dataclasses.replace(agents[name], prompt=instructions)
+
+    for name, spec in get_collector_registry().collectors.items():
+        target = spec.effective_output_token_target()
+        if target:
+            agents[name] = dataclasses.replace(
+                agents[name], prompt=agents[name].prompt + output_target_note(target)
+            )
+
+    return agents
+
 
 # =============================================================================
 # Readiness Checks
@@ -141,19 +367,48 @@ def get_mcp_configs_valid() -> tuple[bool, bool]:
     return wc_valid, mc_valid
 
 
+def describe_collectors() -> dict[str, dict[str, Any]]:
+    """
+    Model, MCP server, and tools of every registered collector.
+
+    Raises:
+        ValueError: The collector registry is invalid
+    """
+    settings = get_settings()
+    return {
+        name: {
+            "model": spec.model or settings.collector_model,
+            "output_token_target": spec.effective_output_token_target() or None,
+            "mcp_server": spec.mcp_server,
+            "tools": spec.tools,
+            "builtin_tools": spec.effective_builtin_tools(),
+            "prompt_file": spec.prompt_file,
+        }
+        for name, spec in get_collector_registry().collectors.items()
+    }
+
+
 def validate_wc_config() -> tuple[bool, str]:
     """
     Validate workload cluster configuration.
 
-    Checks that KUBECONFIG is set and the file exists.
+    Checks that KUBECONFIG is set and the file exists, unless a remote
+    mcp-kubernetes endpoint or the fake cluster is used. With Teleport access,
+    checks that tsh has written the kubeconfig.
 
     Returns:
         Tuple of (is_valid, error_message). If valid, error_message is empty.
     """
-    import os
-
     settings = get_settings()
 
+    if settings.mcp_kubernetes_wc_url or settings.fake_cluster:
+        return True, ""
+
+    if teleport_enabled():
+        if not os.path.isfile(wc_kubeconfig()):
+            return False, "Teleport kubeconfig not written yet (tsh kube login failed)"
+        return True, ""
+
     if not settings.kubeconfig:
         return False, "KUBECONFIG environment variable not set"
 
@@ -168,15 +423,17 @@ def validate_mc_config() -> tuple[bool, str]:
     Validate management cluster configuration.
 
     Checks either MC_KUBECONFIG file exists (local) or
-    service account token is mounted (in-cluster).
+    service account token is mounted (in-cluster), unless a remote
+    mcp-kubernetes endpoint or the fake cluster is used.
 
     Returns:
         Tuple of (is_valid, error_message). If valid, error_message is empty.
     """
-    import os
-
     settings = get_settings()
 
+    if settings.mcp_kubernetes_mc_url or settings.fake_cluster:
+        return True, ""
+
     # Local mode: check kubeconfig file
     if settings.mc_kubeconfig:
         if not os.path.isfile(settings.mc_kubeconfig):
@@ -194,6 +451,34 @@ def validate_mc_config() -> tuple[bool, str]:
     )
 
 
+def validate_collector_registry() -> tuple[bool, str]:
+    """
+    Validate the collector registry.
+
+    Returns:
+        Tuple of (is_valid, error_message). If valid, error_message is empty.
+    """
+    try:
+        get_collector_registry()
+    except ValueError as e:
+        return False, str(e)
+    return True, ""
+
+
+def validate_prompt_templates() -> tuple[bool, str]:
+    """
+    Validate that the prompts only reference documented variables.
+
+    Returns:
+        Tuple of (is_valid, error_message). If valid, error_message is empty.
+    """
+    try:
+        validate_prompts()
+    except (OSError, ValueError) as e:
+        return False, str(e)
+    return True, ""
+
+
 def validate_anthropic_api_key() -> tuple[bool, str]:
     """
     Validate that the Anthropic API key is configured.
@@ -201,13 +486,13 @@ def validate_anthropic_api_key() -> tuple[bool, str]:
     Returns:
         Tuple of (is_valid, error_message). If valid, error_message is empty.
     """
-    settings = get_settings()
+    api_key = get_secret("anthropic_api_key")
 
-    if not settings.anthropic_api_key:
+    if not api_key:
         return False, "ANTHROPIC_API_KEY environment variable not set"
 
     # Basic format validation (API keys start with "sk-ant-")
-    if not settings.anthropic_api_key.startswith("sk-ant-"):
+    if not api_key.startswith("sk-ant-"):
         return (
             False,
             "ANTHROPIC_API_KEY does not appear to be a valid Anthropic API key",
@@ -220,12 +505,17 @@ def validate_mcp_binary() -> tuple[bool, str]:
     """
     Validate that the MCP kubernetes binary exists.
 
+    The binary is not needed when both clusters use remote endpoints or the
+    fake cluster is used.
+
     Returns:
         Tuple of (is_valid, error_message). If valid, error_message is empty.
     """
-    import os
-
     settings = get_settings()
+    if settings.fake_cluster or (
+        settings.mcp_kubernetes_wc_url and settings.mcp_kubernetes_mc_url
+    ):
+        return True, ""
     mcp_path = settings.mcp_kubernetes_path
     if os.path.isfile(mcp_path) and os.access(mcp_path, os.X_OK):
         return True, ""
@@ -243,16 +533,22 @@ def run_preflight_checks() -> dict[str, dict[str, Any]]:
         "mc_config": {"valid": bool, "error": str},
         "anthropic_api": {"valid": bool, "error": str},
         "mcp_binary": {"valid": bool, "error": str},
+        "collector_registry": {"valid": bool, "error": str},
+        "prompts": {"valid": bool, "error": str},
     }
     """
     wc_valid, wc_error = validate_wc_config()
     mc_valid, mc_error = validate_mc_config()
     api_valid, api_error = validate_anthropic_api_key()
     mcp_valid, mcp_error = validate_mcp_binary()
+    registry_valid, registry_error = validate_collector_registry()
+    prompts_valid, prompts_error = validate_prompt_templates()
 
     return {
         "wc_config": {"valid": wc_valid, "error": wc_error},
         "mc_config": {"valid": mc_valid, "error": mc_error},
         "anthropic_api": {"valid": api_valid, "error": api_error},
         "mcp_binary": {"valid": mcp_valid, "error": mcp_error},
+        "collector_registry": {"valid": registry_valid, "error": registry_error},
+        "prompts": {"valid": prompts_valid, "error": prompts_error},
     }
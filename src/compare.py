@@ -0,0 +1,112 @@
+"""
+Investigation comparison for A/B and regression workflows.
+
+Produces a structured diff of findings, costs, and durations between two
+stored investigations of the same query, typically run against different
+models or prompt versions.
+"""
+
+from typing import Any
+
+from store import InvestigationRecord
+
+# DiagnosticReport list fields compared bullet-by-bullet
+_REPORT_LIST_FIELDS = ["summary", "likely_cause", "recommended_next_steps"]
+
+# Token counters compared from the usage dict
+_USAGE_FIELDS = [
+    "input_tokens",
+    "output_tokens",
+    "cache_creation_input_tokens",
+    "cache_read_input_tokens",
+]
+
+
+def normalize_text(text: str) -> str:
+    """Normalize text for equality checks (case and whitespace insensitive)."""
+    return " ".join(text.lower().split())
+
+
+def _numeric_delta(a: float | int | None, b: float | int | None) -> dict[str, Any]:
+    """Describe a numeric metric for both investigations and the change from a to b."""
+    delta: float | int | None = None
+    if a is not None and b is not None:
+        delta = b - a
+    return {"a": a, "b": b, "delta": delta}
+
+
+def _diff_bullets(a: list[str], b: list[str]) -> dict[str, list[str]]:
+    """Split two bullet lists into common and side-specific entries."""
+    a_norm = {normalize_text(x): x for x in a}
+    b_norm = {normalize_text(x): x for x in b}
+    return {
+        "common": [a_norm[k] for k in a_norm if k in b_norm],
+        "only_in_a": [a_norm[k] for k in a_norm if k not in b_norm],
+        "only_in_b": [b_norm[k] for k in b_norm if k not in a_norm],
+    }
+
+
+def _diff_findings(a: InvestigationRecord, b: InvestigationRecord) -> dict[str, Any]:
+    """Compare the reports of two investigations."""
+    if a.structured is None or b.structured is None:
+        # Fall back to a plain comparison when either report is unstructured
+        return {
+            "structured": False,
+            "identical": a.result.strip() == b.result.strip(),
+        }
+
+    findings: dict[str, Any] = {"structured": True}
+    for field in _REPORT_LIST_FIELDS:
+        findings[field] = _diff_bullets(
+            a.structured.get(field, []), b.structured.get(field, [])
+        )
+    findings["identical"] = all(
+        not findings[field]["only_in_a"] and not findings[field]["only_in_b"]
+        for field in _REPORT_LIST_FIELDS
+    )
+    return findings
+
+
+def compare_investigations(
+    a: InvestigationRecord, b: InvestigationRecord
+) -> dict[str, Any]:
+    """
+    Build a structured comparison of two investigations.
+
+    Returns:
+        {
+            "query": "...",
+            "versions": {"a": {...}, "b": {...}},
+            "findings": {...},
+            "metrics": {"duration_ms": {"a": .., "b": .., "delta": ..}, ...}
+        }
+    """
+    usage_a = a.usage or {}
+    usage_b = b.usage or {}
+
+    metrics: dict[str, Any] = {
+        "duration_ms": _numeric_delta(a.duration_ms, b.duration_ms),
+        "num_turns": _numeric_delta(a.num_turns, b.num_turns),
+        "total_cost_usd": _numeric_delta(a.total_cost_usd, b.total_cost_usd),
+        "usage": {
+            field: _numeric_delta(usage_a.get(field), usage_b.get(field))
+            for field in _USAGE_FIELDS
+        },
+    }
+
+    return {
+        "query": a.query,
+        "versions": {
+            side: {
+                "id": record.id,
+                "created_at": record.created_at,
+                "coordinator_model": record.coordinator_model,
+                "collector_model": record.collector_model,
+                "prompt_version": record.prompt_version,
+                "model_upgrade": record.model_upgrade,
+            }
+            for side, record in (("a", a), ("b", b))
+        },
+        "findings": _diff_findings(a, b),
+        "metrics": metrics,
+    }
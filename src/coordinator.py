@@ -11,102 +11,1045 @@ The coordinator:
 4. Synthesizes findings into diagnostic reports
 
 IMPORTANT: The coordinator has NO direct MCP/Kubernetes access.
-It can only delegate to collectors via allowed_tools=["Task"].
+It can only delegate to collectors via allowed_tools=["Task"], and search
+runbooks if they are configured.
 """
 
-from typing import Any, AsyncGenerator, TypedDict
+import asyncio
+import contextlib
+import dataclasses
+import re
+import time
+from typing import Any, AsyncGenerator
 
 from claude_agent_sdk import (
     ClaudeSDKClient,
     ClaudeAgentOptions,
+    HookMatcher,
     AssistantMessage,
+    Message,
     TextBlock,
     ResultMessage,
+    SystemMessage,
     ToolUseBlock,
     ToolResultBlock,
+    UserMessage,
 )
 
+from activity import get_activity_tracker
+from agent_limits import create_agent_limit_hooks
+from alert_rules import ALERT_RULES_ARTIFACT, alert_rules_artifact, suggest_alert_rules
+from approvals import approval_patterns, create_approval_hooks, get_approval_queue
 from app_logging import logger
+from collector_cache import create_collector_cache_hooks
+from generation import GenerationOverrides, thinking_budget
+from k8s_read_cache import create_k8s_read_cache_hooks
+from llm import sidecar_cost_usd, track_sidecar_costs
+from log_sampling import create_log_sampler
+from output_limit import create_output_limiter
 from collectors import (
-    get_wc_mcp_config,
-    get_mc_mcp_config,
+    coordinator_builtin_tools,
     create_agent_definitions,
+    get_collector_registry,
 )
-from config import get_settings, get_coordinator_prompt
+from config import ReportFormat, get_settings, get_coordinator_prompt
+from critic import build_revision_request, review_report
+from debug_trace import sdk_trace
+from invocation import propagate_invocation_chain
+from mcp_health import (
+    McpServerUnavailableError,
+    check_mcp_servers,
+    open_session,
+    restart_backoff_seconds,
+)
+from namespace_scope import namespace_note, namespace_scope_ctx
+from progress import ProgressEvent, ProgressTracker
+from patch_suggestions import patch_artifact, suggest_patches
+from process_limits import limit_mcp_processes, limited_cli_path
+from redaction import scrub_report
+from remediation import (
+    REMEDIATION_NOTE,
+    REMEDIATION_SERVER,
+    REMEDIATION_TOOLS_PATTERN,
+    REMEDIATOR,
+    create_remediation_server,
+    create_remediator_definition,
+    remediation_tool_names,
+)
+from report_validation import validate_report
+from report_writer import write_report
+from time_budget import create_time_budget_hooks
+from tool_metrics import ToolCallTimer
+from tool_output import create_tool_output_hooks
+from tool_policy import create_tool_policy_hooks
 from telemetry import trace_operation, add_event, set_span_attribute
-from schemas import parse_markdown_report, DiagnosticReport
+from tenant_quotas import charge_tenant, remaining_budget
+from schemas import (
+    parse_report,
+    DiagnosticReport,
+    InvestigationResult,
+    SuggestedAlertRule,
+)
+from secret_files import get_secret
+from session_summary import FollowUp, prepare_follow_up, record_turn
+from traffic_recording import TrafficSession
+from triage import classify_investigation
+
 
+class StalledStreamError(Exception):
+    """Raised when the model stream produces no messages within the stall timeout."""
 
-class InvestigationResult(TypedDict):
-    """Result from a coordinator investigation including usage metrics."""
 
-    result: str
-    duration_ms: int
-    num_turns: int
-    total_cost_usd: float | None
-    usage: dict[str, Any] | None
-    breakdown: dict[str, dict[str, Any]] | None
+class UnsupportedOptionError(ValueError):
+    """The selected backend does not support a requested option."""
+
+
+# How often the stall watchdog checks for tool calls awaiting approval
+_APPROVAL_POLL_SECONDS = 5
+# Time a stalled session gets to report its cost after being interrupted
+_INTERRUPT_TIMEOUT_SECONDS = 10
+# Rough characters-per-token ratio used to estimate context size
+_CHARS_PER_TOKEN = 4
+# Result subtype of a session stopped at its cost ceiling
+BUDGET_EXCEEDED_SUBTYPE = "error_max_budget_usd"
+# Result subtypes of sessions the model ended itself (turn or retry limits),
+# not failures of the model provider
+_MODEL_ENDED_SUBTYPES = frozenset(
+    {"error_max_turns", "error_max_structured_output_retries"}
+)
+# Appended to streamed reports cut short by the cost ceiling
+TRUNCATED_NOTE = (
+    "\n\n[Investigation stopped at the cost ceiling; this report is partial]"
+)
+# Precedes per-request instructions appended to the coordinator prompt
+INSTRUCTIONS_HEADING = "\n\n## Additional Instructions for This Investigation\n\n"
+# Characters not allowed in artifact names
+_ARTIFACT_NAME_PATTERN = re.compile(r"[^\w.-]")
 
 
 def create_coordinator_options(
     timeout_seconds: int | None = None,
     max_turns: int | None = None,
+    collector_instructions: dict[str, str] | None = None,
+    use_collector_cache: bool = True,
+    report_writer: bool = False,
+    session_id: str | None = None,
+    mcp_servers: dict[str, Any] | None = None,
+    traffic: TrafficSession | None = None,
+    generation: GenerationOverrides | None = None,
+    instructions: str | None = None,
+    remediate: bool = False,
 ) -> ClaudeAgentOptions:
     """
     Create ClaudeAgentOptions for the coordinator.
 
     Architecture:
     - Coordinator uses Task tool to delegate to subagents
-    - Two MCP servers configured: kubernetes_wc and kubernetes_mc
+    - MCP servers of the registered collectors configured (by default
+      kubernetes_wc and kubernetes_mc)
     - Each subagent (via AgentDefinition) is restricted to its own MCP tools
-    - Coordinator itself has NO MCP access (allowed_tools=["Task"] only)
+    - Coordinator itself has NO cluster access (allowed_tools=["Task"], plus
+      search_runbooks and compare_baseline if runbooks and baselines are
+      configured)
 
     Args:
-        timeout_seconds: Maximum time for investigation (used for HTTP timeouts
-                        and logging, not passed to SDK)
+        timeout_seconds: Maximum time for investigation (used for HTTP timeouts,
+                        logging, and the time budget notes, not passed to SDK)
         max_turns: Maximum conversation turns (default from config)
+        collector_instructions: Optional per-run replacement collector prompts
+        use_collector_cache: Serve and store collector results and Kubernetes
+            get/list results from the TTL caches (collector results are never
+            cached together with collector_instructions)
+        report_writer: The coordinator outputs findings for the report writer
+            instead of the user-facing report
+        session_id: Resume this earlier coordinator session (follow-up query)
+        mcp_servers: Replacement MCP server configs, such as the recorded
+            tool responses of evaluation scenarios (default: the servers of
+            the registered collectors)
+        traffic: Record the model and tool traffic of the session, or
+            answer it from a recording or script
+        generation: Per-request model, output token, and reasoning effort
+            overrides
+        instructions: Per-request instructions appended to the system prompt
+        remediate: Give the coordinator the remediator agent (confirmed by
+            the request; requires SHOOT_REMEDIATION_ENABLED)
     """
     settings = get_settings()
+    generation = generation or GenerationOverrides()
+    if remediate and not settings.remediation_enabled:
+        raise UnsupportedOptionError(
+            "Remediation is disabled (SHOOT_REMEDIATION_ENABLED)"
+        )
 
-    return ClaudeAgentOptions(
-        system_prompt=get_coordinator_prompt(),
-        model=settings.coordinator_model,
-        # Configure both MCP servers with distinct names
-        # Tool isolation is enforced via AgentDefinition.tools
-        mcp_servers={
-            "kubernetes_wc": get_wc_mcp_config(),  # type: ignore[dict-item]
-            "kubernetes_mc": get_mc_mcp_config(),  # type: ignore[dict-item]
-        },
-        # Coordinator can ONLY delegate via Task tool
-        # No direct MCP access - enforces hierarchical pattern
-        allowed_tools=["Task"],
+    # Cached results come from the regular prompts, so experiments bypass the cache
+    cache_enabled = (
+        use_collector_cache
+        and settings.collector_cache_ttl_seconds > 0
+        and not collector_instructions
+    )
+
+    registry = get_collector_registry()
+    namespaces = namespace_scope_ctx.get()
+
+    # The tool policy runs first, so refused calls are never served from a cache
+    write_tools = remediation_tool_names() if remediate else set()
+    hooks: dict[str, list[HookMatcher]] = create_tool_policy_hooks(
+        registry, write_tools, namespaces
+    )
+    # Sensitive calls wait for approval before a cache could answer them;
+    # remediation always does
+    approval_rules = approval_patterns()
+    if remediate:
+        approval_rules.append(REMEDIATION_TOOLS_PATTERN)
+    if approval_rules:
+        for event, matchers in create_approval_hooks(approval_rules).items():
+            hooks.setdefault(event, []).extend(matchers)
+    if cache_enabled:
+        for event, matchers in create_collector_cache_hooks().items():
+            hooks.setdefault(event, []).extend(matchers)
+    if use_collector_cache and settings.k8s_read_cache_ttl_seconds > 0:
+        for event, matchers in create_k8s_read_cache_hooks().items():
+            hooks.setdefault(event, []).extend(matchers)
+    # Tool output is sampled, redacted, scanned for prompt injections, and
+    # size-limited before any model sees it
+    log_sampler = (
+        create_log_sampler(
+            settings.log_sample_token_budget, settings.log_sample_max_lines
+        )
+        if settings.log_sample_token_budget > 0
+        else None
+    )
+    output_limiter = (
+        create_output_limiter(
+            settings.tool_output_max_tokens,
+            settings.tool_output_overflow,
+        )
+        if settings.tool_output_max_tokens > 0
+        else None
+    )
+    if (
+        log_sampler is not None
+        or settings.redaction_enabled
+        or output_limiter
+        or settings.injection_scan != "off"
+    ):
+        tool_output = create_tool_output_hooks(
+            log_sampler,
+            settings.redaction_enabled,
+            output_limiter,
+            settings.injection_scan,
+        )
+        for event, matchers in tool_output.items():
+            hooks.setdefault(event, []).extend(matchers)
+    # Tool call limits of the coordinator and of each collector run
+    agent_limits = create_agent_limit_hooks(
+        registry,
+        settings.max_coordinator_tool_calls,
+        settings.max_collector_tool_calls,
+    )
+    for event, matchers in agent_limits.items():
+        hooks.setdefault(event, []).extend(matchers)
+    # Remaining time is reported to the coordinator after each collector result
+    time_budget = create_time_budget_hooks(timeout_seconds or settings.timeout_seconds)
+    for event, matchers in time_budget.items():
+        hooks.setdefault(event, []).extend(matchers)
+    env: dict[str, str] = {}
+    if traffic is not None:
+        for event, matchers in traffic.hooks().items():
+            hooks.setdefault(event, []).extend(matchers)
+        mcp_servers = mcp_servers or traffic.mcp_servers(registry)
+        env.update(traffic.env())
+
+    # Read per session so a rotated key file is picked up
+    api_key = get_secret("anthropic_api_key")
+    if api_key:
+        env["ANTHROPIC_API_KEY"] = api_key
+    max_output_tokens = (
+        generation.max_output_tokens or settings.coordinator_max_output_tokens
+    )
+    if max_output_tokens:
+        env["CLAUDE_CODE_MAX_OUTPUT_TOKENS"] = str(max_output_tokens)
+    system_prompt = get_coordinator_prompt(report_writer)
+    if remediate:
+        system_prompt += REMEDIATION_NOTE
+    if instructions:
+        system_prompt += f"{INSTRUCTIONS_HEADING}{instructions}"
+    mcp_servers = mcp_servers or registry.server_configs()
+    agents = create_agent_definitions(collector_instructions)
+    if remediate:
+        mcp_servers = {**mcp_servers, REMEDIATION_SERVER: create_remediation_server()}
+        agents[REMEDIATOR] = create_remediator_definition()
+    if namespaces is not None:
+        # The tool policy enforces the restriction; the agents are told so
+        # they do not waste calls on refused reads
+        note = namespace_note(namespaces)
+        system_prompt += note
+        agents = {
+            name: dataclasses.replace(agent, prompt=agent.prompt + note)
+            for name, agent in agents.items()
+        }
+    options = ClaudeAgentOptions(
+        system_prompt=system_prompt,
+        model=generation.model or settings.coordinator_model,
+        # Configure the MCP servers of all registered collectors
+        # Tool isolation is enforced via AgentDefinition.tools and the tool policy
+        # The invocation chain is passed on for recursion detection
+        # Spawned servers get the subprocess resource limits
+        mcp_servers=limit_mcp_processes(  # type: ignore[arg-type]
+            propagate_invocation_chain(mcp_servers)
+        ),
+        # Coordinator can ONLY delegate via Task tool (and search runbooks and
+        # compare baselines)
+        # No cluster access - enforces hierarchical pattern
+        allowed_tools=["Task", *coordinator_builtin_tools()],
         # Define collector subagents
-        agents=create_agent_definitions(),
+        agents=agents,
         # Bypass permission prompts for automated execution
         permission_mode="bypassPermissions",
-        # Turn limits to prevent runaway investigations
+        # Turn and cost limits to prevent runaway investigations
         max_turns=max_turns or settings.max_turns,
+        max_budget_usd=attempt_budget_usd(),
+        # Emit partial stream events so the stall watchdog sees every chunk
+        include_partial_messages=True,
+        # Continue an earlier investigation's conversation
+        resume=session_id,
+        # Tool policy, caching, output sampling, redaction, and size limit,
+        # tool call limits, and time budget notes via tool hooks
+        hooks=hooks,  # type: ignore[arg-type]
+        env=env,
+        # Same message size limit as the claude_cli backend's events
+        max_buffer_size=settings.subprocess_output_max_bytes,
+        # The CLI runs with its resource limits in its own process group
+        cli_path=limited_cli_path(),
+    )
+    # Thinking is billed as output tokens, so it is part of the usage and
+    # cost the session reports
+    thinking_tokens = thinking_budget(generation.reasoning_effort, max_output_tokens)
+    if thinking_tokens:
+        options.max_thinking_tokens = thinking_tokens
+        set_span_attribute("thinking_budget_tokens", thinking_tokens)
+    return options
+
+
+def attempt_budget_usd() -> float | None:
+    """
+    Cost ceiling of an investigation attempt.
+
+    A tenant's attempt may spend at most what is left of its budget, which
+    earlier attempts of the same investigation have already been charged.
+    """
+    max_budget_usd = get_settings().max_cost_usd_per_query or None
+    remaining = remaining_budget()
+    if remaining is not None:
+        max_budget_usd = min(max_budget_usd or remaining, remaining)
+    return max_budget_usd
+
+
+def sidecars_affordable(session_cost_usd: float | None) -> bool:
+    """
+    Whether optional sidecar requests (critic, suggestions, triage) may still
+    run without passing the cost ceiling or the tenant's budget.
+
+    Sidecars are charged to the tenant as they run, the session once the
+    report is final.
+    """
+    session_cost = session_cost_usd or 0.0
+    max_cost_usd = get_settings().max_cost_usd_per_query
+    if max_cost_usd and session_cost + sidecar_cost_usd() >= max_cost_usd:
+        return False
+    remaining = remaining_budget()
+    return remaining is None or session_cost < remaining
+
+
+async def interrupted_cost(client: ClaudeSDKClient) -> float | None:
+    """
+    Interrupt a stalled session and return the cost it reports.
+
+    Returns None if the session does not report within a few seconds.
+    """
+    with contextlib.suppress(Exception):
+        async with asyncio.timeout(_INTERRUPT_TIMEOUT_SECONDS):
+            await client.interrupt()
+            async for message in client.receive_response():
+                if isinstance(message, ResultMessage):
+                    return message.total_cost_usd
+    return None
+
+
+async def receive_with_watchdog(
+    client: ClaudeSDKClient,
+    stall_timeout_seconds: int,
+) -> AsyncGenerator[Message, None]:
+    """
+    Receive response messages, failing fast if the stream goes silent.
+
+    Every message (including partial stream events) resets the inactivity
+    timer. A hung provider connection then fails after stall_timeout_seconds
+    instead of consuming the whole investigation deadline.
+
+    While a tool call of the session waits for human approval, the timer is
+    held: the silence is not the provider's. The session init message is
+    also checked for MCP servers that failed to start or connect.
+
+    Raises:
+        StalledStreamError: No message was received within stall_timeout_seconds
+        McpServerUnavailableError: An MCP server of the session failed
+    """
+    watchdog = _StallWatchdog(stall_timeout_seconds)
+    holder = asyncio.create_task(watchdog.hold_for_approvals())
+    messages = client.receive_response().__aiter__()
+    try:
+        while True:
+            try:
+                async with asyncio.timeout(stall_timeout_seconds) as timer:
+                    watchdog.timer = timer
+                    message = await messages.__anext__()
+            except StopAsyncIteration:
+                return
+            except TimeoutError:
+                get_activity_tracker().record_provider_result(False)
+                raise StalledStreamError(
+                    f"No response from model for {stall_timeout_seconds}s"
+                )
+            finally:
+                watchdog.timer = None
+            if isinstance(message, SystemMessage):
+                if message.subtype == "init":
+                    watchdog.session_id = message.data.get("session_id")
+                check_mcp_servers(message)
+            yield message
+    finally:
+        holder.cancel()
+
+
+class _StallWatchdog:
+    """Stall timer of a response stream, held while tool calls await approval."""
+
+    def __init__(self, stall_timeout_seconds: int) -> None:
+        self.stall_timeout_seconds = stall_timeout_seconds
+        self.timer: asyncio.Timeout | None = None
+        self.session_id: str | None = None
+
+    async def hold_for_approvals(self) -> None:
+        """Push the stall deadline back while an approval is pending."""
+        loop = asyncio.get_running_loop()
+        while True:
+            await asyncio.sleep(_APPROVAL_POLL_SECONDS)
+            timer = self.timer
+            if (
+                timer is not None
+                and not timer.expired()
+                and get_approval_queue().waiting(self.session_id)
+            ):
+                timer.reschedule(loop.time() + self.stall_timeout_seconds)
+
+
+class _InvestigationState:
+    """Mutable state accumulated while processing one investigation attempt."""
+
+    def __init__(self) -> None:
+        self.result_text = ""
+        self.debug_messages: list[Any] = []
+        self.turn_count = 0
+        # Capture metrics from ResultMessage
+        self.metrics: dict[str, Any] = {
+            "duration_ms": 0,
+            "num_turns": 0,
+            "total_cost_usd": None,
+            "usage": None,
+        }
+        # Track subagent metrics separately
+        self.subagent_breakdown: dict[str, dict[str, Any]] = {}
+        # Map tool_use_id to subagent type for Task calls
+        self.task_tool_uses: dict[str, str] = {}
+        # Map tool_use_id to monotonic start time for in-flight Task calls.
+        # Several Task calls may be in flight at once when the coordinator
+        # dispatches collectors in parallel.
+        self.task_started_at: dict[str, float] = {}
+        # Approximate size of the coordinator conversation, in characters
+        self.context_chars = 0
+        # Part of context_chars that is the system prompt
+        self.system_prompt_chars = 0
+        # Model the coordinator was switched to when nearing its context limit
+        self.model_upgrade: str | None = None
+        # (collector, result text) for each completed Task delegation
+        self.evidence: list[tuple[str, str]] = []
+        # Text of every tool result inside collector subagents (cluster reads)
+        self.tool_outputs: list[str] = []
+        # Critic verdict on the report, if a review ran
+        self.review: dict[str, Any] | None = None
+        # Suggested patch artifacts (name -> YAML), if patches were proposed
+        self.suggested_patches: dict[str, str] = {}
+        # Suggested alert rules, if an issue nothing alerted on was found
+        self.alert_rules: list[SuggestedAlertRule] = []
+        # Severity and triage labels, if the outcome was classified
+        self.triage: dict[str, Any] | None = None
+        # Coordinator session, for follow-up queries
+        self.session_id: str | None = None
+        # The session stopped at the cost ceiling; the report is partial
+        self.truncated = False
+        # Latency and size metrics of collector and MCP tool calls
+        self.tool_timer = ToolCallTimer()
+
+    def start_task(self, tool_use_id: str, subagent_type: str) -> None:
+        """Record the start of a Task delegation to a subagent."""
+        self.task_tool_uses[tool_use_id] = subagent_type
+        self.task_started_at[tool_use_id] = time.monotonic()
+        entry = self._breakdown_entry(subagent_type)
+        entry["calls"] += 1
+        entry["max_concurrency"] = max(
+            entry["max_concurrency"], self._in_flight_count(subagent_type)
+        )
+
+    def finish_task(self, tool_use_id: str, is_error: bool) -> str | None:
+        """Record the result of a Task delegation; returns its subagent type."""
+        subagent_type = self.task_tool_uses.get(tool_use_id)
+        started_at = self.task_started_at.pop(tool_use_id, None)
+        if subagent_type is None or started_at is None:
+            return None
+        entry = self._breakdown_entry(subagent_type)
+        entry["duration_ms"] += int((time.monotonic() - started_at) * 1000)
+        if is_error:
+            entry["errors"] += 1
+        return subagent_type
+
+    def _in_flight_count(self, subagent_type: str) -> int:
+        return sum(
+            1
+            for tool_use_id in self.task_started_at
+            if self.task_tool_uses.get(tool_use_id) == subagent_type
+        )
+
+    def _breakdown_entry(self, subagent_type: str) -> dict[str, Any]:
+        return self.subagent_breakdown.setdefault(
+            subagent_type,
+            {"calls": 0, "errors": 0, "duration_ms": 0, "max_concurrency": 0},
+        )
+
+
+def _handle_assistant_message(
+    state: _InvestigationState, message: AssistantMessage
+) -> None:
+    """Accumulate text and track Task delegations from an assistant message."""
+    state.debug_messages.append(message)
+
+    # Messages produced inside a subagent carry the Task tool_use_id they belong
+    # to; they are not part of the coordinator's report.
+    if getattr(message, "parent_tool_use_id", None):
+        return
+
+    state.turn_count += 1
+    for block in message.content:
+        if isinstance(block, TextBlock):
+            state.result_text += block.text
+            state.context_chars += len(block.text)
+        elif isinstance(block, ToolUseBlock):
+            state.context_chars += len(str(block.input))
+            # Track Task tool uses to capture subagent metrics
+            if block.name == "Task":
+                subagent_type = block.input.get("subagent_type", "unknown")
+                state.start_task(block.id, subagent_type)
+                logger.info(
+                    f"Tracking Task call for subagent: {subagent_type}, id: {block.id}"
+                )
+    add_event("assistant_message", {"turn": state.turn_count})
+
+
+def _handle_user_message(state: _InvestigationState, message: UserMessage) -> None:
+    """
+    Complete Task delegations whose results are returned to the coordinator.
+
+    Tool results inside collectors are kept as evidence for report validation.
+    """
+    state.debug_messages.append(message)
+    if isinstance(message.content, str):
+        return
+    if getattr(message, "parent_tool_use_id", None):
+        # Tool results inside a collector: raw cluster facts for validation
+        state.tool_outputs.extend(
+            _tool_result_text(block)
+            for block in message.content
+            if isinstance(block, ToolResultBlock)
+        )
+        return
+
+    for block in message.content:
+        if isinstance(block, ToolResultBlock):
+            state.context_chars += len(str(block.content or ""))
+            subagent_type = state.finish_task(block.tool_use_id, bool(block.is_error))
+            if subagent_type:
+                state.evidence.append((subagent_type, _tool_result_text(block)))
+                logger.info(
+                    f"Task result for subagent: {subagent_type}, "
+                    f"id: {block.tool_use_id}, is_error: {block.is_error}"
+                )
+                add_event(
+                    "subagent_completed",
+                    {"subagent": subagent_type, "is_error": bool(block.is_error)},
+                )
+
+
+def _tool_result_text(block: ToolResultBlock) -> str:
+    """Flatten the content of a tool result block into text."""
+    if isinstance(block.content, str):
+        return block.content
+    if isinstance(block.content, list):
+        return "\n".join(
+            str(item.get("text", ""))
+            for item in block.content
+            if isinstance(item, dict) and item.get("type") == "text"
+        )
+    return ""
+
+
+def _merge_usage(
+    total: dict[str, Any] | None, usage: dict[str, Any] | None
+) -> dict[str, Any] | None:
+    """Add up numeric token counters of two usage dicts."""
+    if not usage:
+        return total
+    merged = dict(total or {})
+    for key, value in usage.items():
+        if isinstance(value, (int, float)) and not isinstance(value, bool):
+            merged[key] = merged.get(key, 0) + value
+        else:
+            merged.setdefault(key, value)
+    return merged
+
+
+def provider_failed(message: ResultMessage) -> bool:
+    """Whether a session ended in an error of the model provider."""
+    return message.is_error and message.subtype not in _MODEL_ENDED_SUBTYPES
+
+
+def _handle_result_message(state: _InvestigationState, message: ResultMessage) -> None:
+    """
+    Capture metrics from a result message.
+
+    A session emits one result per query (a follow-up revision request adds
+    another): durations, turns, and token usage are summed, while the cost
+    reported by the session is already cumulative.
+    """
+    state.metrics["duration_ms"] += message.duration_ms
+    state.metrics["num_turns"] += message.num_turns
+    state.metrics["total_cost_usd"] = message.total_cost_usd
+    state.metrics["usage"] = _merge_usage(state.metrics["usage"], message.usage)
+    state.session_id = message.session_id
+
+    if message.subtype == BUDGET_EXCEEDED_SUBTYPE:
+        # The provider worked; the session was stopped on purpose
+        get_activity_tracker().record_provider_result(True)
+        state.truncated = True
+        logger.warning(
+            f"Investigation stopped at the cost ceiling, "
+            f"cost: ${message.total_cost_usd or 0:.4f}"
+        )
+        add_event("cost_ceiling_reached", {"cost_usd": message.total_cost_usd or 0})
+        set_span_attribute("truncated", True)
+        return
+
+    get_activity_tracker().record_provider_result(not provider_failed(message))
+    if message.is_error:
+        logger.error(f"Coordinator error: {message.result}")
+        set_span_attribute("error", True)
+        set_span_attribute("error.message", str(message.result))
+    else:
+        logger.info(
+            f"Investigation completed in {message.duration_ms}ms, "
+            f"turns: {message.num_turns}, "
+            f"cost: ${message.total_cost_usd or 0:.4f}"
+        )
+        # Record metrics as span attributes
+        set_span_attribute("duration_ms", message.duration_ms)
+        set_span_attribute("num_turns", message.num_turns)
+        set_span_attribute("cost_usd", message.total_cost_usd or 0)
+        if message.usage:
+            set_span_attribute("usage", str(message.usage))
+
+
+async def _maybe_upgrade_model(
+    client: ClaudeSDKClient, state: _InvestigationState
+) -> None:
+    """
+    Switch the coordinator to a larger-context model when nearing its limit.
+
+    Triggered after a collector result is added to the conversation. The
+    upgrade applies to all following coordinator turns and happens at most once
+    per investigation, which bounds its cost. Collector subagents keep their
+    configured model.
+    """
+    settings = get_settings()
+    if not settings.context_upgrade_model or state.model_upgrade:
+        return
+
+    estimated_tokens = state.context_chars // _CHARS_PER_TOKEN
+    limit = int(
+        settings.coordinator_context_tokens * settings.context_upgrade_threshold
+    )
+    if estimated_tokens < limit:
+        return
+
+    await client.set_model(settings.context_upgrade_model)
+    state.model_upgrade = settings.context_upgrade_model
+    logger.warning(
+        f"Coordinator context ~{estimated_tokens} tokens exceeds {limit}, "
+        f"upgrading to {settings.context_upgrade_model}"
+    )
+    add_event(
+        "model_upgraded",
+        {"model": settings.context_upgrade_model, "estimated_tokens": estimated_tokens},
+    )
+    set_span_attribute("model_upgrade", settings.context_upgrade_model)
+
+
+async def _receive(
+    client: ClaudeSDKClient, state: _InvestigationState, stall_timeout_seconds: int
+) -> None:
+    """Process response messages for the latest query until its result."""
+    async for message in receive_with_watchdog(client, stall_timeout_seconds):
+        logger.info(f"Received message type: {type(message).__name__}")
+        state.tool_timer.observe(message)
+
+        if isinstance(message, AssistantMessage):
+            _handle_assistant_message(state, message)
+        elif isinstance(message, UserMessage):
+            _handle_user_message(state, message)
+            await _maybe_upgrade_model(client, state)
+        elif isinstance(message, ResultMessage):
+            _handle_result_message(state, message)
+
+
+async def _review_and_revise(
+    client: ClaudeSDKClient,
+    state: _InvestigationState,
+    query_text: str,
+    stall_timeout_seconds: int,
+) -> None:
+    """
+    Run the critic on the draft report and ask the coordinator to revise it.
+
+    Each round reviews the current report; if claims are unsupported or
+    evidence is missing, the coordinator receives the review in the same
+    session (so it can delegate further collection) and its new reply
+    replaces the report. Stops when the report is supported or after
+    SHOOT_CRITIC_MAX_ROUNDS rounds.
+    """
+    settings = get_settings()
+    for round_number in range(1, settings.critic_max_rounds + 1):
+        if not _affordable(state, "critic"):
+            return
+        try:
+            review, usage = await review_report(
+                query_text, state.result_text, state.evidence
+            )
+        except Exception as e:
+            # The review is best-effort; keep the draft if the critic fails
+            logger.warning(f"Critic review failed, keeping draft report: {e}")
+            return
+
+        critic = state.subagent_breakdown.setdefault("critic", {"calls": 0})
+        critic["calls"] += 1
+        critic["usage"] = _merge_usage(critic.get("usage"), usage)
+
+        if review is None:
+            return
+        state.review = {**review.model_dump(), "rounds": round_number}
+        add_event(
+            "critic_review",
+            {
+                "round": round_number,
+                "supported": review.supported,
+                "unsupported_claims": len(review.unsupported_claims),
+                "missing_evidence": len(review.missing_evidence),
+            },
+        )
+        if review.supported:
+            return
+
+        logger.info(
+            f"Critic requested revision (round {round_number}): "
+            f"{len(review.unsupported_claims)} unsupported claims, "
+            f"{len(review.missing_evidence)} missing evidence items"
+        )
+        state.review["revised"] = True
+        draft = state.result_text
+        state.result_text = ""
+        await client.query(build_revision_request(review))
+        await _receive(client, state, stall_timeout_seconds)
+        if state.truncated:
+            # A partial revision is worse than the complete draft
+            state.result_text = draft
+            return
+
+
+async def _write_report(
+    state: _InvestigationState,
+    query_text: str,
+    language: str | None,
+    report_format: ReportFormat,
+) -> None:
+    """Replace the coordinator's findings with the report writer's report."""
+    try:
+        report, usage = await write_report(
+            query_text, state.result_text, language, report_format
+        )
+    except Exception as e:
+        # Raw findings are still useful to the caller
+        logger.warning(f"Report writer failed, returning findings: {e}")
+        return
+
+    state.subagent_breakdown["report_writer"] = {"calls": 1, "usage": usage}
+    add_event("report_written", {"format": report_format})
+    if report:
+        state.result_text = report
+
+
+async def _suggest_patches(state: _InvestigationState, query_text: str) -> None:
+    """Propose patches for misconfigured resources the report identifies."""
+    try:
+        patches, usage = await suggest_patches(
+            query_text, state.result_text, state.evidence
+        )
+    except Exception as e:
+        # The report stands without suggestions
+        logger.warning(f"Patch suggester failed: {e}")
+        return
+
+    state.subagent_breakdown["patch_suggester"] = {"calls": 1, "usage": usage}
+    add_event("patches_suggested", {"patches": len(patches)})
+    for index, patch in enumerate(patches, start=1):
+        name, content = patch_artifact(index, patch)
+        state.suggested_patches[name] = scrub_report(content)
+
+
+async def _suggest_alert_rules(state: _InvestigationState, query_text: str) -> None:
+    """Propose alert rules for an issue the report identifies that went unalerted."""
+    try:
+        rules, usage = await suggest_alert_rules(
+            query_text, state.result_text, state.evidence
+        )
+    except Exception as e:
+        # The report stands without suggestions
+        logger.warning(f"Alert rule suggester failed: {e}")
+        return
+
+    state.subagent_breakdown["alert_rule_suggester"] = {"calls": 1, "usage": usage}
+    add_event("alert_rules_suggested", {"rules": len(rules)})
+    state.alert_rules = [
+        rule.model_copy(
+            update={
+                "summary": scrub_report(rule.summary),
+                "explanation": scrub_report(rule.explanation),
+            }
+        )
+        for rule in rules
+    ]
+
+
+async def _classify(state: _InvestigationState, query_text: str) -> None:
+    """Classify the severity and probable cause of the investigation."""
+    try:
+        triage, usage = await classify_investigation(
+            query_text, state.result_text, state.truncated
+        )
+    except Exception as e:
+        # The report stands unclassified
+        logger.warning(f"Triage classifier failed: {e}")
+        return
+
+    state.subagent_breakdown["triage"] = {"calls": 1, "usage": usage}
+    if triage is not None:
+        state.triage = triage.model_dump()
+        add_event("investigation_triaged", state.triage)
+        set_span_attribute("output.severity", triage.severity)
+
+
+def _validate_report(
+    state: _InvestigationState, modify: bool
+) -> dict[str, Any] | None:
+    """Cross-check the final report against the collected evidence."""
+    settings = get_settings()
+    if settings.report_validation == "off" or not state.result_text:
+        return None
+
+    evidence = state.tool_outputs + [text for _, text in state.evidence]
+    state.result_text, validation = validate_report(
+        state.result_text, evidence, settings.report_validation, modify
     )
+    add_event(
+        "report_validation",
+        {
+            "model": state.model_upgrade or settings.coordinator_model,
+            "references": validation["references"],
+            "unverified": len(validation["unverified"]),
+            "hallucination_rate": validation["hallucination_rate"],
+        },
+    )
+    set_span_attribute("output.hallucination_rate", validation["hallucination_rate"])
+    return validation
+
+
+def _artifacts(state: _InvestigationState) -> dict[str, str]:
+    """
+    Raw evidence behind the report, by artifact name.
+
+    Every collector result returned to the coordinator and every tool output
+    inside the collectors, scrubbed like the report, suggested patches, and
+    suggested alert rules.
+    """
+    artifacts: dict[str, str] = {}
+    for index, (collector, text) in enumerate(state.evidence, start=1):
+        name = _ARTIFACT_NAME_PATTERN.sub("_", collector)
+        artifacts[f"collector-{index:02d}-{name}.txt"] = scrub_report(text)
+    for index, text in enumerate(state.tool_outputs, start=1):
+        artifacts[f"tool-output-{index:03d}.txt"] = scrub_report(text)
+    artifacts.update(state.suggested_patches)
+    if state.alert_rules:
+        artifacts[ALERT_RULES_ARTIFACT] = alert_rules_artifact(state.alert_rules)
+    return artifacts
+
+
+def _affordable(state: _InvestigationState, sidecar: str) -> bool:
+    """Whether an optional sidecar may run, noting it when it is skipped."""
+    if sidecars_affordable(state.metrics["total_cost_usd"]):
+        return True
+    logger.info(f"Skipping {sidecar}: the investigation reached its cost ceiling")
+    add_event("sidecar_skipped", {"sidecar": sidecar})
+    return False
 
 
-async def run_coordinator(  # noqa: C901
+def _total_cost_usd(state: _InvestigationState) -> float | None:
+    """Cost of the coordinator session and the sidecar requests."""
+    sidecar_cost = sidecar_cost_usd()
+    if state.metrics["total_cost_usd"] is None and not sidecar_cost:
+        return None
+    return (state.metrics["total_cost_usd"] or 0.0) + sidecar_cost
+
+
+def _record_follow_up(
+    state: _InvestigationState, follow_up: FollowUp, query_text: str
+) -> None:
+    """Add the investigation to its session history for later follow-ups."""
+    if follow_up.usage is not None:
+        state.subagent_breakdown["session_summary"] = {
+            "calls": 1,
+            "usage": follow_up.usage,
+        }
+    if state.session_id:
+        # A resumed session's history already counts the system prompt
+        context_chars = state.context_chars
+        if follow_up.resume is not None:
+            context_chars -= state.system_prompt_chars
+        record_turn(
+            follow_up,
+            state.session_id,
+            query_text,
+            state.result_text,
+            context_chars,
+        )
+
+
+async def _run_attempt(
+    options: ClaudeAgentOptions,
+    query_text: str,
+    stall_timeout_seconds: int,
+    verify: bool = False,
+) -> _InvestigationState:
+    """
+    Run one investigation attempt in a fresh client session.
+
+    A failed attempt is charged to the tenant here; a completed one is
+    charged once its report is final.
+    """
+    state = _InvestigationState()
+    if isinstance(options.system_prompt, str):
+        state.system_prompt_chars = len(options.system_prompt)
+    state.context_chars = state.system_prompt_chars + len(query_text)
+
+    try:
+        async with open_session(options) as client:
+            try:
+                # Send the investigation query
+                await client.query(query_text)
+                await _receive(client, state, stall_timeout_seconds)
+
+                # Optional second pass: verify the draft against collected
+                # evidence (no further model calls once the cost ceiling was
+                # reached)
+                if verify and not state.truncated:
+                    await _review_and_revise(
+                        client, state, query_text, stall_timeout_seconds
+                    )
+            except StalledStreamError:
+                cost = await interrupted_cost(client)
+                if cost is not None:
+                    state.metrics["total_cost_usd"] = cost
+                raise
+    except BaseException:
+        charge_tenant(state.metrics["total_cost_usd"])
+        raise
+
+    return state
+
+
+async def run_coordinator(
     query_text: str,
     timeout_seconds: int | None = None,
     max_turns: int | None = None,
+    collector_instructions: dict[str, str] | None = None,
+    use_collector_cache: bool = True,
+    verify: bool | None = None,
+    language: str | None = None,
+    report_format: ReportFormat | None = None,
+    session_id: str | None = None,
+    debug: bool = False,
+    mcp_servers: dict[str, Any] | None = None,
+    traffic: TrafficSession | None = None,
+    generation: GenerationOverrides | None = None,
+    instructions: str | None = None,
+    remediate: bool = False,
+    suggest_patches: bool | None = None,
+    suggest_alert_rules: bool | None = None,
 ) -> InvestigationResult:
     """
     Run the coordinator agent to investigate a Kubernetes issue.
 
     Uses ClaudeSDKClient for a single query/response cycle.
     The coordinator delegates to collector subagents via the Task tool.
+    If the model stream stalls, the attempt is aborted and retried up to
+    SHOOT_STALL_MAX_RETRIES times.
 
     Args:
         query_text: High-level failure description (e.g., "Deployment not ready")
         timeout_seconds: Optional timeout override
         max_turns: Optional max turns override
+        collector_instructions: Optional per-run replacement collector prompts
+        use_collector_cache: Whether collector results may be served from cache
+        verify: Run the critic review pass (default: SHOOT_CRITIC_ENABLED)
+        language: Report language; implies the report writer
+        report_format: "markdown" or "json" report; implies the report writer
+        session_id: Continue the conversation of an earlier investigation; a
+            session grown too large continues from a summary in a new session
+        debug: Return a trace of the agent conversation with the result
+        mcp_servers: Replacement MCP server configs (see
+            create_coordinator_options)
+        traffic: Record or answer the model and tool traffic of the session
+            (the proxy must be running)
+        generation: Per-request coordinator model and generation overrides
+        instructions: Per-request instructions for the coordinator
+        remediate: Remediation was confirmed; the coordinator gets the
+            remediator agent
+        suggest_patches: Propose patches for misconfigured resources found
+            (default: SHOOT_PATCH_SUGGESTIONS_ENABLED)
+        suggest_alert_rules: Propose alert rules for issues found that
+            nothing alerted on (default: SHOOT_ALERT_RULE_SUGGESTIONS_ENABLED)
 
     Returns:
         InvestigationResult with diagnostic report and usage metrics
+
+    Raises:
+        StalledStreamError: The model stream stalled on every attempt
+        McpServerUnavailableError: MCP servers failed after every restart
     """
     settings = get_settings()
 
@@ -118,103 +1061,105 @@ async def run_coordinator(  # noqa: C901
             "max_turns": max_turns or settings.max_turns,
         },
     ) as _span:  # noqa: F841
-        options = create_coordinator_options(timeout_seconds, max_turns)
-
-        result_text = ""
-        debug_messages: list[Any] = []
-        # Capture metrics from ResultMessage
-        metrics: dict[str, Any] = {
-            "duration_ms": 0,
-            "num_turns": 0,
-            "total_cost_usd": None,
-            "usage": None,
-        }
-        # Track subagent metrics separately
-        subagent_breakdown: dict[str, dict[str, Any]] = {}
-        # Map tool_use_id to subagent type for Task calls
-        task_tool_uses: dict[str, str] = {}
+        # Sidecar requests are added to the session's cost
+        track_sidecar_costs()
+        # A requested language or format needs the report writer
+        use_report_writer = bool(
+            settings.report_writer_enabled or language or report_format
+        )
+        follow_up = await prepare_follow_up(session_id, query_text)
+        options = create_coordinator_options(
+            timeout_seconds,
+            max_turns,
+            collector_instructions,
+            use_collector_cache,
+            report_writer=use_report_writer,
+            session_id=follow_up.resume,
+            mcp_servers=mcp_servers,
+            traffic=traffic,
+            generation=generation,
+            instructions=instructions,
+            remediate=remediate,
+        )
 
         logger.info(f"Starting investigation: {query_text[:100]}...")
         add_event("investigation_started", {"query_length": len(query_text)})
 
-        async with ClaudeSDKClient(options=options) as client:
-            # Send the investigation query
-            await client.query(query_text)
-
-            # Process response messages
-            turn_count = 0
-            async for message in client.receive_response():
-                # Log all message types to debug
-                logger.info(f"Received message type: {type(message).__name__}")
-
-                if isinstance(message, AssistantMessage):
-                    turn_count += 1
-                    for block in message.content:
-                        if isinstance(block, TextBlock):
-                            result_text += block.text
-                        elif isinstance(block, ToolUseBlock):
-                            # Track Task tool uses to capture subagent metrics
-                            if block.name == "Task":
-                                subagent_type = block.input.get(
-                                    "subagent_type", "unknown"
-                                )
-                                task_tool_uses[block.id] = subagent_type
-                                logger.info(
-                                    f"Tracking Task call for subagent: {subagent_type}, id: {block.id}"
-                                )
-                        elif isinstance(block, ToolResultBlock):
-                            # Capture subagent metrics from Task results
-                            logger.info(
-                                f"Got ToolResultBlock: tool_use_id={block.tool_use_id}, is_error={block.is_error}"
-                            )
-                            if block.tool_use_id in task_tool_uses:
-                                subagent_type = task_tool_uses[block.tool_use_id]
-                                logger.info(f"Found Task result for {subagent_type}")
-                                # The content should be the Task tool output
-                                # According to SDK docs, Task returns: result, usage, total_cost_usd, duration_ms
-                                # But the actual content might be just the text result
-                                # Let's log what we actually get
-                                logger.info(
-                                    f"ToolResultBlock content type: {type(block.content)}"
-                                )
-                                logger.info(
-                                    f"ToolResultBlock content: {str(block.content)[:500]}"
-                                )
-                    debug_messages.append(message)
-                    add_event("assistant_message", {"turn": turn_count})
-                elif isinstance(message, ResultMessage):
-                    # Capture metrics
-                    metrics["duration_ms"] = message.duration_ms
-                    metrics["num_turns"] = message.num_turns
-                    metrics["total_cost_usd"] = message.total_cost_usd
-                    metrics["usage"] = message.usage
-
-                    if message.is_error:
-                        logger.error(f"Coordinator error: {message.result}")
-                        set_span_attribute("error", True)
-                        set_span_attribute("error.message", str(message.result))
-                    else:
-                        logger.info(
-                            f"Investigation completed in {message.duration_ms}ms, "
-                            f"turns: {message.num_turns}, "
-                            f"cost: ${message.total_cost_usd or 0:.4f}"
-                        )
-                        # Record metrics as span attributes
-                        set_span_attribute("duration_ms", message.duration_ms)
-                        set_span_attribute("num_turns", message.num_turns)
-                        set_span_attribute("cost_usd", message.total_cost_usd or 0)
-                        if message.usage:
-                            set_span_attribute("usage", str(message.usage))
+        attempt = 0
+        restarts = 0
+        while True:
+            try:
+                state = await _run_attempt(
+                    options,
+                    follow_up.query,
+                    settings.stall_timeout_seconds,
+                    verify=settings.critic_enabled if verify is None else verify,
+                )
+                break
+            except StalledStreamError as e:
+                attempt += 1
+                add_event("stream_stalled", {"attempt": attempt})
+                if attempt > settings.stall_max_retries:
+                    logger.error(f"Model stream stalled, giving up: {e}")
+                    set_span_attribute("error", True)
+                    set_span_attribute("error.type", "stalled_stream")
+                    raise
+                _limit_retry_budget(options, e)
+                logger.warning(
+                    f"Model stream stalled, retrying "
+                    f"({attempt}/{settings.stall_max_retries}): {e}"
+                )
+            except McpServerUnavailableError as e:
+                restarts += 1
+                await _backoff_mcp_restart(e, restarts)
+                _limit_retry_budget(options, e)
 
         # Debug mode: log all messages
         if settings.debug:
             logger.info("=== DEBUG MODE: Coordinator All Messages ===")
-            for msg in debug_messages:
+            for msg in state.debug_messages:
                 logger.info(msg)
             logger.info("=== End Coordinator Debug Output ===")
 
+        findings: str | None = None
+        if use_report_writer and not state.truncated:
+            findings = state.result_text
+            await _write_report(
+                state, query_text, language, report_format or "markdown"
+            )
+
+        validation = _validate_report(
+            state, modify=not (use_report_writer and report_format == "json")
+        )
+        # Nothing sensitive leaves the service in the report or findings
+        state.result_text = scrub_report(state.result_text)
+        if findings is not None:
+            findings = scrub_report(findings)
+
+        if suggest_patches is None:
+            suggest_patches = settings.patch_suggestions_enabled
+        if suggest_patches and not state.truncated and _affordable(state, "patches"):
+            await _suggest_patches(state, query_text)
+        if suggest_alert_rules is None:
+            suggest_alert_rules = settings.alert_rule_suggestions_enabled
+        if (
+            suggest_alert_rules
+            and not state.truncated
+            and _affordable(state, "alert_rules")
+        ):
+            await _suggest_alert_rules(state, query_text)
+        if (
+            settings.triage_enabled
+            and state.result_text
+            and _affordable(state, "triage")
+        ):
+            await _classify(state, query_text)
+
+        _record_follow_up(state, follow_up, query_text)
+        charge_tenant(state.metrics["total_cost_usd"])
+
         # Try to parse structured output
-        parsed_report = parse_markdown_report(result_text)
+        parsed_report = parse_report(state.result_text)
         if parsed_report:
             set_span_attribute("output.structured", True)
             set_span_attribute("output.summary_items", len(parsed_report.summary))
@@ -222,12 +1167,23 @@ async def run_coordinator(  # noqa: C901
             set_span_attribute("output.structured", False)
 
         return InvestigationResult(
-            result=result_text,
-            duration_ms=metrics["duration_ms"],
-            num_turns=metrics["num_turns"],
-            total_cost_usd=metrics["total_cost_usd"],
-            usage=metrics["usage"],
-            breakdown=subagent_breakdown if subagent_breakdown else None,
+            result=state.result_text,
+            duration_ms=state.metrics["duration_ms"],
+            num_turns=state.metrics["num_turns"],
+            total_cost_usd=_total_cost_usd(state),
+            usage=state.metrics["usage"],
+            breakdown=state.subagent_breakdown if state.subagent_breakdown else None,
+            model_upgrade=state.model_upgrade,
+            review=state.review,
+            findings=findings,
+            validation=validation,
+            session_id=state.session_id,
+            debug_trace=sdk_trace(state.debug_messages) if debug else None,
+            artifacts=_artifacts(state),
+            truncated=state.truncated,
+            triage=state.triage,
+            alert_rules=[rule.model_dump() for rule in state.alert_rules] or None,
+            thinking_budget_tokens=options.max_thinking_tokens,
         )
 
 
@@ -235,20 +1191,39 @@ async def run_coordinator_streaming(
     query_text: str,
     timeout_seconds: int | None = None,
     max_turns: int | None = None,
-) -> AsyncGenerator[str, None]:
+    collector_instructions: dict[str, str] | None = None,
+    traffic: TrafficSession | None = None,
+    progress: bool = False,
+    generation: GenerationOverrides | None = None,
+    instructions: str | None = None,
+) -> AsyncGenerator[str | ProgressEvent, None]:
     """
     Run the coordinator agent with streaming response.
 
     Yields text chunks as they are received, providing real-time feedback
-    during long investigations.
+    during long investigations, and optionally progress events of the
+    coordinator and its collectors.
 
     Args:
         query_text: High-level failure description
         timeout_seconds: Optional timeout override
         max_turns: Optional max turns override
+        collector_instructions: Optional per-run replacement collector prompts
+        traffic: Record or answer the model and tool traffic of the session
+            (the proxy must be running)
+        progress: Also yield progress events of the agents' tool calls
+        generation: Per-request coordinator model and generation overrides
+        instructions: Per-request instructions for the coordinator
 
     Yields:
-        Text chunks as they are generated
+        Text chunks as they are generated; a report cut short by the cost
+        ceiling ends with TRUNCATED_NOTE. With progress, ProgressEvents in
+        between.
+
+    Raises:
+        StalledStreamError: The model stream stalled after text was already
+            sent, or on every retry
+        McpServerUnavailableError: MCP servers failed after every restart
     """
     with trace_operation(
         "coordinator.investigate.streaming",
@@ -257,7 +1232,14 @@ async def run_coordinator_streaming(
             "streaming": True,
         },
     ) as _span:  # noqa: F841
-        options = create_coordinator_options(timeout_seconds, max_turns)
+        options = create_coordinator_options(
+            timeout_seconds,
+            max_turns,
+            collector_instructions,
+            traffic=traffic,
+            generation=generation,
+            instructions=instructions,
+        )
 
         logger.info(f"Starting streaming investigation: {query_text[:100]}...")
         add_event(
@@ -265,39 +1247,136 @@ async def run_coordinator_streaming(
             {"query_length": len(query_text), "streaming": True},
         )
 
-        async with ClaudeSDKClient(options=options) as client:
-            await client.query(query_text)
+        settings = get_settings()
+        attempt = 0
+        restarts = 0
+        yielded_text = False
+        while True:
+            try:
+                async with open_session(options) as client:
+                    await client.query(query_text)
 
-            turn_count = 0
-            async for message in client.receive_response():
-                if isinstance(message, AssistantMessage):
-                    turn_count += 1
-                    for block in message.content:
-                        if isinstance(block, TextBlock):
-                            yield block.text
-                    add_event("assistant_message", {"turn": turn_count})
-                elif isinstance(message, ResultMessage):
-                    if message.is_error:
-                        logger.error(f"Coordinator error: {message.result}")
-                        set_span_attribute("error", True)
-                    else:
-                        logger.info(
-                            f"Streaming investigation completed in {message.duration_ms}ms, "
-                            f"turns: {message.num_turns}, "
-                            f"cost: ${message.total_cost_usd or 0:.4f}"
-                        )
-                        set_span_attribute("duration_ms", message.duration_ms)
-                        set_span_attribute("num_turns", message.num_turns)
-                        set_span_attribute("cost_usd", message.total_cost_usd or 0)
-
-
-def get_structured_report(result_text: str) -> DiagnosticReport | None:
-    """
-    Attempt to parse the coordinator's text output into a structured report.
+                    turn_count = 0
+                    tool_timer = ToolCallTimer()
+                    tracker = ProgressTracker()
+                    try:
+                        async for message in receive_with_watchdog(
+                            client, settings.stall_timeout_seconds
+                        ):
+                            tool_timer.observe(message)
+                            if progress:
+                                for event in tracker.observe_message(message):
+                                    yield event
+                            if isinstance(message, AssistantMessage):
+                                # Skip subagent output; only stream the coordinator
+                                if getattr(message, "parent_tool_use_id", None):
+                                    continue
+                                turn_count += 1
+                                for block in message.content:
+                                    if isinstance(block, TextBlock):
+                                        yielded_text = True
+                                        yield scrub_report(block.text)
+                                add_event("assistant_message", {"turn": turn_count})
+                            elif isinstance(message, ResultMessage):
+                                _log_streaming_result(message)
+                                if message.subtype == BUDGET_EXCEEDED_SUBTYPE:
+                                    yield TRUNCATED_NOTE
+                    except StalledStreamError:
+                        # The stalled attempt is charged like a completed one
+                        charge_tenant(await interrupted_cost(client))
+                        raise
+                return
+            except StalledStreamError as e:
+                attempt += 1
+                add_event("stream_stalled", {"attempt": attempt})
+                # Text already sent to the client cannot be taken back
+                if yielded_text or attempt > settings.stall_max_retries:
+                    logger.error(f"Model stream stalled, giving up: {e}")
+                    set_span_attribute("error", True)
+                    set_span_attribute("error.type", "stalled_stream")
+                    raise
+                _limit_retry_budget(options, e)
+                logger.warning(
+                    f"Model stream stalled, retrying "
+                    f"({attempt}/{settings.stall_max_retries}): {e}"
+                )
+            except McpServerUnavailableError as e:
+                # Servers are checked at session start, before any text is sent
+                restarts += 1
+                await _backoff_mcp_restart(e, restarts)
+                _limit_retry_budget(options, e)
+
+
+def _limit_retry_budget(options: ClaudeAgentOptions, error: Exception) -> None:
+    """
+    Lower the cost ceiling of the next attempt to the tenant's remaining budget.
+
+    Raises:
+        The error of the failed attempt, if the tenant's budget is spent
+    """
+    options.max_budget_usd = attempt_budget_usd()
+    if options.max_budget_usd is not None and options.max_budget_usd <= 0:
+        logger.error(f"{error}, not retrying: the tenant's budget is spent")
+        set_span_attribute("error", True)
+        raise error
+
+
+async def _backoff_mcp_restart(error: McpServerUnavailableError, restart: int) -> None:
+    """
+    Wait before retrying in a fresh session, which restarts the MCP servers.
+
+    Raises:
+        McpServerUnavailableError: SHOOT_MCP_MAX_RESTARTS was exceeded
+    """
+    max_restarts = get_settings().mcp_max_restarts
+    if restart > max_restarts:
+        logger.error(f"{error}, giving up after {max_restarts} restarts")
+        set_span_attribute("error", True)
+        set_span_attribute("error.type", "mcp_unavailable")
+        raise error
+    delay = restart_backoff_seconds(restart)
+    logger.warning(f"{error}, restarting in {delay:.0f}s ({restart}/{max_restarts})")
+    add_event("mcp_restart", {"restart": restart})
+    await asyncio.sleep(delay)
+
+
+def _log_streaming_result(message: ResultMessage) -> None:
+    """Log and record metrics for the result of a streaming investigation."""
+    charge_tenant(message.total_cost_usd)
+    if message.subtype == BUDGET_EXCEEDED_SUBTYPE:
+        get_activity_tracker().record_provider_result(True)
+        logger.warning(
+            f"Streaming investigation stopped at the cost ceiling, "
+            f"cost: ${message.total_cost_usd or 0:.4f}"
+        )
+        add_event("cost_ceiling_reached", {"cost_usd": message.total_cost_usd or 0})
+        set_span_attribute("truncated", True)
+        return
+    get_activity_tracker().record_provider_result(not provider_failed(message))
+    if message.is_error:
+        logger.error(f"Coordinator error: {message.result}")
+        set_span_attribute("error", True)
+    else:
+        logger.info(
+            f"Streaming investigation completed in {message.duration_ms}ms, "
+            f"turns: {message.num_turns}, "
+            f"cost: ${message.total_cost_usd or 0:.4f}"
+        )
+        set_span_attribute("duration_ms", message.duration_ms)
+        set_span_attribute("num_turns", message.num_turns)
+        set_span_attribute("cost_usd", message.total_cost_usd or 0)
+
+
+def get_structured_report(
+    result_text: str, alert_rules: list[dict[str, Any]] | None = None
+) -> DiagnosticReport | None:
+    """
+    Attempt to parse the coordinator's text output into a structured report,
+    with the alert rules suggested for it.
 
     Returns None if the output doesn't match the expected format.
     """
-    return parse_markdown_report(result_text)
+    return parse_report(result_text, alert_rules)
 
 
 def is_coordinator_ready() -> bool:
@@ -0,0 +1,213 @@
+"""
+Export of per-investigation LLM costs in a FinOps FOCUS-compatible layout.
+
+Completed investigations are buffered and periodically written as one file
+per export to object storage (S3 or any S3-compatible store) or a local
+directory, so central cost tooling can ingest shoot spend alongside cloud
+costs. Each investigation becomes one row using FOCUS column names.
+"""
+
+import asyncio
+import csv
+import io
+import json
+from collections import deque
+from datetime import datetime, timedelta, timezone
+from functools import lru_cache
+from pathlib import Path
+from threading import Lock
+from typing import Any
+
+import boto3  # type: ignore[import-untyped]
+
+from app_logging import logger
+from config import get_settings
+from store import InvestigationRecord
+
+# FOCUS columns written for each investigation, in file order
+FOCUS_COLUMNS = [
+    "BillingAccountId",
+    "SubAccountId",
+    "ChargePeriodStart",
+    "ChargePeriodEnd",
+    "ChargeCategory",
+    "ChargeDescription",
+    "BilledCost",
+    "EffectiveCost",
+    "ListCost",
+    "BillingCurrency",
+    "ProviderName",
+    "PublisherName",
+    "InvoiceIssuerName",
+    "ServiceName",
+    "ServiceCategory",
+    "ResourceId",
+    "ResourceName",
+    "ResourceType",
+    "SkuId",
+    "ConsumedQuantity",
+    "ConsumedUnit",
+    "Tags",
+]
+
+# Records waiting for export are dropped beyond this, oldest first
+_MAX_PENDING = 10000
+
+
+def focus_row(record: InvestigationRecord) -> dict[str, Any]:
+    """Convert an investigation into a FOCUS cost row."""
+    settings = get_settings()
+    end = datetime.fromisoformat(record.created_at)
+    start = end - timedelta(milliseconds=record.duration_ms)
+    cost = record.total_cost_usd or 0.0
+    usage = record.usage or {}
+    tokens = sum(
+        value
+        for key, value in usage.items()
+        if key.endswith("_tokens") and isinstance(value, int)
+    )
+    tags = {
+        "shoot.cluster": record.cluster,
+        "shoot.organization_namespace": settings.org_ns,
+        "shoot.prompt_version": record.prompt_version,
+        "shoot.collector_model": record.collector_model,
+    }
+    if record.shadow_of:
+        tags["shoot.shadow_of"] = record.shadow_of
+    return {
+        "BillingAccountId": settings.cost_export_billing_account,
+        "SubAccountId": record.cluster,
+        "ChargePeriodStart": start.isoformat(),
+        "ChargePeriodEnd": end.isoformat(),
+        "ChargeCategory": "Usage",
+        "ChargeDescription": "Shoot investigation",
+        "BilledCost": cost,
+        "EffectiveCost": cost,
+        "ListCost": cost,
+        "BillingCurrency": "USD",
+        "ProviderName": "Anthropic",
+        "PublisherName": "Anthropic",
+        "InvoiceIssuerName": "Anthropic",
+        "ServiceName": settings.otel_service_name,
+        "ServiceCategory": "AI and Machine Learning",
+        "ResourceId": record.id,
+        "ResourceName": record.cluster,
+        "ResourceType": "Investigation",
+        "SkuId": record.model_upgrade or record.coordinator_model,
+        "ConsumedQuantity": tokens,
+        "ConsumedUnit": "Tokens",
+        "Tags": tags,
+    }
+
+
+def serialize_rows(rows: list[dict[str, Any]], export_format: str) -> bytes:
+    """Serialize FOCUS rows as CSV or JSON Lines."""
+    if export_format == "json":
+        return "".join(json.dumps(row) + "\n" for row in rows).encode("utf-8")
+
+    buffer = io.StringIO()
+    writer = csv.DictWriter(buffer, fieldnames=FOCUS_COLUMNS)
+    writer.writeheader()
+    for row in rows:
+        writer.writerow({**row, "Tags": json.dumps(row["Tags"])})
+    return buffer.getvalue().encode("utf-8")
+
+
+def _write_object(destination: str, key: str, body: bytes) -> None:
+    """Write an export file to S3 (s3://bucket/prefix) or a local directory."""
+    settings = get_settings()
+    if destination.startswith("s3://"):
+        bucket, _, prefix = destination.removeprefix("s3://").partition("/")
+        client = boto3.client(
+            "s3", endpoint_url=settings.cost_export_s3_endpoint_url or None
+        )
+        object_key = f"{prefix.rstrip('/')}/{key}" if prefix else key
+        client.put_object(Bucket=bucket, Key=object_key, Body=body)
+        return
+
+    path = Path(destination) / key
+    path.parent.mkdir(parents=True, exist_ok=True)
+    path.write_bytes(body)
+
+
+class CostExporter:
+    """Buffers completed investigations and writes them out in batches."""
+
+    def __init__(self, destination: str, export_format: str) -> None:
+        self._destination = destination
+        self._format = export_format
+        self._pending: deque[InvestigationRecord] = deque(maxlen=_MAX_PENDING)
+        self._lock = Lock()
+
+    def enqueue(self, record: InvestigationRecord) -> None:
+        """Queue an investigation for the next export."""
+        with self._lock:
+            self._pending.append(record)
+
+    async def flush(self) -> int:
+        """
+        Write all queued investigations as one export file.
+
+        On failure the records are queued again for the next export.
+
+        Returns:
+            Number of exported investigations
+        """
+        with self._lock:
+            records = list(self._pending)
+            self._pending.clear()
+        if not records:
+            return 0
+
+        now = datetime.now(timezone.utc)
+        extension = "jsonl" if self._format == "json" else "csv"
+        key = (
+            f"{now:%Y/%m/%d}/{get_settings().otel_service_name}-"
+            f"{now:%Y%m%dT%H%M%SZ}.{extension}"
+        )
+        body = serialize_rows([focus_row(r) for r in records], self._format)
+        try:
+            await asyncio.to_thread(_write_object, self._destination, key, body)
+        except Exception as e:
+            logger.error(f"Cost export to {self._destination} failed: {e}")
+            with self._lock:
+                # Failed records go before the ones queued meanwhile; when
+                # they don't all fit, the oldest are dropped
+                requeued = [*records, *self._pending]
+                self._pending.clear()
+                self._pending.extend(requeued)
+            dropped = len(requeued) - _MAX_PENDING
+            if dropped > 0:
+                logger.warning(
+                    f"Cost export queue full, dropped the {dropped} oldest "
+                    "investigations"
+                )
+            return 0
+
+        logger.info(f"Exported costs of {len(records)} investigations to {key}")
+        return len(records)
+
+    async def run(self, interval_seconds: int) -> None:
+        """Export periodically until cancelled, flushing once more on shutdown."""
+        try:
+            while True:
+                await asyncio.sleep(interval_seconds)
+                await self.flush()
+        finally:
+            await self.flush()
+
+
+@lru_cache()
+def get_cost_exporter() -> CostExporter | None:
+    """Get the process-wide cost exporter, or None if export is disabled."""
+    settings = get_settings()
+    if not settings.cost_export_destination:
+        return None
+    return CostExporter(settings.cost_export_destination, settings.cost_export_format)
+
+
+def export_investigation_cost(record: InvestigationRecord) -> None:
+    """Queue an investigation for cost export if export is enabled."""
+    exporter = get_cost_exporter()
+    if exporter is not None:
+        exporter.enqueue(record)
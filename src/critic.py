@@ -0,0 +1,75 @@
+"""
+Critic (report verification) agent for the Shoot agent system.
+
+The critic reviews the coordinator's draft report against the evidence
+returned by the collectors, flags unsupported claims, and lists evidence that
+is missing for the stated likely cause. It has no tools and calls the
+Anthropic Messages API directly with a single request (llm.py).
+"""
+
+from typing import Any
+
+from pydantic import BaseModel, Field
+
+from app_logging import logger
+from config import get_critic_prompt, get_settings
+from llm import complete, format_report_input, parse_json_answer
+
+_MAX_OUTPUT_TOKENS = 2048
+
+
+class CriticReview(BaseModel):
+    """Verdict of the critic on a draft report."""
+
+    supported: bool = Field(..., description="All claims are backed by evidence")
+    unsupported_claims: list[str] = Field(default_factory=list)
+    missing_evidence: list[str] = Field(default_factory=list)
+
+
+def parse_review(text: str) -> CriticReview | None:
+    """Parse the critic's JSON verdict, tolerating surrounding prose or fences."""
+    return parse_json_answer(text, CriticReview)
+
+
+def build_revision_request(review: CriticReview) -> str:
+    """Build the follow-up message asking the coordinator to revise its report."""
+    lines = ["A reviewer checked your report against the collected evidence."]
+    if review.unsupported_claims:
+        lines.append("\nUnsupported claims:")
+        lines.extend(f"- {claim}" for claim in review.unsupported_claims)
+    if review.missing_evidence:
+        lines.append("\nMissing evidence:")
+        lines.extend(f"- {item}" for item in review.missing_evidence)
+    lines.append(
+        "\nCollect the missing evidence through the collectors if needed, drop or "
+        "correct unsupported claims, and reply with the complete revised report "
+        "in the required output format."
+    )
+    return "\n".join(lines)
+
+
+async def review_report(
+    query: str, draft: str, evidence: list[tuple[str, str]]
+) -> tuple[CriticReview | None, dict[str, Any]]:
+    """
+    Review a draft report against collector evidence.
+
+    Args:
+        query: Original failure description
+        draft: Coordinator's draft report
+        evidence: (collector name, result text) for each collector call
+
+    Returns:
+        Tuple of (review or None if the verdict could not be parsed, token usage)
+    """
+    settings = get_settings()
+    answer = await complete(
+        settings.critic_model or settings.coordinator_model,
+        get_critic_prompt(),
+        format_report_input(query, "Draft report", draft, evidence),
+        _MAX_OUTPUT_TOKENS,
+    )
+    review = parse_review(answer.text)
+    if review is None:
+        logger.warning(f"Could not parse critic verdict: {answer.text[:200]}")
+    return review, answer.usage
@@ -0,0 +1,134 @@
+"""
+Per-request debug traces of investigations.
+
+An investigation requested with `"debug": true` records a trace of its agent
+conversation: the text and tool calls of the coordinator and its collectors,
+and the tool results they got. The trace is returned with the result and kept
+with the investigation record, instead of logging every message of every
+request like the process-wide DEBUG setting.
+
+Entries are truncated and scrubbed like final reports, since the trace leaves
+the service with the response.
+"""
+
+import json
+from typing import Any
+
+from claude_agent_sdk import (
+    AssistantMessage,
+    TextBlock,
+    ToolResultBlock,
+    ToolUseBlock,
+    UserMessage,
+)
+
+from redaction import get_report_scrubber
+
+# Text of one trace entry is truncated to this many characters
+_MAX_ENTRY_CHARS = 2000
+# Traces are cut off after this many entries
+_MAX_ENTRIES = 500
+
+
+def _clip(text: str) -> str:
+    scrubber = get_report_scrubber()
+    if scrubber is not None:
+        text, _ = scrubber.scrub(text)
+    if len(text) > _MAX_ENTRY_CHARS:
+        truncated = len(text) - _MAX_ENTRY_CHARS
+        text = f"{text[:_MAX_ENTRY_CHARS]}... [{truncated} chars truncated]"
+    return text
+
+
+def content_text(content: Any) -> str:
+    """Flatten tool result content (a string or a list of content blocks) to text."""
+    if isinstance(content, str):
+        return content
+    if isinstance(content, list):
+        return "\n".join(
+            str(item.get("text", ""))
+            for item in content
+            if isinstance(item, dict) and item.get("type") == "text"
+        )
+    return ""
+
+
+def _entry(parent: str | None, kind: str, **fields: Any) -> dict[str, Any]:
+    # parent is the Task tool_use_id of the collector the entry belongs to
+    return {"agent": "coordinator" if not parent else parent, "type": kind, **fields}
+
+
+def sdk_trace(messages: list[Any]) -> list[dict[str, Any]]:
+    """Build a debug trace from the Agent SDK messages of an investigation."""
+    trace: list[dict[str, Any]] = []
+    for message in messages:
+        parent = getattr(message, "parent_tool_use_id", None)
+        if isinstance(message, AssistantMessage):
+            for block in message.content:
+                if isinstance(block, TextBlock):
+                    trace.append(_entry(parent, "text", text=_clip(block.text)))
+                elif isinstance(block, ToolUseBlock):
+                    trace.append(
+                        _entry(
+                            parent,
+                            "tool_use",
+                            id=block.id,
+                            name=block.name,
+                            input=_clip(json.dumps(block.input)),
+                        )
+                    )
+        elif isinstance(message, UserMessage) and not isinstance(message.content, str):
+            for block in message.content:
+                if isinstance(block, ToolResultBlock):
+                    trace.append(
+                        _entry(
+                            parent,
+                            "tool_result",
+                            tool_use_id=block.tool_use_id,
+                            is_error=bool(block.is_error),
+                            content=_clip(content_text(block.content)),
+                        )
+                    )
+    return truncate_trace(trace)
+
+
+def cli_trace_entries(event: dict[str, Any]) -> list[dict[str, Any]]:
+    """Debug trace entries of one claude CLI stream-json event."""
+    if event.get("type") not in ("assistant", "user"):
+        return []
+    content = event.get("message", {}).get("content", [])
+    if not isinstance(content, list):
+        return []
+    parent = event.get("parent_tool_use_id")
+    entries = []
+    for block in content:
+        if not isinstance(block, dict):
+            continue
+        if block.get("type") == "text":
+            entries.append(_entry(parent, "text", text=_clip(block.get("text", ""))))
+        elif block.get("type") == "tool_use":
+            entries.append(
+                _entry(
+                    parent,
+                    "tool_use",
+                    id=block.get("id"),
+                    name=block.get("name"),
+                    input=_clip(json.dumps(block.get("input", {}))),
+                )
+            )
+        elif block.get("type") == "tool_result":
+            entries.append(
+                _entry(
+                    parent,
+                    "tool_result",
+                    tool_use_id=block.get("tool_use_id"),
+                    is_error=bool(block.get("is_error")),
+                    content=_clip(content_text(block.get("content"))),
+                )
+            )
+    return entries
+
+
+def truncate_trace(trace: list[dict[str, Any]]) -> list[dict[str, Any]]:
+    """Cut a trace off at the maximum number of entries."""
+    return trace[:_MAX_ENTRIES]
@@ -0,0 +1,93 @@
+"""
+Investigations delegated by other agents.
+
+Shared by the agent-facing protocols (mcp_server.py, a2a.py): investigations
+are admitted like `POST /` requests, under the same recursion protection,
+model provider circuit breaker, and tenant restrictions, and kept in the
+investigation history.
+"""
+
+import asyncio
+import math
+from typing import Any
+
+from activity import get_activity_tracker
+from app_logging import logger
+from backend import get_backend
+from circuit_breaker import get_circuit_breaker
+from config import get_settings
+from cost_export import export_investigation_cost
+from invocation import enter_invocation_chain, parse_invocation_chain
+from jira_issues import file_jira_issue
+from namespace_scope import namespace_scope_ctx
+from similar_investigations import with_similar_investigations
+from store import InvestigationRecord, get_investigation_store, record_from_result
+from tenancy import tenant_cluster_refusal, tenant_namespaces
+from tenant_quotas import QuotaExceededError, admit_investigation, settle_reservation
+from triage import record_triage_metric
+
+
+def admission_refusal(invocation_chain: str | None) -> str | None:
+    """
+    Check whether a delegated investigation may start.
+
+    Returns:
+        None if it may run, otherwise why it is refused
+    """
+    if not enter_invocation_chain(parse_invocation_chain(invocation_chain)):
+        return (
+            "Recursive invocation depth exceeded: this request already passed "
+            f"{get_settings().max_invocation_depth} shoot instances"
+        )
+    # Delegated investigations of a tenant run on its terms (tenancy.py)
+    refusal = tenant_cluster_refusal(get_settings().wc_cluster)
+    if refusal is not None:
+        return refusal
+    retry_after = get_circuit_breaker().admit()
+    if retry_after is not None:
+        return f"Model provider unavailable, retry in {math.ceil(retry_after)} seconds"
+    namespaces = tenant_namespaces(None)
+    if namespaces is not None:
+        namespace_scope_ctx.set(namespaces)
+    try:
+        admit_investigation()
+    except QuotaExceededError as e:
+        get_circuit_breaker().release_probe()
+        return str(e)
+    return None
+
+
+async def run_delegated_investigation(
+    request_id: str, query: str, timeout_seconds: int | None = None
+) -> tuple[InvestigationRecord, list[dict[str, Any]]]:
+    """
+    Run an investigation to completion and keep it in the history.
+
+    Returns:
+        Tuple of (investigation record, similar earlier investigations)
+
+    Raises:
+        asyncio.TimeoutError: The investigation did not finish in time
+    """
+    timeout_seconds = timeout_seconds or get_settings().timeout_seconds
+    coordinator_query, similar = with_similar_investigations(query)
+    logger.info(
+        f"Starting delegated investigation request_id={request_id} "
+        f"query_length={len(query)} timeout={timeout_seconds}s"
+    )
+    try:
+        async with asyncio.timeout(timeout_seconds + 30):
+            with get_activity_tracker().investigation(request_id):
+                result = await get_backend().run(
+                    coordinator_query, timeout_seconds=timeout_seconds
+                )
+    finally:
+        settle_reservation()
+
+    record = record_from_result(request_id, query, result)
+    get_investigation_store().add(record)
+    export_investigation_cost(record)
+    record_triage_metric(record.cluster, record.triage)
+    file_jira_issue(record)
+    logger.info(f"Delegated investigation completed request_id={request_id}")
+    return record, similar
@@ -0,0 +1,213 @@
+"""
+Connectivity checks of the dependencies of the Shoot agent system.
+
+Used by the deep readiness probe (GET /ready?deep=true) and the doctor:
+
+- every MCP server of the collector registry is started (or connected to)
+  and must answer tools/list
+- the workload and management cluster API servers (or their remote
+  mcp-kubernetes endpoints) must accept TCP connections
+- optionally (SHOOT_READY_CHECK_MODEL_API), the Anthropic API must accept
+  the API key; listing models costs no tokens
+
+Starting MCP servers is expensive, so probe results are cached for
+SHOOT_READY_DEEP_CACHE_SECONDS.
+"""
+
+import asyncio
+import os
+import socket
+import time
+from functools import lru_cache
+from typing import Any, Callable, Coroutine
+from urllib.parse import urlparse
+
+import yaml
+from anthropic import Anthropic, APIError
+
+from app_logging import logger
+from collectors import get_collector_registry
+from config import get_settings
+from invocation import propagate_invocation_chain
+from mcp_kubernetes import connect_mcp_server
+from secret_files import get_secret
+from teleport_access import wc_kubeconfig
+
+_CONNECT_TIMEOUT_SECONDS = 5
+# Time an MCP server gets to start and list its tools
+_MCP_PROBE_TIMEOUT_SECONDS = 20
+
+
+def check_anthropic_api() -> tuple[bool, str]:
+    """Check that the Anthropic API accepts the configured key."""
+    client = Anthropic(
+        api_key=get_secret("anthropic_api_key") or None,
+        timeout=_CONNECT_TIMEOUT_SECONDS * 2,
+    )
+    try:
+        client.models.list(limit=1)
+    except APIError as e:
+        return False, f"Anthropic API request failed: {e}"
+    return True, ""
+
+
+def kubeconfig_server(path: str) -> str:
+    """
+    API server URL of the current context of a kubeconfig.
+
+    Raises:
+        ValueError: The kubeconfig cannot be read or has no current cluster
+    """
+    try:
+        with open(path) as f:
+            kubeconfig = yaml.safe_load(f) or {}
+    except (OSError, yaml.YAMLError) as e:
+        raise ValueError(f"Cannot read kubeconfig {path}: {e}") from e
+    contexts = {
+        entry.get("name"): entry.get("context", {})
+        for entry in kubeconfig.get("contexts", [])
+    }
+    clusters = {
+        entry.get("name"): entry.get("cluster", {})
+        for entry in kubeconfig.get("clusters", [])
+    }
+    context = contexts.get(kubeconfig.get("current-context"), {})
+    server = clusters.get(context.get("cluster"), {}).get("server")
+    if not server:
+        raise ValueError(f"Kubeconfig {path} has no server for its current context")
+    return str(server)
+
+
+def check_reachable(url: str) -> tuple[bool, str]:
+    """Check that a TCP connection to the host of a URL can be opened."""
+    parsed = urlparse(url)
+    port = parsed.port or (443 if parsed.scheme == "https" else 80)
+    try:
+        with socket.create_connection(
+            (parsed.hostname or "", port), timeout=_CONNECT_TIMEOUT_SECONDS
+        ):
+            pass
+    except OSError as e:
+        return False, f"Cannot connect to {parsed.hostname}:{port}: {e}"
+    return True, ""
+
+
+def check_wc_reachable() -> tuple[bool, str]:
+    """Check that the workload cluster (or its remote MCP endpoint) is reachable."""
+    settings = get_settings()
+    try:
+        url = settings.mcp_kubernetes_wc_url or kubeconfig_server(wc_kubeconfig())
+    except ValueError as e:
+        return False, str(e)
+    return check_reachable(url)
+
+
+def check_mc_reachable() -> tuple[bool, str]:
+    """Check that the management cluster (or its remote MCP endpoint) is reachable."""
+    settings = get_settings()
+    if settings.mcp_kubernetes_mc_url:
+        return check_reachable(settings.mcp_kubernetes_mc_url)
+    if settings.mc_kubeconfig:
+        try:
+            return check_reachable(kubeconfig_server(settings.mc_kubeconfig))
+        except ValueError as e:
+            return False, str(e)
+    host = os.environ.get("KUBERNETES_SERVICE_HOST")
+    if not host:
+        return False, "Not running in-cluster and MC_KUBECONFIG not set"
+    port = os.environ.get("KUBERNETES_SERVICE_PORT", "443")
+    return check_reachable(f"https://{host}:{port}")
+
+
+async def list_mcp_tools(config: dict[str, Any]) -> int:
+    """
+    Start or connect to an MCP server and count the tools it lists.
+
+    Raises:
+        Exception: The server cannot be started, connected to, or initialized
+    """
+    async with connect_mcp_server(config) as session:
+        result = await session.list_tools()
+        return len(result.tools)
+
+
+async def probe_mcp_server(name: str, config: dict[str, Any]) -> dict[str, Any]:
+    """Check that an MCP server answers tools/list."""
+    started = time.monotonic()
+    try:
+        async with asyncio.timeout(_MCP_PROBE_TIMEOUT_SECONDS):
+            tools = await list_mcp_tools(config)
+    except Exception as e:
+        logger.warning(f"MCP server {name} failed its readiness probe: {e!r}")
+        return {
+            "valid": False,
+            "error": f"tools/list failed: {e!r}",
+            "latency_ms": int((time.monotonic() - started) * 1000),
+        }
+    return {
+        "valid": tools > 0,
+        "error": "" if tools else "Server lists no tools",
+        "tools": tools,
+        "latency_ms": int((time.monotonic() - started) * 1000),
+    }
+
+
+async def _timed(check: Callable[[], tuple[bool, str]]) -> dict[str, Any]:
+    started = time.monotonic()
+    valid, error = await asyncio.to_thread(check)
+    return {
+        "valid": valid,
+        "error": error,
+        "latency_ms": int((time.monotonic() - started) * 1000),
+    }
+
+
+async def run_dependency_checks() -> dict[str, dict[str, Any]]:
+    """Probe all dependencies concurrently; returns a result per dependency."""
+    results: dict[str, dict[str, Any]] = {}
+    checks: dict[str, Coroutine[Any, Any, dict[str, Any]]] = {
+        "cluster_wc": _timed(check_wc_reachable),
+        "cluster_mc": _timed(check_mc_reachable),
+    }
+    if get_settings().ready_check_model_api:
+        checks["anthropic_api"] = _timed(check_anthropic_api)
+    try:
+        servers = get_collector_registry().server_configs()
+    except ValueError as e:
+        servers = {}
+        results["collector_registry"] = {"valid": False, "error": str(e)}
+    for name, config in propagate_invocation_chain(servers).items():
+        if config.get("type") == "sdk":
+            # In-process servers have nothing to probe
+            continue
+        checks[f"mcp_{name}"] = probe_mcp_server(name, config)
+
+    results.update(zip(checks.keys(), await asyncio.gather(*checks.values())))
+    return results
+
+
+class DependencyChecker:
+    """Dependency check results, cached for a few seconds."""
+
+    def __init__(self, cache_seconds: int) -> None:
+        self._cache_seconds = cache_seconds
+        self._lock = asyncio.Lock()
+        self._results: dict[str, dict[str, Any]] | None = None
+        self._checked_at = 0.0
+
+    async def check(self) -> dict[str, dict[str, Any]]:
+        """Latest results, probing again once the cached ones expired."""
+        # Concurrent probes wait for the one in progress instead of starting
+        # more MCP servers
+        async with self._lock:
+            age = time.monotonic() - self._checked_at
+            if self._results is None or age >= self._cache_seconds:
+                self._results = await run_dependency_checks()
+                self._checked_at = time.monotonic()
+            return self._results
+
+
+@lru_cache()
+def get_dependency_checker() -> DependencyChecker:
+    """Get the process-wide dependency checker."""
+    return DependencyChecker(get_settings().ready_deep_cache_seconds)
@@ -0,0 +1,77 @@
+"""
+Configuration doctor for the Shoot agent system.
+
+Checks a configuration before the service is started, so misconfigurations
+surface before the first investigation fails: the settings load, the
+preflight checks of /ready (kubeconfigs, API key, MCP binary, collector
+registry, prompt template variables), and whether the Anthropic API and both
+clusters are reachable.
+
+    python doctor.py [--json]
+
+Prints one line per check (or a JSON object) and exits with status 1 if any
+check fails.
+"""
+
+import argparse
+import json
+import sys
+from typing import Any, Callable
+
+from pydantic import ValidationError
+
+from collectors import run_preflight_checks
+from config import get_settings
+from dependency_checks import (
+    check_anthropic_api,
+    check_mc_reachable,
+    check_wc_reachable,
+)
+
+
+def check_settings() -> tuple[bool, str]:
+    """Check that the settings (environment, .env, config file) are valid."""
+    try:
+        get_settings()
+    except (ValidationError, ValueError) as e:
+        return False, str(e)
+    return True, ""
+
+
+def run_checks() -> dict[str, dict[str, Any]]:
+    """Run all checks; later checks are skipped if the settings are invalid."""
+    settings_valid, settings_error = check_settings()
+    results = {"settings": {"valid": settings_valid, "error": settings_error}}
+    if not settings_valid:
+        return results
+
+    results.update(run_preflight_checks())
+    connectivity: dict[str, Callable[[], tuple[bool, str]]] = {
+        "anthropic_connectivity": check_anthropic_api,
+        "wc_reachable": check_wc_reachable,
+        "mc_reachable": check_mc_reachable,
+    }
+    for name, check in connectivity.items():
+        valid, error = check()
+        results[name] = {"valid": valid, "error": error}
+    return results
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description="Check the shoot configuration")
+    parser.add_argument("--json", action="store_true", help="print results as JSON")
+    args = parser.parse_args()
+
+    results = run_checks()
+    if args.json:
+        print(json.dumps(results, indent=2))
+    else:
+        for name, result in results.items():
+            status = "PASS" if result["valid"] else "FAIL"
+            detail = f": {result['error']}" if result["error"] else ""
+            print(f"{status} {name}{detail}")
+    return 0 if all(result["valid"] for result in results.values()) else 1
+
+
+if __name__ == "__main__":
+    sys.exit(main())
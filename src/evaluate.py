@@ -0,0 +1,206 @@
+"""
+Evaluation harness for prompts and models.
+
+Replays a suite of recorded scenarios against the current prompts and
+models and scores the reports, so prompt and model changes can be
+regression-tested before they are rolled out. A scenario is a YAML file with
+a failure description, the recorded MCP tool responses its investigation
+gets instead of cluster data (recorded_tools.py), and its expectations:
+
+    name: crashloop-missing-configmap
+    query: Deployment api in namespace shop is not ready
+    tool_calls:
+      - tool: mcp__kubernetes_wc__describe
+        output: |
+          ...
+    expect:
+      keywords: [api-config]        # must all appear in the report
+      forbidden: [OOMKilled]        # must not appear
+      judge: The report names the missing ConfigMap api-config as the cause
+
+    python evaluate.py SUITE_DIR [--judge] [--filter TEXT] [--json]
+
+Keyword checks are case-insensitive. With --judge, a model also grades each
+report against its `judge` expectation. Investigations run through the
+agent_sdk backend with the collector caches bypassed. Prints one line per
+scenario (or a JSON object) and exits with status 1 if any scenario fails.
+"""
+
+import argparse
+import asyncio
+import json
+import sys
+from pathlib import Path
+from typing import Any
+
+import yaml
+from pydantic import BaseModel, Field, ValidationError
+
+from collectors import get_collector_registry
+from config import get_eval_judge_prompt, get_settings
+from coordinator import run_coordinator
+from llm import complete, parse_json_answer
+from recorded_tools import RecordedCall, RecordedTools, recorded_server_configs
+
+_MAX_JUDGE_OUTPUT_TOKENS = 1024
+
+
+class Expectations(BaseModel):
+    """What a scenario's report must and must not contain."""
+
+    keywords: list[str] = Field(default_factory=list)
+    forbidden: list[str] = Field(default_factory=list)
+    judge: str | None = Field(
+        default=None, description="Expected outcome, graded by the judge model"
+    )
+
+
+class Scenario(BaseModel):
+    """A recorded investigation and its expectations."""
+
+    name: str = Field(..., min_length=1)
+    query: str = Field(..., min_length=1)
+    tool_calls: list[RecordedCall] = Field(default_factory=list)
+    tool_schemas: dict[str, dict[str, Any]] = Field(
+        default_factory=dict, description="Input schemas by qualified tool name"
+    )
+    expect: Expectations = Field(default_factory=Expectations)
+
+
+class JudgeVerdict(BaseModel):
+    """Verdict of the judge model on a report."""
+
+    passed: bool
+    reason: str = ""
+
+
+def load_scenarios(directory: Path) -> list[Scenario]:
+    """
+    Load the scenarios of a suite, sorted by file name.
+
+    Raises:
+        ValueError: A file is not a valid scenario
+    """
+    scenarios = []
+    for path in sorted([*directory.glob("*.yaml"), *directory.glob("*.yml")]):
+        try:
+            scenarios.append(Scenario.model_validate(yaml.safe_load(path.read_text())))
+        except (OSError, yaml.YAMLError, ValidationError) as e:
+            raise ValueError(f"Invalid scenario {path}: {e}") from e
+    return scenarios
+
+
+def check_keywords(report: str, expect: Expectations) -> list[str]:
+    """Failed keyword expectations of a report."""
+    text = report.lower()
+    failures = [
+        f"missing keyword: {keyword}"
+        for keyword in expect.keywords
+        if keyword.lower() not in text
+    ]
+    failures.extend(
+        f"forbidden keyword: {keyword}"
+        for keyword in expect.forbidden
+        if keyword.lower() in text
+    )
+    return failures
+
+
+def parse_verdict(text: str) -> JudgeVerdict | None:
+    """Parse the judge's JSON verdict, tolerating surrounding prose or fences."""
+    return parse_json_answer(text, JudgeVerdict)
+
+
+async def judge_report(
+    query: str, expected: str, report: str
+) -> tuple[JudgeVerdict | None, dict[str, Any]]:
+    """
+    Grade a report against the expected outcome.
+
+    Returns:
+        Tuple of (verdict or None if it could not be parsed, token usage)
+    """
+    settings = get_settings()
+    answer = await complete(
+        settings.critic_model or settings.coordinator_model,
+        get_eval_judge_prompt(),
+        (
+            f"## Failure description\n{query}\n\n"
+            f"## Expected outcome\n{expected}\n\n"
+            f"## Report\n{report}"
+        ),
+        _MAX_JUDGE_OUTPUT_TOKENS,
+    )
+    return parse_verdict(answer.text), answer.usage
+
+
+async def run_scenario(scenario: Scenario, judge: bool) -> dict[str, Any]:
+    """Run a scenario's investigation against its recording and score the report."""
+    recording = RecordedTools(scenario.tool_calls)
+    servers = recorded_server_configs(
+        get_collector_registry(), recording, scenario.tool_schemas
+    )
+    try:
+        result = await run_coordinator(
+            scenario.query, use_collector_cache=False, mcp_servers=servers
+        )
+    except Exception as e:
+        return {"name": scenario.name, "passed": False, "failures": [str(e)]}
+
+    failures = check_keywords(result["result"], scenario.expect)
+    outcome: dict[str, Any] = {
+        "name": scenario.name,
+        "duration_ms": result["duration_ms"],
+        "total_cost_usd": result["total_cost_usd"],
+        "unmatched_calls": recording.unmatched,
+    }
+    if judge and scenario.expect.judge:
+        verdict, _ = await judge_report(
+            scenario.query, scenario.expect.judge, result["result"]
+        )
+        outcome["judge"] = verdict.model_dump() if verdict else None
+        if verdict is None:
+            failures.append("judge verdict could not be parsed")
+        elif not verdict.passed:
+            failures.append(f"judge: {verdict.reason}")
+    outcome.update(passed=not failures, failures=failures)
+    return outcome
+
+
+async def run_suite(
+    scenarios: list[Scenario], judge: bool
+) -> list[dict[str, Any]]:
+    """Run scenarios one after another, bounding load on the model API."""
+    return [await run_scenario(scenario, judge) for scenario in scenarios]
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description="Evaluate recorded scenarios")
+    parser.add_argument("suite", type=Path, help="directory of scenario files")
+    parser.add_argument(
+        "--judge", action="store_true", help="grade reports with the judge model"
+    )
+    parser.add_argument(
+        "--filter", default="", help="only run scenarios whose name contains this"
+    )
+    parser.add_argument("--json", action="store_true", help="print results as JSON")
+    args = parser.parse_args()
+
+    scenarios = [
+        scenario
+        for scenario in load_scenarios(args.suite)
+        if args.filter in scenario.name
+    ]
+    results = asyncio.run(run_suite(scenarios, args.judge))
+    if args.json:
+        print(json.dumps(results, indent=2))
+    else:
+        for result in results:
+            status = "PASS" if result["passed"] else "FAIL"
+            detail = f": {'; '.join(result['failures'])}" if result["failures"] else ""
+            print(f"{status} {result['name']}{detail}")
+    return 0 if all(result["passed"] for result in results) else 1
+
+
+if __name__ == "__main__":
+    sys.exit(main())
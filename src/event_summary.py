@@ -0,0 +1,289 @@
+"""
+Deduplicated summaries of Kubernetes Events.
+
+Raw Event listings are repetitive: every replica of a crash-looping
+Deployment reports the same BackOff every few seconds, each with its own
+Pod name, timestamps, and IDs. The events collector gets the in-process
+`summarize_events` tool instead, which lists the Events of the requested
+namespaces through the workload cluster's mcp-kubernetes server and
+condenses them into clusters:
+
+- Events are keyed by type, reason, kind of the involved object, the
+  object's group (Pods of the same Deployment, ReplicaSet, StatefulSet, or
+  DaemonSet form one group), and the message with IDs, numbers, IP addresses,
+  and generated name suffixes masked
+- each cluster reports its total count (including Events Kubernetes already
+  folded into one), the objects involved, first and last occurrence, and the
+  latest message
+
+Warnings come first, then clusters by count, so the coordinator sees the
+dominant failure signal in a few lines.
+"""
+
+import json
+import re
+from datetime import datetime, timedelta, timezone
+from typing import Any
+
+from claude_agent_sdk import tool
+from pydantic import BaseModel, Field
+
+from mcp_kubernetes import (
+    call_mcp_tool,
+    connect_mcp_server,
+    get_wc_mcp_config,
+    list_result_items,
+)
+from telemetry import add_event
+
+# Clusters returned, and objects listed per cluster
+_MAX_CLUSTERS = 40
+_MAX_OBJECTS = 5
+_DEFAULT_SINCE_MINUTES = 60
+
+# Alphabet of generated name suffixes (pod-template-hash, Pod suffixes): no
+# vowels and no 0, 1, or 3, so words rarely match. Suffixes that stand alone
+# must also contain a digit, which "proxy" or "nginx" do not
+_HASH = "[bcdfghjklmnpqrstvwxz2456789]"
+_POD_SUFFIX = rf"(?={_HASH}{{0,4}}[2456789]){_HASH}{{5}}"
+_TEMPLATE_HASH = rf"(?={_HASH}{{0,9}}[2456789]){_HASH}{{8,10}}"
+
+# Masked in messages, so Events differing only in generated values cluster
+_MESSAGE_PATTERNS = [
+    (
+        re.compile(
+            r"\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b"
+        ),
+        "<uid>",
+    ),
+    (re.compile(r"\b(sha256:)?[0-9a-f]{12,}\b"), "<id>"),
+    (re.compile(r"\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b"), "<ip>"),
+    (re.compile(rf"-{_HASH}{{8,10}}-{_HASH}{{5}}\b"), "-<hash>"),
+    (re.compile(rf"(?<=[a-z])-{_POD_SUFFIX}\b"), "-<hash>"),
+    (re.compile(r"\b\d+(\.\d+)?(ms|s|m|h|Mi|Gi|Ki|%)?\b"), "<n>"),
+]
+# Generated name suffixes of Pods and ReplicaSets, to group them by owner
+_NAME_SUFFIXES = [
+    re.compile(rf"-{_HASH}{{8,10}}-{_HASH}{{5}}$"),  # Deployment Pod
+    re.compile(rf"-{_TEMPLATE_HASH}$"),  # ReplicaSet
+    re.compile(rf"-{_POD_SUFFIX}$"),  # DaemonSet or Job Pod
+    re.compile(r"-\d+$"),  # StatefulSet Pod
+]
+
+
+class EventCluster(BaseModel):
+    """Events with the same type, reason, object group, and message."""
+
+    type: str
+    reason: str
+    kind: str
+    namespace: str
+    group: str
+    count: int = 0
+    objects: list[str] = Field(default_factory=list)
+    first_seen: str = ""
+    last_seen: str = ""
+    message: str = ""
+
+
+def normalize_message(message: str) -> str:
+    """Message with IDs, numbers, addresses, and generated suffixes masked."""
+    for pattern, replacement in _MESSAGE_PATTERNS:
+        message = pattern.sub(replacement, message)
+    return " ".join(message.split())
+
+
+def object_group(kind: str, name: str) -> str:
+    """Name of an object without generated suffixes, `api-*` for Pods of `api`."""
+    if kind not in ("Pod", "ReplicaSet"):
+        return name
+    for pattern in _NAME_SUFFIXES:
+        stripped = pattern.sub("", name)
+        if stripped != name:
+            return f"{stripped}-*"
+    return name
+
+
+def _timestamp(event: dict[str, Any]) -> str:
+    """Last occurrence of an Event, as an ISO timestamp."""
+    return (
+        event.get("lastTimestamp")
+        or (event.get("series") or {}).get("lastObservedTime")
+        or event.get("eventTime")
+        or event.get("metadata", {}).get("creationTimestamp")
+        or ""
+    )
+
+
+def _first_timestamp(event: dict[str, Any]) -> str:
+    return (
+        event.get("firstTimestamp")
+        or event.get("eventTime")
+        or event.get("metadata", {}).get("creationTimestamp")
+        or _timestamp(event)
+    )
+
+
+def _count(event: dict[str, Any]) -> int:
+    """Occurrences of an Event, including those Kubernetes folded into it."""
+    series = event.get("series") or {}
+    return int(series.get("count") or event.get("count") or 1)
+
+
+def _parse_time(value: str) -> datetime | None:
+    try:
+        return datetime.fromisoformat(value.replace("Z", "+00:00"))
+    except ValueError:
+        return None
+
+
+def cluster_events(
+    events: list[dict[str, Any]], since: datetime | None = None
+) -> list[EventCluster]:
+    """
+    Cluster Events by type, reason, object group, and normalized message.
+
+    Args:
+        events: Event objects (core/v1 or events.k8s.io/v1)
+        since: Ignore Events last seen before this time
+
+    Returns:
+        Clusters, Warnings first, then by count and last occurrence
+    """
+    clusters: dict[tuple[str, ...], EventCluster] = {}
+    for event in events:
+        last_seen = _timestamp(event)
+        seen = _parse_time(last_seen)
+        if since is not None and seen is not None and seen < since:
+            continue
+        involved = event.get("involvedObject") or event.get("regarding") or {}
+        kind = involved.get("kind", "")
+        name = involved.get("name", "")
+        namespace = involved.get("namespace") or event.get("metadata", {}).get(
+            "namespace", ""
+        )
+        message = event.get("message") or event.get("note") or ""
+        key = (
+            event.get("type", ""),
+            event.get("reason", ""),
+            kind,
+            namespace,
+            object_group(kind, name),
+            normalize_message(message),
+        )
+        cluster = clusters.get(key)
+        if cluster is None:
+            cluster = clusters[key] = EventCluster(
+                type=key[0],
+                reason=key[1],
+                kind=kind,
+                namespace=namespace,
+                group=key[4],
+                first_seen=_first_timestamp(event),
+            )
+        cluster.count += _count(event)
+        if name not in cluster.objects:
+            cluster.objects.append(name)
+        cluster.first_seen = min(cluster.first_seen, _first_timestamp(event))
+        if last_seen >= cluster.last_seen:
+            cluster.last_seen = last_seen
+            cluster.message = message
+    # Newest first, then stable sorts by type and count
+    ordered = sorted(clusters.values(), key=lambda c: c.last_seen, reverse=True)
+    return sorted(ordered, key=lambda c: (c.type != "Warning", -c.count))
+
+
+def format_clusters(
+    clusters: list[EventCluster], total: int, scope: dict[str, Any]
+) -> dict[str, Any]:
+    """Condensed summary of Event clusters for the model."""
+    entries = []
+    for cluster in clusters[:_MAX_CLUSTERS]:
+        entry = cluster.model_dump(exclude={"objects"})
+        entry["objects"] = cluster.objects[:_MAX_OBJECTS]
+        if len(cluster.objects) > _MAX_OBJECTS:
+            entry["more_objects"] = len(cluster.objects) - _MAX_OBJECTS
+        entries.append(entry)
+    summary: dict[str, Any] = {
+        "scope": scope,
+        "events": total,
+        "clusters": entries,
+    }
+    if len(clusters) > _MAX_CLUSTERS:
+        summary["more_clusters"] = len(clusters) - _MAX_CLUSTERS
+    return summary
+
+
+async def list_events(
+    namespaces: list[str], warnings_only: bool
+) -> list[dict[str, Any]]:
+    """
+    Events of the namespaces (all namespaces if none are given).
+
+    Raises:
+        ValueError: Events cannot be listed
+    """
+    base: dict[str, Any] = {"resourceType": "events", "fullOutput": True}
+    if warnings_only:
+        base["fieldSelector"] = "type=Warning"
+    calls = (
+        [{**base, "namespace": namespace} for namespace in namespaces]
+        if namespaces
+        else [{**base, "allNamespaces": True}]
+    )
+    events: list[dict[str, Any]] = []
+    async with connect_mcp_server(get_wc_mcp_config()) as session:
+        for arguments in calls:
+            text = await call_mcp_tool(session, "list", arguments)
+            events.extend(list_result_items(text))
+    return events
+
+
+@tool(
+    "summarize_events",
+    "Deduplicated summary of the Kubernetes Events in workload cluster "
+    "namespaces (all namespaces if none are given): Events are clustered by "
+    "type, reason, object group (Pods of the same workload together), and "
+    "message, with counts, involved objects, first and last occurrence, and "
+    "the latest message. Warnings come first.",
+    {
+        "type": "object",
+        "properties": {
+            "namespaces": {
+                "type": "array",
+                "items": {"type": "string"},
+                "description": "Namespaces to summarize (default: all)",
+            },
+            "since_minutes": {
+                "type": "integer",
+                "minimum": 1,
+                "description": "Only Events seen in this many minutes (default 60)",
+            },
+            "warnings_only": {
+                "type": "boolean",
+                "description": "Only Warning Events (default true)",
+            },
+        },
+    },
+)
+async def summarize_events(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: clustered Events of the namespaces."""
+    namespaces = [str(namespace) for namespace in args.get("namespaces") or []]
+    warnings_only = args.get("warnings_only", True) is not False
+    try:
+        since_minutes = int(args.get("since_minutes") or _DEFAULT_SINCE_MINUTES)
+        events = await list_events(namespaces, warnings_only)
+    except Exception as e:
+        return {"content": [{"type": "text", "text": str(e)}], "is_error": True}
+    since = datetime.now(timezone.utc) - timedelta(minutes=since_minutes)
+    clusters = cluster_events(events, since)
+    add_event(
+        "events_summarized", {"events": len(events), "clusters": len(clusters)}
+    )
+    scope = {
+        "namespaces": namespaces or "all",
+        "since_minutes": since_minutes,
+        "warnings_only": warnings_only,
+    }
+    summary = format_clusters(clusters, len(events), scope)
+    return {"content": [{"type": "text", "text": json.dumps(summary, indent=2)}]}
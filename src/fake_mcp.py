@@ -0,0 +1,284 @@
+"""
+Fake mcp-kubernetes server for local development.
+
+Serves canned Kubernetes objects, events, and pod logs over MCP (stdio) with
+the read-only tools of mcp-kubernetes (`get`, `list`, `describe`, `logs`,
+`events`), so the whole agent stack runs without a cluster, kubeconfig, or
+mcp-kubernetes binary. With SHOOT_FAKE_CLUSTER=true, the built-in workload
+and management cluster servers are started as
+
+    python fake_mcp.py --cluster workload|management [--fixtures FILE]
+
+The fixtures (SHOOT_FAKE_CLUSTER_FIXTURES, default the bundled
+`fake_cluster.yaml`) hold the objects and logs of each cluster:
+
+    workload:
+      objects:                  # any Kubernetes objects, Events included
+        - {apiVersion: v1, kind: Pod, metadata: {name: api, namespace: shop}}
+      logs:
+        shop/api: "log lines"   # <namespace>/<pod>[/<container>]
+    management:
+      objects: [...]
+
+Objects are matched by kind (singular, plural, or short name like `deploy`),
+name, namespace, API group, and equality label and field selectors.
+"""
+
+import argparse
+import json
+from pathlib import Path
+from typing import Any
+
+import yaml
+from mcp.server.fastmcp import FastMCP
+from mcp.server.fastmcp.exceptions import ToolError
+
+DEFAULT_FIXTURES = Path(__file__).parent / "fake_cluster.yaml"
+CLUSTERS = ("workload", "management")
+
+_SHORT_NAMES = {
+    "cm": "configmap",
+    "deploy": "deployment",
+    "ds": "daemonset",
+    "ev": "event",
+    "hr": "helmrelease",
+    "ing": "ingress",
+    "ks": "kustomization",
+    "no": "node",
+    "ns": "namespace",
+    "po": "pod",
+    "pv": "persistentvolume",
+    "pvc": "persistentvolumeclaim",
+    "rs": "replicaset",
+    "sts": "statefulset",
+    "svc": "service",
+}
+
+
+def _kind_matches(resource_type: str, kind: str) -> bool:
+    """Whether a resource type (as given to kubectl) names a kind."""
+    name = resource_type.lower().split(".")[0]
+    name = _SHORT_NAMES.get(name, name)
+    kind = kind.lower()
+    plurals = {kind, f"{kind}s", f"{kind}es"}
+    if kind.endswith("y"):
+        plurals.add(f"{kind[:-1]}ies")
+    return name in plurals
+
+
+def _field(obj: dict[str, Any], path: str) -> str:
+    """Value of a dotted field path as a string, empty if it is missing."""
+    value: Any = obj
+    for key in path.split("."):
+        if not isinstance(value, dict):
+            return ""
+        value = value.get(key)
+    return "" if value is None else str(value)
+
+
+def _selector_matches(values: dict[str, str], selector: str) -> bool:
+    """Whether values match an equality selector (`a=b,c!=d,e`)."""
+    for requirement in filter(None, (part.strip() for part in selector.split(","))):
+        if "!=" in requirement:
+            key, _, value = requirement.partition("!=")
+            if values.get(key.strip()) == value.strip():
+                return False
+        elif "=" in requirement:
+            key, _, value = requirement.partition("=")
+            if values.get(key.strip()) != value.strip().lstrip("="):
+                return False
+        elif requirement.strip() not in values:
+            return False
+    return True
+
+
+class FakeCluster:
+    """Canned objects and pod logs of one cluster."""
+
+    def __init__(self, objects: list[dict[str, Any]], logs: dict[str, str]) -> None:
+        self.objects = objects
+        self.logs = logs
+
+    def find(
+        self,
+        resource_type: str,
+        namespace: str = "",
+        api_group: str = "",
+        label_selector: str = "",
+        field_selector: str = "",
+    ) -> list[dict[str, Any]]:
+        """Objects of a resource type; all namespaces if none is given."""
+        found = []
+        for obj in self.objects:
+            metadata = obj.get("metadata", {})
+            group = str(obj.get("apiVersion", "")).rpartition("/")[0]
+            if not _kind_matches(resource_type, str(obj.get("kind", ""))):
+                continue
+            if namespace and metadata.get("namespace", namespace) != namespace:
+                continue
+            if api_group and group != api_group:
+                continue
+            labels = metadata.get("labels") or {}
+            if label_selector and not _selector_matches(labels, label_selector):
+                continue
+            if field_selector:
+                paths = [
+                    part.partition("=")[0].rstrip("!")
+                    for part in field_selector.split(",")
+                ]
+                fields = {path: _field(obj, path) for path in paths}
+                if not _selector_matches(fields, field_selector):
+                    continue
+            found.append(obj)
+        return found
+
+    def get(
+        self, resource_type: str, name: str, namespace: str = "", api_group: str = ""
+    ) -> dict[str, Any]:
+        """
+        An object by name.
+
+        Raises:
+            ToolError: There is no such object
+        """
+        for obj in self.find(resource_type, namespace, api_group):
+            if obj.get("metadata", {}).get("name") == name:
+                return obj
+        location = f" in namespace {namespace}" if namespace else ""
+        raise ToolError(f'{resource_type} "{name}" not found{location}')
+
+    def events_for(self, obj: dict[str, Any]) -> list[dict[str, Any]]:
+        """Events about an object."""
+        metadata = obj.get("metadata", {})
+        return [
+            event
+            for event in self.find("events", metadata.get("namespace", ""))
+            if event.get("involvedObject", {}).get("kind") == obj.get("kind")
+            and event.get("involvedObject", {}).get("name") == metadata.get("name")
+        ]
+
+
+def load_fixtures(path: Path) -> dict[str, FakeCluster]:
+    """
+    Load the fake clusters from a fixture file.
+
+    Raises:
+        ValueError: The file cannot be read or is not a valid fixture
+    """
+    try:
+        data = yaml.safe_load(path.read_text()) or {}
+    except (OSError, yaml.YAMLError) as e:
+        raise ValueError(f"Cannot read fake cluster fixtures {path}: {e}") from e
+    if not isinstance(data, dict):
+        raise ValueError(f"Fake cluster fixtures {path} must be a mapping")
+    clusters = {}
+    for name in CLUSTERS:
+        spec = data.get(name) or {}
+        objects = spec.get("objects") or []
+        logs = spec.get("logs") or {}
+        if not isinstance(objects, list) or not isinstance(logs, dict):
+            raise ValueError(f"{name} of {path} needs an objects list and logs map")
+        clusters[name] = FakeCluster(
+            [obj for obj in objects if isinstance(obj, dict)],
+            {str(key): str(text) for key, text in logs.items()},
+        )
+    return clusters
+
+
+def create_fake_server(cluster: FakeCluster) -> FastMCP:
+    """MCP server answering the read-only mcp-kubernetes tools from a cluster."""
+    server = FastMCP("fake-kubernetes")
+
+    # Arguments are named like those of mcp-kubernetes
+    @server.tool(name="get")
+    def get_resource(
+        resourceType: str, name: str, namespace: str = "", apiGroup: str = ""
+    ) -> str:
+        """Get a Kubernetes resource as JSON."""
+        obj = cluster.get(resourceType, name, namespace, apiGroup)
+        return json.dumps(obj, indent=2)
+
+    @server.tool(name="list")
+    def list_resources(
+        resourceType: str,
+        namespace: str = "",
+        allNamespaces: bool = False,
+        apiGroup: str = "",
+        labelSelector: str = "",
+        fieldSelector: str = "",
+        fullOutput: bool = False,
+    ) -> str:
+        """List Kubernetes resources, optionally filtered by selectors."""
+        items = cluster.find(
+            resourceType,
+            "" if allNamespaces else namespace,
+            apiGroup,
+            labelSelector,
+            fieldSelector,
+        )
+        if not fullOutput:
+            items = [
+                {key: value for key, value in item.items() if key != "spec"}
+                for item in items
+            ]
+        return json.dumps({"items": items}, indent=2)
+
+    @server.tool(name="describe")
+    def describe_resource(
+        resourceType: str, name: str, namespace: str = "", apiGroup: str = ""
+    ) -> str:
+        """Describe a Kubernetes resource with its events."""
+        obj = cluster.get(resourceType, name, namespace, apiGroup)
+        lines = [yaml.safe_dump(obj, sort_keys=False).rstrip(), "Events:"]
+        events = cluster.events_for(obj)
+        for event in events:
+            lines.append(
+                f"  {event.get('type', 'Normal')}  {event.get('reason', '')}  "
+                f"(x{event.get('count', 1)})  {event.get('message', '')}"
+            )
+        if not events:
+            lines.append("  <none>")
+        return "\n".join(lines)
+
+    @server.tool(name="logs")
+    def pod_logs(
+        name: str, namespace: str, container: str = "", tailLines: int = 0
+    ) -> str:
+        """Get the logs of a pod container."""
+        cluster.get("pods", name, namespace)
+        key = f"{namespace}/{name}"
+        text = cluster.logs.get(f"{key}/{container}" if container else key)
+        if text is None:
+            text = cluster.logs.get(key, "")
+        lines = text.splitlines()
+        return "\n".join(lines[-tailLines:] if tailLines > 0 else lines)
+
+    @server.tool(name="events")
+    def list_events(namespace: str = "", name: str = "", kind: str = "") -> str:
+        """List events, optionally only those about one object."""
+        events = [
+            event
+            for event in cluster.find("events", namespace)
+            if (not name or event.get("involvedObject", {}).get("name") == name)
+            and (not kind or event.get("involvedObject", {}).get("kind") == kind)
+        ]
+        return json.dumps({"items": events}, indent=2)
+
+    return server
+
+
+def main() -> None:
+    parser = argparse.ArgumentParser(description="Fake mcp-kubernetes server")
+    parser.add_argument("--cluster", choices=CLUSTERS, default="workload")
+    parser.add_argument("--fixtures", type=Path, default=DEFAULT_FIXTURES)
+    # Arguments meant for mcp-kubernetes (like impersonation) are ignored
+    args, _ = parser.parse_known_args()
+    try:
+        clusters = load_fixtures(args.fixtures)
+    except ValueError as e:
+        parser.exit(1, f"{e}\n")
+    create_fake_server(clusters[args.cluster]).run("stdio")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,95 @@
+"""
+Per-request model and generation overrides of the coordinator.
+
+Requests can choose the coordinator model, its maximum output tokens, and its
+reasoning effort, so urgent incidents can use the strongest model while
+routine checks use a cheap one:
+
+    {"query": "...", "model": "claude-opus-4-5", "reasoning_effort": "high"}
+
+Models must be the configured coordinator model or listed in
+SHOOT_ALLOWED_COORDINATOR_MODELS. Reasoning effort sets the extended thinking
+budget; without one, SHOOT_COORDINATOR_REASONING_EFFORT applies. Thinking
+counts against the output token limit, so the budget is kept below it.
+Sampling temperature is not configurable through the Agent SDK (and is not
+supported with extended thinking) and is refused.
+"""
+
+from typing import Any, Literal
+
+from pydantic import BaseModel, Field
+
+from config import get_settings
+
+ReasoningEffort = Literal["low", "medium", "high"]
+
+# Extended thinking budget (tokens) by reasoning effort
+THINKING_TOKENS = {"low": 4096, "medium": 16384, "high": 32768}
+# Smallest extended thinking budget the API accepts
+MIN_THINKING_TOKENS = 1024
+# Request keys of the overrides
+GENERATION_KEYS = ("model", "max_output_tokens", "reasoning_effort")
+
+
+class GenerationOverrides(BaseModel):
+    """Model and generation settings of one investigation's coordinator."""
+
+    model: str | None = Field(default=None, min_length=1)
+    max_output_tokens: int | None = Field(default=None, ge=1024, le=128000)
+    reasoning_effort: ReasoningEffort | None = None
+
+
+def thinking_budget(
+    reasoning_effort: ReasoningEffort | None, max_output_tokens: int
+) -> int | None:
+    """
+    Extended thinking budget of the coordinator.
+
+    Args:
+        reasoning_effort: Requested effort, or None for the configured default
+        max_output_tokens: Output token limit of the session (0: SDK default)
+
+    Returns:
+        The budget in tokens, or None if the coordinator does not think
+    """
+    if reasoning_effort is None:
+        default = get_settings().coordinator_reasoning_effort
+        if default == "off":
+            return None
+        reasoning_effort = default
+    budget = THINKING_TOKENS[reasoning_effort]
+    if max_output_tokens:
+        budget = min(budget, max_output_tokens - 1)
+    if budget < MIN_THINKING_TOKENS:
+        return None
+    return budget
+
+
+def allowed_coordinator_models() -> set[str]:
+    """Models requests may choose for the coordinator."""
+    settings = get_settings()
+    extra = settings.allowed_coordinator_models.split(",")
+    return {settings.coordinator_model, *(model.strip() for model in extra)} - {""}
+
+
+def parse_generation_overrides(data: dict[str, Any]) -> GenerationOverrides | None:
+    """
+    Read the generation overrides of a request body.
+
+    Returns:
+        The overrides, or None if the request sets none
+
+    Raises:
+        ValueError: An override is invalid, unsupported, or not allowed
+    """
+    if "temperature" in data:
+        raise ValueError("temperature is not supported by the coordinator backend")
+    requested = {key: data[key] for key in GENERATION_KEYS if key in data}
+    if not requested:
+        return None
+    overrides = GenerationOverrides.model_validate(requested)
+    if overrides.model and overrides.model not in allowed_coordinator_models():
+        raise ValueError(
+            f"model must be one of {', '.join(sorted(allowed_coordinator_models()))}"
+        )
+    return overrides
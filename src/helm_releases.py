@@ -0,0 +1,452 @@
+"""
+Deep inspection of Helm releases in the workload cluster.
+
+Helm keeps every revision of a release in a Secret
+(`sh.helm.release.v1.<release>.v<revision>`, labeled `owner=helm`) holding
+the gzipped release: chart metadata, the user-supplied values, the rendered
+manifest, and the outcome of the revision with Helm's description of it.
+"Why did the upgrade of app X fail" investigations need exactly that, so the
+helm collector gets three in-process tools that read the release Secrets
+through the workload cluster's mcp-kubernetes server and decode them:
+
+- `helm_release_history`: revisions with status, chart and app version, and
+  Helm's description (which carries the failure message)
+- `helm_release_values`: user-supplied values of a revision and their diff
+  to an earlier revision (by default the last successful one)
+- `helm_release_manifest`: rendered manifests of a revision, optionally
+  filtered by kind and name, diffed against an earlier revision or compared
+  field by field with the live objects
+
+Raw Secret data never reaches the model: only decoded fields are returned,
+and values and manifests are redacted like tool output (Secret data and
+credential-named fields) before they are diffed.
+"""
+
+import base64
+import difflib
+import gzip
+import json
+import zlib
+from typing import Any
+
+import yaml
+from claude_agent_sdk import tool
+from pydantic import BaseModel, Field
+
+from config import get_settings
+from mcp_kubernetes import (
+    call_mcp_tool,
+    connect_mcp_server,
+    get_wc_mcp_config,
+    list_result_items,
+)
+from redaction import Redactor, get_redaction_allowlist
+from telemetry import add_event
+
+_GZIP_MAGIC = b"\x1f\x8b\x08"
+# Revision statuses of successful releases
+_SUCCESSFUL_STATUSES = ("deployed", "superseded")
+# Live objects compared per call, and differences reported per object
+_MAX_LIVE_OBJECTS = 20
+_MAX_DIFFERENCES = 50
+
+
+class HelmRevision(BaseModel):
+    """One revision of a Helm release."""
+
+    revision: int
+    status: str = ""
+    chart: str = ""
+    chart_version: str = ""
+    app_version: str = ""
+    updated: str = ""
+    description: str = ""
+    values: dict[str, Any] = Field(default_factory=dict)
+    manifests: list[dict[str, Any]] = Field(default_factory=list)
+
+    def summary(self) -> dict[str, Any]:
+        """The revision without its values and manifests."""
+        return self.model_dump(exclude={"values", "manifests"})
+
+
+def decode_release(data: str) -> dict[str, Any]:
+    """
+    Decode the `release` field of a Helm release Secret.
+
+    The field is base64 (Secret data) of base64 (Helm) of gzipped JSON.
+
+    Raises:
+        ValueError: The field is not an encoded Helm release
+    """
+    try:
+        payload = base64.b64decode(base64.b64decode(data))
+        if payload.startswith(_GZIP_MAGIC):
+            payload = gzip.decompress(payload)
+        release = json.loads(payload)
+    except (ValueError, OSError, EOFError, zlib.error) as e:
+        raise ValueError(f"Not an encoded Helm release: {e}") from e
+    if not isinstance(release, dict):
+        raise ValueError("Not an encoded Helm release")
+    return release
+
+
+def _redact(value: Any) -> Any:
+    if not get_settings().redaction_enabled:
+        return value
+    return Redactor(get_redaction_allowlist()).redact_object(value)
+
+
+def revision_from_release(release: dict[str, Any]) -> HelmRevision:
+    """The revision of a decoded Helm release, with redacted values and manifests."""
+    chart = release.get("chart", {}).get("metadata", {})
+    info = release.get("info", {})
+    manifests = [
+        doc
+        for doc in yaml.safe_load_all(release.get("manifest") or "")
+        if isinstance(doc, dict)
+    ]
+    return HelmRevision(
+        revision=release.get("version", 0),
+        status=info.get("status", ""),
+        chart=chart.get("name", ""),
+        chart_version=chart.get("version", ""),
+        app_version=chart.get("appVersion", ""),
+        updated=info.get("last_deployed", ""),
+        description=info.get("description", ""),
+        values=_redact(release.get("config") or {}),
+        manifests=_redact(manifests),
+    )
+
+
+async def load_revisions(namespace: str, release: str) -> list[HelmRevision]:
+    """
+    Revisions of a Helm release, oldest first.
+
+    Raises:
+        ValueError: The release Secrets cannot be listed or decoded, or there
+            are none
+    """
+    async with connect_mcp_server(get_wc_mcp_config()) as session:
+        text = await call_mcp_tool(
+            session,
+            "list",
+            {
+                "resourceType": "secrets",
+                "namespace": namespace,
+                "labelSelector": f"owner=helm,name={release}",
+                "fullOutput": True,
+            },
+        )
+    revisions = []
+    for item in list_result_items(text):
+        data = item.get("data", {}).get("release")
+        if data:
+            revisions.append(revision_from_release(decode_release(data)))
+    if not revisions:
+        raise ValueError(f"No Helm release {release} in namespace {namespace}")
+    add_event("helm_release_loaded", {"revisions": len(revisions)})
+    return sorted(revisions, key=lambda r: r.revision)
+
+
+def select_revisions(
+    revisions: list[HelmRevision],
+    revision: int | None,
+    compare_to: int | None,
+) -> tuple[HelmRevision, HelmRevision | None]:
+    """
+    The inspected revision (default the latest) and the one it is compared
+    with (default the last successful revision before it, else the previous
+    one).
+
+    Raises:
+        ValueError: A requested revision does not exist
+    """
+    by_number = {r.revision: r for r in revisions}
+    if revision is None:
+        selected = revisions[-1]
+    elif revision in by_number:
+        selected = by_number[revision]
+    else:
+        raise ValueError(f"No revision {revision}; revisions: {sorted(by_number)}")
+    if compare_to is not None:
+        if compare_to not in by_number:
+            raise ValueError(
+                f"No revision {compare_to}; revisions: {sorted(by_number)}"
+            )
+        return selected, by_number[compare_to]
+    earlier = [r for r in revisions if r.revision < selected.revision]
+    successful = [r for r in earlier if r.status in _SUCCESSFUL_STATUSES]
+    if successful:
+        return selected, successful[-1]
+    return selected, earlier[-1] if earlier else None
+
+
+def _yaml(value: Any) -> str:
+    return yaml.safe_dump(value, sort_keys=True, default_flow_style=False)
+
+
+def unified_diff(old: str, new: str, old_name: str, new_name: str) -> str:
+    """Unified diff of two texts, empty if they are equal."""
+    return "".join(
+        difflib.unified_diff(
+            old.splitlines(keepends=True),
+            new.splitlines(keepends=True),
+            fromfile=old_name,
+            tofile=new_name,
+        )
+    )
+
+
+def filter_manifests(
+    manifests: list[dict[str, Any]], kind: str | None, name: str | None
+) -> list[dict[str, Any]]:
+    """Manifests of a kind (case-insensitive) and name, if given."""
+    return [
+        doc
+        for doc in manifests
+        if (not kind or str(doc.get("kind", "")).lower() == kind.lower())
+        and (not name or doc.get("metadata", {}).get("name") == name)
+    ]
+
+
+def live_differences(desired: Any, live: Any, path: str = "") -> list[str]:
+    """
+    Fields of a rendered manifest whose live value differs.
+
+    Only fields set in the manifest are compared, so defaults and status
+    added by the API server are ignored. Lists of named items (containers,
+    ports, env) are matched by name.
+    """
+    if isinstance(desired, dict):
+        if not isinstance(live, dict):
+            return [f"{path}: desired {desired!r}, live {live!r}"]
+        differences = []
+        for key, value in desired.items():
+            key_path = f"{path}.{key}" if path else str(key)
+            if key not in live:
+                differences.append(f"{key_path}: missing in live object")
+            else:
+                differences.extend(live_differences(value, live[key], key_path))
+        return differences
+    if (
+        isinstance(desired, list)
+        and isinstance(live, list)
+        and all(isinstance(item, dict) and "name" in item for item in desired)
+        and all(isinstance(item, dict) for item in live)
+    ):
+        live_by_name = {item.get("name"): item for item in live}
+        differences = []
+        for item in desired:
+            item_path = f"{path}[{item['name']}]"
+            if item["name"] not in live_by_name:
+                differences.append(f"{item_path}: missing in live object")
+            else:
+                differences.extend(
+                    live_differences(item, live_by_name[item["name"]], item_path)
+                )
+        return differences
+    if desired != live and str(desired) != str(live):
+        return [f"{path}: desired {desired!r}, live {live!r}"]
+    return []
+
+
+async def compare_with_live(
+    manifests: list[dict[str, Any]], namespace: str
+) -> list[dict[str, Any]]:
+    """Compare rendered manifests with their live objects."""
+    results = []
+    async with connect_mcp_server(get_wc_mcp_config()) as session:
+        for doc in manifests[:_MAX_LIVE_OBJECTS]:
+            kind = str(doc.get("kind", ""))
+            metadata = doc.get("metadata", {})
+            name = metadata.get("name", "")
+            group = str(doc.get("apiVersion", "")).rpartition("/")[0]
+            arguments = {
+                "resourceType": kind.lower(),
+                "namespace": metadata.get("namespace", namespace),
+                "name": name,
+            }
+            if group:
+                arguments["apiGroup"] = group
+            entry: dict[str, Any] = {"object": f"{kind}/{name}"}
+            try:
+                live = json.loads(await call_mcp_tool(session, "get", arguments))
+            except ValueError as e:
+                entry["live"] = f"not found or not readable: {e}"
+                results.append(entry)
+                continue
+            differences = live_differences(_strip_secret_data(doc), _redact(live))
+            entry["differences"] = differences[:_MAX_DIFFERENCES]
+            if len(differences) > _MAX_DIFFERENCES:
+                entry["more_differences"] = len(differences) - _MAX_DIFFERENCES
+            results.append(entry)
+    return results
+
+
+def _strip_secret_data(doc: dict[str, Any]) -> dict[str, Any]:
+    """Secret data is redacted on both sides, so it cannot be compared."""
+    if doc.get("kind") != "Secret":
+        return doc
+    return {k: v for k, v in doc.items() if k not in ("data", "stringData")}
+
+
+def _result(value: Any, is_error: bool = False) -> dict[str, Any]:
+    text = value if isinstance(value, str) else json.dumps(value, indent=2)
+    result: dict[str, Any] = {"content": [{"type": "text", "text": text}]}
+    if is_error:
+        result["is_error"] = True
+    return result
+
+
+def _optional_int(args: dict[str, Any], key: str) -> int | None:
+    value = args.get(key)
+    return None if value is None or value == "" else int(value)
+
+
+_RELEASE_PROPERTIES = {
+    "namespace": {
+        "type": "string",
+        "description": "Namespace of the release Secrets (the release namespace)",
+    },
+    "release": {"type": "string", "description": "Helm release name"},
+}
+_REVISION_PROPERTIES = {
+    "revision": {
+        "type": "integer",
+        "description": "Revision to inspect (default: the latest)",
+    },
+    "compare_to": {
+        "type": "integer",
+        "description": (
+            "Revision to diff against (default: the last successful revision "
+            "before it)"
+        ),
+    },
+}
+
+
+@tool(
+    "helm_release_history",
+    "Revision history of a Helm release in the workload cluster, from its "
+    "release Secrets: status, chart and app version, deployment time, and "
+    "Helm's description of each revision, which carries the error of failed "
+    "installs, upgrades, and rollbacks.",
+    {
+        "type": "object",
+        "properties": _RELEASE_PROPERTIES,
+        "required": ["namespace", "release"],
+    },
+)
+async def helm_release_history(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: revisions of a release, oldest first."""
+    try:
+        revisions = await load_revisions(args["namespace"], args["release"])
+    except Exception as e:
+        return _result(str(e), is_error=True)
+    return _result({"revisions": [r.summary() for r in revisions]})
+
+
+@tool(
+    "helm_release_values",
+    "User-supplied values of a Helm release revision in the workload cluster, "
+    "and a unified diff of them against an earlier revision (by default the "
+    "last successful one), to see which configuration change an upgrade "
+    "brought. Credentials are redacted.",
+    {
+        "type": "object",
+        "properties": {**_RELEASE_PROPERTIES, **_REVISION_PROPERTIES},
+        "required": ["namespace", "release"],
+    },
+)
+async def helm_release_values(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: values of a revision and their diff."""
+    try:
+        revisions = await load_revisions(args["namespace"], args["release"])
+        selected, earlier = select_revisions(
+            revisions,
+            _optional_int(args, "revision"),
+            _optional_int(args, "compare_to"),
+        )
+    except Exception as e:
+        return _result(str(e), is_error=True)
+    result: dict[str, Any] = {
+        "revision": selected.summary(),
+        "values": selected.values,
+    }
+    if earlier is not None:
+        result["compared_to"] = earlier.summary()
+        diff = unified_diff(
+            _yaml(earlier.values),
+            _yaml(selected.values),
+            f"values (revision {earlier.revision})",
+            f"values (revision {selected.revision})",
+        )
+        result["values_diff"] = diff or "No changes."
+    return _result(result)
+
+
+@tool(
+    "helm_release_manifest",
+    "Rendered manifests (the desired state) of a Helm release revision in the "
+    "workload cluster, optionally filtered by kind and name. With "
+    "`compare_to`, a unified diff against another revision's manifests. With "
+    "`live=true`, each manifest is compared with its live object instead, "
+    "listing fields whose live value differs or that are missing (at most 20 "
+    "objects; filter by kind and name). Quantities like CPU and memory may "
+    "differ in notation only.",
+    {
+        "type": "object",
+        "properties": {
+            **_RELEASE_PROPERTIES,
+            "revision": _REVISION_PROPERTIES["revision"],
+            "compare_to": {
+                "type": "integer",
+                "description": "Revision to diff the manifests against",
+            },
+            "kind": {"type": "string", "description": "Only manifests of this kind"},
+            "name": {"type": "string", "description": "Only manifests of this name"},
+            "live": {
+                "type": "boolean",
+                "description": "Compare the manifests with the live objects",
+            },
+        },
+        "required": ["namespace", "release"],
+    },
+)
+async def helm_release_manifest(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: manifests of a revision, their diff, or their live drift."""
+    namespace = args["namespace"]
+    kind, name = args.get("kind") or None, args.get("name") or None
+    try:
+        compare_to = _optional_int(args, "compare_to")
+        revisions = await load_revisions(namespace, args["release"])
+        selected, earlier = select_revisions(
+            revisions, _optional_int(args, "revision"), compare_to
+        )
+        manifests = filter_manifests(selected.manifests, kind, name)
+        result: dict[str, Any] = {"revision": selected.summary()}
+        if compare_to is not None and earlier is not None:
+            result["compared_to"] = earlier.summary()
+            diff = unified_diff(
+                yaml.safe_dump_all(filter_manifests(earlier.manifests, kind, name)),
+                yaml.safe_dump_all(manifests),
+                f"manifests (revision {earlier.revision})",
+                f"manifests (revision {selected.revision})",
+            )
+            result["manifest_diff"] = diff or "No changes."
+        elif args.get("live"):
+            result["live_comparison"] = await compare_with_live(manifests, namespace)
+            if len(manifests) > _MAX_LIVE_OBJECTS:
+                result["not_compared"] = len(manifests) - _MAX_LIVE_OBJECTS
+        else:
+            result["manifests"] = manifests
+    except Exception as e:
+        return _result(str(e), is_error=True)
+    return _result(result)
+
+
+HELM_TOOLS = {
+    "helm_release_history": helm_release_history,
+    "helm_release_values": helm_release_values,
+    "helm_release_manifest": helm_release_manifest,
+}
@@ -0,0 +1,205 @@
+"""
+Idempotency keys of investigation requests.
+
+Clients retrying `POST /` after a timeout or dropped connection, and webhooks
+delivered at least once, would otherwise start the same investigation again.
+A request with an `Idempotency-Key` header instead gets the response of the
+first request with that key:
+
+- while the first request runs, retries wait for it and get its response
+- once it completed, retries get its response and status code (202 for a
+  callback investigation), marked with `Idempotent-Replayed: true`, for
+  SHOOT_IDEMPOTENCY_TTL_SECONDS
+- if it failed, the next retry runs the investigation again
+- reusing a key with a different request body is refused (422)
+
+Replayed responses do not count against quotas or wait for the model
+provider. Keys are scoped to the caller's tenant and impersonated user, so
+callers cannot read each other's results, and kept in memory per replica.
+When the store is full, the oldest completed keys are evicted; keys whose
+request still runs are kept, so their waiters never start a duplicate run.
+"""
+
+import asyncio
+import hashlib
+import time
+from collections import OrderedDict
+from dataclasses import dataclass
+from functools import lru_cache
+from typing import Any, AsyncGenerator
+
+from fastapi import HTTPException, Request
+
+from app_logging import logger
+from config import get_settings
+from impersonation import impersonation_ctx
+from telemetry import add_event
+from tenancy import tenant_ctx
+
+IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+REPLAYED_HEADER = "Idempotent-Replayed"
+_MAX_KEY_LENGTH = 255
+
+
+@dataclass
+class StoredResponse:
+    """Response of a completed idempotent request."""
+
+    body: dict[str, Any]
+    status_code: int = 200
+
+
+class IdempotentReplay(Exception):
+    """A request repeats one that already completed; answer with its response."""
+
+    def __init__(self, response: StoredResponse) -> None:
+        super().__init__("Idempotent replay")
+        self.response = response
+
+
+@dataclass
+class _Entry:
+    fingerprint: str
+    created: float
+    outcome: asyncio.Future[StoredResponse | None]
+
+
+class IdempotencyReservation:
+    """The right of a request to run the investigation for its key."""
+
+    def __init__(self, store: "IdempotencyStore", key: str, entry: _Entry) -> None:
+        self._store = store
+        self._key = key
+        self._entry = entry
+
+    def complete(self, response: dict[str, Any], status_code: int = 200) -> None:
+        """Keep the response and its status code for retries of the request."""
+        if not self._entry.outcome.done():
+            self._entry.outcome.set_result(StoredResponse(response, status_code))
+
+    def release(self) -> None:
+        """Forget the key unless the request completed, so a retry runs again."""
+        if self._entry.outcome.done():
+            return
+        self._store.forget(self._key, self._entry)
+        self._entry.outcome.set_result(None)
+
+
+class IdempotencyStore:
+    """Bounded TTL store of the responses of idempotent requests."""
+
+    def __init__(self, ttl_seconds: int, max_entries: int) -> None:
+        self._ttl_seconds = ttl_seconds
+        self._max_entries = max_entries
+        self._entries: OrderedDict[str, _Entry] = OrderedDict()
+
+    def _get(self, key: str) -> _Entry | None:
+        entry = self._entries.get(key)
+        if entry is None:
+            return None
+        expired = time.monotonic() - entry.created > self._ttl_seconds
+        if expired and entry.outcome.done():
+            del self._entries[key]
+            return None
+        return entry
+
+    def _evict(self) -> None:
+        """Evict the oldest completed entries while over capacity."""
+        excess = len(self._entries) - self._max_entries
+        if excess <= 0:
+            return
+        # Running entries stay, or their waiters would run the request again
+        completed = [
+            key for key, entry in self._entries.items() if entry.outcome.done()
+        ]
+        for key in completed[:excess]:
+            del self._entries[key]
+
+    def forget(self, key: str, entry: _Entry) -> None:
+        """Remove the entry of a key, unless it was replaced."""
+        if self._entries.get(key) is entry:
+            del self._entries[key]
+
+    async def reserve(
+        self, key: str, fingerprint: str
+    ) -> IdempotencyReservation | StoredResponse:
+        """
+        Reserve a key for a request, or get the response of the request that
+        used it, waiting for it if it still runs.
+
+        Raises:
+            HTTPException: 422 if the key was used with a different request
+        """
+        while True:
+            entry = self._get(key)
+            if entry is None:
+                entry = _Entry(
+                    fingerprint=fingerprint,
+                    created=time.monotonic(),
+                    outcome=asyncio.get_running_loop().create_future(),
+                )
+                self._entries[key] = entry
+                self._evict()
+                return IdempotencyReservation(self, key, entry)
+            if entry.fingerprint != fingerprint:
+                raise HTTPException(
+                    status_code=422,
+                    detail=f"{IDEMPOTENCY_KEY_HEADER} was used with a different request",
+                )
+            response = await asyncio.shield(entry.outcome)
+            if response is not None:
+                return response
+            # The request failed; the first retry to get here runs it again
+
+
+@lru_cache()
+def get_idempotency_store() -> IdempotencyStore:
+    """Get the process-wide idempotency store."""
+    settings = get_settings()
+    return IdempotencyStore(
+        settings.idempotency_ttl_seconds, settings.idempotency_max_entries
+    )
+
+
+def _scoped_key(key: str) -> str:
+    """The key of the current caller, tenant, and impersonated user."""
+    identity = impersonation_ctx.get()
+    user = identity.user if identity is not None else ""
+    return f"{tenant_ctx.get() or ''}\n{user}\n{key}"
+
+
+async def check_idempotency_key(
+    request: Request,
+) -> AsyncGenerator[IdempotencyReservation | None, None]:
+    """
+    FastAPI dependency answering retries of an idempotent request.
+
+    Yields:
+        The reservation whose response the request completes, None without an
+        Idempotency-Key header
+
+    Raises:
+        IdempotentReplay: A request with the key already completed
+        HTTPException: 400 for an invalid key, 422 if the key was used with a
+            different request
+    """
+    key = request.headers.get(IDEMPOTENCY_KEY_HEADER)
+    if key is None or get_settings().idempotency_ttl_seconds == 0:
+        yield None
+        return
+    key = key.strip()
+    if not key or len(key) > _MAX_KEY_LENGTH:
+        raise HTTPException(
+            status_code=400,
+            detail=f"{IDEMPOTENCY_KEY_HEADER} must be 1 to {_MAX_KEY_LENGTH} characters",
+        )
+    fingerprint = hashlib.sha256(await request.body()).hexdigest()
+    outcome = await get_idempotency_store().reserve(_scoped_key(key), fingerprint)
+    if not isinstance(outcome, IdempotencyReservation):
+        logger.info(f"Replaying the response of idempotency key {key!r}")
+        add_event("idempotent_replay", {})
+        raise IdempotentReplay(outcome)
+    try:
+        yield outcome
+    finally:
+        outcome.release()
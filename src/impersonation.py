@@ -0,0 +1,249 @@
+"""
+Kubernetes impersonation of the engineer requesting an investigation.
+
+By default every investigation reads the clusters with shoot's own
+credentials. With SHOOT_IMPERSONATION_ENABLED, shoot runs behind an
+authenticating proxy (e.g. oauth2-proxy) that sets the caller's user and
+groups as request headers (SHOOT_IMPERSONATION_USER_HEADER,
+SHOOT_IMPERSONATION_GROUPS_HEADER), and the mcp-kubernetes servers of the
+request impersonate that identity, so the investigation only sees what the
+engineer is allowed to see:
+
+- the caller's user and groups are mapped to a Kubernetes user and groups,
+  with SHOOT_IMPERSONATION_USER_PREFIX and SHOOT_IMPERSONATION_GROUP_PREFIX
+  prepended (matching the OIDC prefixes of the API servers)
+- the servers are started as subprocesses of the request with a copy of
+  their kubeconfig (or, in-cluster, of the service account credentials)
+  whose users carry `as` and `as-groups`; remote endpoints
+  (MCP_KUBERNETES_*_URL) and the shared pool are not used, as they hold
+  shoot's own credentials
+- caches and similar earlier investigations are scoped to the identity
+
+shoot's credentials need the `impersonate` verb on users and groups. Requests
+without a user header are refused, except those with the admin token, which
+run with shoot's own access. The proxy must overwrite the headers, as shoot
+trusts them as they are. Impersonation cannot be combined with remote
+mcp-kubernetes endpoints (config.py), and the kubeconfig copies are removed
+on shutdown.
+"""
+
+import hashlib
+import os
+from contextvars import ContextVar
+from pathlib import Path
+from typing import Any, Mapping
+
+import yaml
+from fastapi import HTTPException, Request
+from pydantic import BaseModel, Field
+
+from app_logging import audit
+from auth import is_admin_token
+from config import get_settings
+from private_files import PrivateDirectory
+
+# Credentials of the service account, for servers started with --in-cluster
+_SERVICE_ACCOUNT_DIR = "/var/run/secrets/kubernetes.io/serviceaccount"
+_IN_CLUSTER_ARG = "--in-cluster"
+# Kubeconfig fields holding paths, resolved relative to the kubeconfig file
+_PATH_FIELDS = (
+    "certificate-authority",
+    "client-certificate",
+    "client-key",
+    "tokenFile",
+)
+# Kubeconfig copies of impersonated servers
+_KUBECONFIGS = PrivateDirectory("shoot-impersonation-")
+
+
+class ImpersonationError(Exception):
+    """The kubeconfig of an impersonated server cannot be written."""
+
+
+class Impersonation(BaseModel):
+    """Kubernetes identity the mcp-kubernetes servers of a request act as."""
+
+    user: str
+    groups: list[str] = Field(default_factory=list)
+
+
+# Identity impersonated by the current request, None for shoot's own
+impersonation_ctx: ContextVar[Impersonation | None] = ContextVar(
+    "impersonation", default=None
+)
+
+
+def identity_from_headers(headers: Mapping[str, str]) -> Impersonation | None:
+    """The Kubernetes identity of a caller, None without a user header."""
+    settings = get_settings()
+    user = (headers.get(settings.impersonation_user_header) or "").strip()
+    if not user:
+        return None
+    groups = headers.get(settings.impersonation_groups_header) or ""
+    return Impersonation(
+        user=f"{settings.impersonation_user_prefix}{user}",
+        groups=[
+            f"{settings.impersonation_group_prefix}{group.strip()}"
+            for group in groups.split(",")
+            if group.strip()
+        ],
+    )
+
+
+def enter_impersonation(headers: Mapping[str, str]) -> str | None:
+    """
+    Adopt the caller's identity of a request for the current context.
+
+    Returns:
+        None if the request may run, otherwise why it is refused
+    """
+    if not get_settings().impersonation_enabled:
+        return None
+    identity = identity_from_headers(headers)
+    if identity is None:
+        if is_admin_token(headers.get("authorization")):
+            return None
+        return "Caller identity required: the request has no user header"
+    impersonation_ctx.set(identity)
+    audit("impersonation", user=identity.user, groups=identity.groups)
+    return None
+
+
+async def check_caller_identity(request: Request) -> None:
+    """
+    FastAPI dependency impersonating the caller of an investigation.
+
+    Raises:
+        HTTPException: 401 if impersonation is enabled and the caller is unknown
+    """
+    refusal = enter_impersonation(request.headers)
+    if refusal is not None:
+        raise HTTPException(status_code=401, detail=refusal)
+    identity = impersonation_ctx.get()
+    # For the access log
+    request.state.user = identity.user if identity is not None else None
+
+
+def impersonation_scope() -> str:
+    """Suffix scoping cache keys to the impersonated identity, if any."""
+    identity = impersonation_ctx.get()
+    if identity is None:
+        return ""
+    return f" as {identity.user} ({','.join(sorted(identity.groups))})"
+
+
+def _in_cluster_kubeconfig() -> dict[str, Any]:
+    """Kubeconfig equivalent to the in-cluster service account credentials."""
+    host = os.environ.get("KUBERNETES_SERVICE_HOST", "")
+    port = os.environ.get("KUBERNETES_SERVICE_PORT", "443")
+    if not host:
+        raise ImpersonationError("Not running in a cluster")
+    if ":" in host:
+        host = f"[{host}]"
+    return {
+        "apiVersion": "v1",
+        "kind": "Config",
+        "clusters": [
+            {
+                "name": "in-cluster",
+                "cluster": {
+                    "server": f"https://{host}:{port}",
+                    "certificate-authority": f"{_SERVICE_ACCOUNT_DIR}/ca.crt",
+                },
+            }
+        ],
+        "users": [
+            {
+                "name": "in-cluster",
+                "user": {"tokenFile": f"{_SERVICE_ACCOUNT_DIR}/token"},
+            }
+        ],
+        "contexts": [
+            {
+                "name": "in-cluster",
+                "context": {"cluster": "in-cluster", "user": "in-cluster"},
+            }
+        ],
+        "current-context": "in-cluster",
+    }
+
+
+def _load_kubeconfig(path: str) -> dict[str, Any]:
+    """A kubeconfig file, with relative paths made absolute."""
+    try:
+        kubeconfig = yaml.safe_load(Path(path).read_text())
+    except (OSError, yaml.YAMLError) as e:
+        raise ImpersonationError(f"Cannot read kubeconfig {path}: {e}") from e
+    if not isinstance(kubeconfig, dict):
+        raise ImpersonationError(f"Kubeconfig {path} is invalid")
+    base = Path(path).resolve().parent
+    for section, key in (("clusters", "cluster"), ("users", "user")):
+        for entry in kubeconfig.get(section) or []:
+            fields = entry.get(key) or {}
+            for field in _PATH_FIELDS:
+                if fields.get(field) and not Path(fields[field]).is_absolute():
+                    fields[field] = str(base / fields[field])
+    return kubeconfig
+
+
+def remove_impersonated_kubeconfigs() -> None:
+    """Remove the kubeconfig copies written for impersonated servers."""
+    _KUBECONFIGS.remove()
+
+
+def impersonated_kubeconfig(kubeconfig: str | None, identity: Impersonation) -> str:
+    """
+    Write a copy of a kubeconfig whose users impersonate an identity.
+
+    Args:
+        kubeconfig: Path of the kubeconfig, None for the in-cluster credentials
+        identity: User and groups to impersonate
+
+    Returns:
+        Path of the copy; identical copies share a file
+
+    Raises:
+        ImpersonationError: The kubeconfig cannot be read
+    """
+    config = _load_kubeconfig(kubeconfig) if kubeconfig else _in_cluster_kubeconfig()
+    for entry in config.get("users") or []:
+        user = entry.setdefault("user", {})
+        user["as"] = identity.user
+        user["as-groups"] = list(identity.groups)
+    content = yaml.safe_dump(config, sort_keys=False)
+    digest = hashlib.sha256(content.encode()).hexdigest()[:16]
+    name = f"{digest}.kubeconfig"
+    path = _KUBECONFIGS.path / name
+    if not path.exists():
+        return _KUBECONFIGS.write(name, content)
+    return str(path)
+
+
+def impersonate_process(
+    args: list[str], env: dict[str, str]
+) -> tuple[list[str], dict[str, str]]:
+    """
+    Arguments and environment of an mcp-kubernetes subprocess acting as the
+    identity of the current request, unchanged without one.
+
+    Raises:
+        ImpersonationError: The kubeconfig cannot be read
+    """
+    identity = impersonation_ctx.get()
+    if identity is None:
+        return args, env
+    in_cluster = _IN_CLUSTER_ARG in args
+    kubeconfig = None if in_cluster else env.get("KUBECONFIG") or None
+    if kubeconfig is None and not in_cluster:
+        raise ImpersonationError("No kubeconfig to impersonate with")
+    path = impersonated_kubeconfig(kubeconfig, identity)
+    return (
+        [arg for arg in args if arg != _IN_CLUSTER_ARG],
+        {**env, "KUBECONFIG": path},
+    )
+
+
+def impersonate_stdio_config(config: dict[str, Any]) -> dict[str, Any]:
+    """An mcp-kubernetes subprocess configuration acting as the caller."""
+    args, env = impersonate_process(list(config.get("args", [])), config.get("env", {}))
+    return {**config, "args": args, "env": env}
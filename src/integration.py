@@ -0,0 +1,274 @@
+"""
+Integration test harness against a real Kubernetes API server.
+
+Creates a kind cluster (or uses the cluster of --kubeconfig, such as an
+envtest API server), seeds it with broken workloads
+(`integration/workloads.yaml`), and runs scenario investigations end to end:
+the model is scripted (scripted_model.py), but the collectors are the real
+ones, calling the real mcp-kubernetes servers over MCP against the cluster,
+which serves as both workload and management cluster. This verifies the tool
+plumbing, MCP transport, and report assembly that evaluate.py and the
+scripted backend replace with recorded responses. A scenario is a YAML file
+with a failure description, the model script of its investigation, and its
+expectations:
+
+    name: image-pull
+    query: Deployment api in namespace integration-shop is not ready
+    model:                          # model script, without tool_calls
+      responses:
+        - tool_uses: [{name: Task, input: {subagent_type: wc_collector, ...}}]
+        - when: wc_collector
+          tool_uses: [{name: mcp__kubernetes_wc__list, input: {...}}]
+      default: ...
+    expect:
+      tool_output: [registry.invalid]  # must all appear in the tool results
+      keywords: [registry.invalid]     # must all appear in the report
+      forbidden: []                    # must not appear in the report
+      structured: true                 # the report must be parseable
+
+    python integration.py ../integration/scenarios [--kubeconfig FILE]
+        [--keep] [--settle-seconds N] [--filter TEXT] [--json]
+
+Needs kind (unless --kubeconfig is given), kubectl, and the mcp-kubernetes
+binary (MCP_KUBERNETES_PATH), but no API key. envtest runs no kubelet, so
+scenarios expecting pod states need kind. The kind cluster is deleted
+afterwards unless --keep is given. Prints one line per scenario (or a JSON
+object) and exits with status 1 if any scenario fails.
+"""
+
+import argparse
+import asyncio
+import json
+import os
+import subprocess  # nosec B404
+import sys
+import tempfile
+import time
+from pathlib import Path
+from typing import Any
+
+import yaml
+from pydantic import BaseModel, Field, ValidationError
+
+from collectors import validate_mcp_binary
+from config import get_settings
+from coordinator import run_coordinator
+from evaluate import Expectations, check_keywords
+from schemas import parse_report
+from scripted_model import ModelScript, ScriptedModel
+from traffic_recording import TrafficSession
+
+DEFAULT_WORKLOADS = Path(__file__).parent.parent / "integration" / "workloads.yaml"
+_CLUSTER_NAME = "shoot-integration"
+_KIND_WAIT = "180s"
+
+
+class IntegrationExpectations(Expectations):
+    """What a scenario's tool results and report must contain."""
+
+    tool_output: list[str] = Field(
+        default_factory=list, description="Text the cluster's tool results must hold"
+    )
+    structured: bool = Field(
+        default=False, description="The report must parse as a structured report"
+    )
+
+
+class IntegrationScenario(BaseModel):
+    """A scripted investigation against the integration cluster."""
+
+    name: str = Field(..., min_length=1)
+    query: str = Field(..., min_length=1)
+    model: ModelScript
+    expect: IntegrationExpectations = Field(default_factory=IntegrationExpectations)
+
+
+def load_scenarios(directory: Path) -> list[IntegrationScenario]:
+    """
+    Load the scenarios of a suite, sorted by file name.
+
+    Raises:
+        ValueError: A file is not a valid scenario
+    """
+    scenarios = []
+    for path in sorted([*directory.glob("*.yaml"), *directory.glob("*.yml")]):
+        try:
+            scenario = IntegrationScenario.model_validate(
+                yaml.safe_load(path.read_text())
+            )
+        except (OSError, yaml.YAMLError, ValidationError) as e:
+            raise ValueError(f"Invalid scenario {path}: {e}") from e
+        if scenario.model.tool_calls:
+            raise ValueError(f"Scenario {path} must not record tool calls")
+        scenarios.append(scenario)
+    return scenarios
+
+
+def _run(*args: str) -> None:
+    """Run a command, failing with its output."""
+    process = subprocess.run(  # nosec B603
+        args, capture_output=True, text=True, check=False
+    )
+    if process.returncode != 0:
+        raise RuntimeError(f"{' '.join(args)} failed: {process.stderr.strip()}")
+
+
+def create_kind_cluster(name: str, kubeconfig: Path) -> None:
+    """Create a kind cluster writing its kubeconfig to a file."""
+    print(f"Creating kind cluster {name}...", file=sys.stderr)
+    _run(
+        "kind",
+        "create",
+        "cluster",
+        "--name",
+        name,
+        "--kubeconfig",
+        str(kubeconfig),
+        "--wait",
+        _KIND_WAIT,
+    )
+
+
+def delete_kind_cluster(name: str) -> None:
+    """Delete a kind cluster, logging failures."""
+    try:
+        _run("kind", "delete", "cluster", "--name", name)
+    except (OSError, RuntimeError) as e:
+        print(f"Could not delete kind cluster {name}: {e}", file=sys.stderr)
+
+
+def seed_workloads(kubeconfig: Path, workloads: Path, settle_seconds: int) -> None:
+    """Apply the broken workloads and give them time to fail."""
+    _run("kubectl", "--kubeconfig", str(kubeconfig), "apply", "-f", str(workloads))
+    print(f"Waiting {settle_seconds}s for the workloads to fail...", file=sys.stderr)
+    time.sleep(settle_seconds)
+
+
+def use_cluster(kubeconfig: Path) -> None:
+    """Point the built-in MCP servers of both clusters at the test cluster."""
+    os.environ["KUBECONFIG"] = str(kubeconfig)
+    os.environ["MC_KUBECONFIG"] = str(kubeconfig)
+    # Not remote or fake servers
+    os.environ["MCP_KUBERNETES_WC_URL"] = ""
+    os.environ["MCP_KUBERNETES_MC_URL"] = ""
+    os.environ["SHOOT_FAKE_CLUSTER"] = "false"
+    get_settings.cache_clear()
+
+
+def check_tool_output(outputs: str, expect: IntegrationExpectations) -> list[str]:
+    """Failed tool output expectations."""
+    return [
+        f"missing tool output: {text}"
+        for text in expect.tool_output
+        if text not in outputs
+    ]
+
+
+async def run_scenario(scenario: IntegrationScenario) -> dict[str, Any]:
+    """Run a scenario's investigation against the cluster and check it."""
+    try:
+        async with TrafficSession(ScriptedModel(scenario.model)) as traffic:
+            result = await run_coordinator(
+                scenario.query, use_collector_cache=False, verify=False, traffic=traffic
+            )
+    except Exception as e:
+        return {"name": scenario.name, "passed": False, "failures": [str(e)]}
+
+    tool_outputs = [
+        text
+        for name, text in (result["artifacts"] or {}).items()
+        if name.startswith("tool-output-")
+    ]
+    outputs = "\n".join(tool_outputs)
+    failures = check_tool_output(outputs, scenario.expect)
+    failures.extend(check_keywords(result["result"], scenario.expect))
+    if scenario.expect.structured and parse_report(result["result"]) is None:
+        failures.append("report is not a parseable structured report")
+    return {
+        "name": scenario.name,
+        "duration_ms": result["duration_ms"],
+        "num_turns": result["num_turns"],
+        "tool_outputs": len(tool_outputs),
+        "passed": not failures,
+        "failures": failures,
+    }
+
+
+async def run_suite(scenarios: list[IntegrationScenario]) -> list[dict[str, Any]]:
+    """Run scenarios one after another."""
+    return [await run_scenario(scenario) for scenario in scenarios]
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description="Run integration scenarios")
+    parser.add_argument("suite", type=Path, help="directory of scenario files")
+    parser.add_argument(
+        "--kubeconfig",
+        type=Path,
+        help="use this cluster (e.g. envtest) instead of creating a kind cluster",
+    )
+    parser.add_argument(
+        "--workloads",
+        type=Path,
+        default=DEFAULT_WORKLOADS,
+        help="manifests of the broken workloads to seed",
+    )
+    parser.add_argument(
+        "--keep",
+        action="store_true",
+        help=f"keep the kind cluster afterwards (kind get kubeconfig --name "
+        f"{_CLUSTER_NAME})",
+    )
+    parser.add_argument(
+        "--settle-seconds",
+        type=int,
+        default=60,
+        help="time for the seeded workloads to fail",
+    )
+    parser.add_argument(
+        "--filter", default="", help="only run scenarios whose name contains this"
+    )
+    parser.add_argument("--json", action="store_true", help="print results as JSON")
+    args = parser.parse_args()
+
+    try:
+        scenarios = [
+            scenario
+            for scenario in load_scenarios(args.suite)
+            if args.filter in scenario.name
+        ]
+    except ValueError as e:
+        print(e, file=sys.stderr)
+        return 1
+    valid, error = validate_mcp_binary()
+    if not valid:
+        print(error, file=sys.stderr)
+        return 1
+
+    with tempfile.TemporaryDirectory() as directory:
+        kubeconfig = args.kubeconfig or Path(directory) / "kubeconfig"
+        try:
+            if args.kubeconfig is None:
+                create_kind_cluster(_CLUSTER_NAME, kubeconfig)
+            seed_workloads(kubeconfig, args.workloads, args.settle_seconds)
+            use_cluster(kubeconfig)
+            results = asyncio.run(run_suite(scenarios))
+        except (OSError, RuntimeError) as e:
+            print(f"Integration setup failed: {e}", file=sys.stderr)
+            return 1
+        finally:
+            if args.kubeconfig is None and not args.keep:
+                delete_kind_cluster(_CLUSTER_NAME)
+
+    if args.json:
+        print(json.dumps(results, indent=2))
+    else:
+        for result in results:
+            status = "PASS" if result["passed"] else "FAIL"
+            detail = f": {'; '.join(result['failures'])}" if result["failures"] else ""
+            print(f"{status} {result['name']}{detail}")
+    return 0 if all(result["passed"] for result in results) else 1
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -0,0 +1,167 @@
+"""
+Release manifest comparison for component inventories.
+
+The inventory collector lists the images and Helm chart versions running in
+the workload cluster, grouped by namespace and app, and calls the in-process
+`compare_release_manifest` tool. The tool compares the inventory against the
+expected release manifest of the installation (SHOOT_RELEASE_MANIFEST) and
+returns a drift report, answering "is this cluster running what we think it
+runs".
+
+Manifest format (YAML):
+
+    apps:
+      - name: cilium
+        namespace: kube-system
+        chart_version: 1.15.6
+        images:
+          - quay.io/cilium/cilium:v1.15.6
+"""
+
+import json
+from functools import lru_cache
+from pathlib import Path
+from typing import Any
+
+import yaml
+from claude_agent_sdk import tool
+from pydantic import BaseModel, Field, ValidationError
+
+from config import get_settings
+
+
+class AppComponents(BaseModel):
+    """Images and chart version of one app."""
+
+    name: str
+    namespace: str
+    chart: str | None = None
+    chart_version: str | None = None
+    images: list[str] = Field(default_factory=list)
+
+
+class ReleaseManifest(BaseModel):
+    """Apps an installation is expected to run."""
+
+    apps: list[AppComponents] = Field(default_factory=list)
+
+
+@lru_cache()
+def load_release_manifest() -> ReleaseManifest | None:
+    """
+    Load the release manifest configured by SHOOT_RELEASE_MANIFEST.
+
+    Returns None if no manifest is configured.
+
+    Raises:
+        ValueError: The manifest cannot be read or is invalid
+    """
+    path = get_settings().release_manifest
+    if not path:
+        return None
+    try:
+        return ReleaseManifest.model_validate(
+            yaml.safe_load(Path(path).read_text()) or {}
+        )
+    except (OSError, yaml.YAMLError, ValidationError) as e:
+        raise ValueError(f"Invalid release manifest {path}: {e}") from e
+
+
+def drift_report(
+    inventory: list[AppComponents], manifest: ReleaseManifest
+) -> dict[str, Any]:
+    """
+    Compare an inventory against the expected release manifest.
+
+    Returns a report grouped by namespace with apps that are missing, run a
+    different chart version, or run unexpected or miss expected images, plus
+    apps that run but are not in the manifest.
+    """
+    running = {(app.namespace, app.name): app for app in inventory}
+    namespaces: dict[str, dict[str, list[Any]]] = {}
+
+    def section(namespace: str) -> dict[str, list[Any]]:
+        return namespaces.setdefault(
+            namespace, {"missing": [], "drifted": [], "unmanaged": []}
+        )
+
+    matching = 0
+    for expected in manifest.apps:
+        actual = running.pop((expected.namespace, expected.name), None)
+        if actual is None:
+            section(expected.namespace)["missing"].append(expected.name)
+            continue
+
+        differences: dict[str, Any] = {}
+        if expected.chart_version and actual.chart_version != expected.chart_version:
+            differences["chart_version"] = {
+                "expected": expected.chart_version,
+                "actual": actual.chart_version,
+            }
+        if expected.images:
+            missing_images = sorted(set(expected.images) - set(actual.images))
+            unexpected_images = sorted(set(actual.images) - set(expected.images))
+            if missing_images:
+                differences["missing_images"] = missing_images
+            if unexpected_images:
+                differences["unexpected_images"] = unexpected_images
+        if differences:
+            section(expected.namespace)["drifted"].append(
+                {"app": expected.name, **differences}
+            )
+        else:
+            matching += 1
+
+    # Whatever is left runs in the cluster but is not part of the release
+    for (namespace, name), app in sorted(running.items()):
+        section(namespace)["unmanaged"].append(
+            {"app": name, "chart_version": app.chart_version, "images": app.images}
+        )
+
+    return {
+        "matching_apps": matching,
+        "namespaces": {
+            namespace: {key: value for key, value in entries.items() if value}
+            for namespace, entries in sorted(namespaces.items())
+        },
+    }
+
+
+@tool(
+    "compare_release_manifest",
+    "Compare the workload cluster component inventory (images and chart versions "
+    "per namespace/app) against the expected release manifest and return a drift report.",
+    {
+        "type": "object",
+        "properties": {
+            "inventory": {
+                "type": "array",
+                "items": {
+                    "type": "object",
+                    "properties": {
+                        "name": {"type": "string"},
+                        "namespace": {"type": "string"},
+                        "chart": {"type": "string"},
+                        "chart_version": {"type": "string"},
+                        "images": {"type": "array", "items": {"type": "string"}},
+                    },
+                    "required": ["name", "namespace"],
+                },
+            }
+        },
+        "required": ["inventory"],
+    },
+)
+async def compare_release_manifest(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: drift report of the given inventory."""
+    try:
+        manifest = load_release_manifest()
+        inventory = [AppComponents(**app) for app in args.get("inventory", [])]
+    except (ValueError, TypeError) as e:
+        return {"content": [{"type": "text", "text": str(e)}], "is_error": True}
+
+    if manifest is None:
+        text = "No release manifest is configured; report the inventory only."
+    else:
+        text = json.dumps(drift_report(inventory, manifest), indent=2)
+    return {"content": [{"type": "text", "text": text}]}
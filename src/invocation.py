@@ -0,0 +1,98 @@
+"""
+Loop detection for recursive invocations of shoot.
+
+When shoot is reachable as a tool of another agent (over MCP or A2A), an
+investigation can end up calling shoot again, directly or through other
+agents. Every instance appends its ID to an invocation chain that is
+propagated to the MCP servers it starts or connects to (as an HTTP header or
+an environment variable for stdio servers); requests whose chain already
+holds SHOOT_MAX_INVOCATION_DEPTH shoot hops are refused.
+"""
+
+from contextvars import ContextVar
+from typing import Any
+
+from fastapi import Header, HTTPException
+
+from app_logging import logger
+from config import get_settings
+
+INVOCATION_CHAIN_HEADER = "X-Shoot-Invocation-Chain"
+# Environment variable carrying the chain to stdio MCP servers
+INVOCATION_CHAIN_ENV = "SHOOT_INVOCATION_CHAIN"
+
+# Chain of shoot instances that led to the current request, outermost first
+invocation_chain_ctx: ContextVar[tuple[str, ...]] = ContextVar(
+    "invocation_chain", default=()
+)
+
+
+def parse_invocation_chain(value: str | None) -> tuple[str, ...]:
+    """Parse a comma-separated invocation chain header."""
+    if not value:
+        return ()
+    return tuple(hop.strip() for hop in value.split(",") if hop.strip())
+
+
+def check_invocation_chain(
+    x_shoot_invocation_chain: str | None = Header(default=None),
+) -> None:
+    """
+    FastAPI dependency refusing requests that recurse too deeply into shoot.
+
+    Raises:
+        HTTPException: 508 if the chain already holds the maximum number of
+            shoot hops
+    """
+    chain = parse_invocation_chain(x_shoot_invocation_chain)
+    if not enter_invocation_chain(chain):
+        raise HTTPException(
+            status_code=508,
+            detail={
+                "error": "Recursive invocation depth exceeded",
+                "max_invocation_depth": get_settings().max_invocation_depth,
+                "invocation_chain": list(chain),
+            },
+        )
+
+
+def enter_invocation_chain(chain: tuple[str, ...]) -> bool:
+    """
+    Adopt the invocation chain of a request for the current context.
+
+    Returns:
+        False if the chain already holds the maximum number of shoot hops
+    """
+    settings = get_settings()
+    if len(chain) >= settings.max_invocation_depth:
+        logger.warning(f"Refusing recursive invocation, chain: {' -> '.join(chain)}")
+        return False
+    if settings.instance_id in chain:
+        logger.warning(f"Serving request that already passed this instance: {chain}")
+    invocation_chain_ctx.set(chain)
+    return True
+
+
+def outgoing_invocation_chain() -> str:
+    """The chain to propagate downstream: the current chain plus this instance."""
+    chain = (*invocation_chain_ctx.get(), get_settings().instance_id)
+    return ",".join(chain)
+
+
+def propagate_invocation_chain(
+    server_configs: dict[str, dict[str, Any]],
+) -> dict[str, dict[str, Any]]:
+    """Add the outgoing invocation chain to MCP server configs."""
+    chain = outgoing_invocation_chain()
+    propagated: dict[str, dict[str, Any]] = {}
+    for name, config in server_configs.items():
+        if config.get("type") == "sdk":
+            # In-process servers never call out
+            propagated[name] = config
+        elif config.get("type") in ("sse", "http"):
+            headers = {**config.get("headers", {}), INVOCATION_CHAIN_HEADER: chain}
+            propagated[name] = {**config, "headers": headers}
+        else:
+            env = {**config.get("env", {}), INVOCATION_CHAIN_ENV: chain}
+            propagated[name] = {**config, "env": env}
+    return propagated
@@ -0,0 +1,234 @@
+"""
+Jira issues for investigations with findings.
+
+With SHOOT_JIRA_URL and SHOOT_JIRA_PROJECT set, every investigation whose
+triage severity (triage.py, SHOOT_TRIAGE_ENABLED) is at least
+SHOOT_JIRA_MIN_SEVERITY gets a Jira issue once it is kept:
+
+- issues are keyed by cluster and affected component with the label
+  `shoot-<cluster>-<component>`, or `shoot-<tenant>.<cluster>-<component>`
+  for a tenant's investigations (tenancy.py); while such an issue is open,
+  later investigations of the same component comment on it instead of
+  opening another one, so tenants never add to each other's issues
+- the issue holds the structured report (failure signal, findings, likely
+  cause, next steps) or, if the report is not parseable, the report text,
+  with the affected resources named in the report, the triage labels, and the
+  investigation ID
+
+Issues are filed in the background through the Jira REST API (v2) with
+SHOOT_JIRA_USER and SHOOT_JIRA_API_TOKEN; failures are logged and do not
+affect the investigation.
+"""
+
+import re
+from functools import lru_cache
+from typing import Any
+
+import httpx
+
+from app_logging import audit, logger
+from background import spawn_background
+from config import get_settings
+from report_validation import extract_references
+from store import InvestigationRecord
+from telemetry import add_event
+
+# Severities that can open issues, least severe first
+_SEVERITY_ORDER = ("degraded", "critical")
+_REQUEST_TIMEOUT_SECONDS = 30
+# Jira limits text fields to 32767 characters
+_MAX_REPORT_CHARS = 30000
+_MAX_RESOURCES = 30
+_LABEL_PATTERN = re.compile(r"[^a-z0-9.-]+")
+_VERSION_PATTERN = re.compile(r"v?\d+\.\d+\.\d+")
+# Ends a {noformat} block, wherever it appears in the report
+_NOFORMAT_PATTERN = re.compile(r"\{noformat\}", re.IGNORECASE)
+
+
+def jira_enabled() -> bool:
+    """Whether investigations are filed as Jira issues."""
+    settings = get_settings()
+    return bool(settings.jira_url and settings.jira_project)
+
+
+def files_issue(record: InvestigationRecord) -> bool:
+    """Whether an investigation's severity calls for a Jira issue."""
+    severity = record.triage["severity"] if record.triage else None
+    if severity not in _SEVERITY_ORDER:
+        return False
+    minimum = _SEVERITY_ORDER.index(get_settings().jira_min_severity)
+    return _SEVERITY_ORDER.index(severity) >= minimum
+
+
+def issue_label(record: InvestigationRecord) -> str:
+    """Label identifying the issue of a cluster's component."""
+    component = record.triage.get("component", "unknown") if record.triage else ""
+    tenant = f"{record.tenant}." if record.tenant else ""
+    value = f"shoot-{tenant}{record.cluster or 'cluster'}-{component or 'unknown'}"
+    # Jira labels cannot contain spaces
+    return _LABEL_PATTERN.sub("-", value.lower()).strip("-")
+
+
+def affected_resources(record: InvestigationRecord) -> list[str]:
+    """Resources the report names, without those the validation flagged."""
+    unverified = set((record.validation or {}).get("unverified") or [])
+    references: set[str] = set()
+    for line in record.result.splitlines():
+        references.update(extract_references(line))
+    resources = sorted(
+        reference
+        for reference in references - unverified
+        if not _VERSION_PATTERN.fullmatch(reference)
+    )
+    return resources[:_MAX_RESOURCES]
+
+
+def _bullets(items: list[str]) -> str:
+    return "\n".join(f"* {item}" for item in items)
+
+
+def issue_description(record: InvestigationRecord) -> str:
+    """Issue text (Jira wiki markup) of an investigation."""
+    sections = []
+    report = record.structured
+    if report:
+        sections += [
+            f"h3. Failure signal\n{report['failure_signal']}",
+            f"h3. Findings\n{_bullets(report['summary'])}",
+            f"h3. Likely cause\n{_bullets(report['likely_cause'])}",
+            f"h3. Recommended next steps\n{_bullets(report['recommended_next_steps'])}",
+        ]
+    else:
+        # The report must not end the block early
+        text = _NOFORMAT_PATTERN.sub("{ noformat}", record.result[:_MAX_REPORT_CHARS])
+        sections.append(f"h3. Report\n{{noformat}}\n{text}\n{{noformat}}")
+    resources = affected_resources(record)
+    if resources:
+        sections.append(
+            "h3. Affected resources\n"
+            + _bullets([f"{{{{{resource}}}}}" for resource in resources])
+        )
+    triage = record.triage or {}
+    facts = [
+        f"Cluster: {record.cluster or '-'}",
+        f"Severity: {triage.get('severity', '-')}",
+        f"Component: {triage.get('component', '-')}",
+        f"Cause category: {triage.get('cause_category', '-')}",
+        f"Investigation: {record.id}",
+    ]
+    if record.namespaces:
+        facts.insert(1, f"Namespaces: {', '.join(record.namespaces)}")
+    if record.tenant:
+        facts.insert(0, f"Tenant: {record.tenant}")
+    sections.append(f"h3. Investigation\n{_bullets(facts)}")
+    return "\n\n".join(sections)
+
+
+def issue_summary(record: InvestigationRecord) -> str:
+    """Issue title of an investigation."""
+    severity = record.triage["severity"] if record.triage else "finding"
+    signal = record.structured["failure_signal"] if record.structured else None
+    text = " ".join((signal or record.query).split())
+    return f"[shoot] {severity} in {record.cluster or 'cluster'}: {text}"[:250]
+
+
+class JiraClient:
+    """Minimal client of the Jira REST API (v2)."""
+
+    def __init__(self, url: str, user: str, api_token: str) -> None:
+        self._url = url.rstrip("/")
+        self._auth = (user, api_token) if user else None
+        self._headers = {} if user else {"Authorization": f"Bearer {api_token}"}
+
+    async def _request(
+        self, method: str, path: str, json: dict[str, Any]
+    ) -> dict[str, Any]:
+        async with httpx.AsyncClient(
+            timeout=_REQUEST_TIMEOUT_SECONDS, auth=self._auth, headers=self._headers
+        ) as client:
+            response = await client.request(
+                method, f"{self._url}/rest/api/2{path}", json=json
+            )
+            response.raise_for_status()
+            return response.json() if response.content else {}
+
+    async def find_open_issue(self, project: str, label: str) -> str | None:
+        """Key of an unresolved issue of a project with a label, if any."""
+        jql = (
+            f'project = "{project}" AND labels = "{label}" '
+            "AND statusCategory != Done ORDER BY created DESC"
+        )
+        found = await self._request(
+            "POST", "/search", {"jql": jql, "maxResults": 1, "fields": ["key"]}
+        )
+        issues = found.get("issues") or []
+        return issues[0]["key"] if issues else None
+
+    async def create_issue(self, fields: dict[str, Any]) -> str:
+        """Create an issue and return its key."""
+        created = await self._request("POST", "/issue", {"fields": fields})
+        return str(created["key"])
+
+    async def add_comment(self, key: str, body: str) -> None:
+        """Comment on an issue."""
+        await self._request("POST", f"/issue/{key}/comment", {"body": body})
+
+
+@lru_cache()
+def get_jira_client() -> JiraClient:
+    """Get the Jira client of the configured instance."""
+    settings = get_settings()
+    return JiraClient(settings.jira_url, settings.jira_user, settings.jira_api_token)
+
+
+async def file_issue(record: InvestigationRecord) -> str:
+    """
+    Create the Jira issue of an investigation, or comment on the open one of
+    its component.
+
+    Returns:
+        Key of the issue
+    """
+    settings = get_settings()
+    client = get_jira_client()
+    label = issue_label(record)
+    description = issue_description(record)
+    key = await client.find_open_issue(settings.jira_project, label)
+    if key is not None:
+        await client.add_comment(
+            key, f"Investigated again ({record.id}):\n\n{description}"
+        )
+        audit("jira_issue_updated", investigation_id=record.id, issue=key)
+        return key
+    labels = [
+        label.strip() for label in settings.jira_labels.split(",") if label.strip()
+    ]
+    key = await client.create_issue(
+        {
+            "project": {"key": settings.jira_project},
+            "issuetype": {"name": settings.jira_issue_type},
+            "summary": issue_summary(record),
+            "description": description,
+            "labels": [*labels, label],
+        }
+    )
+    audit("jira_issue_created", investigation_id=record.id, issue=key)
+    return key
+
+
+async def _file_issue_logged(record: InvestigationRecord) -> None:
+    try:
+        key = await file_issue(record)
+    except (httpx.HTTPError, KeyError, ValueError) as e:
+        logger.warning(f"Jira issue of investigation {record.id} failed: {e!r}")
+        add_event("jira_issue_failed", {})
+        return
+    logger.info(f"Investigation {record.id} filed as Jira issue {key}")
+    add_event("jira_issue_filed", {"issue": key})
+
+
+def file_jira_issue(record: InvestigationRecord) -> None:
+    """File a Jira issue for an investigation in the background, if it calls for one."""
+    if not jira_enabled() or not files_issue(record):
+        return
+    spawn_background(_file_issue_logged(record))
@@ -0,0 +1,131 @@
+"""
+Read-through cache for Kubernetes get/list calls made by collectors.
+
+During alert storms many concurrent investigations inspect the same
+namespaces. Collector `get` and `list` calls on the mcp-kubernetes servers are
+cached for a short TTL, keyed by MCP server (cluster) and the canonical call
+arguments (resource kind/API group, namespace, name, and selectors). The cache
+is process-wide, so it is shared by all investigations of the same clusters.
+
+Like the collector result cache, it is implemented with tool hooks on the
+coordinator session, which also fire for collector subagent tool calls:
+PostToolUse stores the text of a call's result, and PreToolUse denies a call
+whose result is cached and hands the cached result back as the deny reason.
+Calls the tool policy refuses for leaving the investigation's namespaces are
+never answered from the cache, whose keys are also scoped to the namespaces.
+Results over the tool output limit (output_limit.py) are not cached, so they
+are always shortened by the tool output hook.
+Results are redacted and scanned for prompt injections (injection_scan.py)
+before they are stored, as the deny reason bypasses the tool output hook.
+"""
+
+import json
+from functools import lru_cache
+from typing import Any
+
+from claude_agent_sdk import HookContext, HookMatcher
+
+from app_logging import logger
+from collector_cache import CacheKey, TTLResultCache, tool_response_text
+from config import get_settings, get_wc_cluster
+from impersonation import impersonation_scope
+from injection_scan import neutralize_injections
+from namespace_scope import namespace_scope_ctx, namespace_scope_key
+from output_limit import exceeds_output_limit
+from redaction import redact_tool_output
+from telemetry import add_event
+from tool_policy import namespace_violation
+
+# Read calls whose results are cached; logs, events, and describe output are
+# left out as they change quickly or are large
+_CACHED_TOOLS_MATCHER = r"mcp__kubernetes_(wc|mc)__(get|list)"
+
+
+@lru_cache()
+def get_k8s_read_cache() -> TTLResultCache:
+    """Get the process-wide Kubernetes read cache."""
+    settings = get_settings()
+    return TTLResultCache(
+        settings.k8s_read_cache_ttl_seconds, settings.k8s_read_cache_max_entries
+    )
+
+
+def read_cache_key(tool_name: str, tool_input: dict[str, Any]) -> CacheKey:
+    """
+    Build the cache key for a Kubernetes read call.
+
+    The tool name carries the MCP server (cluster) and verb; the arguments
+    are serialized with sorted keys so equivalent calls share an entry. The
+    workload cluster server is qualified with the targeted cluster, as
+    requests may target different clusters, and both servers with the
+    impersonated identity and the namespace restriction, as callers may see
+    different objects.
+    """
+    _, server, verb = tool_name.split("__", 2)
+    if server == "kubernetes_wc":
+        server = f"{server}/{get_wc_cluster()}"
+    server = f"{server}{impersonation_scope()}{namespace_scope_key()}"
+    return (server, verb, json.dumps(tool_input, sort_keys=True, default=str))
+
+
+async def _serve_cached_read(
+    input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+) -> dict[str, Any]:
+    """PreToolUse hook: answer a get/list call from the cache if possible."""
+    tool_name = input_data.get("tool_name", "")
+    tool_input = input_data.get("tool_input", {})
+    namespaces = namespace_scope_ctx.get()
+    if namespaces is not None and namespace_violation(
+        tool_name, tool_input, namespaces
+    ):
+        # The tool policy refuses the call; the cache must not answer it
+        return {}
+    key = read_cache_key(tool_name, tool_input)
+    cached = get_k8s_read_cache().get(key)
+    if cached is None:
+        return {}
+
+    age, result = cached
+    logger.debug(f"Serving cached {key[1]} on {key[0]} (age {age:.0f}s)")
+    add_event("k8s_read_cache_hit", {"server": key[0], "verb": key[1]})
+    return {
+        "hookSpecificOutput": {
+            "hookEventName": "PreToolUse",
+            "permissionDecision": "deny",
+            "permissionDecisionReason": (
+                f"Not re-run: identical {key[1]} call was answered {age:.0f}s ago. "
+                f"Use this cached result as the tool output:\n\n{result}"
+            ),
+        }
+    }
+
+
+async def _store_read(
+    input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+) -> dict[str, Any]:
+    """PostToolUse hook: cache the text returned by a get/list call."""
+    result = tool_response_text(input_data.get("tool_response"))
+    if result and not exceeds_output_limit(result):
+        # Cached results are handed to the model as-is, so store them redacted
+        # and scanned
+        settings = get_settings()
+        if settings.redaction_enabled:
+            result, _ = redact_tool_output(result)
+        result, _ = neutralize_injections(result, settings.injection_scan)
+        key = read_cache_key(
+            input_data.get("tool_name", ""), input_data.get("tool_input", {})
+        )
+        get_k8s_read_cache().put(key, result)
+    return {}
+
+
+def create_k8s_read_cache_hooks() -> dict[str, list[HookMatcher]]:
+    """Create session hooks that cache collector Kubernetes get/list results."""
+    return {
+        "PreToolUse": [
+            HookMatcher(matcher=_CACHED_TOOLS_MATCHER, hooks=[_serve_cached_read])  # type: ignore[list-item]
+        ],
+        "PostToolUse": [
+            HookMatcher(matcher=_CACHED_TOOLS_MATCHER, hooks=[_store_read])  # type: ignore[list-item]
+        ],
+    }
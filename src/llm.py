@@ -0,0 +1,166 @@
+"""
+Single-request calls of the Anthropic Messages API.
+
+The critic, report writer, patch and alert rule suggesters, triage
+classifier, planner, session and tool output summarizers, and the
+evaluation judge have no tools: each makes one Messages API request. They
+share the request, its token usage, the user message of those checking a
+report against collector evidence, and the parsing of JSON answers here.
+
+The Messages API reports tokens, not cost, so the cost of a request is
+estimated from list prices per model family, the most expensive family for
+unknown models. It is charged to the tenant right away (tenant_quotas.py)
+and added to the sidecar costs of the investigation the request belongs to,
+which its total_cost_usd and cost ceiling include.
+"""
+
+import json
+import re
+from contextvars import ContextVar
+from dataclasses import dataclass
+from typing import Any, TypeVar
+
+from anthropic import AsyncAnthropic
+from pydantic import BaseModel, ValidationError
+
+from secret_files import get_secret
+from tenant_quotas import charge_tenant
+
+# USD per million input and output tokens, by model family
+_PRICES_PER_MTOK = {
+    "haiku": (1.0, 5.0),
+    "sonnet": (3.0, 15.0),
+    "opus": (15.0, 75.0),
+}
+_DEFAULT_PRICES = _PRICES_PER_MTOK["opus"]
+_JSON_OBJECT_PATTERN = re.compile(r"\{.*\}", re.DOTALL)
+# Evidence from a single collector call is truncated to this many characters
+_MAX_EVIDENCE_CHARS = 20000
+
+ModelT = TypeVar("ModelT", bound=BaseModel)
+
+
+class SidecarCosts:
+    """Cost of the Messages API requests made for one investigation."""
+
+    def __init__(self) -> None:
+        self.cost_usd = 0.0
+        self.calls = 0
+
+
+# Sidecar costs of the current investigation, None outside of one
+sidecar_costs_ctx: ContextVar[SidecarCosts | None] = ContextVar(
+    "sidecar_costs", default=None
+)
+
+
+def track_sidecar_costs() -> SidecarCosts:
+    """Start adding up the sidecar costs of an investigation in this context."""
+    costs = SidecarCosts()
+    sidecar_costs_ctx.set(costs)
+    return costs
+
+
+def sidecar_cost_usd() -> float:
+    """Sidecar costs of the current investigation so far."""
+    costs = sidecar_costs_ctx.get()
+    return costs.cost_usd if costs is not None else 0.0
+
+
+def estimate_cost_usd(model: str, input_tokens: int, output_tokens: int) -> float:
+    """Cost of a request at the list prices of its model family."""
+    input_price, output_price = next(
+        (prices for family, prices in _PRICES_PER_MTOK.items() if family in model),
+        _DEFAULT_PRICES,
+    )
+    return (input_tokens * input_price + output_tokens * output_price) / 1_000_000
+
+
+@dataclass
+class Completion:
+    """Answer of a single Messages API request."""
+
+    # Text blocks, joined
+    text: str
+    # Content blocks, for tool use
+    content: list[Any]
+    stop_reason: str | None
+    # input_tokens, output_tokens, and the estimated cost_usd
+    usage: dict[str, Any]
+
+
+async def complete(
+    model: str,
+    system: str,
+    content: str,
+    max_tokens: int,
+    **kwargs: Any,
+) -> Completion:
+    """
+    Send one user message and return the answer, counting its cost.
+
+    Keyword arguments (tools, tool_choice) are passed to messages.create.
+
+    Raises:
+        anthropic.APIError: The request failed
+    """
+    client = AsyncAnthropic(api_key=get_secret("anthropic_api_key") or None)
+    message = await client.messages.create(
+        model=model,
+        max_tokens=max_tokens,
+        system=system,
+        messages=[{"role": "user", "content": content}],
+        **kwargs,
+    )
+    input_tokens = message.usage.input_tokens
+    output_tokens = message.usage.output_tokens
+    cost_usd = estimate_cost_usd(model, input_tokens, output_tokens)
+    charge_tenant(cost_usd)
+    costs = sidecar_costs_ctx.get()
+    if costs is not None:
+        costs.cost_usd += cost_usd
+        costs.calls += 1
+    return Completion(
+        text="".join(block.text for block in message.content if block.type == "text"),
+        content=list(message.content),
+        stop_reason=message.stop_reason,
+        usage={
+            "input_tokens": input_tokens,
+            "output_tokens": output_tokens,
+            "cost_usd": round(cost_usd, 6),
+        },
+    )
+
+
+def format_report_input(
+    query: str, report_heading: str, report: str, evidence: list[tuple[str, str]]
+) -> str:
+    """
+    Build a user message with the failure description, a report, and the
+    collector evidence (collector, text) it is based on.
+    """
+    sections = [f"## Failure description\n{query}", f"## {report_heading}\n{report}"]
+    if evidence:
+        for index, (collector, text) in enumerate(evidence, start=1):
+            if len(text) > _MAX_EVIDENCE_CHARS:
+                text = text[:_MAX_EVIDENCE_CHARS] + "\n[... truncated]"
+            sections.append(f"## Evidence {index} (from {collector})\n{text}")
+    else:
+        sections.append("## Evidence\nNo collector evidence was gathered.")
+    return "\n\n".join(sections)
+
+
+def parse_json_answer(text: str, model: type[ModelT]) -> ModelT | None:
+    """
+    Parse a JSON object answer into a model, tolerating surrounding prose or
+    fences.
+
+    Returns None if there is no object or it does not match the model.
+    """
+    match = _JSON_OBJECT_PATTERN.search(text)
+    if not match:
+        return None
+    try:
+        return model(**json.loads(match.group(0)))
+    except (json.JSONDecodeError, ValidationError, TypeError):
+        return None
@@ -0,0 +1,124 @@
+"""
+Budget-aware sampling of collector log output.
+
+Naive head/tail dumps of container logs either miss the error or flood the
+collector's context. The output of every `logs` call on the mcp-kubernetes
+servers is replaced with a sample (see tool_output.py):
+
+- error lines first, with their stack traces attached, de-duplicated by a
+  signature that ignores timestamps, numbers, and IDs, with repeat counts;
+- the most recent other lines filling the remaining space;
+- at most SHOOT_LOG_SAMPLE_MAX_LINES lines per call (one container).
+
+The sample size also shrinks with the investigation's remaining log token
+budget (SHOOT_LOG_SAMPLE_TOKEN_BUDGET), so many log calls cannot exhaust the
+context between them.
+"""
+
+import re
+from typing import Any, Callable
+
+from telemetry import add_event
+
+# Tools whose output is sampled
+LOGS_TOOLS_PATTERN = re.compile(r"mcp__kubernetes_(wc|mc)__logs")
+
+_ERROR_PATTERN = re.compile(
+    r"\b(error|err|exception|fatal|panic|fail(ed|ure)?|traceback|critical|"
+    r"level=(error|fatal)|oomkilled|crashloop)\b",
+    re.IGNORECASE,
+)
+# Continuation lines of a stack trace (indented, or Java/Python/Go frames)
+_STACK_PATTERN = re.compile(
+    r"^(\s+|at |Caused by:|File \"|goroutine \d+|\.\.\. \d+ more)"
+)
+# Variable parts ignored when comparing errors
+_VARIABLE_PATTERN = re.compile(
+    r"\d{4}-\d{2}-\d{2}[T ][\d:.,]+Z?|0x[0-9a-f]+|[0-9a-f]{8,}|\d+", re.IGNORECASE
+)
+
+# Rough size of a log line in tokens, for budget-aware sizing
+_TOKENS_PER_LINE = 30
+# Never sample below this many lines while there is any budget left
+_MIN_SAMPLE_LINES = 20
+
+
+def error_signature(line: str) -> str:
+    """Signature of an error line, ignoring timestamps, numbers, and IDs."""
+    return _VARIABLE_PATTERN.sub("#", line).strip()
+
+
+def sample_log_lines(lines: list[str], max_lines: int) -> list[str]:
+    """
+    Sample log lines: distinct errors with stack traces first, then recent lines.
+
+    Repeated errors are kept once, annotated with their number of occurrences.
+    """
+    if len(lines) <= max_lines:
+        return lines
+
+    # Group error lines with the stack trace lines following them
+    errors: dict[str, list[Any]] = {}  # signature -> [count, block]
+    error_indexes: set[int] = set()
+    index = 0
+    while index < len(lines):
+        if not _ERROR_PATTERN.search(lines[index]):
+            index += 1
+            continue
+        start = index
+        index += 1
+        while index < len(lines) and _STACK_PATTERN.match(lines[index]):
+            index += 1
+        block = lines[start:index]
+        error_indexes.update(range(start, index))
+        entry = errors.setdefault(error_signature(block[0]), [0, block])
+        entry[0] += 1
+
+    sample: list[str] = []
+    for count, block in errors.values():
+        space = max_lines - len(sample)
+        if space <= 0:
+            break
+        suffix = f"  [repeated {count}x]" if count > 1 else ""
+        # Long stack traces are cut rather than dropped
+        sample.extend([block[0] + suffix, *block[1:]][:space])
+
+    # Fill up with the most recent non-error lines
+    remaining = max_lines - len(sample)
+    recent = [line for i, line in enumerate(lines) if i not in error_indexes]
+    if remaining > 0 and recent:
+        sample.append("--- most recent lines ---")
+        sample.extend(recent[-(remaining - 1) :] if remaining > 1 else [])
+    return sample
+
+
+def create_log_sampler(token_budget: int, max_lines: int) -> Callable[[str], str]:
+    """
+    Create a sampler for the logs output of one investigation.
+
+    The token budget is shared by all logs calls of the investigation.
+    """
+    state = {"remaining_tokens": token_budget}
+
+    def sample(text: str) -> str:
+        lines = text.splitlines()
+        budget_lines = state["remaining_tokens"] // _TOKENS_PER_LINE
+        limit = max(min(max_lines, budget_lines), min(_MIN_SAMPLE_LINES, len(lines)))
+        sampled = sample_log_lines(lines, limit)
+        state["remaining_tokens"] = max(
+            0, state["remaining_tokens"] - len(sampled) * _TOKENS_PER_LINE
+        )
+        if len(sampled) == len(lines):
+            return text
+
+        add_event(
+            "log_sample",
+            {"lines": len(lines), "sampled": len(sampled), "limit": limit},
+        )
+        header = (
+            f"[log sample] {len(sampled)} of {len(lines)} lines: distinct errors "
+            "with stack traces first (repeats counted), then the most recent lines."
+        )
+        return "\n".join([header, *sampled])
+
+    return sample
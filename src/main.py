@@ -12,25 +12,130 @@ Architecture:
 """
 
 import asyncio
+import contextlib
+import json
+import re
 import uuid
 from contextvars import ContextVar
-from typing import Any, AsyncGenerator
+from pathlib import Path
+from typing import Any, AsyncGenerator, AsyncIterator
 
-from fastapi import FastAPI, HTTPException, Request
-from fastapi.responses import StreamingResponse
+from fastapi import Depends, FastAPI, HTTPException, Query, Request
+from fastapi.responses import (
+    FileResponse,
+    HTMLResponse,
+    JSONResponse,
+    PlainTextResponse,
+    Response,
+    StreamingResponse,
+)
+import jinja2
 
-from app_logging import logger
-from collectors import get_mcp_configs_valid, run_preflight_checks
-from config import get_settings
+from access_log import enable_access_log
+from a2a import agent_card, handle_a2a_request
+from activity import get_activity_tracker, register_activity_metrics
+from app_logging import audit, get_log_level, logger, set_log_level
+from approvals import get_approval_queue
+from auth import is_admin_token, require_admin
+from background import drain_background_tasks
+from baseline import baselines_enabled, get_baseline_store
+from baseline_capture import capture_and_store_baseline, run_baseline_capture
+from callbacks import start_callback_investigation, validate_callback_url
+from circuit_breaker import (
+    admit_model_circuit,
+    check_model_circuit,
+    get_circuit_breaker,
+)
+from cluster_kubeconfig import (
+    CLUSTER_NAME_PATTERN,
+    ClusterUnavailableError,
+    get_kubeconfig_cache,
+)
+from cluster_provider import run_provider_detection
+from cluster_target import cluster_target_ctx
+from teleport_access import login_wc_cluster, run_teleport_login, teleport_enabled
+from collectors import (
+    create_agent_definitions,
+    describe_collectors,
+    get_mcp_configs_valid,
+    run_preflight_checks,
+)
+from compare import compare_investigations, normalize_text
+from config import ReportFormat, get_prompt_version, get_settings, sanitized_settings
+from cost_export import export_investigation_cost, get_cost_exporter
+from dependency_checks import get_dependency_checker
+from backend import get_backend
+from claude_cli import CliTimeoutError
 from coordinator import (
-    run_coordinator,
-    run_coordinator_streaming,
-    is_coordinator_ready,
     get_structured_report,
     InvestigationResult,
+    StalledStreamError,
+    UnsupportedOptionError,
+)
+from generation import GenerationOverrides, parse_generation_overrides
+from idempotency import (
+    REPLAYED_HEADER,
+    IdempotencyReservation,
+    IdempotentReplay,
+    check_idempotency_key,
+)
+from impersonation import (
+    ImpersonationError,
+    check_caller_identity,
+    remove_impersonated_kubeconfigs,
+)
+from invocation import INVOCATION_CHAIN_HEADER, check_invocation_chain
+from jira_issues import file_jira_issue
+from mcp_health import (
+    McpServerUnavailableError,
+    close_open_sessions,
+    get_mcp_health_tracker,
 )
+from mcp_kubernetes import get_poolable_mcp_configs
+from mcp_pool import get_mcp_server_pool
+from mcp_server import get_mcp_server
+from namespace_scope import namespace_scope_ctx
+from patch_suggestions import PATCH_ARTIFACT_PREFIX
+from planning import check_plan, estimate_cost, plan_investigation
+from progress import ProgressEvent, server_sent_event
+from prompt_reload import reload_prompt_templates, watch_prompts
+from query_policy import QueryPolicyViolation, check_query
+from quality import QUALITY_DIMENSIONS, aggregate_quality, record_feedback_metric
+from replay import get_replay, start_replay
+from report_html import render_report_html
+from report_markdown import REPORT_ARTIFACT
+from runbooks import runbooks_enabled, warm_runbook_index
+from runtime_debug import (
+    check_debug_endpoints,
+    heap_profile,
+    runtime_stats,
+    start_memory_tracing,
+    task_stacks,
+    thread_stacks,
+)
+from similar_investigations import with_similar_investigations
+from startup import get_startup_progress, run_startup
 from schemas import DIAGNOSTIC_REPORT_SCHEMA
-from telemetry import get_tracer, trace_operation
+from store import (
+    Feedback,
+    InvestigationRecord,
+    get_investigation_store,
+    instructions_digest,
+    record_from_result,
+    record_summary,
+)
+from teams import handle_teams_message, teams_enabled, verify_teams_signature
+from telemetry import add_event, get_tracer, set_span_attribute, trace_operation
+from tenancy import (
+    check_tenant,
+    get_tenant_registry,
+    tenant_cluster_refusal,
+    tenant_ctx,
+    tenant_namespaces,
+    visible_to_caller,
+)
+from tenant_quotas import check_tenant_quota, quota_status, settle_reservation
+from triage import record_triage_metric
 
 # Initialize telemetry on module load
 get_tracer()
@@ -38,61 +143,592 @@ get_tracer()
 # Request ID context variable for tracking
 request_id_ctx: ContextVar[str] = ContextVar("request_id", default="")
 
+# Upper bound for a single per-request collector instruction override
+MAX_COLLECTOR_INSTRUCTIONS_LENGTH = 20000
+# Upper bound for the requested report language name
+MAX_LANGUAGE_LENGTH = 50
+# Upper bound for per-request coordinator instructions
+MAX_INSTRUCTIONS_LENGTH = 2000
+# Session IDs returned by earlier investigations (UUIDs)
+SESSION_ID_PATTERN = re.compile(r"[A-Za-z0-9-]{1,100}")
+
+
+@contextlib.asynccontextmanager
+async def lifespan(app: FastAPI) -> AsyncIterator[None]:
+    """
+    Run background tasks for the lifetime of the app.
+
+    Registers the activity metrics, runs the periodic cost export, Teleport
+    logins, the pooled MCP servers, infrastructure provider detection,
+    baseline capture, the prompts watcher, runbook indexing, and shoot's own
+    MCP server if enabled, and the startup steps reported by /startup, and on
+    shutdown lets callback investigations finish and closes open coordinator
+    sessions together with their MCP server processes and the fetched
+    kubeconfigs.
+    """
+    register_activity_metrics()
+    start_memory_tracing()
+
+    mcp_sessions = contextlib.AsyncExitStack()
+    if get_settings().mcp_server_enabled:
+        await mcp_sessions.enter_async_context(get_mcp_server().session_manager.run())
+
+    teleport_task: asyncio.Task[None] | None = None
+    if teleport_enabled():
+        # The workload cluster MCP servers need the kubeconfig when they start
+        await login_wc_cluster()
+        teleport_task = asyncio.create_task(
+            run_teleport_login(get_settings().teleport_login_interval_seconds)
+        )
+
+    pool_task: asyncio.Task[None] | None = None
+    pool = get_mcp_server_pool()
+    if pool is not None:
+        for name, config in get_poolable_mcp_configs().items():
+            pool.add(name, config)
+        try:
+            await pool.start()
+        except RuntimeError as e:
+            # Retried by the health checks; sessions fail until then
+            logger.error(f"Failed to start pooled MCP servers: {e}")
+        pool_task = asyncio.create_task(
+            pool.run(get_settings().mcp_pool_health_interval_seconds)
+        )
+
+    # Runs after the pool started, so the MCP handshake reaches pooled servers
+    startup_task = asyncio.create_task(run_startup())
+
+    provider_task: asyncio.Task[None] | None = None
+    settings = get_settings()
+    if settings.cluster_provider_detection and not settings.cluster_provider:
+        # Investigations started before detection finishes use generic guidance
+        provider_task = asyncio.create_task(run_provider_detection())
+
+    export_task: asyncio.Task[None] | None = None
+    exporter = get_cost_exporter()
+    if exporter is not None:
+        interval = get_settings().cost_export_interval_seconds
+        logger.info(f"Cost export enabled, every {interval}s")
+        export_task = asyncio.create_task(exporter.run(interval))
+
+    runbooks_task: asyncio.Task[None] | None = None
+    if runbooks_enabled():
+        # Cloning and indexing must not delay startup
+        runbooks_task = asyncio.create_task(asyncio.to_thread(warm_runbook_index))
+
+    baseline_task: asyncio.Task[None] | None = None
+    if baselines_enabled():
+        baseline_interval = get_settings().baseline_interval_seconds
+        logger.info(f"Baseline capture enabled, every {baseline_interval}s")
+        baseline_task = asyncio.create_task(run_baseline_capture(baseline_interval))
+
+    watch_task: asyncio.Task[None] | None = None
+    watch_interval = get_settings().prompts_watch_interval_seconds
+    if watch_interval:
+        watch_task = asyncio.create_task(watch_prompts(watch_interval))
+    try:
+        yield
+    finally:
+        # Before their coordinator sessions are closed
+        await drain_background_tasks()
+        await mcp_sessions.aclose()
+        startup_task.cancel()
+        with contextlib.suppress(asyncio.CancelledError):
+            await startup_task
+        if watch_task is not None:
+            watch_task.cancel()
+            with contextlib.suppress(asyncio.CancelledError):
+                await watch_task
+        await close_open_sessions()
+        # After the MCP servers started with them are closed
+        get_kubeconfig_cache().clear()
+        remove_impersonated_kubeconfigs()
+        if baseline_task is not None:
+            baseline_task.cancel()
+            with contextlib.suppress(asyncio.CancelledError):
+                await baseline_task
+        if runbooks_task is not None:
+            runbooks_task.cancel()
+        if teleport_task is not None:
+            teleport_task.cancel()
+            with contextlib.suppress(asyncio.CancelledError):
+                await teleport_task
+        if provider_task is not None:
+            provider_task.cancel()
+            with contextlib.suppress(asyncio.CancelledError):
+                await provider_task
+        if pool is not None and pool_task is not None:
+            pool_task.cancel()
+            with contextlib.suppress(asyncio.CancelledError):
+                await pool_task
+            await pool.stop()
+        if export_task is not None:
+            # Cancelling triggers a final flush of pending records
+            export_task.cancel()
+            with contextlib.suppress(asyncio.CancelledError):
+                await export_task
+
+
 # Configure HTTP endpoint
 app = FastAPI(
     title="Shoot API",
     description="A Kubernetes debugging agent powered by Claude",
     version="2.12.0",
+    lifespan=lifespan,
 )
 
+if get_settings().access_log_enabled:
+    enable_access_log(app)
+if get_settings().mcp_server_enabled:
+    app.mount("/mcp", get_mcp_server().streamable_http_app())
+
+
+@app.exception_handler(IdempotentReplay)
+async def replay_idempotent_response(
+    request: Request, exc: IdempotentReplay
+) -> JSONResponse:
+    """Answer a retry of an idempotent request with the original response."""
+    return JSONResponse(
+        exc.response.body,
+        status_code=exc.response.status_code,
+        headers={REPLAYED_HEADER: "true"},
+    )
+
+
+def get_session_id(data: dict[str, Any]) -> str | None:
+    """Validate the session ID of a follow-up query."""
+    session_id = data.get("session_id")
+    if session_id is not None and (
+        not isinstance(session_id, str) or not SESSION_ID_PATTERN.fullmatch(session_id)
+    ):
+        raise HTTPException(
+            status_code=400,
+            detail="session_id must be a session ID returned by an earlier investigation",
+        )
+    return session_id
+
+
+def get_report_options(
+    data: dict[str, Any],
+) -> tuple[str | None, ReportFormat | None]:
+    """Validate the report language and format requested for the report writer."""
+    language = data.get("language")
+    if language is not None and (
+        not isinstance(language, str)
+        or not language.strip()
+        or len(language) > MAX_LANGUAGE_LENGTH
+    ):
+        raise HTTPException(
+            status_code=400,
+            detail=f"language must be a non-empty string of at most {MAX_LANGUAGE_LENGTH} characters",
+        )
+    report_format = data.get("format")
+    if report_format is not None and report_format not in ("markdown", "json"):
+        raise HTTPException(
+            status_code=400, detail='format must be "markdown" or "json"'
+        )
+    return language, report_format
+
+
+def get_query(data: dict[str, Any]) -> str:
+    """Sanitize the query and check it against the query policy."""
+    try:
+        return check_query(data.get("query"))
+    except QueryPolicyViolation as e:
+        raise HTTPException(status_code=e.status_code, detail=e.detail()) from e
+
+
+def get_instructions(data: dict[str, Any], request_id: str) -> str | None:
+    """
+    Validate the per-request coordinator instructions.
+
+    Instructions are appended to the coordinator system prompt and steer the
+    investigation, so every use is audit-logged.
+    """
+    instructions = data.get("instructions")
+    if instructions is None:
+        return None
+    if (
+        not isinstance(instructions, str)
+        or not instructions.strip()
+        or len(instructions) > MAX_INSTRUCTIONS_LENGTH
+    ):
+        raise HTTPException(
+            status_code=400,
+            detail=f"instructions must be a non-empty string of at most {MAX_INSTRUCTIONS_LENGTH} characters",
+        )
+    # The same text the query policy refuses must not reach the system prompt
+    try:
+        instructions = check_query(instructions, "instructions")
+    except QueryPolicyViolation as e:
+        raise HTTPException(status_code=e.status_code, detail=e.detail()) from e
+    audit(
+        "request_instructions",
+        request_id=request_id,
+        digest=instructions_digest(instructions),
+        instructions=instructions,
+    )
+    return instructions
+
+
+def get_generation_overrides(data: dict[str, Any]) -> GenerationOverrides | None:
+    """Validate the coordinator model and generation overrides of a request."""
+    try:
+        return parse_generation_overrides(data)
+    except ValueError as e:
+        raise HTTPException(
+            status_code=400, detail=f"Invalid generation overrides: {e}"
+        )
+
+
+def get_remediate(data: dict[str, Any], request_id: str) -> bool:
+    """
+    Validate the remediation confirmation of a request.
+
+    Remediation must be enabled with SHOOT_REMEDIATION_ENABLED and confirmed
+    per request; every confirmation is audit-logged.
+    """
+    remediate = data.get("remediate", False)
+    if not isinstance(remediate, bool):
+        raise HTTPException(status_code=400, detail="remediate must be a boolean")
+    if remediate and not get_settings().remediation_enabled:
+        raise HTTPException(
+            status_code=400,
+            detail="Remediation is disabled (SHOOT_REMEDIATION_ENABLED)",
+        )
+    if remediate:
+        audit("remediation_confirmed", request_id=request_id)
+    return remediate
+
+
+async def enter_cluster_target(data: dict[str, Any], request_id: str) -> None:
+    """
+    Target the workload cluster a request names, if any.
+
+    The cluster's kubeconfig is fetched from its `<cluster>-kubeconfig`
+    Secret in `cluster_namespace` (default ORG_NS) on the management cluster,
+    or with tsh kube login if SHOOT_WC_ACCESS is teleport; every targeting is
+    audit-logged. Naming the configured cluster in its
+    namespace targets it as usual. Tenants may only target their clusters.
+    """
+    settings = get_settings()
+    cluster = data.get("cluster")
+    namespace = data.get("cluster_namespace", settings.org_ns)
+    if cluster is not None:
+        for field, value in (("cluster", cluster), ("cluster_namespace", namespace)):
+            if not isinstance(value, str) or not CLUSTER_NAME_PATTERN.fullmatch(value):
+                raise HTTPException(
+                    status_code=400,
+                    detail=f"{field} must be a Kubernetes object name",
+                )
+    refusal = tenant_cluster_refusal(
+        settings.wc_cluster if cluster is None else cluster
+    )
+    if refusal is not None:
+        raise HTTPException(status_code=403, detail=refusal)
+    if cluster is None or (
+        cluster == settings.wc_cluster and namespace == settings.org_ns
+    ):
+        return
+    if not settings.dynamic_clusters_enabled:
+        raise HTTPException(
+            status_code=400,
+            detail="Per-request clusters are disabled (SHOOT_DYNAMIC_CLUSTERS_ENABLED)",
+        )
+    audit(
+        "request_cluster", request_id=request_id, cluster=cluster, namespace=namespace
+    )
+    try:
+        target = await get_kubeconfig_cache().get(namespace, cluster)
+    except ClusterUnavailableError as e:
+        logger.warning(f"Cluster unavailable request_id={request_id}: {e}")
+        raise HTTPException(
+            status_code=502, detail={"error": str(e), "request_id": request_id}
+        )
+    cluster_target_ctx.set(target)
+
+
+def enter_namespace_scope(data: dict[str, Any], request_id: str) -> None:
+    """
+    Restrict the investigation to the namespaces a request names, if any.
+
+    The restriction is enforced by the tool policy; every restriction is
+    audit-logged. Follow-ups cannot be restricted, as their session may hold
+    data of other namespaces. A tenant's investigations are restricted to its
+    namespaces, or to those of them the request names.
+    """
+    namespaces = data.get("namespaces")
+    if namespaces is not None and (
+        not isinstance(namespaces, list)
+        or not namespaces
+        or not all(
+            isinstance(namespace, str) and CLUSTER_NAME_PATTERN.fullmatch(namespace)
+            for namespace in namespaces
+        )
+    ):
+        raise HTTPException(
+            status_code=400,
+            detail="namespaces must be a non-empty list of namespace names",
+        )
+    try:
+        scope = tenant_namespaces(
+            tuple(sorted(set(namespaces))) if namespaces is not None else None
+        )
+    except ValueError as e:
+        raise HTTPException(status_code=403, detail=str(e))
+    if scope is None:
+        return
+    if data.get("session_id") is not None:
+        raise HTTPException(
+            status_code=400,
+            detail="Follow-ups cannot be restricted to namespaces",
+        )
+    audit("request_namespaces", request_id=request_id, namespaces=list(scope))
+    namespace_scope_ctx.set(scope)
+
+
+async def admit_validated_request() -> None:
+    """
+    Admit a validated investigation to the model circuit and the tenant's quotas.
+
+    Called after the last validation, so refused and malformed requests don't
+    count against the quotas or take the model circuit's probe slot. A probe
+    slot is given back if the quotas refuse the request.
+    """
+    admit_model_circuit()
+    try:
+        await check_tenant_quota()
+    except HTTPException:
+        get_circuit_breaker().release_probe()
+        raise
+
+
+async def run_plan_only(
+    request_id: str,
+    query: str,
+    generation: GenerationOverrides | None,
+    instructions: str | None,
+) -> dict[str, Any]:
+    """Plan an investigation without running it (plan_only requests)."""
+    logger.info(f"Planning investigation request_id={request_id}")
+    plan, text, usage = await plan_investigation(query, generation, instructions)
+    response: dict[str, Any] = {
+        "request_id": request_id,
+        "plan": plan.model_dump() if plan else None,
+        "result": text,
+        "estimate": {
+            "collector_runs": len(plan.steps) if plan else None,
+            **estimate_cost(query),
+        },
+        "usage": usage,
+    }
+    warnings = check_plan(plan) if plan else ["The plan could not be parsed"]
+    if warnings:
+        response["warnings"] = warnings
+    return response
+
+
+def get_collector_instructions(
+    request: Request, data: dict[str, Any], request_id: str
+) -> dict[str, str] | None:
+    """
+    Validate per-request collector instruction overrides.
+
+    Overrides let prompt engineers replace collector system prompts for a
+    single run. They require the admin token and are rejected in the
+    production profile.
+    """
+    overrides = data.get("collector_instructions")
+    if not overrides:
+        return None
+
+    if get_settings().profile == "production":
+        raise HTTPException(
+            status_code=403,
+            detail="collector_instructions is disabled in the production profile",
+        )
+    if not is_admin_token(request.headers.get("authorization")):
+        raise HTTPException(
+            status_code=401, detail="collector_instructions requires the admin token"
+        )
+    if not isinstance(overrides, dict) or not all(
+        isinstance(text, str) and text.strip() for text in overrides.values()
+    ):
+        raise HTTPException(
+            status_code=400,
+            detail="collector_instructions must map collector names to non-empty strings",
+        )
+
+    unknown = sorted(set(overrides) - create_agent_definitions().keys())
+    if unknown:
+        raise HTTPException(
+            status_code=400, detail=f"Unknown collectors: {', '.join(unknown)}"
+        )
+    too_long = sorted(
+        name
+        for name, text in overrides.items()
+        if len(text) > MAX_COLLECTOR_INSTRUCTIONS_LENGTH
+    )
+    if too_long:
+        raise HTTPException(
+            status_code=400,
+            detail=(
+                f"collector_instructions longer than "
+                f"{MAX_COLLECTOR_INSTRUCTIONS_LENGTH} characters: {', '.join(too_long)}"
+            ),
+        )
+
+    digests = {name: instructions_digest(text) for name, text in overrides.items()}
+    logger.warning(
+        f"Collector instructions overridden request_id={request_id} overrides={digests}"
+    )
+    return overrides
+
 
 @app.get("/health")
-async def health() -> dict[str, str]:
-    """Liveness probe - checks if the application is running."""
+async def health() -> dict[str, Any]:
+    """
+    Liveness probe - checks if the application is running.
+
+    Fails with 503 while an investigation has been in flight for longer than
+    SHOOT_INVESTIGATION_CEILING_SECONDS: its timeouts did not fire, so the
+    process is considered wedged and is restarted.
+    """
+    tracker = get_activity_tracker()
+    ceiling = get_settings().investigation_ceiling_seconds
+    stuck = tracker.stuck_count(ceiling)
+    if stuck:
+        oldest = int(tracker.oldest_age_seconds())
+        logger.error(
+            f"{stuck} investigations exceeded the {ceiling}s ceiling "
+            f"(oldest {oldest}s), failing liveness"
+        )
+        raise HTTPException(
+            status_code=503,
+            detail={
+                "status": "unhealthy",
+                "stuck_investigations": stuck,
+                "oldest_investigation_seconds": oldest,
+                "ceiling_seconds": ceiling,
+            },
+        )
     return {"status": "healthy"}
 
 
+@app.get("/startup")
+async def startup() -> dict[str, Any]:
+    """
+    Startup probe - reports initialization progress.
+
+    Fails with 503 until the prompts are loaded, the agents are constructed,
+    and every MCP server answered its handshake; the body lists each step
+    with its attempts and last error. Once started, the readiness and
+    liveness probes take over.
+    """
+    progress = get_startup_progress()
+    status = progress.status()
+    if not progress.done():
+        raise HTTPException(status_code=503, detail=status)
+    return status
+
+
 @app.get("/ready")
 async def ready(deep: bool = False) -> dict[str, Any]:
     """
     Readiness probe - checks if the application is ready to serve traffic.
 
+    Reports the last known status of each MCP server; the status is
+    "degraded" while a server failed on its last check. Not ready while the
+    model provider circuit breaker is open.
+
     Args:
-        deep: If True, performs actual connectivity checks to clusters.
-              Default is False for faster health checks.
+        deep: If True, also runs the preflight checks and probes every
+              dependency: MCP servers must answer tools/list, the cluster
+              API servers must be reachable, and, if
+              SHOOT_READY_CHECK_MODEL_API is set, the Anthropic API must
+              accept the key. Probe results are cached for
+              SHOOT_READY_DEEP_CACHE_SECONDS. Default is False for faster
+              health checks.
     """
     wc_valid, mc_valid = get_mcp_configs_valid()
-    coordinator_ready = is_coordinator_ready()
+    coordinator_ready = get_backend().ready()
+
+    mcp_health = get_mcp_health_tracker()
 
     checks = {
-        "status": "ready",
+        "status": "ready" if mcp_health.healthy() else "degraded",
         "kubernetes_wc": wc_valid,
         "kubernetes_mc": mc_valid,
         "coordinator": coordinator_ready,
+        "backend": get_backend().name,
+        # Last status reported by a session for each MCP server
+        "mcp_servers": mcp_health.status(),
+        "model_circuit": get_circuit_breaker().status(),
     }
+    pool = get_mcp_server_pool()
+    if pool is not None:
+        checks["mcp_pool"] = pool.status()
 
     # Deep check: validate actual cluster connectivity
     if deep:
         preflight = run_preflight_checks()
         checks["preflight"] = preflight
-        # Consider not ready if any preflight check fails
-        all_preflight_valid = all(check["valid"] for check in preflight.values())
-        if not all_preflight_valid:
+        dependencies = await get_dependency_checker().check()
+        checks["dependencies"] = dependencies
+        # Consider not ready if any preflight or dependency check fails
+        all_valid = all(
+            check["valid"] for check in (*preflight.values(), *dependencies.values())
+        )
+        if not all_valid:
             checks["status"] = "not_ready"
             raise HTTPException(status_code=503, detail=checks)
 
-    # If any critical dependency is missing, return 503
+    # If any critical dependency is missing, or the model provider keeps
+    # failing, return 503
     if not all(
         [checks["kubernetes_wc"], checks["kubernetes_mc"], checks["coordinator"]]
-    ):
+    ) or checks["model_circuit"]["state"] == "open":
         checks["status"] = "not_ready"
         raise HTTPException(status_code=503, detail=checks)
 
     return checks
 
 
-@app.post("/")
-async def run(request: Request) -> dict[str, Any]:
+@app.get("/status")
+async def status() -> dict[str, Any]:
+    """
+    Public status feed for internal status pages.
+
+    Unauthenticated and free of cluster data: reports only service health,
+    a coarse bucket of in-flight investigations, and model provider status.
+    Disabled (404) unless SHOOT_STATUS_PAGE_ENABLED is set.
+    """
+    if not get_settings().status_page_enabled:
+        raise HTTPException(status_code=404, detail="Not Found")
+
+    tracker = get_activity_tracker()
+    return {
+        "status": "operational" if get_backend().ready() else "degraded",
+        "queue_depth": tracker.queue_depth_bucket(),
+        "provider": tracker.provider_status(),
+    }
+
+
+@app.post(
+    "/",
+    dependencies=[
+        Depends(check_tenant),
+        Depends(check_caller_identity),
+        Depends(check_idempotency_key),
+        Depends(check_invocation_chain),
+        Depends(check_model_circuit),
+    ],
+)
+async def run(
+    request: Request,
+    http_response: Response,
+    idempotency: IdempotencyReservation | None = Depends(check_idempotency_key),
+) -> dict[str, Any]:
     """
     Run the Shoot agent to investigate a Kubernetes issue.
 
@@ -101,13 +737,33 @@ async def run(request: Request) -> dict[str, Any]:
             "query": "Description of the issue, e.g., 'Deployment not ready'",
             "timeout_seconds": 300,  // optional, default 300
             "max_turns": 15,         // optional, default 15
-            "structured": false      // optional, return structured JSON if parseable
+            "structured": false,     // optional, return structured JSON if parseable
+            "verify": true,          // optional, critic review pass (default SHOOT_CRITIC_ENABLED)
+            "language": "German",    // optional, report language (uses the report writer)
+            "format": "markdown",    // optional, "markdown" or "json" (uses the report writer)
+            "session_id": "uuid",    // optional, follow-up in an earlier investigation's session
+            "debug": false,          // optional, return a trace of the agent conversation
+            "record": false,         // optional, record model and tool traffic for replay
+            "model": "...",          // optional, coordinator model (SHOOT_ALLOWED_COORDINATOR_MODELS)
+            "max_output_tokens": 16000,  // optional, coordinator output token limit
+            "reasoning_effort": "high",  // optional, "low", "medium", or "high" thinking budget
+            "instructions": "...",   // optional, appended to the coordinator prompt (audited)
+            "plan_only": false,      // optional, return the investigation plan without running it
+            "remediate": false,      // optional, confirm remediation (SHOOT_REMEDIATION_ENABLED)
+            "suggest_patches": true, // optional, propose patches (default SHOOT_PATCH_SUGGESTIONS_ENABLED)
+            "suggest_alert_rules": true, // optional, propose alert rules (default SHOOT_ALERT_RULE_SUGGESTIONS_ENABLED)
+            "cluster": "mycluster",  // optional, target another workload cluster (SHOOT_DYNAMIC_CLUSTERS_ENABLED)
+            "cluster_namespace": "org-acme",  // optional, its namespace on the management cluster (default ORG_NS)
+            "namespaces": ["shop"],  // optional, restrict the investigation to these namespaces
+            "callback_url": "https://...",  // optional, run in the background and post the outcome here
+            "collector_instructions": {"wc_collector": "..."}  // optional, see below
         }
 
     Returns:
         {
             "result": "Diagnostic report with findings and recommendations",
             "request_id": "uuid",
+            "session_id": "uuid",    // pass back as session_id for a follow-up query
             "metrics": {
                 "duration_ms": 12345,
                 "num_turns": 8,
@@ -120,40 +776,174 @@ async def run(request: Request) -> dict[str, Any]:
                 },
                 "breakdown": {
                     "wc_collector": {
-                        "usage": {"input_tokens": 500, "output_tokens": 200},
-                        "total_cost_usd": 0.01,
-                        "duration_ms": 3000
+                        "calls": 2,
+                        "errors": 0,
+                        "duration_ms": 3000,
+                        "max_concurrency": 1
                     },
                     "mc_collector": {
-                        "usage": {"input_tokens": 300, "output_tokens": 150},
-                        "total_cost_usd": 0.008,
-                        "duration_ms": 2000
+                        "calls": 1,
+                        "errors": 0,
+                        "duration_ms": 2000,
+                        "max_concurrency": 1
                     }
-                }
+                },
+                "thinking_budget_tokens": 16384  // null without extended thinking
             }
         }
 
         If structured=true and output is parseable:
         {"result": "...", "structured": {...}, "metrics": {...}, "request_id": "uuid"}
+
+        If similar earlier investigations were given to the coordinator, the
+        response includes {"similar_investigations": [{"id": "uuid",
+        "score": 0.42}, ...]}.
+
+        If the investigation was stopped at SHOOT_MAX_COST_USD_PER_QUERY, the
+        response includes {"truncated": true} and the report is partial.
+
+        If patches were proposed for misconfigured resources, the response
+        includes {"suggested_patches": ["suggested-patch-01-deployment-api.yaml"]},
+        artifacts of the investigation that are never applied.
+
+        If alert rules were proposed for an issue nothing alerted on, the
+        response includes {"alert_rules": [{"alert": "...", "expr": "...",
+        "duration": "15m", "severity": "warning", "summary": "...",
+        "explanation": "..."}]}, also in the structured report and the
+        suggested-alert-rules.yaml artifact (a PrometheusRule, never deployed).
+
+        If SHOOT_TRIAGE_ENABLED is set, the response includes
+        {"triage": {"severity": "degraded", "component": "coredns",
+                    "cause_category": "resources"}}.
+
+        If a critic review ran, the response includes
+        {"review": {"supported": bool, "unsupported_claims": [...],
+                    "missing_evidence": [...], "rounds": n}}.
+
+        If report validation is enabled, the response includes
+        {"validation": {"mode": "flag", "references": n, "unverified": [...],
+                        "hallucination_rate": 0.1}}.
+
+        If debug=true, the response includes the agent conversation (text,
+        tool calls, and truncated tool results of the coordinator and its
+        collectors) in {"debug_trace": [{"agent": "coordinator", "type":
+        "tool_use", ...}, ...]}.
+
+        If record=true, the model and tool traffic of the coordinator session
+        is kept as the recording.json artifact of the investigation, for
+        offline replay with replay_recording.py.
+
+        If collector_instructions was supplied, the response includes
+        {"metadata": {"collector_instructions": {"wc_collector": "<digest>"}}}.
+
+    If plan_only=true, nothing is collected: the coordinator model writes the
+    plan it would follow and the response is
+        {"request_id": "uuid", "plan": {"summary": "...", "hypotheses": [...],
+         "steps": [{"collector": "wc_collector", "goal": "...", "queries": [...],
+                    "expected_tools": ["get"]}]},
+         "result": "<planner text>", "usage": {...},
+         "estimate": {"collector_runs": 2, "cost_usd": 0.41, "based_on": ["uuid"]}}
+    with "warnings" if the plan names unknown collectors or tools. The cost
+    estimate is the median cost of similar earlier investigations (null
+    without any).
+
+    remediate=true gives the coordinator the remediator agent, which can
+    restart Deployments, delete stuck Pods, and resume HelmReleases; each
+    action waits for approval through POST /admin/approvals/{id}.
+
+    cluster targets another workload cluster than WC_CLUSTER: its kubeconfig
+    is fetched from the `<cluster>-kubeconfig` Secret on the management
+    cluster (502 if that fails), and its collectors, prompts, caches, and
+    record use that cluster.
+
+    namespaces restricts the investigation to the named namespaces: Kubernetes
+    calls outside them, across all namespaces, or of cluster-scoped resources
+    are refused by the tool policy. It cannot be combined with session_id.
+
+    collector_instructions replaces collector system prompts for this run only
+    (prompt experiments). It requires the admin token and is rejected when
+    SHOOT_PROFILE is "production".
+
+    callback_url answers at once with 202 and {"request_id": "uuid",
+    "status": "accepted"}, and posts the response, or the error, to the URL
+    signed with SHOOT_CALLBACK_SECRET when the investigation finishes
+    (callbacks.py).
+
+    With an Idempotency-Key header, retries get the response of the first
+    request with the key instead of investigating again (idempotency.py).
     """
     # Generate request ID for tracking
     request_id = str(uuid.uuid4())
     request_id_ctx.set(request_id)
+    request.state.request_id = request_id
     settings = get_settings()
 
+    # A callback investigation settles its reservation when it finishes
+    in_background = False
     with trace_operation("api.investigate") as span:
         span.set_attribute("request_id", request_id)
 
         try:
             data = await request.json()
-            query = data.get("query")
-            if not query:
-                raise HTTPException(status_code=400, detail="Query is required")
+            query = get_query(data)
+            request.state.query = query
 
             # Optional parameters with defaults from config
             timeout_seconds = data.get("timeout_seconds") or settings.timeout_seconds
             max_turns = data.get("max_turns")
             want_structured = data.get("structured", False)
+            verify = data.get("verify")
+            if verify is not None and not isinstance(verify, bool):
+                raise HTTPException(status_code=400, detail="verify must be a boolean")
+            suggest_patches = data.get("suggest_patches")
+            if suggest_patches is not None and not isinstance(suggest_patches, bool):
+                raise HTTPException(
+                    status_code=400, detail="suggest_patches must be a boolean"
+                )
+            suggest_alert_rules = data.get("suggest_alert_rules")
+            if suggest_alert_rules is not None and not isinstance(
+                suggest_alert_rules, bool
+            ):
+                raise HTTPException(
+                    status_code=400, detail="suggest_alert_rules must be a boolean"
+                )
+            language, report_format = get_report_options(data)
+            generation = get_generation_overrides(data)
+            instructions = get_instructions(data, request_id)
+            await enter_cluster_target(data, request_id)
+            enter_namespace_scope(data, request_id)
+            plan_only = data.get("plan_only", False)
+            if not isinstance(plan_only, bool):
+                raise HTTPException(
+                    status_code=400, detail="plan_only must be a boolean"
+                )
+            remediate = get_remediate(data, request_id)
+            session_id = get_session_id(data)
+            debug = data.get("debug", False)
+            if not isinstance(debug, bool):
+                raise HTTPException(status_code=400, detail="debug must be a boolean")
+            record = data.get("record", False)
+            if not isinstance(record, bool):
+                raise HTTPException(status_code=400, detail="record must be a boolean")
+            collector_instructions = get_collector_instructions(
+                request, data, request_id
+            )
+            callback_url = data.get("callback_url")
+            if callback_url is not None:
+                try:
+                    callback_url = await validate_callback_url(callback_url)
+                except ValueError as e:
+                    raise HTTPException(status_code=400, detail=str(e))
+            await admit_validated_request()
+            if plan_only:
+                plan = await run_plan_only(request_id, query, generation, instructions)
+                if idempotency is not None:
+                    idempotency.complete(plan)
+                return plan
+            # A follow-up's session already holds the earlier conversation
+            coordinator_query, similar = (
+                (query, []) if session_id else with_similar_investigations(query)
+            )
 
             span.set_attribute("query_length", len(query))
             span.set_attribute("timeout_seconds", timeout_seconds)
@@ -163,48 +953,171 @@ async def run(request: Request) -> dict[str, Any]:
                 f"query_length={len(query)} timeout={timeout_seconds}s"
             )
 
-            # HTTP-level timeout with buffer for graceful shutdown
-            http_timeout = timeout_seconds + 30
-            try:
-                async with asyncio.timeout(http_timeout):
-                    investigation_result: InvestigationResult = await run_coordinator(
-                        query,
-                        timeout_seconds=timeout_seconds,
-                        max_turns=max_turns,
+            async def investigate() -> dict[str, Any]:
+                # HTTP-level timeout with buffer for graceful shutdown
+                http_timeout = timeout_seconds + 30
+                try:
+                    async with asyncio.timeout(http_timeout):
+                        with get_activity_tracker().investigation(request_id):
+                            investigation_result: InvestigationResult = (
+                                await get_backend().run(
+                                    coordinator_query,
+                                    timeout_seconds=timeout_seconds,
+                                    max_turns=max_turns,
+                                    collector_instructions=collector_instructions,
+                                    verify=verify,
+                                    language=language,
+                                    report_format=report_format,
+                                    session_id=session_id,
+                                    debug=debug,
+                                    record=record,
+                                    generation=generation,
+                                    instructions=instructions,
+                                    remediate=remediate,
+                                    suggest_patches=suggest_patches,
+                                    suggest_alert_rules=suggest_alert_rules,
+                                )
+                            )
+                except UnsupportedOptionError as e:
+                    raise HTTPException(status_code=400, detail=str(e))
+                except CliTimeoutError as e:
+                    logger.error(f"claude CLI timed out request_id={request_id}")
+                    set_span_attribute("error", True)
+                    set_span_attribute("error.type", "timeout")
+                    raise HTTPException(
+                        status_code=504,
+                        detail={
+                            "error": "Investigation timed out",
+                            "request_id": request_id,
+                            "timeout_seconds": e.timeout_seconds,
+                        },
                     )
-            except asyncio.TimeoutError:
-                logger.error(f"Investigation timed out request_id={request_id}")
-                span.set_attribute("error", True)
-                span.set_attribute("error.type", "timeout")
-                raise HTTPException(
-                    status_code=504,
-                    detail={
-                        "error": "Investigation timed out",
-                        "request_id": request_id,
-                        "timeout_seconds": http_timeout,
+                except asyncio.TimeoutError:
+                    logger.error(f"Investigation timed out request_id={request_id}")
+                    set_span_attribute("error", True)
+                    set_span_attribute("error.type", "timeout")
+                    raise HTTPException(
+                        status_code=504,
+                        detail={
+                            "error": "Investigation timed out",
+                            "request_id": request_id,
+                            "timeout_seconds": http_timeout,
+                        },
+                    )
+                except StalledStreamError as e:
+                    logger.error(f"Investigation stalled request_id={request_id}: {e}")
+                    set_span_attribute("error", True)
+                    set_span_attribute("error.type", "stalled_stream")
+                    raise HTTPException(
+                        status_code=504,
+                        detail={
+                            "error": "Model stream stalled",
+                            "request_id": request_id,
+                            "stall_timeout_seconds": settings.stall_timeout_seconds,
+                        },
+                    )
+                except ImpersonationError as e:
+                    logger.error(
+                        f"Cannot impersonate the caller request_id={request_id}: {e}"
+                    )
+                    set_span_attribute("error", True)
+                    set_span_attribute("error.type", "impersonation")
+                    raise HTTPException(
+                        status_code=503,
+                        detail={"error": str(e), "request_id": request_id},
+                    )
+                except McpServerUnavailableError as e:
+                    logger.error(
+                        f"MCP servers unavailable request_id={request_id}: {e}"
+                    )
+                    set_span_attribute("error", True)
+                    set_span_attribute("error.type", "mcp_unavailable")
+                    raise HTTPException(
+                        status_code=503,
+                        detail={"error": str(e), "request_id": request_id},
+                    )
+
+                # Build response with result and metrics
+                response: dict[str, Any] = {
+                    "result": investigation_result["result"],
+                    "request_id": request_id,
+                    "session_id": investigation_result.get("session_id"),
+                    "metrics": {
+                        "duration_ms": investigation_result["duration_ms"],
+                        "num_turns": investigation_result["num_turns"],
+                        "total_cost_usd": investigation_result["total_cost_usd"],
+                        "usage": investigation_result["usage"],
+                        "breakdown": investigation_result.get("breakdown"),
+                        "model_upgrade": investigation_result.get("model_upgrade"),
+                        "thinking_budget_tokens": investigation_result.get(
+                            "thinking_budget_tokens"
+                        ),
                     },
+                }
+
+                if similar:
+                    response["similar_investigations"] = similar
+                if investigation_result.get("truncated"):
+                    response["truncated"] = True
+                if investigation_result.get("review"):
+                    response["review"] = investigation_result["review"]
+                if investigation_result.get("validation"):
+                    response["validation"] = investigation_result["validation"]
+                if investigation_result.get("triage"):
+                    response["triage"] = investigation_result["triage"]
+                if investigation_result.get("debug_trace") is not None:
+                    response["debug_trace"] = investigation_result["debug_trace"]
+                suggested_patches = sorted(
+                    name
+                    for name in investigation_result.get("artifacts") or {}
+                    if name.startswith(PATCH_ARTIFACT_PREFIX)
                 )
+                if suggested_patches:
+                    response["suggested_patches"] = suggested_patches
 
-            # Build response with result and metrics
-            response: dict[str, Any] = {
-                "result": investigation_result["result"],
-                "request_id": request_id,
-                "metrics": {
-                    "duration_ms": investigation_result["duration_ms"],
-                    "num_turns": investigation_result["num_turns"],
-                    "total_cost_usd": investigation_result["total_cost_usd"],
-                    "usage": investigation_result["usage"],
-                    "breakdown": investigation_result.get("breakdown"),
-                },
-            }
+                if investigation_result.get("alert_rules"):
+                    response["alert_rules"] = investigation_result["alert_rules"]
 
-            # Optionally include structured output
-            if want_structured:
-                structured = get_structured_report(investigation_result["result"])
-                if structured:
+                structured = get_structured_report(
+                    investigation_result["result"],
+                    investigation_result.get("alert_rules"),
+                )
+
+                # Optionally include structured output
+                if want_structured and structured:
                     response["structured"] = structured.model_dump()
 
-            logger.info(f"Investigation completed request_id={request_id}")
+                # Keep the investigation for later comparison
+                investigation_record = record_from_result(
+                    request_id,
+                    query,
+                    investigation_result,
+                    collector_instructions=collector_instructions,
+                    generation=generation,
+                    instructions=instructions,
+                )
+                get_investigation_store().add(investigation_record)
+                export_investigation_cost(investigation_record)
+                record_triage_metric(
+                    investigation_record.cluster, investigation_record.triage
+                )
+                file_jira_issue(investigation_record)
+                digests = investigation_record.collector_instructions
+                if digests:
+                    response["metadata"] = {"collector_instructions": digests}
+
+                logger.info(f"Investigation completed request_id={request_id}")
+                return response
+
+            if callback_url is not None:
+                start_callback_investigation(request_id, callback_url, investigate)
+                in_background = True
+                response = {"request_id": request_id, "status": "accepted"}
+                http_response.status_code = 202
+            else:
+                response = await investigate()
+            if idempotency is not None:
+                idempotency.complete(response, http_response.status_code or 200)
             return response
 
         except HTTPException:
@@ -216,9 +1129,20 @@ async def run(request: Request) -> dict[str, Any]:
             raise HTTPException(
                 status_code=500, detail={"error": str(e), "request_id": request_id}
             )
+        finally:
+            if not in_background:
+                settle_reservation()
 
 
-@app.post("/stream")
+@app.post(
+    "/stream",
+    dependencies=[
+        Depends(check_tenant),
+        Depends(check_invocation_chain),
+        Depends(check_model_circuit),
+        Depends(check_caller_identity),
+    ],
+)
 async def run_stream(request: Request) -> StreamingResponse:
     """
     Run the Shoot agent with streaming response.
@@ -230,25 +1154,48 @@ async def run_stream(request: Request) -> StreamingResponse:
         {
             "query": "Description of the issue, e.g., 'Deployment not ready'",
             "timeout_seconds": 300,  // optional, default 300
-            "max_turns": 15          // optional, default 15
+            "max_turns": 15,         // optional, default 15
+            "progress": false,       // optional, also stream progress events
+            "model": "...",          // optional, generation overrides as for POST /
+            "instructions": "...",   // optional, as for POST /
+            "cluster": "mycluster",  // optional, as for POST /
+            "cluster_namespace": "org-acme",  // optional, as for POST /
+            "namespaces": ["shop"],  // optional, as for POST /
+            "collector_instructions": {"wc_collector": "..."}  // optional, admin only
         }
 
     Returns:
         text/event-stream with diagnostic report chunks
+
+        With progress=true, the stream is framed as server-sent events:
+        `text` events ({"text": "..."}) with the report chunks, `progress`
+        events ({"agent": "wc_collector", "message": "running get pods -n
+        kube-system"}) with what the agents are doing, and an `error` event
+        ({"error": "..."}) if the investigation fails.
     """
     # Generate request ID for tracking
     request_id = str(uuid.uuid4())
     request_id_ctx.set(request_id)
+    request.state.request_id = request_id
     settings = get_settings()
 
     try:
         data = await request.json()
-        query = data.get("query")
-        if not query:
-            raise HTTPException(status_code=400, detail="Query is required")
+        query = get_query(data)
+        request.state.query = query
 
         timeout_seconds = data.get("timeout_seconds") or settings.timeout_seconds
         max_turns = data.get("max_turns")
+        progress = data.get("progress", False)
+        if not isinstance(progress, bool):
+            raise HTTPException(status_code=400, detail="progress must be a boolean")
+        generation = get_generation_overrides(data)
+        instructions = get_instructions(data, request_id)
+        await enter_cluster_target(data, request_id)
+        enter_namespace_scope(data, request_id)
+        collector_instructions = get_collector_instructions(request, data, request_id)
+        await admit_validated_request()
+        coordinator_query, _ = with_similar_investigations(query)
 
         logger.info(
             f"Starting streaming investigation request_id={request_id} "
@@ -257,12 +1204,22 @@ async def run_stream(request: Request) -> StreamingResponse:
 
         async def generate() -> AsyncGenerator[str, None]:
             try:
-                async for chunk in run_coordinator_streaming(
-                    query,
-                    timeout_seconds=timeout_seconds,
-                    max_turns=max_turns,
-                ):
-                    yield chunk
+                with get_activity_tracker().investigation(request_id):
+                    async for chunk in get_backend().stream(
+                        coordinator_query,
+                        timeout_seconds=timeout_seconds,
+                        max_turns=max_turns,
+                        collector_instructions=collector_instructions,
+                        progress=progress,
+                        generation=generation,
+                        instructions=instructions,
+                    ):
+                        if isinstance(chunk, ProgressEvent):
+                            yield server_sent_event("progress", chunk.to_dict())
+                        elif progress:
+                            yield server_sent_event("text", {"text": chunk})
+                        else:
+                            yield chunk
                 logger.info(
                     f"Streaming investigation completed request_id={request_id}"
                 )
@@ -270,7 +1227,12 @@ async def run_stream(request: Request) -> StreamingResponse:
                 logger.exception(
                     f"Streaming investigation failed request_id={request_id}"
                 )
-                yield f"\n\n[ERROR: {str(e)}]"
+                if progress:
+                    yield server_sent_event("error", {"error": str(e)})
+                else:
+                    yield f"\n\n[ERROR: {str(e)}]"
+            finally:
+                settle_reservation()
 
         return StreamingResponse(
             generate(),
@@ -283,14 +1245,72 @@ async def run_stream(request: Request) -> StreamingResponse:
             },
         )
     except HTTPException:
+        settle_reservation()
         raise
     except Exception as e:
+        settle_reservation()
         logger.exception(f"Streaming investigation failed request_id={request_id}")
         raise HTTPException(
             status_code=500, detail={"error": str(e), "request_id": request_id}
         )
 
 
+@app.get("/.well-known/agent-card.json")
+async def a2a_agent_card(request: Request) -> dict[str, Any]:
+    """
+    A2A agent card: shoot's skills and endpoint for other agents.
+
+    Disabled (404) unless SHOOT_A2A_ENABLED is set.
+    """
+    settings = get_settings()
+    if not settings.a2a_enabled:
+        raise HTTPException(status_code=404, detail="Not Found")
+    return agent_card(settings.a2a_url or f"{request.base_url}a2a", app.version)
+
+
+@app.post(
+    "/a2a", dependencies=[Depends(check_tenant), Depends(check_caller_identity)]
+)
+async def a2a(request: Request) -> Response:
+    """
+    A2A JSON-RPC endpoint (message/send, message/stream, tasks/get).
+
+    Investigations are refused with a JSON-RPC error, instead of 508 or 503,
+    when the invocation chain is too deep or the model provider circuit is
+    open. Disabled (404) unless SHOOT_A2A_ENABLED is set. With
+    SHOOT_IMPERSONATION_ENABLED, callers without an identity get 401, and
+    with SHOOT_TENANTS_CONFIG, callers of no tenant.
+    """
+    if not get_settings().a2a_enabled:
+        raise HTTPException(status_code=404, detail="Not Found")
+    return await handle_a2a_request(
+        await request.body(), request.headers.get(INVOCATION_CHAIN_HEADER)
+    )
+
+
+@app.post("/teams")
+async def teams(request: Request) -> dict[str, Any]:
+    """
+    Microsoft Teams outgoing webhook: investigate the message mentioning shoot.
+
+    Answers at once; the report is posted to SHOOT_TEAMS_WEBHOOK_URL as an
+    Adaptive Card. Disabled (404) unless SHOOT_TEAMS_OUTGOING_WEBHOOK_SECRET
+    is set; messages without a valid HMAC signature get 401.
+    """
+    if not teams_enabled():
+        raise HTTPException(status_code=404, detail="Not Found")
+    body = await request.body()
+    if not verify_teams_signature(body, request.headers.get("authorization")):
+        raise HTTPException(status_code=401, detail="Invalid Teams signature")
+    try:
+        activity = json.loads(body)
+    except json.JSONDecodeError:
+        raise HTTPException(status_code=400, detail="Invalid JSON")
+    if not isinstance(activity, dict):
+        raise HTTPException(status_code=400, detail="Invalid activity")
+    return handle_teams_message(activity)
+
+
 @app.get("/schema")
 async def get_schema() -> dict[str, Any]:
     """
@@ -300,3 +1320,495 @@ async def get_schema() -> dict[str, Any]:
     successfully generates a structured diagnostic report.
     """
     return DIAGNOSTIC_REPORT_SCHEMA
+
+
+@app.get(
+    "/investigations/{investigation_id}/compare/{other_id}",
+    dependencies=[Depends(check_tenant)],
+)
+async def compare(investigation_id: str, other_id: str) -> dict[str, Any]:
+    """
+    Compare two investigations of the same query.
+
+    Returns a structured diff of findings, costs, and durations, along with
+    the models and prompt versions each investigation was run with.
+    Investigations are only kept in memory for a limited history
+    (SHOOT_INVESTIGATION_HISTORY_SIZE).
+    """
+    a, b = get_record_or_404(investigation_id), get_record_or_404(other_id)
+    if normalize_text(a.query) != normalize_text(b.query):
+        raise HTTPException(
+            status_code=400,
+            detail={"error": "Investigations were run for different queries"},
+        )
+
+    return compare_investigations(a, b)
+
+
+# Artifact name of the debug trace, if the investigation was run with debug
+TRANSCRIPT_ARTIFACT = "transcript.json"
+# Single-page web UI served at /ui
+UI_PAGE = Path(__file__).parent / "ui" / "index.html"
+
+
+def get_record_or_404(investigation_id: str) -> InvestigationRecord:
+    """Get a stored investigation visible to the caller or fail with 404."""
+    record = get_investigation_store().get(investigation_id)
+    if record is None or not visible_to_caller(record.tenant):
+        raise HTTPException(
+            status_code=404,
+            detail={"error": "Investigation not found", "request_id": investigation_id},
+        )
+    return record
+
+
+@app.get("/ui")
+async def ui() -> FileResponse:
+    """
+    Web UI for submitting queries and browsing past investigations.
+
+    Disabled (404) unless SHOOT_UI_ENABLED is set.
+    """
+    if not get_settings().ui_enabled:
+        raise HTTPException(status_code=404, detail="Not Found")
+    return FileResponse(UI_PAGE, media_type="text/html")
+
+
+@app.get("/quota", dependencies=[Depends(check_tenant)])
+async def get_quota() -> dict[str, Any]:
+    """
+    Get the usage and quotas of the caller's tenant today and this month.
+
+    Returns:
+        Investigations and model cost with their limits, remaining amounts,
+        and reset times; 404 if the caller has no tenant
+    """
+    tenant = tenant_ctx.get()
+    if tenant is None:
+        raise HTTPException(status_code=404, detail="The caller has no tenant")
+    return quota_status(tenant)
+
+
+@app.get("/investigations", dependencies=[Depends(check_tenant)])
+async def list_investigations() -> dict[str, Any]:
+    """
+    List the investigation history of this replica, newest first.
+
+    Entries hold the ID, the beginning of the query, and the outcome; get an
+    investigation's report with GET /investigations/{id}. Disabled (404)
+    unless SHOOT_UI_ENABLED is set, as it exposes every stored query. Tenants
+    only see their own investigations.
+    """
+    if not get_settings().ui_enabled:
+        raise HTTPException(status_code=404, detail="Not Found")
+    records = reversed(get_investigation_store().list())
+    return {
+        "investigations": [
+            record_summary(record)
+            for record in records
+            if visible_to_caller(record.tenant)
+        ]
+    }
+
+
+@app.get("/investigations/{investigation_id}", dependencies=[Depends(check_tenant)])
+async def get_investigation(investigation_id: str) -> dict[str, Any]:
+    """Get a stored investigation with its report, metrics, and review."""
+    record = get_record_or_404(investigation_id)
+    return record.model_dump(exclude={"artifacts", "debug_trace"})
+
+
+@app.get(
+    "/investigations/{investigation_id}/report.html",
+    dependencies=[Depends(check_tenant)],
+)
+async def get_report_html(investigation_id: str) -> HTMLResponse:
+    """
+    Get a stored investigation as an HTML page, for links from alerts.
+
+    The page is rendered from SHOOT_REPORT_HTML_TEMPLATE or the bundled
+    template, with the report, its metadata, and the evidence collapsed.
+    """
+    record = get_record_or_404(investigation_id)
+    try:
+        page = render_report_html(record)
+    except (OSError, jinja2.TemplateError) as e:
+        logger.error(f"Cannot render the HTML report template: {e!r}")
+        raise HTTPException(status_code=500, detail="Invalid HTML report template")
+    return HTMLResponse(page)
+
+
+@app.get(
+    "/investigations/{investigation_id}/artifacts",
+    dependencies=[Depends(check_tenant)],
+)
+async def list_artifacts(investigation_id: str) -> dict[str, Any]:
+    """
+    List the raw evidence behind an investigation report.
+
+    Artifacts are the report as a standalone Markdown document with metadata
+    (`report.md`), the collector results returned to the coordinator
+    (`collector-NN-<collector>.txt`), the tool outputs inside the collectors
+    (`tool-output-NNN.txt`), and the agent conversation (`transcript.json`)
+    if the investigation was run with debug.
+    """
+    record = get_record_or_404(investigation_id)
+    artifacts = [
+        {"name": name, "size": len(text)} for name, text in record.artifacts.items()
+    ]
+    if record.debug_trace is not None:
+        artifacts.append(
+            {"name": TRANSCRIPT_ARTIFACT, "size": len(json.dumps(record.debug_trace))}
+        )
+    return {"request_id": investigation_id, "artifacts": artifacts}
+
+
+@app.get(
+    "/investigations/{investigation_id}/artifacts/{name}",
+    response_model=None,
+    dependencies=[Depends(check_tenant)],
+)
+async def get_artifact(investigation_id: str, name: str) -> Response:
+    """
+    Get one artifact of an investigation as plain text (the transcript as
+    JSON, the report document as a Markdown download).
+    """
+    record = get_record_or_404(investigation_id)
+    if name == TRANSCRIPT_ARTIFACT and record.debug_trace is not None:
+        return JSONResponse(record.debug_trace)
+    text = record.artifacts.get(name)
+    if text is None:
+        raise HTTPException(
+            status_code=404,
+            detail={"error": "Artifact not found", "name": name},
+        )
+    if name == REPORT_ARTIFACT:
+        return Response(
+            text,
+            media_type="text/markdown; charset=utf-8",
+            headers={
+                "Content-Disposition": (
+                    f'attachment; filename="shoot-{investigation_id}.md"'
+                )
+            },
+        )
+    return PlainTextResponse(text)
+
+
+@app.post(
+    "/investigations/{investigation_id}/feedback",
+    dependencies=[Depends(check_tenant)],
+)
+async def feedback(investigation_id: str, request: Request) -> dict[str, Any]:
+    """
+    Rate an investigation report.
+
+    Request body:
+        {
+            "rating": "up",         // "up" or "down"
+            "comment": "..."        // optional
+        }
+
+    Later feedback replaces earlier feedback for the same investigation.
+    Ratings are aggregated by GET /analytics/quality and counted in the
+    `shoot.feedback.ratings` metric.
+    """
+    try:
+        data = await request.json()
+        rating = Feedback.model_validate(data)
+    except (ValueError, TypeError) as e:
+        raise HTTPException(status_code=400, detail=f"Invalid feedback: {e}")
+
+    get_record_or_404(investigation_id)
+    record = get_investigation_store().set_feedback(investigation_id, rating)
+    if record is None:
+        raise HTTPException(
+            status_code=404,
+            detail={"error": "Investigation not found", "request_id": investigation_id},
+        )
+
+    add_event(
+        "investigation_feedback",
+        {
+            "rating": rating.rating,
+            "coordinator_model": record.coordinator_model,
+            "collector_model": record.collector_model,
+            "prompt_version": record.prompt_version,
+        },
+    )
+    record_feedback_metric(record, rating)
+    return {"request_id": investigation_id, "feedback": rating.model_dump()}
+
+
+@app.get("/analytics/quality", dependencies=[Depends(check_tenant)])
+async def quality(
+    group_by: str = Query(
+        default="coordinator_model,prompt_version",
+        description=f"Comma-separated dimensions: {', '.join(QUALITY_DIMENSIONS)}",
+    ),
+) -> dict[str, Any]:
+    """
+    Aggregate report feedback per model and prompt version.
+
+    Covers the investigations in the in-memory history
+    (SHOOT_INVESTIGATION_HISTORY_SIZE), excluding shadow re-runs. Tenants
+    only see their own investigations.
+    """
+    dimensions = tuple(d.strip() for d in group_by.split(",") if d.strip())
+    unknown = [d for d in dimensions if d not in QUALITY_DIMENSIONS]
+    if not dimensions or unknown:
+        raise HTTPException(
+            status_code=400,
+            detail=f"group_by must be a comma-separated subset of {', '.join(QUALITY_DIMENSIONS)}",
+        )
+
+    records = [
+        record
+        for record in get_investigation_store().list()
+        if visible_to_caller(record.tenant)
+    ]
+    return {
+        "group_by": list(dimensions),
+        "groups": aggregate_quality(records, dimensions),  # type: ignore[arg-type]
+    }
+
+
+@app.get("/admin/config", dependencies=[Depends(require_admin)])
+async def admin_config() -> dict[str, Any]:
+    """
+    Get the effective configuration of this replica.
+
+    Returns the settings (from the environment, .env, and config file) with
+    credentials masked, the backend, the registered collectors with their
+    models and tools, and the prompt version.
+
+    Requires `Authorization: Bearer <SHOOT_ADMIN_TOKEN>`.
+    """
+    try:
+        collectors: dict[str, Any] = describe_collectors()
+    except ValueError as e:
+        collectors = {"error": str(e)}
+    return {
+        "settings": sanitized_settings(get_settings()),
+        "backend": get_backend().name,
+        "collectors": collectors,
+        "prompt_version": get_prompt_version(),
+    }
+
+
+@app.post("/admin/reload", dependencies=[Depends(require_admin)])
+async def admin_reload() -> dict[str, Any]:
+    """
+    Reload the coordinator, collector, critic, and report writer prompts.
+
+    New investigations use the reloaded prompts; running ones keep theirs.
+    Returns the prompt version before and after the reload.
+
+    Requires `Authorization: Bearer <SHOOT_ADMIN_TOKEN>`.
+    """
+    try:
+        return reload_prompt_templates("admin")
+    except (OSError, ValueError) as e:
+        raise HTTPException(
+            status_code=500, detail=f"Failed to reload prompts: {e}"
+        ) from e
+
+
+@app.get("/admin/loglevel", dependencies=[Depends(require_admin)])
+async def admin_log_level() -> dict[str, Any]:
+    """Get the level of the application logger of this replica."""
+    return {"level": get_log_level()}
+
+
+@app.put("/admin/loglevel", dependencies=[Depends(require_admin)])
+async def admin_set_log_level(request: Request) -> dict[str, Any]:
+    """
+    Set the level of the application logger of this replica.
+
+    Request body:
+        {
+            "level": "DEBUG"        // DEBUG, INFO, WARNING, or ERROR
+        }
+
+    Takes effect immediately, without a restart, so debug logging can be
+    turned on for a misbehaving replica while it keeps its state. The level
+    applies to this replica only and reverts to INFO on restart.
+
+    Requires `Authorization: Bearer <SHOOT_ADMIN_TOKEN>`.
+    """
+    try:
+        data = await request.json()
+        previous = set_log_level(str(data["level"]))
+    except (ValueError, TypeError, KeyError) as e:
+        raise HTTPException(status_code=400, detail=f"Invalid log level: {e}")
+
+    level = get_log_level()
+    logger.warning(f"Log level changed from {previous} to {level}")
+    audit("log_level_changed", previous=previous, level=level)
+    return {"previous": previous, "level": level}
+
+
+@app.post("/admin/replay", dependencies=[Depends(require_admin)])
+async def admin_replay(
+    query_filter: str = Query(
+        default="", alias="filter", description="Case-insensitive query substring"
+    ),
+    limit: int = Query(default=10, ge=1, le=50),
+) -> dict[str, Any]:
+    """
+    Re-run stored investigations against the current prompts and models.
+
+    Matching investigations are replayed in the background in shadow mode:
+    re-runs are stored with `shadow_of` set to the original ID and compared
+    against it. Poll GET /admin/replay/{replay_id} for results.
+
+    Requires `Authorization: Bearer <SHOOT_ADMIN_TOKEN>`.
+    """
+    run = start_replay(query_filter, limit)
+    return run.model_dump()
+
+
+@app.get("/admin/replay/{replay_id}", dependencies=[Depends(require_admin)])
+async def admin_replay_status(replay_id: str) -> dict[str, Any]:
+    """Get the status and comparison results of a replay run."""
+    run = get_replay(replay_id)
+    if run is None:
+        raise HTTPException(status_code=404, detail="Replay not found")
+    return run.model_dump()
+
+
+@app.get("/admin/approvals", dependencies=[Depends(require_admin)])
+async def admin_list_approvals(status: str | None = None) -> dict[str, Any]:
+    """
+    List tool call approval requests of this instance, newest first.
+
+    Query parameters:
+        status: Only requests with this status (pending, approved, denied,
+            expired)
+    """
+    requests = get_approval_queue().list()
+    if status is not None:
+        requests = [r for r in requests if r.status == status]
+    return {"approvals": [r.model_dump() for r in requests]}
+
+
+@app.post("/admin/approvals/{approval_id}", dependencies=[Depends(require_admin)])
+async def admin_decide_approval(approval_id: str, request: Request) -> dict[str, Any]:
+    """
+    Approve or deny a pending tool call.
+
+    Request body:
+        {
+            "approved": true,
+            "reason": "..."  // optional, reported to the model on denial
+        }
+
+    Returns:
+        The decided approval request; 404 if unknown, 409 if already decided
+        or expired
+    """
+    try:
+        data = await request.json()
+    except ValueError:
+        raise HTTPException(status_code=400, detail="Invalid JSON")
+    if not isinstance(data, dict):
+        raise HTTPException(status_code=400, detail="Body must be a JSON object")
+    approved = data.get("approved")
+    if not isinstance(approved, bool):
+        raise HTTPException(status_code=400, detail="approved must be a boolean")
+    reason = data.get("reason")
+    if reason is not None and not isinstance(reason, str):
+        raise HTTPException(status_code=400, detail="reason must be a string")
+    try:
+        decided = get_approval_queue().decide(approval_id, approved, reason)
+    except KeyError:
+        raise HTTPException(status_code=404, detail="Approval request not found")
+    except ValueError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    return decided.model_dump()
+
+
+@app.get("/admin/baselines", dependencies=[Depends(require_admin)])
+async def admin_list_baselines() -> dict[str, Any]:
+    """List the kept workload cluster baselines, newest first, with their counts."""
+    snapshots = reversed(get_baseline_store().list())
+    return {"baselines": [snapshot.summary() for snapshot in snapshots]}
+
+
+@app.post("/admin/baselines", dependencies=[Depends(require_admin)])
+async def admin_capture_baseline() -> dict[str, Any]:
+    """
+    Capture a workload cluster baseline now.
+
+    Returns:
+        The baseline; 409 if baselines are disabled, 502 if the capture failed
+    """
+    if not baselines_enabled():
+        raise HTTPException(
+            status_code=409,
+            detail="Baselines are disabled (SHOOT_BASELINE_INTERVAL_SECONDS)",
+        )
+    try:
+        snapshot = await capture_and_store_baseline()
+    except Exception as e:
+        logger.warning(f"Baseline capture failed: {e!r}")
+        raise HTTPException(status_code=502, detail=f"Baseline capture failed: {e!r}")
+    return snapshot.model_dump()
+
+
+@app.get("/admin/tenants", dependencies=[Depends(require_admin)])
+async def admin_list_tenants() -> dict[str, Any]:
+    """List the usage and quotas of every tenant; 404 without tenancy."""
+    registry = get_tenant_registry()
+    if registry is None:
+        raise HTTPException(status_code=404, detail="Tenancy is disabled")
+    return {"tenants": [quota_status(tenant) for tenant in registry.tenants]}
+
+
+_DEBUG_DEPENDENCIES = [Depends(require_admin), Depends(check_debug_endpoints)]
+
+
+@app.get("/admin/debug/runtime", dependencies=_DEBUG_DEPENDENCIES)
+async def admin_debug_runtime() -> dict[str, Any]:
+    """
+    Get the runtime state of this replica.
+
+    Returns memory, garbage collector, thread, asyncio task, and file
+    descriptor counts, and the child processes (MCP servers, claude CLI) with
+    their memory, to spot leaks during long investigations. 404 unless
+    SHOOT_DEBUG_ENDPOINTS_ENABLED is set.
+
+    Requires `Authorization: Bearer <SHOOT_ADMIN_TOKEN>`.
+    """
+    return runtime_stats()
+
+
+@app.get("/admin/debug/tasks", dependencies=_DEBUG_DEPENDENCIES)
+async def admin_debug_tasks() -> dict[str, Any]:
+    """List the asyncio tasks of this replica with their stacks."""
+    tasks = task_stacks()
+    return {"count": len(tasks), "tasks": tasks}
+
+
+@app.get("/admin/debug/threads", dependencies=_DEBUG_DEPENDENCIES)
+async def admin_debug_threads() -> dict[str, Any]:
+    """List the threads of this replica with their stacks."""
+    threads = thread_stacks()
+    return {"count": len(threads), "threads": threads}
+
+
+@app.get("/admin/debug/heap", dependencies=_DEBUG_DEPENDENCIES)
+async def admin_debug_heap(
+    limit: int = Query(default=25, ge=1, le=200),
+) -> dict[str, Any]:
+    """
+    Get the lines allocating the most memory, from tracemalloc.
+
+    The first request starts tracing; later requests also report the growth
+    since the previous request, so two requests some time apart show where
+    memory accumulates. Tracing slows allocations down and stays on until
+    the replica restarts.
+
+    Requires `Authorization: Bearer <SHOOT_ADMIN_TOKEN>`.
+    """
+    return await asyncio.to_thread(heap_profile, limit)
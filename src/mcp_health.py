@@ -0,0 +1,135 @@
+"""
+MCP server supervision for the Shoot agent system.
+
+MCP servers are started (or connected to) by each coordinator session. A
+server that fails to start used to surface only as empty or confusing
+collector results. Every session now reports the status of its MCP servers
+in its init message: failed servers abort the attempt so it can be retried
+in a fresh session (which restarts them) with backoff, and the last known
+status of every server is reported by /ready.
+
+Open sessions are tracked so they, and the MCP server processes they own,
+are torn down on shutdown.
+"""
+
+import asyncio
+import time
+from contextlib import asynccontextmanager
+from functools import lru_cache
+from threading import Lock
+from typing import Any, AsyncIterator
+
+from claude_agent_sdk import ClaudeAgentOptions, ClaudeSDKClient, SystemMessage
+
+from app_logging import logger
+from telemetry import add_event
+
+# Server statuses in the session init message that make a server unusable
+_FAILED_STATUSES = {"failed", "needs-auth"}
+# Upper bound for the delay between MCP restart attempts
+_MAX_RESTART_BACKOFF_SECONDS = 30
+
+
+class McpServerUnavailableError(Exception):
+    """One or more MCP servers failed to start or connect."""
+
+
+class McpHealthTracker:
+    """Last known status of each MCP server, as reported by sessions."""
+
+    def __init__(self) -> None:
+        self._lock = Lock()
+        # server name -> {"status", "checked_at", "consecutive_failures"}
+        self._servers: dict[str, dict[str, Any]] = {}
+
+    def record(self, statuses: dict[str, str]) -> None:
+        """Record the statuses reported by a session."""
+        with self._lock:
+            for name, status in statuses.items():
+                previous = self._servers.get(name, {})
+                failures = previous.get("consecutive_failures", 0)
+                self._servers[name] = {
+                    "status": status,
+                    "checked_at": time.time(),
+                    "consecutive_failures": (
+                        failures + 1 if status in _FAILED_STATUSES else 0
+                    ),
+                }
+
+    def status(self) -> dict[str, dict[str, Any]]:
+        """Last known status of every server seen so far."""
+        with self._lock:
+            return {name: dict(info) for name, info in self._servers.items()}
+
+    def healthy(self) -> bool:
+        """Whether no server failed on its last check."""
+        with self._lock:
+            return not any(
+                info["status"] in _FAILED_STATUSES for info in self._servers.values()
+            )
+
+
+@lru_cache()
+def get_mcp_health_tracker() -> McpHealthTracker:
+    """Get the process-wide MCP health tracker."""
+    return McpHealthTracker()
+
+
+def check_mcp_servers(message: SystemMessage) -> None:
+    """
+    Record MCP server statuses from a session init message.
+
+    Raises:
+        McpServerUnavailableError: A server failed to start or connect
+    """
+    if message.subtype != "init":
+        return
+    statuses = {
+        server.get("name", "unknown"): server.get("status", "unknown")
+        for server in message.data.get("mcp_servers", [])
+        if isinstance(server, dict)
+    }
+    if not statuses:
+        return
+
+    get_mcp_health_tracker().record(statuses)
+    failed = sorted(
+        name for name, status in statuses.items() if status in _FAILED_STATUSES
+    )
+    if failed:
+        add_event("mcp_servers_unavailable", {"servers": ",".join(failed)})
+        raise McpServerUnavailableError(f"MCP servers unavailable: {', '.join(failed)}")
+
+
+def restart_backoff_seconds(restart: int) -> float:
+    """Delay before the given (1-based) restart attempt."""
+    return float(min(2 ** (restart - 1), _MAX_RESTART_BACKOFF_SECONDS))
+
+
+# Sessions currently open, closed on shutdown
+_OPEN_SESSIONS: set[ClaudeSDKClient] = set()
+
+
+@asynccontextmanager
+async def open_session(options: ClaudeAgentOptions) -> AsyncIterator[ClaudeSDKClient]:
+    """Open a coordinator session that is tracked until it is closed."""
+    async with ClaudeSDKClient(options=options) as client:
+        _OPEN_SESSIONS.add(client)
+        try:
+            yield client
+        finally:
+            _OPEN_SESSIONS.discard(client)
+
+
+async def close_open_sessions() -> None:
+    """Disconnect all open sessions, stopping their MCP server processes."""
+    sessions = list(_OPEN_SESSIONS)
+    if not sessions:
+        return
+    logger.info(f"Closing {len(sessions)} open coordinator sessions")
+    results = await asyncio.gather(
+        *(client.disconnect() for client in sessions), return_exceptions=True
+    )
+    for result in results:
+        if isinstance(result, Exception):
+            logger.warning(f"Failed to close coordinator session: {result}")
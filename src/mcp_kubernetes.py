@@ -0,0 +1,214 @@
+"""
+Connections to the built-in mcp-kubernetes servers.
+
+The workload cluster (`kubernetes_wc`) and management cluster
+(`kubernetes_mc`) servers are configured from MCP_KUBERNETES_* settings:
+remote endpoints, the shared pool (mcp_pool.py), or subprocesses (fake ones
+serving canned resources with SHOOT_FAKE_CLUSTER, fake_mcp.py). Besides
+the collector sessions, shoot itself connects to them as an MCP client for
+work without a model, such as baseline capture and Helm release inspection,
+and so gets the same read-only access as the collectors.
+"""
+
+import json
+import os
+import shlex
+import sys
+from contextlib import AsyncExitStack, asynccontextmanager
+from typing import Any, AsyncIterator
+
+from mcp import ClientSession, StdioServerParameters
+from mcp.client.sse import sse_client
+from mcp.client.stdio import stdio_client
+from mcp.client.streamable_http import streamablehttp_client
+
+from cluster_target import cluster_target_ctx
+from config import get_settings
+from fake_mcp import DEFAULT_FIXTURES
+from impersonation import impersonate_stdio_config, impersonation_ctx
+from mcp_pool import get_mcp_server_pool
+from secret_files import get_secret
+from teleport_access import wc_kubeconfig
+
+
+def _remote_mcp_config(url: str) -> dict[str, Any]:
+    """Get the configuration of a remote mcp-kubernetes endpoint."""
+    settings = get_settings()
+    token = get_secret("mcp_kubernetes_token")
+    headers = {"Authorization": f"Bearer {token}"} if token else {}
+    return {
+        "type": settings.mcp_kubernetes_transport,
+        "url": url,
+        "headers": headers,
+    }
+
+
+def _fake_stdio_config(cluster: str) -> dict[str, Any]:
+    """Get the subprocess configuration of a fake cluster server (fake_mcp.py)."""
+    fixtures = get_settings().fake_cluster_fixtures or str(DEFAULT_FIXTURES)
+    script = os.path.join(os.path.dirname(__file__), "fake_mcp.py")
+    return {
+        "command": sys.executable,
+        "args": [script, "--cluster", cluster, "--fixtures", fixtures],
+    }
+
+
+def _wc_stdio_config() -> dict[str, Any]:
+    """Get the subprocess configuration of the workload cluster server."""
+    settings = get_settings()
+    if settings.fake_cluster:
+        return _fake_stdio_config("workload")
+    return {
+        "command": settings.mcp_kubernetes_path,
+        "args": shlex.split(settings.mcp_kubernetes_args),
+        "env": {"KUBECONFIG": wc_kubeconfig()},
+    }
+
+
+def _mc_stdio_config() -> dict[str, Any]:
+    """Get the subprocess configuration of the management cluster server."""
+    settings = get_settings()
+    if settings.fake_cluster:
+        return _fake_stdio_config("management")
+    if settings.mc_kubeconfig:
+        # Local development: use kubeconfig file
+        return {
+            "command": settings.mcp_kubernetes_path,
+            "args": shlex.split(settings.mcp_kubernetes_args),
+            "env": {"KUBECONFIG": settings.mc_kubeconfig},
+        }
+    else:
+        # Production: use in-cluster service account
+        return {
+            "command": settings.mcp_kubernetes_path,
+            "args": [*shlex.split(settings.mcp_kubernetes_args), "--in-cluster"],
+        }
+
+
+def _pooled_mcp_config(name: str) -> dict[str, Any] | None:
+    """Get the configuration of a pooled built-in server, if it is pooled."""
+    pool = get_mcp_server_pool()
+    url = pool.url(name) if pool is not None else None
+    return {"type": "http", "url": url} if url else None
+
+
+def get_wc_mcp_config() -> dict[str, Any]:
+    """
+    Get MCP server configuration for workload cluster.
+
+    Connects to MCP_KUBERNETES_WC_URL if set (mcp-kubernetes running as its
+    own deployment with its own RBAC), or to the pooled server if
+    SHOOT_MCP_POOL_ENABLED. Otherwise starts mcp-kubernetes as a subprocess
+    using the KUBECONFIG environment variable to connect to the workload
+    cluster; the binary and its arguments come from MCP_KUBERNETES_PATH and
+    MCP_KUBERNETES_ARGS.
+
+    A request targeting another cluster (cluster_target.py) always gets its
+    own subprocess with the kubeconfig fetched for it, and so does a request
+    impersonating its caller (impersonation.py).
+    """
+    settings = get_settings()
+    target = cluster_target_ctx.get()
+    if target is not None:
+        return impersonate_stdio_config(
+            {**_wc_stdio_config(), "env": {"KUBECONFIG": target.kubeconfig}}
+        )
+    if impersonation_ctx.get() is not None:
+        return impersonate_stdio_config(_wc_stdio_config())
+    if settings.mcp_kubernetes_wc_url:
+        return _remote_mcp_config(settings.mcp_kubernetes_wc_url)
+    return _pooled_mcp_config("kubernetes_wc") or _wc_stdio_config()
+
+
+def get_mc_mcp_config(impersonate: bool = True) -> dict[str, Any]:
+    """
+    Get MCP server configuration for management cluster.
+
+    Connects to MCP_KUBERNETES_MC_URL if set, or to the pooled server if
+    SHOOT_MCP_POOL_ENABLED. Otherwise starts mcp-kubernetes as a subprocess:
+    uses MC_KUBECONFIG if set (local development), otherwise uses
+    --in-cluster mode (production). The binary and its arguments come from
+    MCP_KUBERNETES_PATH and MCP_KUBERNETES_ARGS.
+
+    A request impersonating its caller gets its own subprocess acting as the
+    caller, unless `impersonate` is False (shoot's own reads).
+    """
+    settings = get_settings()
+    if impersonate and impersonation_ctx.get() is not None:
+        return impersonate_stdio_config(_mc_stdio_config())
+    if settings.mcp_kubernetes_mc_url:
+        return _remote_mcp_config(settings.mcp_kubernetes_mc_url)
+    return _pooled_mcp_config("kubernetes_mc") or _mc_stdio_config()
+
+
+def get_poolable_mcp_configs() -> dict[str, dict[str, Any]]:
+    """Get the subprocess configurations of the built-in servers without a remote URL."""
+    settings = get_settings()
+    configs = {}
+    if not settings.mcp_kubernetes_wc_url:
+        configs["kubernetes_wc"] = _wc_stdio_config()
+    if not settings.mcp_kubernetes_mc_url:
+        configs["kubernetes_mc"] = _mc_stdio_config()
+    return configs
+
+
+@asynccontextmanager
+async def connect_mcp_server(config: dict[str, Any]) -> AsyncIterator[ClientSession]:
+    """
+    Start or connect to an MCP server and open an initialized client session.
+
+    Raises:
+        Exception: The server cannot be started, connected to, or initialized
+    """
+    async with AsyncExitStack() as stack:
+        if config.get("type") == "http":
+            read, write, _ = await stack.enter_async_context(
+                streamablehttp_client(config["url"], headers=config.get("headers"))
+            )
+        elif config.get("type") == "sse":
+            read, write = await stack.enter_async_context(
+                sse_client(config["url"], headers=config.get("headers"))
+            )
+        else:
+            params = StdioServerParameters(
+                command=config["command"],
+                args=config.get("args", []),
+                env={**os.environ, **config.get("env", {})},
+            )
+            read, write = await stack.enter_async_context(stdio_client(params))
+        session = await stack.enter_async_context(ClientSession(read, write))
+        await session.initialize()
+        yield session
+
+
+async def call_mcp_tool(
+    session: ClientSession, tool_name: str, arguments: dict[str, Any]
+) -> str:
+    """
+    Call a tool of an MCP server and return the text of its result.
+
+    Raises:
+        ValueError: The tool reported an error
+    """
+    result = await session.call_tool(tool_name, arguments)
+    text = "\n".join(
+        block.text for block in result.content if getattr(block, "text", None)
+    )
+    if result.isError:
+        raise ValueError(text or f"{tool_name} failed")
+    return text
+
+
+def list_result_items(text: str) -> list[dict[str, Any]]:
+    """
+    Objects of a `list` result (with fullOutput).
+
+    Raises:
+        ValueError: The result is not a JSON object list
+    """
+    data = json.loads(text)
+    if isinstance(data, dict):
+        data = data.get("items", [])
+    if not isinstance(data, list):
+        raise ValueError("list result has no items")
+    return [item for item in data if isinstance(item, dict)]
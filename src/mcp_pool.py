@@ -0,0 +1,204 @@
+"""
+Shared pool of built-in MCP servers across investigations.
+
+By default every coordinator session starts its own mcp-kubernetes
+subprocesses and waits for their MCP handshake, which adds startup latency to
+every query. With SHOOT_MCP_POOL_ENABLED the built-in `kubernetes_wc` and
+`kubernetes_mc` servers are instead started once per process, serving
+streamable HTTP on a loopback port, and every session connects to them.
+
+A background task health-checks the pooled servers every
+SHOOT_MCP_POOL_HEALTH_INTERVAL_SECONDS and restarts servers whose process
+exited or whose port stopped accepting connections. Servers with a remote URL
+(MCP_KUBERNETES_WC_URL / MCP_KUBERNETES_MC_URL) are not pooled.
+
+Pooled servers run in their own process group with the MCP server resource
+limits (process_limits.py), and are restarted once they ran for
+SHOOT_MCP_SERVER_MAX_RUNTIME_SECONDS.
+"""
+
+import asyncio
+import contextlib
+import os
+import signal
+import socket
+from functools import lru_cache
+from typing import Any
+
+from app_logging import logger
+from config import get_settings
+from process_limits import apply_limits
+from telemetry import add_event
+
+# How long a pooled server may take to accept connections after starting
+_STARTUP_TIMEOUT_SECONDS = 30
+_STOP_TIMEOUT_SECONDS = 5
+
+
+def free_port() -> int:
+    """Pick a free loopback port for a local server."""
+    with socket.socket(socket.AF_INET, socket.SOCK_STREAM) as sock:
+        sock.bind(("127.0.0.1", 0))
+        return int(sock.getsockname()[1])
+
+
+async def _port_open(port: int) -> bool:
+    """Whether a server accepts connections on the loopback port."""
+    try:
+        _, writer = await asyncio.open_connection("127.0.0.1", port)
+    except OSError:
+        return False
+    writer.close()
+    await writer.wait_closed()
+    return True
+
+
+class PooledMcpServer:
+    """A long-lived mcp-kubernetes process serving streamable HTTP."""
+
+    def __init__(self, name: str, stdio_config: dict[str, Any]) -> None:
+        self.name = name
+        self._command: str = stdio_config["command"]
+        self._args: list[str] = stdio_config.get("args", [])
+        self._env: dict[str, str] = stdio_config.get("env", {})
+        self.port = free_port()
+        self.restarts = 0
+        self._process: asyncio.subprocess.Process | None = None
+        self._started = 0.0
+
+    @property
+    def url(self) -> str:
+        """Streamable HTTP endpoint of the server."""
+        return f"http://127.0.0.1:{self.port}/mcp"
+
+    async def start(self) -> None:
+        """
+        Start the server and wait until it accepts connections.
+
+        Raises:
+            RuntimeError: The server exited or did not come up in time
+        """
+        settings = get_settings()
+        self._process = await asyncio.create_subprocess_exec(
+            self._command,
+            *self._args,
+            "--transport",
+            "streamable-http",
+            "--http-addr",
+            f"127.0.0.1:{self.port}",
+            env={**os.environ, **self._env},
+            start_new_session=True,
+        )
+        apply_limits(
+            self._process.pid,
+            settings.mcp_server_memory_limit_mb,
+            settings.mcp_server_cpu_limit_seconds,
+        )
+        loop = asyncio.get_running_loop()
+        self._started = loop.time()
+        deadline = loop.time() + _STARTUP_TIMEOUT_SECONDS
+        while loop.time() < deadline:
+            if self._process.returncode is not None:
+                raise RuntimeError(
+                    f"MCP server {self.name} exited with code {self._process.returncode}"
+                )
+            if await _port_open(self.port):
+                logger.info(f"Pooled MCP server {self.name} listening on {self.url}")
+                return
+            await asyncio.sleep(0.2)
+        await self.stop()
+        raise RuntimeError(f"MCP server {self.name} did not start in time")
+
+    async def stop(self) -> None:
+        """Terminate the server process and any children it started."""
+        process, self._process = self._process, None
+        if process is None or process.returncode is not None:
+            return
+        with contextlib.suppress(ProcessLookupError):
+            os.killpg(process.pid, signal.SIGTERM)
+        try:
+            await asyncio.wait_for(process.wait(), _STOP_TIMEOUT_SECONDS)
+        except asyncio.TimeoutError:
+            with contextlib.suppress(ProcessLookupError):
+                os.killpg(process.pid, signal.SIGKILL)
+            await process.wait()
+
+    def expired(self) -> bool:
+        """Whether the server ran for the maximum runtime."""
+        max_runtime = get_settings().mcp_server_max_runtime_seconds
+        if not max_runtime or self._process is None:
+            return False
+        return asyncio.get_running_loop().time() - self._started >= max_runtime
+
+    async def healthy(self) -> bool:
+        """Whether the process runs and accepts connections."""
+        if self._process is None or self._process.returncode is not None:
+            return False
+        return await _port_open(self.port)
+
+
+class McpServerPool:
+    """Built-in MCP servers shared by all coordinator sessions."""
+
+    def __init__(self) -> None:
+        self._servers: dict[str, PooledMcpServer] = {}
+
+    def add(self, name: str, stdio_config: dict[str, Any]) -> None:
+        """Register a server to be pooled."""
+        self._servers[name] = PooledMcpServer(name, stdio_config)
+
+    def url(self, name: str) -> str | None:
+        """URL of a pooled server, or None if the server is not pooled."""
+        server = self._servers.get(name)
+        return server.url if server is not None else None
+
+    async def start(self) -> None:
+        """Start all pooled servers."""
+        await asyncio.gather(*(server.start() for server in self._servers.values()))
+
+    async def stop(self) -> None:
+        """Stop all pooled servers."""
+        await asyncio.gather(*(server.stop() for server in self._servers.values()))
+
+    async def check(self) -> None:
+        """Restart pooled servers that are not healthy or reached max runtime."""
+        for server in self._servers.values():
+            if server.expired():
+                logger.info(f"Pooled MCP server {server.name} reached max runtime")
+            elif await server.healthy():
+                continue
+            else:
+                logger.warning(f"Pooled MCP server {server.name} unhealthy, restarting")
+            add_event("mcp_pool_restart", {"server": server.name})
+            server.restarts += 1
+            await server.stop()
+            try:
+                await server.start()
+            except RuntimeError as e:
+                # Sessions report the server as failed until a check succeeds
+                logger.error(f"Failed to restart pooled MCP server: {e}")
+
+    async def run(self, interval_seconds: int) -> None:
+        """Health-check the pooled servers until cancelled."""
+        while True:
+            await asyncio.sleep(interval_seconds)
+            await self.check()
+
+    def status(self) -> dict[str, dict[str, Any]]:
+        """URL and restart count of each pooled server."""
+        return {
+            name: {"url": server.url, "restarts": server.restarts}
+            for name, server in self._servers.items()
+        }
+
+
+@lru_cache()
+def get_mcp_server_pool() -> McpServerPool | None:
+    """
+    Get the process-wide pool of built-in MCP servers.
+
+    Returns None if pooling is disabled.
+    """
+    if not get_settings().mcp_pool_enabled:
+        return None
+    return McpServerPool()
@@ -0,0 +1,146 @@
+"""
+shoot as an MCP server.
+
+Higher-level assistants delegate cluster debugging to shoot through two MCP
+tools:
+
+- `investigate_cluster`: run an investigation of a failure description and
+  return the report (takes minutes; clients need a matching tool timeout)
+- `get_investigation`: fetch a completed investigation by ID
+
+The tools are served over streamable HTTP at `/mcp/` of the API when
+SHOOT_MCP_SERVER_ENABLED is set, or over stdio by running this module:
+
+    python mcp_server.py
+
+Investigations are admitted and kept like `POST /` ones (delegation.py); the
+invocation chain is read from the X-Shoot-Invocation-Chain header, or from
+SHOOT_INVOCATION_CHAIN over stdio, and over HTTP the caller is mapped to its
+tenant (tenancy.py) and impersonated like on `POST /` (impersonation.py).
+"""
+
+import asyncio
+import os
+import uuid
+from functools import lru_cache
+from typing import Any
+
+from mcp.server.fastmcp import Context, FastMCP
+from mcp.server.fastmcp.exceptions import ToolError
+
+from delegation import admission_refusal, run_delegated_investigation
+from impersonation import enter_impersonation
+from invocation import INVOCATION_CHAIN_ENV, INVOCATION_CHAIN_HEADER
+from query_policy import QueryPolicyViolation, check_query
+from store import get_investigation_store
+from tenancy import enter_tenant, visible_to_caller
+from telemetry import trace_operation
+
+_INSTRUCTIONS = (
+    "shoot investigates failures in a Kubernetes workload cluster and its "
+    "management cluster and writes a diagnostic report with findings and "
+    "recommendations. Describe the failing resource and its symptoms."
+)
+
+
+async def investigate_cluster(
+    query: str, ctx: Context, timeout_seconds: int | None = None
+) -> dict[str, Any]:
+    """
+    Investigate a Kubernetes failure and return a diagnostic report.
+
+    Args:
+        query: Description of the failure, e.g. "Deployment api in namespace
+            shop is not ready"
+        timeout_seconds: Investigation timeout (default: the server's)
+    """
+    request = ctx.request_context.request
+    if request is not None:
+        chain = request.headers.get(INVOCATION_CHAIN_HEADER)
+        # Over stdio, the local user runs with shoot's own access
+        refusal = enter_tenant(request.headers) or enter_impersonation(
+            request.headers
+        )
+        if refusal is not None:
+            raise ToolError(refusal)
+    else:
+        chain = os.environ.get(INVOCATION_CHAIN_ENV)
+    # Refused queries don't count against the tenant's quotas
+    try:
+        query = check_query(query)
+    except QueryPolicyViolation as e:
+        raise ToolError(f"{e.rule}: {e.message}") from e
+    refusal = admission_refusal(chain)
+    if refusal is not None:
+        raise ToolError(refusal)
+
+    request_id = str(uuid.uuid4())
+    with trace_operation("mcp.investigate_cluster") as span:
+        span.set_attribute("request_id", request_id)
+        try:
+            record, similar = await run_delegated_investigation(
+                request_id, query, timeout_seconds
+            )
+        except asyncio.TimeoutError as e:
+            raise ToolError(f"Investigation {request_id} timed out") from e
+    return {
+        "investigation_id": request_id,
+        "report": record.result,
+        "truncated": record.truncated,
+        "triage": record.triage,
+        "similar_investigations": similar,
+        "total_cost_usd": record.total_cost_usd,
+    }
+
+
+async def get_investigation(investigation_id: str, ctx: Context) -> dict[str, Any]:
+    """
+    Get a completed investigation: its query, report, and metrics.
+
+    Args:
+        investigation_id: ID returned by investigate_cluster or the shoot API
+    """
+    request = ctx.request_context.request
+    if request is not None:
+        refusal = enter_tenant(request.headers)
+        if refusal is not None:
+            raise ToolError(refusal)
+    record = get_investigation_store().get(investigation_id)
+    if record is None or not visible_to_caller(record.tenant):
+        raise ToolError(f"Investigation {investigation_id} not found")
+    return record.model_dump(
+        include={
+            "id",
+            "query",
+            "cluster",
+            "created_at",
+            "result",
+            "structured",
+            "duration_ms",
+            "total_cost_usd",
+            "truncated",
+            "review",
+            "validation",
+            "triage",
+        }
+    )
+
+
+@lru_cache()
+def get_mcp_server() -> FastMCP:
+    """Get the MCP server exposing shoot's investigation tools."""
+    server = FastMCP(
+        "shoot",
+        instructions=_INSTRUCTIONS,
+        # Mounted at /mcp of the API
+        streamable_http_path="/",
+        # Replicas share no MCP session state
+        stateless_http=True,
+    )
+    server.add_tool(investigate_cluster)
+    server.add_tool(get_investigation)
+    return server
+
+
+if __name__ == "__main__":
+    get_mcp_server().run("stdio")
@@ -0,0 +1,40 @@
+"""
+Namespaces an investigation is restricted to.
+
+For customer-facing use, a request can name the namespaces a tenant may
+investigate (`namespaces`). The restriction is set for the request's
+context and enforced by the tool policy (tool_policy.py) when the session is
+created: Kubernetes tool calls must name one of the namespaces, calls across
+all namespaces and of cluster-scoped resources are refused, and tools that
+cannot be scoped to namespaces are not available. The coordinator and its
+collectors are told about the restriction, and caches and similar earlier
+investigations are scoped to it.
+"""
+
+from contextvars import ContextVar
+
+# Namespaces of the current request (sorted), None if it is not restricted
+namespace_scope_ctx: ContextVar[tuple[str, ...] | None] = ContextVar(
+    "namespace_scope", default=None
+)
+
+
+def namespace_scope_key() -> str:
+    """Suffix scoping cache keys to the restricted namespaces, if any."""
+    namespaces = namespace_scope_ctx.get()
+    if namespaces is None:
+        return ""
+    return f" in {','.join(namespaces)}"
+
+
+def namespace_note(namespaces: tuple[str, ...]) -> str:
+    """Prompt section telling an agent about the restriction."""
+    listed = ", ".join(f"`{namespace}`" for namespace in namespaces)
+    return (
+        "\n\n## Namespace Restriction\n\n"
+        f"This investigation is restricted to the namespaces {listed}. Every "
+        "Kubernetes call must name one of them; calls across all namespaces, "
+        "to other namespaces, and of cluster-scoped resources such as Nodes "
+        "are refused. Do not speculate about resources outside these "
+        "namespaces, and say so in the report if the cause may lie outside them."
+    )
@@ -0,0 +1,156 @@
+"""
+Size limit for collector MCP tool output.
+
+A single listing on a big cluster (e.g. `get pods -A -o yaml`) can exceed a
+collector's context window and fail the investigation. Tool output larger
+than SHOOT_TOOL_OUTPUT_MAX_TOKENS is shortened before the model sees it (see
+tool_output.py), depending on SHOOT_TOOL_OUTPUT_OVERFLOW:
+
+- truncate: the head and the tail of the output are kept, with a marker
+  naming how much was omitted;
+- summarize: the output is split into chunks that a small model summarizes
+  concurrently (map), and the summaries replace the output (reduce). If the
+  summaries are still too large, or summarizing fails, they are truncated;
+- paginate: the output is stored and returned page by page (output_pages.py).
+
+Output is redacted before it is summarized, so no Secret data is sent to the
+summary model.
+"""
+
+import asyncio
+from typing import Awaitable, Callable
+
+from app_logging import logger
+from config import ToolOutputOverflow, get_settings, get_tool_output_summary_prompt
+from llm import complete
+from output_pages import first_page
+from telemetry import add_event
+
+# Rough characters-per-token ratio of tool output
+_CHARS_PER_TOKEN = 4
+# Share of truncated output kept from the head; the rest comes from the tail
+_HEAD_FRACTION = 2 / 3
+# Size of the chunks summarized in one request
+_CHUNK_TOKENS = 50000
+# Larger output is truncated to this many chunks before summarizing
+_MAX_CHUNKS = 8
+# Longest summary of one chunk
+_MAX_SUMMARY_TOKENS = 4096
+
+
+def truncate_output(text: str, max_chars: int) -> str:
+    """Keep the head and tail of text, marking the omitted middle."""
+    if len(text) <= max_chars:
+        return text
+    head = int(max_chars * _HEAD_FRACTION)
+    tail = max_chars - head
+    omitted = len(text) - max_chars
+    return (
+        f"{text[:head]}\n"
+        f"[... {omitted} characters (~{omitted // _CHARS_PER_TOKEN} tokens) of "
+        "tool output omitted; request a narrower listing (namespace, label "
+        "selector, or a single resource) for the rest ...]\n"
+        f"{text[-tail:]}"
+    )
+
+
+def split_chunks(text: str, chunk_chars: int) -> list[str]:
+    """Split text into chunks of at most chunk_chars, on line boundaries if possible."""
+    chunks = []
+    while len(text) > chunk_chars:
+        cut = text.rfind("\n", 0, chunk_chars) + 1 or chunk_chars
+        chunks.append(text[:cut])
+        text = text[cut:]
+    if text:
+        chunks.append(text)
+    return chunks
+
+
+async def _summarize_chunk(
+    model: str, tool_name: str, chunk: str, part: str, max_tokens: int
+) -> str:
+    answer = await complete(
+        model,
+        get_tool_output_summary_prompt(),
+        f"## Output of {tool_name} ({part})\n{chunk}",
+        max_tokens,
+    )
+    return answer.text
+
+
+async def summarize_output(tool_name: str, text: str, max_chars: int) -> str:
+    """
+    Summarize oversized tool output in chunks with a small model.
+
+    Raises:
+        anthropic.APIError: A summary request failed
+    """
+    settings = get_settings()
+    chunk_chars = _CHUNK_TOKENS * _CHARS_PER_TOKEN
+    chunks = split_chunks(truncate_output(text, chunk_chars * _MAX_CHUNKS), chunk_chars)
+    # The summaries share the output limit
+    max_tokens = min(
+        _MAX_SUMMARY_TOKENS, max(256, max_chars // _CHARS_PER_TOKEN // len(chunks))
+    )
+    summaries = await asyncio.gather(
+        *(
+            _summarize_chunk(
+                settings.tool_output_summary_model or settings.collector_model,
+                tool_name,
+                chunk,
+                f"part {index} of {len(chunks)}",
+                max_tokens,
+            )
+            for index, chunk in enumerate(chunks, start=1)
+        )
+    )
+    summary = "\n".join(summary.strip() for summary in summaries)
+    return truncate_output(
+        f"[Summary of {len(text)} characters of {tool_name} output, which was "
+        "too large to return in full. Request a narrower listing for details.]\n"
+        f"{summary}",
+        max_chars,
+    )
+
+
+def exceeds_output_limit(text: str) -> bool:
+    """Whether tool output is over SHOOT_TOOL_OUTPUT_MAX_TOKENS."""
+    max_tokens = get_settings().tool_output_max_tokens
+    return max_tokens > 0 and len(text) > max_tokens * _CHARS_PER_TOKEN
+
+
+def create_output_limiter(
+    max_tokens: int, overflow: ToolOutputOverflow
+) -> Callable[[str, str], Awaitable[str]]:
+    """
+    Create the function shortening a tool's output to max_tokens.
+
+    Args:
+        max_tokens: Largest output passed on unchanged
+        overflow: How larger output is shortened
+    """
+    max_chars = max_tokens * _CHARS_PER_TOKEN
+
+    async def limit_output(tool_name: str, text: str) -> str:
+        if len(text) <= max_chars:
+            return text
+        add_event(
+            "tool_output_oversized",
+            {"tool": tool_name, "chars": len(text), "overflow": overflow},
+        )
+        if overflow == "paginate":
+            page = first_page(tool_name, text, max_chars)
+            if page is not None:
+                return page
+            logger.warning(f"Cannot page {tool_name} output, truncating")
+            return truncate_output(text, max_chars)
+        if overflow == "truncate":
+            return truncate_output(text, max_chars)
+        try:
+            return await summarize_output(tool_name, text, max_chars)
+        except Exception as e:
+            # Truncated output is still better than a failed tool call
+            logger.warning(f"Summarizing {tool_name} output failed, truncating: {e}")
+            return truncate_output(text, max_chars)
+
+    return limit_output
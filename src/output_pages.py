@@ -0,0 +1,121 @@
+"""
+Paged access to oversized tool output.
+
+With SHOOT_TOOL_OUTPUT_OVERFLOW=paginate, tool output over the size limit is
+not cut (see output_limit.py): the full text is stored as an artifact in
+memory and the collector receives the first page, with a footer naming the
+artifact. The built-in `fetch_more(artifact, offset)` tool, given to every
+collector in this mode, returns the following pages, so large listings can
+be read in full instead of losing data to truncation.
+
+Artifacts are kept process-wide, bounded by count and total size; the
+oldest are dropped first. Their IDs are random, so one investigation cannot
+read another's output by guessing.
+"""
+
+import secrets
+from collections import OrderedDict
+from threading import Lock
+from typing import Any
+
+from claude_agent_sdk import tool
+
+from telemetry import add_event
+
+# Stored artifacts, and their total size, before the oldest are dropped
+_MAX_ARTIFACTS = 200
+_MAX_TOTAL_CHARS = 50 * 1024 * 1024
+# Room left in a page for its footer, so pages stay within the output limit
+_FOOTER_CHARS = 400
+
+
+class OutputPages:
+    """Oversized tool outputs, by artifact ID."""
+
+    def __init__(self, max_artifacts: int, max_total_chars: int) -> None:
+        self._max_artifacts = max_artifacts
+        self._max_total_chars = max_total_chars
+        self._lock = Lock()
+        self._outputs: OrderedDict[str, tuple[str, int]] = OrderedDict()
+        self._total_chars = 0
+
+    def store(self, tool_name: str, text: str, page_chars: int) -> str:
+        """Store an output; returns its artifact ID."""
+        artifact = f"out-{secrets.token_hex(6)}"
+        with self._lock:
+            self._outputs[artifact] = (text, page_chars)
+            self._total_chars += len(text)
+            while self._outputs and (
+                len(self._outputs) > self._max_artifacts
+                or self._total_chars > self._max_total_chars
+            ):
+                _, (dropped, _) = self._outputs.popitem(last=False)
+                self._total_chars -= len(dropped)
+        add_event("tool_output_paged", {"tool": tool_name, "chars": len(text)})
+        return artifact
+
+    def page(self, artifact: str, offset: int) -> str | None:
+        """The page of an output starting at offset, with its footer."""
+        with self._lock:
+            entry = self._outputs.get(artifact)
+        if entry is None:
+            return None
+        text, page_chars = entry
+        offset = max(0, min(offset, len(text)))
+        end = min(offset + page_chars, len(text))
+        footer = f"[{artifact}: characters {offset}-{end} of {len(text)}."
+        if end < len(text):
+            footer += (
+                f' Call fetch_more with artifact="{artifact}" and offset={end} '
+                "for the next page, or request a narrower listing.]"
+            )
+        else:
+            footer += " End of output.]"
+        return f"{text[offset:end]}\n{footer}"
+
+
+_OUTPUT_PAGES = OutputPages(_MAX_ARTIFACTS, _MAX_TOTAL_CHARS)
+
+
+def get_output_pages() -> OutputPages:
+    """Get the process-wide store of paged tool outputs."""
+    return _OUTPUT_PAGES
+
+
+def first_page(tool_name: str, text: str, max_chars: int) -> str | None:
+    """
+    Store an oversized output and return its first page.
+
+    Returns None if the output could not be kept: it exceeds the total size
+    of stored outputs, or was dropped for newer ones right away.
+    """
+    page_chars = max(max_chars - _FOOTER_CHARS, 1)
+    pages = get_output_pages()
+    artifact = pages.store(tool_name, text, page_chars)
+    return pages.page(artifact, 0)
+
+
+@tool(
+    "fetch_more",
+    "Fetch the next page of a tool output that was too large to return at once. "
+    "Use the artifact and offset named in the footer of the previous page.",
+    {
+        "type": "object",
+        "properties": {
+            "artifact": {"type": "string"},
+            "offset": {"type": "integer", "minimum": 0},
+        },
+        "required": ["artifact", "offset"],
+    },
+)
+async def fetch_more(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: a page of a stored tool output."""
+    try:
+        offset = int(args.get("offset", 0))
+    except (TypeError, ValueError):
+        offset = 0
+    page = get_output_pages().page(str(args.get("artifact", "")), offset)
+    if page is None:
+        text = "Unknown or expired artifact; run the original tool call again."
+        return {"content": [{"type": "text", "text": text}], "is_error": True}
+    return {"content": [{"type": "text", "text": page}]}
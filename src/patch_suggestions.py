@@ -0,0 +1,127 @@
+"""
+Suggested patches for misconfigured resources.
+
+When a report identifies a misconfigured resource as the cause, a dedicated
+step proposes the merge patch that would correct it. Each patch is kept as a
+`suggested-patch-*.yaml` artifact of the investigation for the user to
+review and apply themselves, or to carry over into GitOps; shoot never
+applies it. Like the critic, the patch suggester has no tools and calls the
+Anthropic Messages API directly with a single request (llm.py).
+"""
+
+import re
+from typing import Any, Literal
+
+import yaml
+from pydantic import BaseModel, Field
+
+from app_logging import logger
+from config import get_patch_suggester_prompt, get_settings
+from llm import complete, format_report_input, parse_json_answer
+
+_MAX_OUTPUT_TOKENS = 4096
+PATCH_ARTIFACT_PREFIX = "suggested-patch-"
+_NAME_PATTERN = re.compile(r"[^\w.-]")
+
+
+class SuggestedPatch(BaseModel):
+    """Proposed merge patch of one resource."""
+
+    cluster: Literal["workload", "management"] = "workload"
+    api_version: str = ""
+    kind: str = Field(..., min_length=1)
+    namespace: str = ""
+    name: str = Field(..., min_length=1)
+    explanation: str = ""
+    patch: str = Field(..., min_length=1)
+
+
+class PatchSuggestions(BaseModel):
+    """Answer of the patch suggester."""
+
+    patches: list[SuggestedPatch] = Field(default_factory=list)
+
+
+def parse_suggestions(text: str) -> list[SuggestedPatch] | None:
+    """
+    Parse the suggester's JSON answer, tolerating surrounding prose or fences.
+
+    Patches that are not valid YAML mappings are dropped.
+    """
+    suggestions = parse_json_answer(text, PatchSuggestions)
+    if suggestions is None:
+        return None
+    valid = []
+    for patch in suggestions.patches:
+        try:
+            parsed = yaml.safe_load(patch.patch)
+        except yaml.YAMLError:
+            parsed = None
+        if isinstance(parsed, dict) and parsed:
+            valid.append(patch)
+        else:
+            logger.warning(f"Dropped invalid patch of {patch.kind}/{patch.name}")
+    return valid
+
+
+def _one_line(text: str) -> str:
+    """Model-written text for a comment line, with line breaks removed."""
+    return " ".join(text.split())
+
+
+def patch_artifact(index: int, patch: SuggestedPatch) -> tuple[str, str]:
+    """
+    Artifact name and content of a suggested patch.
+
+    The metadata written by the model goes into comment lines built one by
+    one, so it cannot add lines to the patch itself.
+    """
+    name = _NAME_PATTERN.sub("_", f"{patch.kind}-{patch.name}".lower())
+    kind = _one_line(patch.kind)
+    resource = _one_line(patch.name)
+    namespace = _one_line(patch.namespace)
+    header = [
+        "# Suggested by shoot; NOT applied. Review before applying.",
+        f"# {patch.cluster} cluster: {kind} {namespace}/{resource}",
+    ]
+    if patch.api_version:
+        header.append(f"# apiVersion: {_one_line(patch.api_version)}")
+    for line in patch.explanation.splitlines():
+        if line.strip():
+            header.append(f"# {line.strip()}")
+    namespace_flag = f" -n {namespace}" if namespace else ""
+    header.append(
+        f"# kubectl patch {kind.lower()} {resource}{namespace_flag} "
+        "--type merge --patch-file <this file>"
+    )
+    content = "\n".join(header) + "\n" + patch.patch.strip() + "\n"
+    return f"{PATCH_ARTIFACT_PREFIX}{index:02d}-{name}.yaml", content
+
+
+async def suggest_patches(
+    query: str, report: str, evidence: list[tuple[str, str]]
+) -> tuple[list[SuggestedPatch], dict[str, Any]]:
+    """
+    Propose patches for the misconfigured resources a report identifies.
+
+    Args:
+        query: Original failure description
+        report: Final report
+        evidence: (collector name, result text) for each collector call
+
+    Returns:
+        Tuple of (patches, empty if none apply or the answer could not be
+        parsed, token usage)
+    """
+    settings = get_settings()
+    answer = await complete(
+        settings.patch_suggester_model or settings.coordinator_model,
+        get_patch_suggester_prompt(),
+        format_report_input(query, "Report", report, evidence),
+        _MAX_OUTPUT_TOKENS,
+    )
+    patches = parse_suggestions(answer.text)
+    if patches is None:
+        logger.warning(f"Could not parse patch suggestions: {answer.text[:200]}")
+        return [], answer.usage
+    return patches, answer.usage
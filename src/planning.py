@@ -0,0 +1,131 @@
+"""
+Plan-only investigations.
+
+A plan-only request (`"plan_only": true`) previews an investigation without
+running it: the coordinator model writes the plan it would follow (which
+collectors, what they collect, which tools they are expected to call), and
+the cost of similar earlier investigations estimates what the full run
+would cost. No tool is called and no cluster is accessed; the planner calls
+the Anthropic Messages API directly with a single request (llm.py).
+"""
+
+import statistics
+from typing import Any
+
+from pydantic import BaseModel, Field
+
+from app_logging import logger
+from collectors import get_collector_registry
+from config import get_plan_prompt, get_settings
+from coordinator import INSTRUCTIONS_HEADING
+from generation import GenerationOverrides
+from llm import complete, parse_json_answer
+from similar_investigations import find_similar_investigations
+
+_MAX_OUTPUT_TOKENS = 2048
+# Similar earlier investigations the cost estimate is based on
+_ESTIMATE_SAMPLE = 5
+
+
+class PlanStep(BaseModel):
+    """One collector run of a planned investigation."""
+
+    collector: str
+    goal: str = ""
+    queries: list[str] = Field(default_factory=list)
+    expected_tools: list[str] = Field(default_factory=list)
+
+
+class InvestigationPlan(BaseModel):
+    """Investigation plan written by the planner."""
+
+    summary: str = ""
+    hypotheses: list[str] = Field(default_factory=list)
+    steps: list[PlanStep] = Field(default_factory=list)
+
+
+def describe_collectors_for_planning() -> str:
+    """Markdown list of the registered collectors, their purpose, and tools."""
+    lines = []
+    for name, spec in get_collector_registry().collectors.items():
+        tools = ", ".join([*spec.tools, *spec.effective_builtin_tools()])
+        lines.append(f"- `{name}`: {spec.description} Tools: {tools}")
+    return "\n".join(lines)
+
+
+def parse_plan(text: str) -> InvestigationPlan | None:
+    """Parse the planner's JSON plan, tolerating surrounding prose or fences."""
+    return parse_json_answer(text, InvestigationPlan)
+
+
+def check_plan(plan: InvestigationPlan) -> list[str]:
+    """Steps naming collectors or tools that are not registered."""
+    collectors = get_collector_registry().collectors
+    problems = []
+    for step in plan.steps:
+        spec = collectors.get(step.collector)
+        if spec is None:
+            problems.append(f"unknown collector {step.collector}")
+            continue
+        known = {*spec.tools, *spec.effective_builtin_tools()}
+        problems.extend(
+            f"{step.collector} has no tool {tool}"
+            for tool in step.expected_tools
+            if tool not in known
+        )
+    return problems
+
+
+def estimate_cost(query: str) -> dict[str, Any]:
+    """
+    Estimate the cost of investigating a query from similar earlier
+    investigations of the cluster.
+
+    Returns:
+        The median cost in USD (None without similar costed investigations)
+        and the IDs of the investigations it is based on
+    """
+    similar = [
+        record
+        for _, record in find_similar_investigations(query, _ESTIMATE_SAMPLE)
+        if record.total_cost_usd is not None
+    ]
+    costs = [record.total_cost_usd for record in similar]
+    return {
+        "cost_usd": round(statistics.median(costs), 4) if costs else None,
+        "based_on": [record.id for record in similar],
+    }
+
+
+async def plan_investigation(
+    query: str,
+    generation: GenerationOverrides | None = None,
+    instructions: str | None = None,
+) -> tuple[InvestigationPlan | None, str, dict[str, Any]]:
+    """
+    Write the plan of an investigation without running it.
+
+    Args:
+        query: Failure description
+        generation: Per-request coordinator model override
+        instructions: Per-request instructions for the coordinator
+
+    Returns:
+        Tuple of (plan or None if it could not be parsed, planner text,
+        token usage)
+    """
+    settings = get_settings()
+    generation = generation or GenerationOverrides()
+    system = get_plan_prompt(describe_collectors_for_planning())
+    if instructions:
+        system += f"{INSTRUCTIONS_HEADING}{instructions}"
+    answer = await complete(
+        generation.model or settings.coordinator_model,
+        system,
+        f"## Failure description\n{query}",
+        _MAX_OUTPUT_TOKENS,
+    )
+    plan = parse_plan(answer.text)
+    if plan is None:
+        logger.warning(f"Could not parse investigation plan: {answer.text[:200]}")
+    return plan, answer.text.strip(), answer.usage
@@ -0,0 +1,56 @@
+"""
+Files only shoot can read.
+
+Kubeconfigs carrying credentials (fetched, written by Teleport, or rewritten
+for impersonation) and the claude CLI wrapper script are kept in private
+temporary directories, created on first use with mode 0700. Files are
+written with mode 0600 (or the mode given) to a new file and renamed, so
+processes reading them, such as running MCP servers, never see a partial
+file.
+"""
+
+import os
+import shutil
+import tempfile
+from pathlib import Path
+from threading import Lock
+
+
+class PrivateDirectory:
+    """A temporary directory readable by shoot only, created on first use."""
+
+    def __init__(self, prefix: str) -> None:
+        self._prefix = prefix
+        self._path: Path | None = None
+        self._lock = Lock()
+
+    @property
+    def path(self) -> Path:
+        """Path of the directory, created if there is none."""
+        with self._lock:
+            if self._path is None:
+                # mkdtemp creates it readable by shoot only
+                self._path = Path(tempfile.mkdtemp(prefix=self._prefix))
+            return self._path
+
+    def write(self, name: str, content: str, mode: int = 0o600) -> str:
+        """
+        Write a file to the directory, replacing it atomically.
+
+        Returns:
+            Path of the file
+        """
+        path = self.path / name
+        partial = path.with_name(f"{name}.partial")
+        fd = os.open(partial, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, mode)
+        with os.fdopen(fd, "w") as f:
+            f.write(content)
+        partial.replace(path)
+        return str(path)
+
+    def remove(self) -> None:
+        """Remove the directory and its files; it is created again on use."""
+        with self._lock:
+            if self._path is not None:
+                shutil.rmtree(self._path, ignore_errors=True)
+                self._path = None
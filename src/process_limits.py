@@ -0,0 +1,205 @@
+"""
+Resource limits for spawned subprocesses.
+
+A runaway MCP server or claude CLI (a leak, a busy loop, a hung call) must
+not take the service down with it. The subprocesses shoot spawns get
+rlimits:
+
+- stdio MCP servers are started through this script, which applies
+  SHOOT_MCP_SERVER_MEMORY_LIMIT_MB (data segment, i.e. heap) and
+  SHOOT_MCP_SERVER_CPU_LIMIT_SECONDS and stops the server after
+  SHOOT_MCP_SERVER_MAX_RUNTIME_SECONDS or when it is terminated itself. The
+  server stays in the process group of the claude CLI that started it, so
+  it is killed together with the CLI:
+
+      python process_limits.py [--memory-mb N] [--cpu-seconds N]
+          [--max-runtime-seconds N] [--new-session] -- COMMAND [ARGS...]
+
+- pooled MCP servers (mcp_pool.py) get the same limits, run in their own
+  process group, and are restarted once they ran for the maximum runtime;
+- the claude CLI gets SHOOT_CLAUDE_CLI_MEMORY_LIMIT_MB and
+  SHOOT_CLAUDE_CLI_CPU_LIMIT_SECONDS; its runtime is bounded by the
+  investigation timeout. The agent_sdk backend starts it through a script
+  running this one with --new-session, so the CLI and the MCP servers it
+  starts get a process group of their own, stopped together.
+
+Processes spawned by shoot itself get their limits right after they start
+(prlimit), as a preexec_fn is not safe in a process running threads. This
+script sets them on itself before it starts the command, which inherits
+them. A limit of 0 leaves the resource unlimited. Limits cannot exceed the
+hard limits shoot itself runs with, and are lowered to them.
+"""
+
+import argparse
+import contextlib
+import os
+import resource
+import shlex
+import shutil
+import signal
+import subprocess  # nosec B404
+import sys
+from functools import lru_cache
+from pathlib import Path
+from types import FrameType
+from typing import Any
+
+from config import get_settings
+from private_files import PrivateDirectory
+
+_SCRIPT = str(Path(__file__).resolve())
+# Time a server gets to exit after SIGTERM before it is killed
+_KILL_GRACE_SECONDS = 5
+
+
+def _set_limit(pid: int, limit: int, value: int) -> None:
+    """Set a soft and hard rlimit of a process, capped at its hard limit."""
+    _, hard = resource.prlimit(pid, limit)
+    if hard != resource.RLIM_INFINITY:
+        value = min(value, hard)
+    resource.prlimit(pid, limit, (value, value))
+
+
+def apply_limits(pid: int, memory_mb: int, cpu_seconds: int) -> None:
+    """
+    Apply memory and CPU limits to a running process (0: this process).
+
+    A process that already exited is left alone.
+    """
+    with contextlib.suppress(ProcessLookupError):
+        if memory_mb:
+            _set_limit(pid, resource.RLIMIT_DATA, memory_mb * 1024 * 1024)
+        if cpu_seconds:
+            _set_limit(pid, resource.RLIMIT_CPU, cpu_seconds)
+
+
+@lru_cache()
+def limited_cli_path() -> str:
+    """
+    Path of a script starting the claude CLI with its limits, in a process
+    group of its own.
+
+    Used as the CLI path of the agent_sdk backend, which starts the CLI
+    itself.
+    """
+    settings = get_settings()
+    cli = shutil.which(settings.claude_cli_path) or settings.claude_cli_path
+    command = [
+        sys.executable,
+        _SCRIPT,
+        "--memory-mb",
+        str(settings.claude_cli_memory_limit_mb),
+        "--cpu-seconds",
+        str(settings.claude_cli_cpu_limit_seconds),
+        "--new-session",
+        "--",
+        cli,
+    ]
+    script = f'#!/bin/sh\nexec {shlex.join(command)} "$@"\n'
+    return PrivateDirectory("shoot-claude-").write("claude", script, mode=0o700)
+
+
+def limited_stdio_config(
+    config: dict[str, Any], memory_mb: int, cpu_seconds: int, max_runtime: int
+) -> dict[str, Any]:
+    """A stdio MCP server config starting the server through this script."""
+    if not memory_mb and not cpu_seconds and not max_runtime:
+        return config
+    args = [
+        _SCRIPT,
+        "--memory-mb",
+        str(memory_mb),
+        "--cpu-seconds",
+        str(cpu_seconds),
+        "--max-runtime-seconds",
+        str(max_runtime),
+        "--",
+        config["command"],
+        *config.get("args", []),
+    ]
+    return {**config, "command": sys.executable, "args": args}
+
+
+def limit_mcp_processes(
+    server_configs: dict[str, dict[str, Any]],
+) -> dict[str, dict[str, Any]]:
+    """Apply the MCP server limits to the stdio servers of MCP server configs."""
+    settings = get_settings()
+    return {
+        name: (
+            config
+            if config.get("type") in ("sdk", "sse", "http")
+            else limited_stdio_config(
+                config,
+                settings.mcp_server_memory_limit_mb,
+                settings.mcp_server_cpu_limit_seconds,
+                settings.mcp_server_max_runtime_seconds,
+            )
+        )
+        for name, config in server_configs.items()
+    }
+
+
+def _signal(process: subprocess.Popen[bytes], signum: int, group: bool) -> None:
+    """Signal a process, or with `group` its process group."""
+    if not group:
+        process.send_signal(signum)
+        return
+    with contextlib.suppress(ProcessLookupError):
+        os.killpg(process.pid, signum)
+
+
+def _stop(process: subprocess.Popen[bytes], group: bool = False) -> int:
+    """Stop a process: SIGTERM, then SIGKILL after a grace period."""
+    _signal(process, signal.SIGTERM, group)
+    try:
+        code = process.wait(_KILL_GRACE_SECONDS)
+    except subprocess.TimeoutExpired:
+        process.kill()
+        code = process.wait()
+    if group:
+        # Children may outlive the command
+        _signal(process, signal.SIGKILL, group)
+    return code
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description="Run a command with rlimits")
+    parser.add_argument("--memory-mb", type=int, default=0)
+    parser.add_argument("--cpu-seconds", type=int, default=0)
+    parser.add_argument("--max-runtime-seconds", type=int, default=0)
+    parser.add_argument("--new-session", action="store_true")
+    parser.add_argument("command", nargs=argparse.REMAINDER)
+    args = parser.parse_args()
+    command = args.command[1:] if args.command[:1] == ["--"] else args.command
+    if not command:
+        parser.error("no command given")
+
+    # Inherited by the command
+    apply_limits(0, args.memory_mb, args.cpu_seconds)
+    # stdin and stdout (the MCP transport) are inherited by the server
+    process = subprocess.Popen(  # nosec B603
+        command, start_new_session=args.new_session
+    )
+
+    def forward(signum: int, frame: FrameType | None) -> None:
+        sys.exit(_stop(process, args.new_session))
+
+    signal.signal(signal.SIGTERM, forward)
+    signal.signal(signal.SIGINT, forward)
+    try:
+        code = process.wait(args.max_runtime_seconds or None)
+    except subprocess.TimeoutExpired:
+        print(
+            f"{command[0]} ran longer than {args.max_runtime_seconds}s, stopping it",
+            file=sys.stderr,
+        )
+        return _stop(process, args.new_session)
+    if args.new_session:
+        # Servers the command left behind
+        _signal(process, signal.SIGKILL, True)
+    return code
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -0,0 +1,144 @@
+"""
+Progress events of investigations.
+
+Streaming investigations can report what the agents are doing while they
+run, derived from the tool calls in the session's message stream:
+
+    coordinator: delegating to wc_collector: Inspect the failing pods
+    wc_collector: running get pods -n kube-system
+    wc_collector: finished
+    coordinator: analyzing results
+
+Events are derived from Agent SDK messages (`observe_message`) or from the
+stream-json events of the claude CLI (`observe_event`), which carry the same
+content as dictionaries.
+"""
+
+import json
+from dataclasses import asdict, dataclass
+from typing import Any
+
+from claude_agent_sdk import (
+    AssistantMessage,
+    ToolResultBlock,
+    ToolUseBlock,
+    UserMessage,
+)
+
+COORDINATOR = "coordinator"
+# Longest tool call description in an event
+_MAX_DESCRIPTION_LENGTH = 160
+
+
+@dataclass(frozen=True)
+class ProgressEvent:
+    """What an agent of an investigation is doing."""
+
+    agent: str
+    message: str
+
+    def to_dict(self) -> dict[str, str]:
+        return asdict(self)
+
+    def __str__(self) -> str:
+        return f"{self.agent}: {self.message}"
+
+
+def server_sent_event(event: str, data: dict[str, Any]) -> str:
+    """A server-sent event with a JSON payload."""
+    return f"event: {event}\ndata: {json.dumps(data)}\n\n"
+
+
+def describe_tool_call(name: str, tool_input: dict[str, Any]) -> str:
+    """
+    Short description of an MCP tool call, e.g. `get pods -n kube-system`
+    for mcp__kubernetes_wc__get with resourceType=pods and namespace=kube-system.
+    """
+    tool = name.split("__", 2)[-1]
+    words = [tool]
+    words.extend(
+        str(value)
+        for key, value in tool_input.items()
+        if key != "namespace" and isinstance(value, (str, int, float)) and value != ""
+    )
+    namespace = tool_input.get("namespace")
+    if isinstance(namespace, str) and namespace:
+        words.append(f"-n {namespace}")
+    return " ".join(words)[:_MAX_DESCRIPTION_LENGTH]
+
+
+class ProgressTracker:
+    """Derives progress events from the message stream of one session."""
+
+    def __init__(self) -> None:
+        # tool_use_id -> subagent type of in-flight Task delegations
+        self._tasks: dict[str, str] = {}
+
+    def _tool_use(
+        self,
+        tool_use_id: str,
+        name: str,
+        tool_input: dict[str, Any],
+        parent_tool_use_id: str | None,
+    ) -> list[ProgressEvent]:
+        if name == "Task":
+            subagent = str(tool_input.get("subagent_type", "subagent"))
+            self._tasks[tool_use_id] = subagent
+            description = tool_input.get("description")
+            detail = f": {description}" if description else ""
+            return [ProgressEvent(COORDINATOR, f"delegating to {subagent}{detail}")]
+        if not name.startswith("mcp__"):
+            return []
+        agent = COORDINATOR
+        if parent_tool_use_id:
+            agent = self._tasks.get(parent_tool_use_id, "subagent")
+        return [
+            ProgressEvent(agent, f"running {describe_tool_call(name, tool_input)}")
+        ]
+
+    def _tool_result(self, tool_use_id: str) -> list[ProgressEvent]:
+        subagent = self._tasks.pop(tool_use_id, None)
+        if subagent is None:
+            return []
+        events = [ProgressEvent(subagent, "finished")]
+        if not self._tasks:
+            events.append(ProgressEvent(COORDINATOR, "analyzing results"))
+        return events
+
+    def observe_message(self, message: Any) -> list[ProgressEvent]:
+        """Progress events of an Agent SDK message."""
+        events: list[ProgressEvent] = []
+        if isinstance(message, AssistantMessage):
+            parent = getattr(message, "parent_tool_use_id", None)
+            for block in message.content:
+                if isinstance(block, ToolUseBlock):
+                    events.extend(
+                        self._tool_use(block.id, block.name, block.input, parent)
+                    )
+        elif isinstance(message, UserMessage) and not isinstance(message.content, str):
+            for block in message.content:
+                if isinstance(block, ToolResultBlock):
+                    events.extend(self._tool_result(block.tool_use_id))
+        return events
+
+    def observe_event(self, event: dict[str, Any]) -> list[ProgressEvent]:
+        """Progress events of a claude CLI stream-json event."""
+        content = (event.get("message") or {}).get("content")
+        if not isinstance(content, list):
+            return []
+        events: list[ProgressEvent] = []
+        for block in content:
+            if not isinstance(block, dict):
+                continue
+            if event.get("type") == "assistant" and block.get("type") == "tool_use":
+                events.extend(
+                    self._tool_use(
+                        str(block.get("id", "")),
+                        str(block.get("name", "")),
+                        block.get("input") or {},
+                        event.get("parent_tool_use_id"),
+                    )
+                )
+            elif event.get("type") == "user" and block.get("type") == "tool_result":
+                events.extend(self._tool_result(str(block.get("tool_use_id", ""))))
+        return events
@@ -0,0 +1,56 @@
+"""
+Prompt reload without restarts.
+
+Prompt templates are cached in memory. They are loaded again when an admin
+calls POST /admin/reload, or, if SHOOT_PROMPTS_WATCH_INTERVAL_SECONDS is set,
+when the prompts directory (for example a mounted ConfigMap) changes.
+Investigations already running keep the prompts they started with.
+"""
+
+import asyncio
+from typing import Any
+
+from app_logging import logger
+from config import get_prompt_version, prompt_files_fingerprint, reload_prompts
+from telemetry import add_event
+
+
+def reload_prompt_templates(reason: str) -> dict[str, Any]:
+    """
+    Reload the prompt templates and report the prompt version change.
+
+    Raises:
+        OSError: A prompt file cannot be read; the previous prompts are kept
+        ValueError: A prompt is invalid; the previous prompts are kept
+    """
+    previous = get_prompt_version()
+    reload_prompts()
+    current = get_prompt_version()
+    if current != previous:
+        logger.info(f"Reloaded prompts ({reason}): version {previous} -> {current}")
+        add_event(
+            "prompts_reloaded",
+            {"reason": reason, "previous_version": previous, "version": current},
+        )
+    return {
+        "previous_prompt_version": previous,
+        "prompt_version": current,
+        "changed": current != previous,
+    }
+
+
+async def watch_prompts(interval_seconds: int) -> None:
+    """Reload the prompts whenever the prompts directory changes, until cancelled."""
+    fingerprint = prompt_files_fingerprint()
+    while True:
+        await asyncio.sleep(interval_seconds)
+        current = prompt_files_fingerprint()
+        if current == fingerprint:
+            continue
+        try:
+            reload_prompt_templates("watch")
+        except (OSError, ValueError) as e:
+            # Retried on the next check while files are being replaced
+            logger.warning(f"Failed to reload changed prompts: {e}")
+            continue
+        fingerprint = current
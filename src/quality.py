@@ -0,0 +1,88 @@
+"""
+Investigation quality metrics from user feedback.
+
+Thumbs-up/down ratings of investigation reports are aggregated per model and
+prompt version, so decisions about which prompts and models to promote can
+be based on how their reports were received. The mean hallucination rate from
+report post-validation is reported alongside. Shadow re-runs are excluded, as
+users never see them.
+
+Each rating is also counted as an OpenTelemetry metric
+(`shoot.feedback.ratings`), labeled with the rating, models, and prompt
+version, so approval can be tracked over time across replicas.
+"""
+
+from functools import lru_cache
+from typing import Any, Literal
+
+from opentelemetry.metrics import Counter
+
+from store import Feedback, InvestigationRecord
+from telemetry import get_meter
+
+QualityDimension = Literal["coordinator_model", "collector_model", "prompt_version"]
+QUALITY_DIMENSIONS: tuple[QualityDimension, ...] = (
+    "coordinator_model",
+    "collector_model",
+    "prompt_version",
+)
+
+
+@lru_cache()
+def _feedback_counter() -> Counter:
+    return get_meter().create_counter(
+        "shoot.feedback.ratings",
+        description="Report ratings by rating, model, and prompt version",
+    )
+
+
+def record_feedback_metric(record: InvestigationRecord, feedback: Feedback) -> None:
+    """Count a rating of an investigation report."""
+    attributes = {name: getattr(record, name) for name in QUALITY_DIMENSIONS}
+    _feedback_counter().add(1, {"rating": feedback.rating, **attributes})
+
+
+def aggregate_quality(
+    records: list[InvestigationRecord], dimensions: tuple[QualityDimension, ...]
+) -> list[dict[str, Any]]:
+    """
+    Aggregate feedback of investigations grouped by the given dimensions.
+
+    Returns one entry per group, most rated first, with the number of
+    investigations, ratings, the share of thumbs-up among ratings, and the
+    mean hallucination rate of validated reports.
+    """
+    groups: dict[tuple[str, ...], dict[str, Any]] = {}
+    for record in records:
+        if record.shadow_of is not None:
+            continue
+        key = tuple(getattr(record, dimension) for dimension in dimensions)
+        group = groups.setdefault(
+            key,
+            {
+                **dict(zip(dimensions, key)),
+                "investigations": 0,
+                "rated": 0,
+                "up": 0,
+                "down": 0,
+                "_hallucination_rates": [],
+            },
+        )
+        group["investigations"] += 1
+        if record.feedback is not None:
+            group["rated"] += 1
+            group[record.feedback.rating] += 1
+        if record.validation is not None:
+            group["_hallucination_rates"].append(
+                record.validation["hallucination_rate"]
+            )
+
+    for group in groups.values():
+        group["approval_rate"] = (
+            round(group["up"] / group["rated"], 3) if group["rated"] else None
+        )
+        rates = group.pop("_hallucination_rates")
+        group["hallucination_rate"] = (
+            round(sum(rates) / len(rates), 3) if rates else None
+        )
+    return sorted(groups.values(), key=lambda group: -group["rated"])
@@ -0,0 +1,133 @@
+"""
+Sanitization and policy checks of incoming queries.
+
+Every query, whatever interface it arrives on (HTTP, MCP, A2A, Teams), and
+the per-request instructions appended to the coordinator prompt are checked
+before an investigation starts:
+
+- control and invisible formatting characters (zero-width spaces,
+  bidirectional overrides), which can hide instructions from a human
+  reader, are stripped; newlines and tabs are kept;
+- queries longer than SHOOT_QUERY_MAX_LENGTH characters are refused;
+- queries matching one of SHOOT_QUERY_DENIED_PATTERNS (case-insensitive
+  regular expressions, matched against the NFKC-normalized query so
+  look-alike characters do not evade them) are refused. The defaults refuse
+  requests to reveal credentials, to override the agents' instructions, and
+  commands to change the cluster; set the setting to `[]` to disable them.
+
+A refused query raises QueryPolicyViolation, which the interfaces turn into
+a structured error naming the violated rule. Denied queries are
+audit-logged.
+"""
+
+import re
+import unicodedata
+from typing import Any
+
+from app_logging import audit
+from config import get_settings
+from telemetry import add_event
+
+# Violated rules
+INVALID_RULE = "invalid"
+TOO_LONG_RULE = "too_long"
+DENIED_PATTERN_RULE = "denied_pattern"
+
+DEFAULT_DENIED_PATTERNS = [
+    # Requests to read out credentials: an imperative at the start of a
+    # sentence, so descriptions of failures involving secrets pass
+    r"(^|[.!?]\s+)\s*(please\s+)?((can|could|would) you\s+)?(reveal|dump|print|"
+    r"show me|output|exfiltrate|leak|decode|base64 -d)\b[^.?!\n]{0,60}"
+    r"\b(secrets?|passwords?|tokens?|credentials?|private keys?|kubeconfigs?)\b",
+    # Overriding the agents' instructions
+    r"\b(ignore|disregard|forget)\b[^.?!\n]{0,20}\b(previous|prior|above|system)"
+    r"\b[^.?!\n]{0,20}\b(instructions|prompts?|rules)\b",
+    # Commands to change the cluster rather than investigate it
+    r"^\s*(please\s+)?(kubectl\s+)?(delete|scale|patch|apply|drain|cordon|"
+    r"rollback|exec)\s+(the\s+|all\s+|every\s+)?(into\b|-|pods?\b|deploy|"
+    r"statefulsets?\b|daemonsets?\b|nodes?\b|namespaces?\b|services?\b|"
+    r"pvcs?\b|helmreleases?\b|resources?\b|clusters?\b)",
+]
+
+# Characters kept although their category is control
+_KEPT_CONTROL = {"\n", "\t"}
+
+
+class QueryPolicyViolation(Exception):
+    """A query was refused by the query policy."""
+
+    def __init__(self, rule: str, message: str, status_code: int = 400) -> None:
+        super().__init__(message)
+        self.rule = rule
+        self.message = message
+        self.status_code = status_code
+
+    def detail(self) -> dict[str, Any]:
+        """Structured error for API responses."""
+        return {
+            "error": "Query policy violation",
+            "rule": self.rule,
+            "message": self.message,
+        }
+
+
+def strip_control_characters(text: str) -> str:
+    """Remove control and formatting characters except newlines and tabs."""
+    return "".join(
+        char
+        for char in text.replace("\r\n", "\n")
+        if char in _KEPT_CONTROL or unicodedata.category(char) not in ("Cc", "Cf")
+    )
+
+
+def denied_patterns() -> list[re.Pattern[str]]:
+    """The configured denied query patterns."""
+    patterns = get_settings().query_denied_patterns
+    if patterns is None:
+        patterns = DEFAULT_DENIED_PATTERNS
+    return [re.compile(pattern, re.IGNORECASE | re.MULTILINE) for pattern in patterns]
+
+
+def check_query(query: Any, field: str = "query") -> str:
+    """
+    Sanitize a query and check it against the query policy.
+
+    Args:
+        query: The query, or other text steering the investigation
+        field: Name of the text in error messages (e.g. "instructions")
+
+    Returns:
+        The sanitized query
+
+    Raises:
+        QueryPolicyViolation: The query is missing, too long, or denied
+    """
+    name = field.capitalize()
+    if not isinstance(query, str):
+        raise QueryPolicyViolation(INVALID_RULE, f"{name} is required")
+    query = strip_control_characters(query).strip()
+    if not query:
+        raise QueryPolicyViolation(INVALID_RULE, f"{name} is required")
+    max_length = get_settings().query_max_length
+    if len(query) > max_length:
+        add_event("query_policy_violation", {"rule": TOO_LONG_RULE})
+        raise QueryPolicyViolation(
+            TOO_LONG_RULE,
+            f"{name} is {len(query)} characters long, at most {max_length} are allowed",
+            status_code=413,
+        )
+
+    normalized = unicodedata.normalize("NFKC", query)
+    for pattern in denied_patterns():
+        if pattern.search(normalized):
+            audit(
+                "query_denied", field=field, pattern=pattern.pattern, query=query[:500]
+            )
+            add_event("query_policy_violation", {"rule": DENIED_PATTERN_RULE})
+            raise QueryPolicyViolation(
+                DENIED_PATTERN_RULE,
+                f"{name} refused: it asks for something shoot does not do, as "
+                "it diagnoses clusters read-only and never reveals credentials",
+                status_code=403,
+            )
+    return query
@@ -0,0 +1,127 @@
+"""
+Recorded MCP tool responses for offline investigations.
+
+The MCP servers of the collectors are replaced by in-process servers that
+expose the same tool names but answer from recorded responses instead of a
+cluster. Investigations can then be re-run deterministically against the
+current prompts and models, without cluster access (evaluate.py).
+
+A recorded call with arguments answers calls with exactly these arguments;
+one without arguments answers any call of its tool, in recording order, the
+last one repeating. Calls without a recorded response get an error result
+and are reported as unmatched.
+"""
+
+from typing import Any
+
+from claude_agent_sdk import SdkMcpTool, create_sdk_mcp_server, tool
+from pydantic import BaseModel, Field
+
+from collectors import (
+    BUILTIN_TOOLS,
+    CLUSTER_BUILTIN_TOOLS,
+    SHOOT_TOOLS_SERVER,
+    CollectorRegistry,
+)
+
+# Input schema of recorded tools without a recorded schema
+_ANY_INPUT_SCHEMA: dict[str, Any] = {
+    "type": "object",
+    "properties": {},
+    "additionalProperties": True,
+}
+
+
+class RecordedCall(BaseModel):
+    """A recorded MCP tool call and its response."""
+
+    tool: str = Field(..., description="Qualified tool name, mcp__<server>__<tool>")
+    input: dict[str, Any] | None = Field(
+        default=None, description="Arguments; None answers any call of the tool"
+    )
+    output: str
+    is_error: bool = False
+
+
+class RecordedTools:
+    """Answers tool calls from recorded responses."""
+
+    def __init__(self, calls: list[RecordedCall]) -> None:
+        self._calls = calls
+        # Position of the next call-any response per tool
+        self._next_any: dict[str, int] = {}
+        self.unmatched: list[dict[str, Any]] = []
+
+    def respond(self, name: str, arguments: dict[str, Any]) -> RecordedCall | None:
+        """Recorded response to a call, or None if there is none."""
+        calls = [call for call in self._calls if call.tool == name]
+        for call in calls:
+            if call.input == arguments:
+                return call
+        any_calls = [call for call in calls if call.input is None]
+        if not any_calls:
+            self.unmatched.append({"tool": name, "input": arguments})
+            return None
+        position = self._next_any.get(name, 0)
+        self._next_any[name] = position + 1
+        return any_calls[min(position, len(any_calls) - 1)]
+
+
+def _recorded_tool(
+    recording: RecordedTools, qualified_name: str, schema: dict[str, Any] | None
+) -> SdkMcpTool[Any]:
+    name = qualified_name.split("__", 2)[2]
+
+    async def handler(args: dict[str, Any]) -> dict[str, Any]:
+        call = recording.respond(qualified_name, args)
+        if call is None:
+            return {
+                "content": [{"type": "text", "text": "No recorded response"}],
+                "is_error": True,
+            }
+        return {
+            "content": [{"type": "text", "text": call.output}],
+            "is_error": call.is_error,
+        }
+
+    return tool(name, f"Recorded {name} tool", schema or _ANY_INPUT_SCHEMA)(handler)
+
+
+def recorded_server_configs(
+    registry: CollectorRegistry,
+    recording: RecordedTools,
+    schemas: dict[str, dict[str, Any]] | None = None,
+) -> dict[str, Any]:
+    """
+    MCP server configs answering the collectors' tools from a recording.
+
+    Args:
+        registry: Collectors whose MCP servers are replaced; built-in tools
+            are kept, except those reading the cluster (Helm release tools)
+        recording: Recorded responses
+        schemas: Input schemas by qualified tool name, so the model sees the
+            arguments of the real tools (default: any arguments)
+    """
+    servers: dict[str, dict[str, SdkMcpTool[Any]]] = {}
+    for spec in registry.collectors.values():
+        tools = servers.setdefault(spec.mcp_server, {})
+        for name in spec.tools:
+            qualified_name = f"mcp__{spec.mcp_server}__{name}"
+            tools[name] = _recorded_tool(
+                recording, qualified_name, (schemas or {}).get(qualified_name)
+            )
+    builtin = dict(BUILTIN_TOOLS)
+    for spec in registry.collectors.values():
+        for name in set(spec.effective_builtin_tools()) & CLUSTER_BUILTIN_TOOLS:
+            qualified_name = f"mcp__{SHOOT_TOOLS_SERVER}__{name}"
+            builtin[name] = _recorded_tool(
+                recording, qualified_name, (schemas or {}).get(qualified_name)
+            )
+    configs: dict[str, Any] = registry.server_configs()
+    if SHOOT_TOOLS_SERVER in configs:
+        servers[SHOOT_TOOLS_SERVER] = builtin
+    for server, tools in servers.items():
+        configs[server] = create_sdk_mcp_server(
+            name=server, version="1.0.0", tools=list(tools.values())
+        )
+    return configs
@@ -0,0 +1,318 @@
+"""
+Redaction of cluster data for the Shoot agent system.
+
+MCP tool output is redacted before it is submitted to the model, so Secret
+data, tokens, certificates and keys, and kubeconfig contents never leave the
+installation in prompts. JSON and YAML output is redacted by structure
+(Secret `data`/`stringData`, credential-named fields); all output is then
+scanned for PEM blocks, JSON Web Tokens, authorization headers, and
+credential-named `key: value` pairs.
+
+Final reports are scrubbed before they are returned to clients: the same
+free-text rules, configurable extra patterns, an entropy heuristic for keys
+and tokens, and optional IP address and hostname masking.
+
+Redaction of cluster data is deliberately aggressive: unknown annotations,
+labels, and fields may carry tokens or customer data. Some of them are
+exactly what investigations need, though (release versions, app and cluster
+references, cert-manager and Helm ownership). The allowlist names the keys
+that are known to be safe and must never be masked.
+
+Entries are shell-style patterns matched against a field path or an
+annotation/label key, e.g. `release.giantswarm.io/*` or `status.conditions`.
+Installations extend the built-in defaults with SHOOT_REDACTION_ALLOWLIST.
+"""
+
+import json
+import math
+import re
+from collections import Counter
+from fnmatch import fnmatchcase
+from functools import lru_cache
+from typing import Any
+
+import yaml
+
+from config import get_settings
+from telemetry import add_event
+
+# Keys that are safe and useful for every installation
+DEFAULT_REDACTION_ALLOWLIST = (
+    # Giant Swarm release, app, and cluster metadata
+    "giantswarm.io/*",
+    "*.giantswarm.io/*",
+    # Well-known Kubernetes, Helm, and Cluster API metadata
+    "app.kubernetes.io/*",
+    "helm.sh/chart",
+    "meta.helm.sh/*",
+    "cluster.x-k8s.io/*",
+    "kubernetes.io/*",
+    "*.kubernetes.io/*",
+    "cert-manager.io/*",
+    # Status fields needed to judge health
+    "status.conditions",
+    "status.phase",
+    "status.replicas",
+    "status.readyReplicas",
+)
+
+
+class RedactionAllowlist:
+    """Patterns of field paths and annotation/label keys that are never redacted."""
+
+    def __init__(self, patterns: tuple[str, ...]) -> None:
+        self.patterns = patterns
+
+    def allows(self, key: str) -> bool:
+        """Whether the field path or annotation/label key is safe to keep."""
+        return any(fnmatchcase(key, pattern) for pattern in self.patterns)
+
+
+def parse_allowlist(value: str) -> tuple[str, ...]:
+    """Parse a comma-separated list of allowlist patterns."""
+    return tuple(pattern.strip() for pattern in value.split(",") if pattern.strip())
+
+
+@lru_cache()
+def get_redaction_allowlist() -> RedactionAllowlist:
+    """Get the built-in allowlist extended by SHOOT_REDACTION_ALLOWLIST."""
+    extra = parse_allowlist(get_settings().redaction_allowlist)
+    return RedactionAllowlist(DEFAULT_REDACTION_ALLOWLIST + extra)
+
+
+# =============================================================================
+# Redaction
+# =============================================================================
+
+REDACTED = "[REDACTED]"
+
+# Keys whose values are credentials, wherever they appear
+_SENSITIVE_KEY_PATTERN = re.compile(
+    r"(password|passwd|secret|token|api[_-]?key|private[_-]?key|credentials?|"
+    r"client-key-data|client-certificate-data|certificate-authority-data)$",
+    re.IGNORECASE,
+)
+# Credentials in free text (logs, describe output, non-parseable output)
+_TEXT_PATTERNS = [
+    # PEM blocks: certificates and keys
+    (
+        re.compile(
+            r"-----BEGIN ([A-Z0-9 ]+)-----.*?-----END \1-----", re.DOTALL
+        ),
+        r"[REDACTED \1]",
+    ),
+    # JSON Web Tokens (service account tokens, OIDC tokens)
+    (re.compile(r"\beyJ[\w-]{8,}\.[\w-]{8,}\.[\w-]+"), REDACTED),
+    # Authorization headers
+    (
+        re.compile(r"\b(Bearer|Basic)\s+[\w\-.~+/=]{8,}", re.IGNORECASE),
+        rf"\1 {REDACTED}",
+    ),
+]
+# `key: value` / `key=value` pairs in free text with a sensitive key
+_TEXT_KEY_VALUE_PATTERN = re.compile(
+    r"(?P<key>[\w.\-/]*(password|passwd|secret|token|api[_-]?key|private[_-]?key|"
+    r"client-key-data|client-certificate-data|certificate-authority-data))"
+    r"(?P<sep>\"?\s*[:=]\s*\"?)(?!\[REDACTED)(?P<value>[^\s\",}]{4,})",
+    re.IGNORECASE,
+)
+
+
+class Redactor:
+    """Masks Secret data, credentials, certificates, and kubeconfig contents."""
+
+    def __init__(self, allowlist: RedactionAllowlist) -> None:
+        self.allowlist = allowlist
+        self.count = 0
+
+    def _keep(self, key: str, path: str) -> bool:
+        return self.allowlist.allows(key) or self.allowlist.allows(path)
+
+    def _mask(self) -> str:
+        self.count += 1
+        return REDACTED
+
+    def redact_object(self, value: Any, path: str = "") -> Any:
+        """Redact a parsed Kubernetes object (or list of objects)."""
+        if isinstance(value, list):
+            return [self.redact_object(item, path) for item in value]
+        if not isinstance(value, dict):
+            return value
+
+        is_secret = value.get("kind") == "Secret"
+        redacted = {}
+        for key, item in value.items():
+            item_path = f"{path}.{key}" if path else str(key)
+            if self._keep(str(key), item_path):
+                redacted[key] = item
+            elif is_secret and key in ("data", "stringData") and isinstance(item, dict):
+                redacted[key] = {name: self._mask() for name in item}
+            elif isinstance(item, str) and _SENSITIVE_KEY_PATTERN.search(str(key)):
+                redacted[key] = self._mask()
+            else:
+                redacted[key] = self.redact_object(item, item_path)
+
+        if is_secret:
+            # The last applied configuration repeats the Secret data
+            annotations = redacted.get("metadata", {}).get("annotations", {})
+            if "kubectl.kubernetes.io/last-applied-configuration" in annotations:
+                annotations["kubectl.kubernetes.io/last-applied-configuration"] = (
+                    self._mask()
+                )
+        return redacted
+
+    def redact_text(self, text: str) -> str:
+        """Redact credentials in free text."""
+        for pattern, replacement in _TEXT_PATTERNS:
+            text, count = pattern.subn(replacement, text)
+            self.count += count
+
+        def mask_value(match: re.Match[str]) -> str:
+            if self.allowlist.allows(match.group("key")):
+                return match.group(0)
+            return f"{match.group('key')}{match.group('sep')}{self._mask()}"
+
+        return _TEXT_KEY_VALUE_PATTERN.sub(mask_value, text)
+
+    def redact(self, text: str) -> str:
+        """
+        Redact tool output.
+
+        JSON and YAML output is parsed so Secret data can be masked by
+        structure; everything is then scanned for credentials in free text.
+        """
+        stripped = text.lstrip()
+        if stripped.startswith(("{", "[")):
+            try:
+                data = json.loads(text)
+            except ValueError:
+                pass
+            else:
+                text = json.dumps(self.redact_object(data), indent=2)
+        elif "kind: Secret" in text or "kind: Config" in text:
+            try:
+                documents = list(yaml.safe_load_all(text))
+            except yaml.YAMLError:
+                pass
+            else:
+                text = yaml.safe_dump_all(
+                    [self.redact_object(doc) for doc in documents], sort_keys=False
+                )
+        return self.redact_text(text)
+
+
+def redact_tool_output(text: str) -> tuple[str, int]:
+    """Redact tool output with the configured allowlist; returns (text, redactions)."""
+    redactor = Redactor(get_redaction_allowlist())
+    redacted = redactor.redact(text)
+    return redacted, redactor.count
+
+
+# =============================================================================
+# Final report scrubbing
+# =============================================================================
+
+# Candidate keys/tokens for the entropy heuristic
+_TOKEN_CANDIDATE_PATTERN = re.compile(r"(?<![\w/+=-])[A-Za-z0-9+/_=-]{20,}(?![\w/+=-])")
+# Identifiers that look random but are not secrets: hex digests and UIDs
+_NOT_SECRET_PATTERN = re.compile(
+    r"[0-9a-f]+|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}",
+    re.IGNORECASE,
+)
+# Kubernetes object names (DNS labels joined by "-"), including generated pod
+# names with ReplicaSet and pod hash suffixes, e.g.
+# cluster-autoscaler-7d9f8b6c5d-x2k4p
+_OBJECT_NAME_PATTERN = re.compile(r"[a-z0-9]+(?:-[a-z0-9]+)+")
+# Minimum Shannon entropy (bits per character) of a masked token
+_MIN_TOKEN_ENTROPY = 4.2
+_IPV4_PATTERN = re.compile(r"(?<![\w.])(?:\d{1,3}\.){3}\d{1,3}(?:/\d{1,2})?(?![\w.])")
+# Hostnames with at least three labels, e.g. api.example.gigantic.io
+_HOSTNAME_PATTERN = re.compile(
+    r"(?<![\w.-])(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.){2,}[a-z]{2,63}(?![\w.-])",
+    re.IGNORECASE,
+)
+
+
+def shannon_entropy(value: str) -> float:
+    """Shannon entropy of a string in bits per character."""
+    counts = Counter(value)
+    return -sum(
+        count / len(value) * math.log2(count / len(value)) for count in counts.values()
+    )
+
+
+def _looks_like_secret(token: str) -> bool:
+    """Entropy heuristic for keys and tokens."""
+    if _NOT_SECRET_PATTERN.fullmatch(token) or _OBJECT_NAME_PATTERN.fullmatch(token):
+        return False
+    has_letters = any(c.isalpha() for c in token)
+    has_digits = any(c.isdigit() for c in token)
+    return has_letters and has_digits and shannon_entropy(token) >= _MIN_TOKEN_ENTROPY
+
+
+class ReportScrubber:
+    """Scrubs sensitive data from final reports before they leave the service."""
+
+    def __init__(
+        self,
+        patterns: list[re.Pattern[str]],
+        mask_ips: bool,
+        mask_hostnames: bool,
+    ) -> None:
+        self.patterns = patterns
+        self.mask_ips = mask_ips
+        self.mask_hostnames = mask_hostnames
+
+    def scrub(self, text: str) -> tuple[str, int]:
+        """Scrub a report; returns the scrubbed text and the number of masks."""
+        redactor = Redactor(get_redaction_allowlist())
+        text = redactor.redact_text(text)
+        count = redactor.count
+
+        for pattern in self.patterns:
+            text, masked = pattern.subn(REDACTED, text)
+            count += masked
+
+        def mask_token(match: re.Match[str]) -> str:
+            nonlocal count
+            if not _looks_like_secret(match.group(0)):
+                return match.group(0)
+            count += 1
+            return REDACTED
+
+        text = _TOKEN_CANDIDATE_PATTERN.sub(mask_token, text)
+        if self.mask_ips:
+            text, masked = _IPV4_PATTERN.subn("[IP]", text)
+            count += masked
+        if self.mask_hostnames:
+            text, masked = _HOSTNAME_PATTERN.subn("[HOSTNAME]", text)
+            count += masked
+        return text, count
+
+
+@lru_cache()
+def get_report_scrubber() -> ReportScrubber | None:
+    """
+    Get the final report scrubber configured by SHOOT_SCRUB_*.
+
+    Returns None if scrubbing is disabled.
+    """
+    settings = get_settings()
+    if not settings.scrub_enabled:
+        return None
+    return ReportScrubber(
+        [re.compile(pattern) for pattern in settings.scrub_patterns],
+        settings.scrub_mask_ips,
+        settings.scrub_mask_hostnames,
+    )
+
+
+def scrub_report(text: str) -> str:
+    """Scrub a final report if scrubbing is enabled."""
+    scrubber = get_report_scrubber()
+    if scrubber is None or not text:
+        return text
+    scrubbed, count = scrubber.scrub(text)
+    if count:
+        add_event("report_scrubbed", {"masked": count})
+    return scrubbed
@@ -0,0 +1,253 @@
+"""
+Opt-in remediation by a dedicated remediator agent.
+
+shoot is read-only by default. With SHOOT_REMEDIATION_ENABLED set, a request
+can confirm remediation (`"remediate": true`); the coordinator then gets a
+`remediator` subagent with three narrowly scoped write tools:
+
+- `restart_deployment`: rolling restart of a workload cluster Deployment
+- `delete_pod`: delete a stuck workload cluster Pod
+- `resume_helmrelease`: resume a suspended HelmRelease on the management
+  cluster
+
+The tools are in-process and run the write through a separate mcp-kubernetes
+process started for the call, with SHOOT_REMEDIATION_MCP_ARGS instead of the
+collectors' --non-destructive arguments; no agent ever sees that server's
+generic write tools. Every remediation call waits for an admin's approval
+(approvals.py), whatever SHOOT_APPROVAL_REQUIRED_TOOLS says, and every
+executed or failed write is audit-logged.
+"""
+
+import os
+import shlex
+from datetime import datetime, timezone
+from typing import Any, Literal
+
+from claude_agent_sdk import AgentDefinition, create_sdk_mcp_server, tool
+from mcp import ClientSession, StdioServerParameters
+from mcp.client.stdio import stdio_client
+
+from app_logging import audit, logger
+from cluster_target import cluster_target_ctx
+from config import get_collector_prompt, get_settings
+from impersonation import impersonate_process
+from teleport_access import wc_kubeconfig
+from telemetry import add_event
+
+REMEDIATION_SERVER = "shoot_remediation"
+REMEDIATOR = "remediator"
+# Pattern of the remediation tools, always subject to approval
+REMEDIATION_TOOLS_PATTERN = f"mcp__{REMEDIATION_SERVER}__*"
+# Appended to the coordinator prompt when remediation is confirmed
+REMEDIATION_NOTE = (
+    "\n\n## Remediation\n\n"
+    f"Remediation was confirmed for this investigation. After the cause is "
+    f"established from collected evidence, you may delegate to the "
+    f"`{REMEDIATOR}` agent to restart a Deployment, delete a stuck Pod, or "
+    "resume a suspended HelmRelease, if that action addresses the cause. Each "
+    "action waits for a human's approval and may be denied. Never remediate "
+    "on a hypothesis, and report every action taken or denied."
+)
+
+Cluster = Literal["wc", "mc"]
+
+
+class RemediationError(Exception):
+    """A remediation write failed."""
+
+
+def _write_server_params(cluster: Cluster) -> StdioServerParameters:
+    """mcp-kubernetes started with write access to a cluster."""
+    settings = get_settings()
+    args = shlex.split(settings.remediation_mcp_args)
+    env = dict(os.environ)
+    if cluster == "wc":
+        # Writes go to the cluster the request targets
+        target = cluster_target_ctx.get()
+        env["KUBECONFIG"] = target.kubeconfig if target else wc_kubeconfig()
+    elif settings.mc_kubeconfig:
+        env["KUBECONFIG"] = settings.mc_kubeconfig
+    else:
+        args.append("--in-cluster")
+    # Writes are made as the caller of an impersonating request
+    args, env = impersonate_process(args, env)
+    return StdioServerParameters(
+        command=settings.mcp_kubernetes_path, args=args, env=env
+    )
+
+
+async def _call_write_tool(
+    cluster: Cluster, tool_name: str, arguments: dict[str, Any]
+) -> str:
+    """
+    Call an mcp-kubernetes tool with write access.
+
+    Raises:
+        RemediationError: The tool call failed
+    """
+    async with stdio_client(_write_server_params(cluster)) as (read, write):
+        async with ClientSession(read, write) as session:
+            await session.initialize()
+            result = await session.call_tool(tool_name, arguments)
+    text = "\n".join(
+        block.text for block in result.content if getattr(block, "text", None)
+    )
+    if result.isError:
+        raise RemediationError(text or f"{tool_name} failed")
+    return text
+
+
+def _text(text: str, is_error: bool = False) -> dict[str, Any]:
+    result: dict[str, Any] = {"content": [{"type": "text", "text": text}]}
+    if is_error:
+        result["is_error"] = True
+    return result
+
+
+async def _remediate(
+    action: str,
+    cluster: Cluster,
+    tool_name: str,
+    arguments: dict[str, Any],
+) -> dict[str, Any]:
+    """Run a remediation write and audit its outcome."""
+    target = f"{arguments['namespace']}/{arguments['name']}"
+    add_event("remediation", {"action": action, "cluster": cluster})
+    try:
+        output = await _call_write_tool(cluster, tool_name, arguments)
+    except Exception as e:
+        logger.error(f"Remediation {action} of {target} failed: {e}")
+        audit(
+            "remediation_failed",
+            action=action,
+            cluster=cluster,
+            target=target,
+            error=str(e),
+        )
+        return _text(f"{action} of {target} failed: {e}", is_error=True)
+    logger.warning(f"Remediation {action} of {target} executed")
+    audit("remediation_executed", action=action, cluster=cluster, target=target)
+    return _text(f"{action} of {target} done. {output}".strip())
+
+
+_TARGET_SCHEMA = {
+    "type": "object",
+    "properties": {
+        "namespace": {"type": "string", "minLength": 1},
+        "name": {"type": "string", "minLength": 1},
+    },
+    "required": ["namespace", "name"],
+}
+
+
+@tool(
+    "restart_deployment",
+    "Rolling restart of a Deployment in the workload cluster. Pods are "
+    "replaced one by one according to the Deployment's rollout strategy.",
+    _TARGET_SCHEMA,
+)
+async def restart_deployment(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: set the restartedAt annotation of the pod template."""
+    restarted_at = datetime.now(timezone.utc).isoformat()
+    patch = {
+        "spec": {
+            "template": {
+                "metadata": {
+                    "annotations": {"kubectl.kubernetes.io/restartedAt": restarted_at}
+                }
+            }
+        }
+    }
+    return await _remediate(
+        "restart_deployment",
+        "wc",
+        "patch",
+        {
+            "resourceType": "deployments",
+            "namespace": args["namespace"],
+            "name": args["name"],
+            "patchType": "merge",
+            "patch": patch,
+        },
+    )
+
+
+@tool(
+    "delete_pod",
+    "Delete a Pod in the workload cluster that is stuck (e.g. Terminating, "
+    "Unknown, or wedged in CrashLoopBackOff) so its controller replaces it. "
+    "Never use it on Pods without a controller.",
+    _TARGET_SCHEMA,
+)
+async def delete_pod(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: delete the Pod."""
+    return await _remediate(
+        "delete_pod",
+        "wc",
+        "delete",
+        {
+            "resourceType": "pods",
+            "namespace": args["namespace"],
+            "name": args["name"],
+        },
+    )
+
+
+@tool(
+    "resume_helmrelease",
+    "Resume a suspended Flux HelmRelease on the management cluster, so it is "
+    "reconciled again.",
+    _TARGET_SCHEMA,
+)
+async def resume_helmrelease(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: set spec.suspend of the HelmRelease to false."""
+    return await _remediate(
+        "resume_helmrelease",
+        "mc",
+        "patch",
+        {
+            "resourceType": "helmreleases.helm.toolkit.fluxcd.io",
+            "namespace": args["namespace"],
+            "name": args["name"],
+            "patchType": "merge",
+            "patch": {"spec": {"suspend": False}},
+        },
+    )
+
+
+REMEDIATION_TOOLS = {
+    "restart_deployment": restart_deployment,
+    "delete_pod": delete_pod,
+    "resume_helmrelease": resume_helmrelease,
+}
+
+
+def remediation_tool_names() -> set[str]:
+    """Qualified names of the remediation tools."""
+    return {f"mcp__{REMEDIATION_SERVER}__{name}" for name in REMEDIATION_TOOLS}
+
+
+def create_remediation_server() -> Any:
+    """In-process MCP server with the remediation tools."""
+    return create_sdk_mcp_server(
+        name=REMEDIATION_SERVER,
+        version="1.0.0",
+        tools=list(REMEDIATION_TOOLS.values()),
+    )
+
+
+def create_remediator_definition() -> AgentDefinition:
+    """The remediator subagent, restricted to the remediation tools."""
+    settings = get_settings()
+    return AgentDefinition(
+        description=(
+            "Use this agent ONLY to remediate a cause established from collected "
+            "evidence: restart a workload cluster Deployment, delete a stuck "
+            "workload cluster Pod, or resume a suspended HelmRelease on the "
+            "management cluster. Every action needs a human's approval. This "
+            "agent cannot collect data."
+        ),
+        prompt=get_collector_prompt("remediator_prompt.md", {}),
+        tools=sorted(remediation_tool_names()),
+        model=settings.coordinator_model,  # type: ignore[arg-type]
+    )
@@ -0,0 +1,166 @@
+"""
+Shadow replay of stored investigations.
+
+Re-runs a filtered set of past investigations against the current prompts
+and models, stores the re-runs as shadow investigations, and records a
+comparison against each original. Used to quantify the effect of prompt or
+model changes on real past incidents. Each re-run targets the original's
+cluster, namespaces, and tenant; investigations run as an impersonated user
+are not replayed, as the user's credentials are not available to the replay.
+"""
+
+import asyncio
+import uuid
+from datetime import datetime, timezone
+from typing import Any, Literal
+
+from pydantic import BaseModel, Field
+
+from activity import get_activity_tracker
+from app_logging import audit, logger
+from background import spawn_background
+from backend import get_backend
+from cluster_kubeconfig import ClusterUnavailableError, get_kubeconfig_cache
+from cluster_target import cluster_target_ctx
+from compare import compare_investigations
+from config import get_settings
+from cost_export import export_investigation_cost
+from namespace_scope import namespace_scope_ctx
+from store import InvestigationRecord, get_investigation_store, record_from_result
+from tenancy import tenant_cluster_refusal, tenant_ctx
+
+
+class ReplayItem(BaseModel):
+    """Outcome of re-running a single stored investigation."""
+
+    original_id: str
+    shadow_id: str | None = None
+    comparison: dict[str, Any] | None = None
+    error: str | None = None
+
+
+class ReplayRun(BaseModel):
+    """A batch replay of stored investigations."""
+
+    id: str
+    filter: str
+    created_at: str = Field(
+        default_factory=lambda: datetime.now(timezone.utc).isoformat()
+    )
+    status: Literal["running", "completed"] = "running"
+    total: int = 0
+    items: list[ReplayItem] = Field(default_factory=list)
+
+
+# Replay runs are kept for the lifetime of the process
+_REPLAY_RUNS: dict[str, ReplayRun] = {}
+
+
+def select_investigations(query_filter: str, limit: int) -> list[InvestigationRecord]:
+    """
+    Select stored (non-shadow) investigations whose query contains the filter.
+
+    The match is case-insensitive; an empty filter selects all investigations.
+    The most recent investigations are selected first.
+    """
+    needle = query_filter.lower()
+    selected = [
+        record
+        for record in reversed(get_investigation_store().list())
+        if record.shadow_of is None and needle in record.query.lower()
+    ]
+    return selected[:limit]
+
+
+async def _enter_original_scope(original: InvestigationRecord, shadow_id: str) -> None:
+    """
+    Target the cluster, namespaces, and tenant of an original investigation.
+
+    Raises:
+        ValueError: The original cannot be replayed with its scope
+        ClusterUnavailableError: The original's cluster cannot be reached
+    """
+    if original.user is not None:
+        raise ValueError(
+            f"Investigations impersonating {original.user} are not replayed"
+        )
+    settings = get_settings()
+    tenant_ctx.set(original.tenant)
+    cluster = original.cluster or settings.wc_cluster
+    namespace = original.cluster_namespace or settings.org_ns
+    refusal = tenant_cluster_refusal(cluster)
+    if refusal is not None:
+        raise ValueError(refusal)
+    if original.namespaces is not None:
+        namespace_scope_ctx.set(tuple(original.namespaces))
+    if cluster == settings.wc_cluster and namespace == settings.org_ns:
+        return
+    if not settings.dynamic_clusters_enabled:
+        raise ValueError(
+            f"Cluster {cluster} cannot be targeted: per-request clusters are "
+            "disabled (SHOOT_DYNAMIC_CLUSTERS_ENABLED)"
+        )
+    audit("request_cluster", request_id=shadow_id, cluster=cluster, namespace=namespace)
+    cluster_target_ctx.set(await get_kubeconfig_cache().get(namespace, cluster))
+
+
+async def _replay_one(original: InvestigationRecord) -> ReplayItem:
+    """
+    Re-run one investigation in shadow mode and compare it to the original.
+
+    Runs as its own task, so the scope it enters does not leak into the
+    replay of the next investigation.
+    """
+    shadow_id = str(uuid.uuid4())
+    try:
+        await _enter_original_scope(original, shadow_id)
+    except (ValueError, ClusterUnavailableError) as e:
+        logger.warning(f"Investigation {original.id} not replayed: {e}")
+        return ReplayItem(original_id=original.id, error=str(e))
+    try:
+        with get_activity_tracker().investigation(shadow_id):
+            # Bypass the collector cache so replays gather fresh evidence
+            result = await get_backend().run(
+                original.query, use_collector_cache=False
+            )
+    except Exception as e:
+        logger.exception(f"Replay of investigation {original.id} failed")
+        return ReplayItem(original_id=original.id, error=str(e))
+
+    shadow = record_from_result(
+        shadow_id, original.query, result, shadow_of=original.id
+    )
+    get_investigation_store().add(shadow)
+    export_investigation_cost(shadow)
+    return ReplayItem(
+        original_id=original.id,
+        shadow_id=shadow_id,
+        comparison=compare_investigations(original, shadow),
+    )
+
+
+async def _run_replay(run: ReplayRun, originals: list[InvestigationRecord]) -> None:
+    """Replay investigations sequentially to bound load on clusters and the model API."""
+    for original in originals:
+        run.items.append(await asyncio.create_task(_replay_one(original)))
+    run.status = "completed"
+    logger.info(
+        f"Replay {run.id} completed: {len(run.items)} investigations, "
+        f"{sum(1 for item in run.items if item.error)} failed"
+    )
+
+
+def start_replay(query_filter: str, limit: int) -> ReplayRun:
+    """Start a background replay of matching investigations and return its run."""
+    originals = select_investigations(query_filter, limit)
+    run = ReplayRun(id=str(uuid.uuid4()), filter=query_filter, total=len(originals))
+    _REPLAY_RUNS[run.id] = run
+
+    logger.info(f"Starting replay {run.id} of {run.total} investigations")
+    spawn_background(_run_replay(run, originals))
+    return run
+
+
+def get_replay(replay_id: str) -> ReplayRun | None:
+    """Return a replay run by ID, or None if unknown."""
+    return _REPLAY_RUNS.get(replay_id)
@@ -0,0 +1,77 @@
+"""
+Offline replay of a recorded investigation.
+
+Runs the investigation of a recording bundle (the recording.json artifact of
+an investigation requested with `"record": true`) again, with the model and
+tool traffic served from the recording (traffic_recording.py), so it needs
+neither network nor cluster access. Used to debug an investigation after the
+fact and as a deterministic integration test of the orchestration.
+
+    python replay_recording.py BUNDLE [--json]
+
+Prints the report and the requests the recording had no response for, and
+exits with status 1 if the replay failed or left requests unanswered. The
+critic review is skipped; the report writer must be disabled
+(SHOOT_REPORT_WRITER_ENABLED), as neither is recorded.
+"""
+
+import argparse
+import asyncio
+import json
+import sys
+from pathlib import Path
+from typing import Any
+
+from pydantic import ValidationError
+
+from coordinator import run_coordinator
+from traffic_recording import RecordingBundle, TrafficSession
+
+
+async def replay_bundle(bundle: RecordingBundle) -> dict[str, Any]:
+    """Replay a recording and report its result and unanswered requests."""
+    async with TrafficSession.replaying(bundle) as traffic:
+        result = await run_coordinator(
+            bundle.query, use_collector_cache=False, verify=False, traffic=traffic
+        )
+    assert traffic.recorded_tools is not None
+    return {
+        "result": result["result"],
+        "num_turns": result["num_turns"],
+        "unmatched_model_requests": traffic.proxy.unmatched,
+        "unmatched_tool_calls": traffic.recorded_tools.unmatched,
+    }
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description="Replay a recorded investigation")
+    parser.add_argument("bundle", type=Path, help="recording bundle (JSON)")
+    parser.add_argument("--json", action="store_true", help="print results as JSON")
+    args = parser.parse_args()
+
+    try:
+        bundle = RecordingBundle.model_validate_json(args.bundle.read_text())
+    except (OSError, ValidationError) as e:
+        print(f"Invalid recording {args.bundle}: {e}", file=sys.stderr)
+        return 1
+
+    try:
+        outcome = asyncio.run(replay_bundle(bundle))
+    except Exception as e:
+        print(f"Replay failed: {e}", file=sys.stderr)
+        return 1
+
+    if args.json:
+        print(json.dumps(outcome, indent=2))
+    else:
+        print(outcome["result"])
+        print(
+            f"\n{outcome['unmatched_model_requests']} unanswered model requests, "
+            f"{len(outcome['unmatched_tool_calls'])} unanswered tool calls"
+        )
+    unanswered = outcome["unmatched_model_requests"] or outcome["unmatched_tool_calls"]
+    return 1 if unanswered else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
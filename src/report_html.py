@@ -0,0 +1,183 @@
+"""
+HTML rendering of investigation reports.
+
+`GET /investigations/{id}/report.html` renders a stored investigation as a
+self-contained HTML page, so reports linked from alerts read well in a
+browser. The page is a Jinja template (autoescaped HTML): the bundled
+`ui/report.html.j2` by default, or the file named by
+SHOOT_REPORT_HTML_TEMPLATE for custom branding and sections. Templates get:
+
+- `brand`: SHOOT_REPORT_HTML_BRAND
+- `record`: the investigation record (query, cluster, metrics, triage, ...)
+- `report_html`: the report rendered from Markdown (JSON reports from their
+  fields)
+- `sections`: the structured report's sections (title and items), empty if
+  the report is not parseable
+- `evidence`: the investigation's evidence artifacts (name and text), shown
+  collapsed by the default template
+
+Reports are Markdown written by the model; the renderer supports headings,
+lists, code, emphasis, links, and tables, and escapes everything else.
+"""
+
+import html
+import re
+from functools import lru_cache
+from pathlib import Path
+from typing import Any
+
+import jinja2
+from markupsafe import Markup
+
+from config import get_settings
+from report_markdown import REPORT_ARTIFACT, report_body
+from store import InvestigationRecord
+
+DEFAULT_TEMPLATE = Path(__file__).parent / "ui" / "report.html.j2"
+
+_STRUCTURED_SECTIONS = (
+    ("summary", "Summary"),
+    ("likely_cause", "Likely Cause"),
+    ("recommended_next_steps", "Recommended Next Steps"),
+)
+_HEADING_PATTERN = re.compile(r"(#{1,6})\s+(.*)")
+_BULLET_PATTERN = re.compile(r"\s*[-*+]\s+(.*)")
+_NUMBERED_PATTERN = re.compile(r"\s*\d+[.)]\s+(.*)")
+_TABLE_SEPARATOR_PATTERN = re.compile(r"\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?")
+_CODE_SPAN_PATTERN = re.compile(r"`([^`]+)`")
+_BOLD_PATTERN = re.compile(r"\*\*(.+?)\*\*")
+_EMPHASIS_PATTERN = re.compile(r"(?<![\w*])\*(?!\s)(.+?)(?<!\s)\*(?![\w*])")
+_LINK_PATTERN = re.compile(r"\[([^\]]+)\]\((https?://[^)\s\"'<>]+)\)")
+
+
+def _inline(text: str) -> str:
+    """Inline Markdown of escaped text; code spans are left alone."""
+    parts = _CODE_SPAN_PATTERN.split(html.escape(text, quote=False))
+    for index in range(0, len(parts), 2):
+        part = _BOLD_PATTERN.sub(r"<strong>\1</strong>", parts[index])
+        part = _EMPHASIS_PATTERN.sub(r"<em>\1</em>", part)
+        # URLs are escaped already and hold no quotes
+        parts[index] = _LINK_PATTERN.sub(r'<a href="\2" rel="noopener">\1</a>', part)
+    for index in range(1, len(parts), 2):
+        parts[index] = f"<code>{parts[index]}</code>"
+    return "".join(parts)
+
+
+def _table(rows: list[str]) -> str:
+    cells = [
+        [cell.strip() for cell in row.strip().strip("|").split("|")]
+        for row in rows
+        if not _TABLE_SEPARATOR_PATTERN.fullmatch(row.strip())
+    ]
+    if not cells:
+        return ""
+    head = "".join(f"<th>{_inline(cell)}</th>" for cell in cells[0])
+    body = "".join(
+        "<tr>" + "".join(f"<td>{_inline(cell)}</td>" for cell in row) + "</tr>"
+        for row in cells[1:]
+    )
+    return f"<table><thead><tr>{head}</tr></thead><tbody>{body}</tbody></table>"
+
+
+def markdown_to_html(text: str) -> Markup:
+    """Render report Markdown as HTML, escaping anything else."""
+    blocks: list[str] = []
+    paragraph: list[str] = []
+    items: list[str] = []
+    list_tag = ""
+    lines = text.splitlines()
+
+    def flush() -> None:
+        nonlocal list_tag
+        if paragraph:
+            blocks.append(f"<p>{'<br>'.join(_inline(line) for line in paragraph)}</p>")
+            paragraph.clear()
+        if items:
+            listed = "".join(f"<li>{_inline(item)}</li>" for item in items)
+            blocks.append(f"<{list_tag}>{listed}</{list_tag}>")
+            items.clear()
+            list_tag = ""
+
+    index = 0
+    while index < len(lines):
+        line = lines[index]
+        stripped = line.strip()
+        if stripped.startswith("```"):
+            flush()
+            end = index + 1
+            while end < len(lines) and not lines[end].strip().startswith("```"):
+                end += 1
+            code = html.escape("\n".join(lines[index + 1 : end]), quote=False)
+            blocks.append(f"<pre><code>{code}</code></pre>")
+            index = end + 1
+            continue
+        if stripped.startswith("|"):
+            flush()
+            end = index
+            while end < len(lines) and lines[end].strip().startswith("|"):
+                end += 1
+            blocks.append(_table(lines[index:end]))
+            index = end
+            continue
+        heading = _HEADING_PATTERN.fullmatch(stripped)
+        bullet = _BULLET_PATTERN.fullmatch(line)
+        numbered = _NUMBERED_PATTERN.fullmatch(line)
+        if not stripped:
+            flush()
+        elif heading:
+            flush()
+            level = len(heading[1])
+            blocks.append(f"<h{level}>{_inline(heading[2])}</h{level}>")
+        elif bullet is not None or numbered is not None:
+            item = bullet if bullet is not None else numbered
+            tag = "ul" if bullet is not None else "ol"
+            if paragraph or (items and list_tag != tag):
+                flush()
+            list_tag = tag
+            items.append(item[1] if item is not None else "")
+        elif items:
+            # Continuation of the previous list item
+            items[-1] += f" {stripped}"
+        else:
+            paragraph.append(stripped)
+        index += 1
+    flush()
+    return Markup("\n".join(blocks))
+
+
+@lru_cache()
+def _template() -> jinja2.Template:
+    path = Path(get_settings().report_html_template or DEFAULT_TEMPLATE)
+    environment = jinja2.Environment(autoescape=True, trim_blocks=True)
+    return environment.from_string(path.read_text())
+
+
+def report_sections(record: InvestigationRecord) -> list[dict[str, Any]]:
+    """Sections of the structured report, empty if it is not parseable."""
+    if record.structured is None:
+        return []
+    return [
+        {"title": title, "items": record.structured[field]}
+        for field, title in _STRUCTURED_SECTIONS
+    ]
+
+
+def render_report_html(record: InvestigationRecord) -> str:
+    """
+    Render an investigation as an HTML page.
+
+    Raises:
+        OSError: The template cannot be read
+        jinja2.TemplateError: The template is invalid
+    """
+    return _template().render(
+        brand=get_settings().report_html_brand,
+        record=record,
+        report_html=markdown_to_html(report_body(record)),
+        sections=report_sections(record),
+        evidence=[
+            {"name": name, "text": text}
+            for name, text in record.artifacts.items()
+            if name != REPORT_ARTIFACT
+        ],
+    )
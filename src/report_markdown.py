@@ -0,0 +1,99 @@
+"""
+Standalone Markdown documents of investigations.
+
+Every kept investigation gets a `report.md` artifact: YAML frontmatter with
+its metadata (ID, query, cluster, timestamps, models, prompt version, cost,
+triage, review, and validation), followed by the report. The document stands
+on its own, so it can be attached to a postmortem or committed to a
+repository as is; it is downloaded like any other artifact
+(`GET /investigations/{id}/artifacts/report.md`).
+"""
+
+from typing import TYPE_CHECKING, Any
+
+import yaml
+
+if TYPE_CHECKING:
+    from store import InvestigationRecord
+
+REPORT_ARTIFACT = "report.md"
+# Query characters in the document title
+_TITLE_LENGTH = 80
+
+_STRUCTURED_SECTIONS = (
+    ("summary", "Summary"),
+    ("likely_cause", "Likely Cause"),
+    ("recommended_next_steps", "Recommended Next Steps"),
+)
+
+
+def report_frontmatter(record: "InvestigationRecord") -> dict[str, Any]:
+    """Metadata of an investigation for the document frontmatter."""
+    metadata: dict[str, Any] = {
+        "id": record.id,
+        "query": record.query,
+        "cluster": record.cluster,
+        "namespaces": record.namespaces,
+        "created_at": record.created_at,
+        "duration_seconds": round(record.duration_ms / 1000, 1),
+        "num_turns": record.num_turns,
+        "total_cost_usd": record.total_cost_usd,
+        "coordinator_model": record.coordinator_model,
+        "collector_model": record.collector_model,
+        "prompt_version": record.prompt_version,
+        "truncated": record.truncated,
+        "triage": record.triage,
+        "review_supported": record.review.get("supported") if record.review else None,
+        "hallucination_rate": (
+            record.validation.get("hallucination_rate") if record.validation else None
+        ),
+        "shadow_of": record.shadow_of,
+    }
+    return {key: value for key, value in metadata.items() if value is not None}
+
+
+def _alert_rules_section(rules: list[dict[str, Any]]) -> str:
+    parts = ["## Suggested Alert Rules"]
+    for rule in rules:
+        parts.append(
+            f"**{rule['alert']}** ({rule['severity']}, for {rule['duration']}): "
+            f"{rule['explanation']}\n\n```promql\n{rule['expr']}\n```"
+        )
+    return "\n\n".join(parts)
+
+
+def report_body(record: "InvestigationRecord") -> str:
+    """
+    The report as Markdown; JSON reports are rendered from their fields.
+
+    Suggested alert rules follow the report.
+    """
+    report = record.structured
+    if report is None or not record.result.lstrip().startswith("{"):
+        parts = [record.result.strip()]
+    else:
+        parts = [f"**Failure signal:** {report['failure_signal']}"]
+        for field, heading in _STRUCTURED_SECTIONS:
+            items = "\n".join(f"- {item}" for item in report[field])
+            parts.append(f"## {heading}\n\n{items}")
+    if report is not None and report.get("alert_rules"):
+        parts.append(_alert_rules_section(report["alert_rules"]))
+    return "\n\n".join(parts)
+
+
+def markdown_report(record: "InvestigationRecord") -> str:
+    """Render an investigation as a standalone Markdown document."""
+    frontmatter = yaml.safe_dump(
+        report_frontmatter(record), sort_keys=False, allow_unicode=True
+    )
+    title = " ".join(record.query.split())
+    if len(title) > _TITLE_LENGTH:
+        title = title[: _TITLE_LENGTH - 3].rstrip() + "..."
+    parts = [f"---\n{frontmatter}---", f"# Investigation: {title}"]
+    if record.truncated:
+        parts.append(
+            "> The investigation was stopped at the cost ceiling; the report is "
+            "partial."
+        )
+    parts.append(report_body(record))
+    return "\n\n".join(parts) + "\n"
@@ -0,0 +1,116 @@
+"""
+Post-validation of final reports against collected cluster facts.
+
+Resource names, namespaces, images, and versions mentioned in the final
+report are cross-checked against an index of everything the collectors read
+from the clusters and returned. References that appear nowhere in that
+evidence are unverifiable: depending on SHOOT_REPORT_VALIDATION they are
+flagged in the report, the lines containing them are stripped, or they are
+only recorded. The share of unverifiable references is recorded per model as
+the report's hallucination rate.
+
+Fenced code blocks (command output, manifests) are left as they are and not
+checked; versions are only looked for outside inline code, as a code span is
+checked as a whole. Only markdown reports are modified; JSON reports keep
+their text.
+"""
+
+import re
+from typing import Any
+
+from config import ReportValidationMode
+
+# Code spans without whitespace: resource names, namespace/name, images, ...
+_CODE_SPAN_PATTERN = re.compile(r"`([^`\s]{2,253})`")
+# Three-part versions, e.g. v1.15.6 or 1.29.3-gs1
+_VERSION_PATTERN = re.compile(r"(?<![\w.])v?\d+\.\d+\.\d+(?:[-+][\w.]+)?(?![\w.])")
+# Inline code, whether or not it is a reference
+_INLINE_CODE_PATTERN = re.compile(r"`[^`]*`")
+# Opening and closing lines of fenced code blocks
+_FENCE_PATTERN = re.compile(r"\s*(```|~~~)")
+
+_UNVERIFIED_MARKER = "_(unverified: {})_"
+
+
+class EvidenceIndex:
+    """Case-insensitive index of collected evidence text."""
+
+    def __init__(self, texts: list[str]) -> None:
+        self._text = "\n".join(texts).lower()
+
+    def contains(self, reference: str) -> bool:
+        """Whether a reference is backed by the evidence."""
+        value = reference.lower().rstrip(".,:;")
+        if value in self._text:
+            return True
+        # namespace/name and kind/name are rarely printed joined
+        parts = [part for part in value.split("/") if part]
+        return len(parts) > 1 and all(part in self._text for part in parts)
+
+
+def extract_references(line: str) -> set[str]:
+    """Resource, namespace, image, and version references in a report line."""
+    references = {
+        span for span in _CODE_SPAN_PATTERN.findall(line) if not span.startswith("-")
+    }
+    references.update(_VERSION_PATTERN.findall(_INLINE_CODE_PATTERN.sub(" ", line)))
+    return references
+
+
+def validate_report(
+    report: str,
+    evidence: list[str],
+    mode: ReportValidationMode,
+    modify: bool = True,
+) -> tuple[str, dict[str, Any]]:
+    """
+    Cross-check a report's references against the evidence.
+
+    Args:
+        report: Final report text
+        evidence: Texts of collector tool outputs and results
+        mode: What to do with unverifiable references
+        modify: Whether the report text may be changed (false for JSON reports)
+
+    Returns:
+        The (possibly flagged or stripped) report and a validation summary
+        with the references, unverified references, and hallucination rate
+    """
+    index = EvidenceIndex(evidence)
+    checked: set[str] = set()
+    unverified: set[str] = set()
+    lines = []
+    fence: str | None = None
+    for line in report.splitlines():
+        match = _FENCE_PATTERN.match(line)
+        if match:
+            if fence is None:
+                fence = match.group(1)
+            elif match.group(1) == fence:
+                fence = None
+            lines.append(line)
+            continue
+        if fence is not None:
+            lines.append(line)
+            continue
+        references = extract_references(line)
+        missing = sorted(ref for ref in references if not index.contains(ref))
+        checked.update(references)
+        unverified.update(missing)
+        if missing and modify and mode == "strip":
+            continue
+        if missing and modify and mode == "flag":
+            line = f"{line} {_UNVERIFIED_MARKER.format(', '.join(missing))}"
+        lines.append(line)
+
+    validation = {
+        "mode": mode,
+        "references": len(checked),
+        "unverified": sorted(unverified),
+        "hallucination_rate": (
+            round(len(unverified) / len(checked), 3) if checked else 0.0
+        ),
+    }
+    if modify and mode in ("flag", "strip"):
+        report = "\n".join(lines)
+    return report, validation
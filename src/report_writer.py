@@ -0,0 +1,98 @@
+"""
+Report writer agent for the Shoot agent system.
+
+The coordinator runs on an expensive model; when the report writer is enabled
+it only hands over terse findings, and a small-model agent turns them into the
+user-facing report in the requested format and language. The writer has no
+tools and calls the Anthropic Messages API directly with a single request
+(llm.py).
+
+A "json" report is not parsed out of free text: the writer is made to call a
+tool whose input schema is the DiagnosticReport schema, so the API returns
+the report as an object, which is validated against the model. A report cut
+off at the output token limit, or one that does not validate, is a failure,
+and the coordinator's findings are returned instead.
+"""
+
+import json
+from typing import Any
+
+from pydantic import ValidationError
+
+from config import ReportFormat, get_report_writer_prompt, get_settings
+from llm import complete
+from schemas import DIAGNOSTIC_REPORT_SCHEMA, DiagnosticReport
+
+_MAX_OUTPUT_TOKENS = 2048
+_REPORT_TOOL = "submit_report"
+# Schema keywords that describe the document rather than the tool input
+_SCHEMA_METADATA = ("$schema", "title", "description")
+
+
+class ReportWriterError(Exception):
+    """The writer's report is incomplete or does not match its format."""
+
+
+def report_tool() -> dict[str, Any]:
+    """Tool the writer calls with a "json" report."""
+    return {
+        "name": _REPORT_TOOL,
+        "description": "Submit the diagnostic report",
+        "input_schema": {
+            key: value
+            for key, value in DIAGNOSTIC_REPORT_SCHEMA.items()
+            if key not in _SCHEMA_METADATA
+        },
+    }
+
+
+async def write_report(
+    query: str,
+    findings: str,
+    language: str | None = None,
+    report_format: ReportFormat = "markdown",
+) -> tuple[str, dict[str, Any]]:
+    """
+    Write the user-facing report from the coordinator's findings.
+
+    Args:
+        query: Original failure description
+        findings: Coordinator's final findings
+        language: Report language (default: SHOOT_REPORT_LANGUAGE)
+        report_format: "markdown" bullet report or "json" DiagnosticReport
+
+    Returns:
+        Tuple of (report text, token usage)
+
+    Raises:
+        ReportWriterError: The report was cut off or is not a valid
+            DiagnosticReport
+    """
+    settings = get_settings()
+    structured: dict[str, Any] = {}
+    if report_format == "json":
+        structured = {
+            "tools": [report_tool()],
+            "tool_choice": {"type": "tool", "name": _REPORT_TOOL},
+        }
+    answer = await complete(
+        settings.report_writer_model or settings.collector_model,
+        get_report_writer_prompt(language or settings.report_language, report_format),
+        f"## Failure description\n{query}\n\n## Findings\n{findings}",
+        _MAX_OUTPUT_TOKENS,
+        **structured,
+    )
+    if answer.stop_reason == "max_tokens":
+        raise ReportWriterError(
+            f"Report cut off at the output token limit ({_MAX_OUTPUT_TOKENS})"
+        )
+    if report_format != "json":
+        return answer.text.strip(), answer.usage
+    for block in answer.content:
+        if block.type == "tool_use" and block.name == _REPORT_TOOL:
+            try:
+                report = DiagnosticReport.model_validate(block.input)
+            except ValidationError as e:
+                raise ReportWriterError(f"Invalid report: {e}") from e
+            return json.dumps(report.model_dump(mode="json"), indent=2), answer.usage
+    raise ReportWriterError("The writer did not submit a report")
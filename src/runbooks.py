@@ -0,0 +1,214 @@
+"""
+Runbook knowledge base for the coordinator.
+
+Team runbooks and postmortems are loaded from SHOOT_RUNBOOKS_DIR, or cloned
+from SHOOT_RUNBOOKS_GIT_URL, split into sections at Markdown headings, and
+indexed. The coordinator gets a `search_runbooks` tool returning the sections
+most similar to a description of the symptoms, so known issues are matched
+against their documented fixes.
+
+Sections are embedded as sparse TF-IDF vectors and ranked by cosine
+similarity (text_index.py), which needs no embedding service.
+
+The index is built once, in the background at startup; files changed later
+are picked up on restart.
+"""
+
+import asyncio
+import re
+import subprocess  # nosec B404
+import tempfile
+from dataclasses import dataclass
+from functools import lru_cache
+from pathlib import Path
+from threading import Lock
+from typing import Any
+
+from claude_agent_sdk import tool
+
+from app_logging import logger
+from config import get_settings
+from telemetry import add_event
+from text_index import TextIndex
+
+# Files indexed as runbooks
+_RUNBOOK_SUFFIXES = {".md", ".markdown", ".txt"}
+# Sections longer than this are split further
+_MAX_SECTION_CHARS = 3000
+# Sections returned per search
+_MAX_RESULTS = 5
+# Sections scoring below this are not returned
+_MIN_SCORE = 0.05
+_GIT_TIMEOUT_SECONDS = 120
+_HEADING_PATTERN = re.compile(r"^#{1,3} +(.+)$", re.MULTILINE)
+# Serializes loading, so the startup warm-up and a first search never clone
+# into the same directory at once
+_LOAD_LOCK = Lock()
+
+
+@dataclass
+class RunbookSection:
+    """A section of a runbook, the unit of search."""
+
+    path: str
+    title: str
+    text: str
+
+
+def split_sections(path: str, text: str) -> list[RunbookSection]:
+    """Split a runbook at its headings, and long sections by size."""
+    title = Path(path).stem
+    starts = [match.start() for match in _HEADING_PATTERN.finditer(text)]
+    bounds = zip([0, *starts], [*starts, len(text)])
+    sections = []
+    for start, end in bounds:
+        body = text[start:end].strip()
+        if not body:
+            continue
+        heading = _HEADING_PATTERN.match(body)
+        section_title = f"{title}: {heading.group(1).strip()}" if heading else title
+        for offset in range(0, len(body), _MAX_SECTION_CHARS):
+            sections.append(
+                RunbookSection(
+                    path, section_title, body[offset : offset + _MAX_SECTION_CHARS]
+                )
+            )
+    return sections
+
+
+def load_runbooks(directory: Path) -> list[RunbookSection]:
+    """Load and split every runbook file below a directory."""
+    sections = []
+    for path in sorted(directory.rglob("*")):
+        if path.suffix.lower() not in _RUNBOOK_SUFFIXES or not path.is_file():
+            continue
+        if ".git" in path.relative_to(directory).parts:
+            continue
+        try:
+            text = path.read_text(errors="replace")
+        except OSError as e:
+            logger.warning(f"Cannot read runbook {path}: {e}")
+            continue
+        sections.extend(split_sections(str(path.relative_to(directory)), text))
+    return sections
+
+
+def sync_git_runbooks(url: str, ref: str, directory: Path) -> None:
+    """
+    Clone a runbook repository, or update an earlier clone, at ref.
+
+    Raises:
+        RuntimeError: git failed
+    """
+    if (directory / ".git").is_dir():
+        commands = [
+            ["git", "-C", str(directory), "fetch", "--depth", "1", "origin", ref],
+            ["git", "-C", str(directory), "reset", "--hard", "FETCH_HEAD"],
+        ]
+    else:
+        commands = [
+            ["git", "clone", "--depth", "1", "--branch", ref, url, str(directory)]
+        ]
+    for command in commands:
+        try:
+            subprocess.run(  # nosec B603 B607
+                command,
+                check=True,
+                capture_output=True,
+                timeout=_GIT_TIMEOUT_SECONDS,
+            )
+        except (OSError, subprocess.SubprocessError) as e:
+            # The URL is left out of the error, it may hold a token
+            stderr = (getattr(e, "stderr", b"") or b"").decode(errors="replace")
+            raise RuntimeError(
+                f"Cannot sync the runbook repository: {stderr[-500:] or e}"
+            ) from e
+
+
+class RunbookIndex:
+    """Runbook sections with their TF-IDF embeddings."""
+
+    def __init__(self, sections: list[RunbookSection]) -> None:
+        self.sections = sections
+        self._index = TextIndex(
+            [f"{section.title}\n{section.text}" for section in sections]
+        )
+
+    def search(
+        self, query: str, limit: int = _MAX_RESULTS
+    ) -> list[tuple[float, RunbookSection]]:
+        """Sections most similar to the query, best first."""
+        return [
+            (score, self.sections[position])
+            for score, position in self._index.search(query, limit, _MIN_SCORE)
+        ]
+
+
+def runbooks_enabled() -> bool:
+    """Whether a runbook source is configured."""
+    settings = get_settings()
+    return bool(settings.runbooks_dir or settings.runbooks_git_url)
+
+
+@lru_cache()
+def get_runbook_index() -> RunbookIndex:
+    """
+    Get the runbook index, loading the runbooks on first use.
+
+    Raises:
+        RuntimeError: The runbook repository cannot be cloned
+    """
+    settings = get_settings()
+    with _LOAD_LOCK:
+        if settings.runbooks_git_url:
+            directory = Path(tempfile.gettempdir()) / "shoot-runbooks"
+            sync_git_runbooks(
+                settings.runbooks_git_url, settings.runbooks_git_ref, directory
+            )
+        else:
+            directory = Path(settings.runbooks_dir)
+        index = RunbookIndex(load_runbooks(directory))
+    logger.info(f"Indexed {len(index.sections)} runbook sections from {directory}")
+    return index
+
+
+def warm_runbook_index() -> None:
+    """Build the runbook index ahead of the first search, logging failures."""
+    try:
+        get_runbook_index()
+    except RuntimeError as e:
+        logger.error(f"Failed to load runbooks: {e}")
+
+
+def format_results(results: list[tuple[float, RunbookSection]]) -> str:
+    """Search results as text for the coordinator."""
+    if not results:
+        return "No matching runbook sections."
+    return "\n\n".join(
+        f"### {section.title} ({section.path}, score {score:.2f})\n{section.text}"
+        for score, section in results
+    )
+
+
+@tool(
+    "search_runbooks",
+    "Search the team's runbooks and postmortems for known issues matching the "
+    "observed symptoms (error messages, resource kinds, components). Returns the "
+    "most relevant sections with their documented causes and fixes.",
+    {
+        "type": "object",
+        "properties": {"query": {"type": "string"}},
+        "required": ["query"],
+    },
+)
+async def search_runbooks(args: dict[str, Any]) -> dict[str, Any]:
+    """Tool handler: runbook sections matching the query."""
+    query = str(args.get("query", ""))
+    try:
+        # The first search may have to wait for the clone
+        index = await asyncio.to_thread(get_runbook_index)
+    except RuntimeError as e:
+        return {"content": [{"type": "text", "text": str(e)}], "is_error": True}
+    results = index.search(query)
+    add_event("runbooks_searched", {"results": len(results)})
+    return {"content": [{"type": "text", "text": format_results(results)}]}
@@ -0,0 +1,199 @@
+"""
+Runtime debug endpoints.
+
+With SHOOT_DEBUG_ENDPOINTS_ENABLED, the admin API exposes the runtime state
+of the replica, to diagnose memory growth during long investigations and
+leaked tasks or MCP server processes in production:
+
+- `GET /admin/debug/runtime`: memory, garbage collector, thread, asyncio
+  task, and file descriptor counts, and the child processes (MCP servers,
+  claude CLI) with their memory
+- `GET /admin/debug/tasks`: the stack of every asyncio task
+- `GET /admin/debug/threads`: the stack of every thread
+- `GET /admin/debug/heap`: the lines allocating the most memory, and the
+  growth since the previous heap request, from tracemalloc
+
+Memory tracing slows allocations down, so it only starts with the first
+heap request, or at startup with SHOOT_DEBUG_TRACEMALLOC_FRAMES. The
+endpoints need the admin token like every /admin endpoint.
+"""
+
+import asyncio
+import gc
+import os
+import resource
+import sys
+import threading
+import tracemalloc
+import traceback
+from pathlib import Path
+from typing import Any
+
+from fastapi import HTTPException
+
+from config import get_settings
+
+# Frames kept per traced allocation when tracing starts on demand
+_DEFAULT_TRACE_FRAMES = 1
+_PROC = Path("/proc")
+
+_last_snapshot: tracemalloc.Snapshot | None = None
+
+
+def check_debug_endpoints() -> None:
+    """
+    FastAPI dependency rejecting debug requests unless they are enabled.
+
+    Raises:
+        HTTPException: 404 if SHOOT_DEBUG_ENDPOINTS_ENABLED is not set
+    """
+    if not get_settings().debug_endpoints_enabled:
+        raise HTTPException(status_code=404, detail="Not Found")
+
+
+def start_memory_tracing() -> None:
+    """Start tracing allocations at startup if configured."""
+    settings = get_settings()
+    frames = settings.debug_tracemalloc_frames
+    if settings.debug_endpoints_enabled and frames and not tracemalloc.is_tracing():
+        tracemalloc.start(frames)
+
+
+def _status_kib(pid: str, field: str) -> int | None:
+    """A memory field of /proc/<pid>/status in KiB, None if unavailable."""
+    try:
+        for line in (_PROC / pid / "status").read_text().splitlines():
+            if line.startswith(f"{field}:"):
+                return int(line.split()[1])
+    except (OSError, ValueError, IndexError):
+        return None
+    return None
+
+
+def child_processes() -> list[dict[str, Any]]:
+    """Direct child processes with their command line and memory (Linux only)."""
+    own = str(os.getpid())
+    children = []
+    for entry in _PROC.glob("[0-9]*"):
+        try:
+            # The command name may contain spaces; the fields after it do not
+            fields = (entry / "stat").read_text().rpartition(")")[2].split()
+            if fields[1] != own:
+                continue
+            cmdline = (entry / "cmdline").read_bytes().replace(b"\0", b" ")
+        except (OSError, IndexError):
+            continue
+        children.append(
+            {
+                "pid": int(entry.name),
+                "state": fields[0],
+                "command": cmdline.decode(errors="replace").strip()[:300],
+                "rss_kib": _status_kib(entry.name, "VmRSS"),
+            }
+        )
+    return children
+
+
+def runtime_stats() -> dict[str, Any]:
+    """Memory, object, thread, task, and process counts of this replica."""
+    usage = resource.getrusage(resource.RUSAGE_SELF)
+    try:
+        open_fds: int | None = len(os.listdir("/proc/self/fd"))
+    except OSError:
+        open_fds = None
+    traced: dict[str, Any] | None = None
+    if tracemalloc.is_tracing():
+        current, peak = tracemalloc.get_traced_memory()
+        traced = {"current_bytes": current, "peak_bytes": peak}
+    return {
+        "pid": os.getpid(),
+        "python": sys.version.split()[0],
+        "rss_kib": _status_kib("self", "VmRSS"),
+        # Linux reports the peak in KiB
+        "max_rss_kib": usage.ru_maxrss,
+        "gc": {
+            "counts": gc.get_count(),
+            "objects": len(gc.get_objects()),
+            "collections": [stats["collections"] for stats in gc.get_stats()],
+            "uncollectable": len(gc.garbage),
+        },
+        "threads": threading.active_count(),
+        "asyncio_tasks": len(asyncio.all_tasks()),
+        "open_fds": open_fds,
+        "tracemalloc": traced,
+        "children": child_processes(),
+    }
+
+
+def task_stacks() -> list[dict[str, Any]]:
+    """Name, coroutine, and stack of every asyncio task of the running loop."""
+    tasks = []
+    for task in asyncio.all_tasks():
+        frames = task.get_stack()
+        tasks.append(
+            {
+                "name": task.get_name(),
+                "coroutine": getattr(task.get_coro(), "__qualname__", ""),
+                "done": task.done(),
+                "stack": [
+                    f"{frame.f_code.co_filename}:{frame.f_lineno} "
+                    f"in {frame.f_code.co_name}"
+                    for frame in frames
+                ],
+            }
+        )
+    return sorted(tasks, key=lambda task: task["coroutine"])
+
+
+def thread_stacks() -> list[dict[str, Any]]:
+    """Name and stack of every thread."""
+    names = {thread.ident: thread.name for thread in threading.enumerate()}
+    return [
+        {
+            "id": ident,
+            "name": names.get(ident, ""),
+            "stack": [line.rstrip() for line in traceback.format_stack(frame)],
+        }
+        for ident, frame in sys._current_frames().items()
+    ]
+
+
+def heap_profile(limit: int) -> dict[str, Any]:
+    """
+    Top allocations by line, and the growth since the previous call.
+
+    Starts tracing on the first call; allocations made before it are not
+    seen.
+    """
+    global _last_snapshot
+    if not tracemalloc.is_tracing():
+        tracemalloc.start(_DEFAULT_TRACE_FRAMES)
+        _last_snapshot = tracemalloc.take_snapshot()
+        return {"tracing": "started", "top": [], "growth": []}
+
+    snapshot = tracemalloc.take_snapshot().filter_traces(
+        [tracemalloc.Filter(False, tracemalloc.__file__)]
+    )
+    top = [
+        {"line": str(stat.traceback), "size_bytes": stat.size, "count": stat.count}
+        for stat in snapshot.statistics("lineno")[:limit]
+    ]
+    growth = []
+    if _last_snapshot is not None:
+        growth = [
+            {
+                "line": str(stat.traceback),
+                "size_diff_bytes": stat.size_diff,
+                "count_diff": stat.count_diff,
+            }
+            for stat in snapshot.compare_to(_last_snapshot, "lineno")[:limit]
+        ]
+    _last_snapshot = snapshot
+    current, peak = tracemalloc.get_traced_memory()
+    return {
+        "tracing": "running",
+        "current_bytes": current,
+        "peak_bytes": peak,
+        "top": top,
+        "growth": growth,
+    }
@@ -5,12 +5,28 @@ This module defines JSON schemas and Pydantic models for validating
 agent outputs, ensuring consistent diagnostic report formats.
 """
 
+import json
 import re
-from typing import Any
+from typing import Any, TypedDict
 
 from pydantic import BaseModel, Field, field_validator
 
 
+class SuggestedAlertRule(BaseModel):
+    """Proposed Prometheus alerting rule that would have caught an issue."""
+
+    alert: str = Field(..., min_length=1, description="Name of the alert")
+    expr: str = Field(..., min_length=1, description="PromQL expression")
+    duration: str = Field(
+        default="5m", description="How long the condition must hold (`for`)"
+    )
+    severity: str = Field(default="warning", description="Severity label")
+    summary: str = Field(default="", description="Summary annotation")
+    explanation: str = Field(
+        default="", description="Why the rule would have caught the issue"
+    )
+
+
 class DiagnosticReport(BaseModel):
     """
     Structured diagnostic report from the coordinator agent.
@@ -43,6 +59,10 @@ class DiagnosticReport(BaseModel):
         min_length=1,
         max_length=6,
     )
+    alert_rules: list[SuggestedAlertRule] = Field(
+        default_factory=list,
+        description="Alert rules that would have caught an unalerted issue",
+    )
 
     @field_validator("summary", "likely_cause", "recommended_next_steps", mode="before")
     @classmethod
@@ -53,6 +73,28 @@ class DiagnosticReport(BaseModel):
         return v
 
 
+class InvestigationResult(TypedDict):
+    """Result from a coordinator investigation including usage metrics."""
+
+    result: str
+    duration_ms: int
+    num_turns: int
+    total_cost_usd: float | None
+    usage: dict[str, Any] | None
+    breakdown: dict[str, dict[str, Any]] | None
+    model_upgrade: str | None
+    review: dict[str, Any] | None
+    findings: str | None
+    validation: dict[str, Any] | None
+    session_id: str | None
+    debug_trace: list[dict[str, Any]] | None
+    artifacts: dict[str, str] | None
+    truncated: bool
+    triage: dict[str, Any] | None
+    alert_rules: list[dict[str, Any]] | None
+    thinking_budget_tokens: int | None
+
+
 # JSON Schema for documentation and external validation
 DIAGNOSTIC_REPORT_SCHEMA: dict[str, Any] = {
     "$schema": "http://json-schema.org/draft-07/schema#",
@@ -87,6 +129,22 @@ DIAGNOSTIC_REPORT_SCHEMA: dict[str, Any] = {
             "minItems": 1,
             "maxItems": 6,
         },
+        "alert_rules": {
+            "type": "array",
+            "description": "Alert rules that would have caught an unalerted issue",
+            "items": {
+                "type": "object",
+                "properties": {
+                    "alert": {"type": "string", "minLength": 1},
+                    "expr": {"type": "string", "minLength": 1},
+                    "duration": {"type": "string"},
+                    "severity": {"type": "string"},
+                    "summary": {"type": "string"},
+                    "explanation": {"type": "string"},
+                },
+                "required": ["alert", "expr"],
+            },
+        },
     },
     "required": ["failure_signal", "summary", "likely_cause", "recommended_next_steps"],
     "additionalProperties": False,
@@ -149,6 +207,36 @@ def parse_markdown_report(text: str) -> DiagnosticReport | None:
         return None
 
 
+def parse_json_report(text: str) -> DiagnosticReport | None:
+    """
+    Parse a JSON diagnostic report (as written by the report writer in "json"
+    format), tolerating surrounding code fences.
+
+    Returns None if parsing fails.
+    """
+    match = re.search(r"\{.*\}", text, re.DOTALL)
+    if not match:
+        return None
+    try:
+        return DiagnosticReport(**json.loads(match.group(0)))
+    except Exception:
+        return None
+
+
+def parse_report(
+    text: str, alert_rules: list[dict[str, Any]] | None = None
+) -> DiagnosticReport | None:
+    """
+    Parse a diagnostic report in either markdown or JSON format.
+
+    Alert rules suggested after the report was written are added to it.
+    """
+    report = parse_markdown_report(text) or parse_json_report(text)
+    if report is not None and alert_rules:
+        report.alert_rules = [SuggestedAlertRule(**rule) for rule in alert_rules]
+    return report
+
+
 def validate_report(report: DiagnosticReport) -> dict[str, Any]:
     """Convert a DiagnosticReport to a JSON-serializable dict."""
     return report.model_dump()
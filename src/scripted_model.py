@@ -0,0 +1,229 @@
+"""
+Scripted model for running investigations without the model API.
+
+With SHOOT_BACKEND=scripted, every investigation runs the real coordinator
+session, collector subagents, hooks, and server handlers, but its model
+requests are answered from a script (SHOOT_SCRIPTED_MODEL_FILE) through the
+loopback proxy of traffic_recording.py, and its MCP tool calls from the
+script's recorded tool responses. Orchestration, tool plumbing, and the API
+can then be exercised without network access or API keys:
+
+    responses:
+      - tool_uses:                  # coordinator delegates to a collector
+          - name: Task
+            input:
+              subagent_type: wc_collector
+              description: Inspect the deployment
+              prompt: Describe deployment api in namespace shop
+      - when: "wc_collector"        # only answers requests containing this
+        tool_uses:
+          - name: mcp__kubernetes_wc__describe
+            input: {resourceType: deployment, namespace: shop, name: api}
+      - text: "Deployment api has 0/2 ready replicas."
+    default: "No further findings."
+    tool_calls:                     # recorded MCP responses (recorded_tools.py)
+      - tool: mcp__kubernetes_wc__describe
+        output: "Replicas: 2 desired | 0 available"
+
+Each model request is answered by the first unused response, in order, whose
+`when` text (if any) appears in the request; once none is left, by `default`
+as a final text answer, which ends the agent's turn.
+"""
+
+import json
+import threading
+from functools import lru_cache
+from pathlib import Path
+from typing import Any
+
+import yaml
+from pydantic import BaseModel, Field, ValidationError
+
+from config import get_settings
+from recorded_tools import RecordedCall
+from traffic_recording import ModelExchange
+
+# Path of the Messages API, the only endpoint answered with scripted content
+_MESSAGES_PATH = "/v1/messages"
+
+
+class ScriptedToolUse(BaseModel):
+    """A tool call of a scripted response."""
+
+    name: str = Field(..., min_length=1)
+    input: dict[str, Any] = Field(default_factory=dict)
+
+
+class ScriptedResponse(BaseModel):
+    """A scripted assistant message."""
+
+    when: str | None = Field(
+        default=None, description="Only answer requests containing this text"
+    )
+    text: str = ""
+    tool_uses: list[ScriptedToolUse] = Field(default_factory=list)
+
+
+class ModelScript(BaseModel):
+    """Scripted responses and recorded tool responses of investigations."""
+
+    responses: list[ScriptedResponse] = Field(default_factory=list)
+    default: str = "Done."
+    tool_calls: list[RecordedCall] = Field(default_factory=list)
+
+
+def load_model_script(path: Path) -> ModelScript:
+    """
+    Load a model script.
+
+    Raises:
+        ValueError: The file is not a valid model script
+    """
+    try:
+        return ModelScript.model_validate(yaml.safe_load(path.read_text()) or {})
+    except (OSError, yaml.YAMLError, ValidationError) as e:
+        raise ValueError(f"Invalid model script {path}: {e}") from e
+
+
+@lru_cache()
+def get_model_script() -> ModelScript:
+    """Get the model script configured by SHOOT_SCRIPTED_MODEL_FILE."""
+    return load_model_script(Path(get_settings().scripted_model_file))
+
+
+def _content_blocks(
+    response: ScriptedResponse, message_id: str
+) -> list[dict[str, Any]]:
+    blocks: list[dict[str, Any]] = []
+    if response.text:
+        blocks.append({"type": "text", "text": response.text})
+    for index, tool_use in enumerate(response.tool_uses):
+        blocks.append(
+            {
+                "type": "tool_use",
+                "id": f"toolu_{message_id}_{index}",
+                "name": tool_use.name,
+                "input": tool_use.input,
+            }
+        )
+    return blocks
+
+
+def _message(
+    response: ScriptedResponse, model: str, message_id: str
+) -> dict[str, Any]:
+    """Messages API response for a scripted message."""
+    return {
+        "id": f"msg_{message_id}",
+        "type": "message",
+        "role": "assistant",
+        "model": model,
+        "content": _content_blocks(response, message_id),
+        "stop_reason": "tool_use" if response.tool_uses else "end_turn",
+        "stop_sequence": None,
+        "usage": {"input_tokens": 0, "output_tokens": 0},
+    }
+
+
+def _event(name: str, data: dict[str, Any]) -> str:
+    return f"event: {name}\ndata: {json.dumps(data)}\n\n"
+
+
+def _delta(block: dict[str, Any]) -> dict[str, Any]:
+    if block["type"] == "text":
+        return {"type": "text_delta", "text": block["text"]}
+    return {"type": "input_json_delta", "partial_json": json.dumps(block["input"])}
+
+
+def stream_events(message: dict[str, Any]) -> str:
+    """Server-sent events streaming a Messages API response."""
+    events = [
+        _event(
+            "message_start",
+            {
+                "type": "message_start",
+                "message": {**message, "content": [], "stop_reason": None},
+            },
+        )
+    ]
+    for index, block in enumerate(message["content"]):
+        # Blocks start empty and get their content in a single delta
+        empty = {"text": ""} if block["type"] == "text" else {"input": {}}
+        events.extend(
+            [
+                _event(
+                    "content_block_start",
+                    {
+                        "type": "content_block_start",
+                        "index": index,
+                        "content_block": {**block, **empty},
+                    },
+                ),
+                _event(
+                    "content_block_delta",
+                    {
+                        "type": "content_block_delta",
+                        "index": index,
+                        "delta": _delta(block),
+                    },
+                ),
+                _event(
+                    "content_block_stop",
+                    {"type": "content_block_stop", "index": index},
+                ),
+            ]
+        )
+    stop = {"stop_reason": message["stop_reason"], "stop_sequence": None}
+    events.append(
+        _event(
+            "message_delta",
+            {"type": "message_delta", "delta": stop, "usage": {"output_tokens": 0}},
+        )
+    )
+    events.append(_event("message_stop", {"type": "message_stop"}))
+    return "".join(events)
+
+
+class ScriptedModel:
+    """Answers Messages API requests from a model script."""
+
+    def __init__(self, script: ModelScript) -> None:
+        self._script = script
+        self._used: set[int] = set()
+        self._lock = threading.Lock()
+        self._count = 0
+
+    def _next_response(self, body: str) -> tuple[int, ScriptedResponse]:
+        with self._lock:
+            self._count += 1
+            for position, response in enumerate(self._script.responses):
+                if position in self._used:
+                    continue
+                if response.when is None or response.when in body:
+                    self._used.add(position)
+                    return self._count, response
+            return self._count, ScriptedResponse(text=self._script.default)
+
+    def respond(self, method: str, path: str, body: str) -> ModelExchange | None:
+        """Scripted answer to a Messages API request; other requests get none."""
+        if method != "POST" or path != _MESSAGES_PATH:
+            return None
+        try:
+            request = json.loads(body)
+        except json.JSONDecodeError:
+            return None
+        count, response = self._next_response(body)
+        model = str(request.get("model", ""))
+        message = _message(response, model, f"scripted{count}")
+        if request.get("stream"):
+            content_type, text = "text/event-stream", stream_events(message)
+        else:
+            content_type, text = "application/json", json.dumps(message)
+        return ModelExchange(
+            method=method,
+            path=path,
+            request=body,
+            status=200,
+            content_type=content_type,
+            response=text,
+        )
@@ -0,0 +1,69 @@
+"""
+Credentials read from mounted secret files.
+
+Every credential can be read from a file instead of its environment variable
+(ANTHROPIC_API_KEY_FILE, SHOOT_ADMIN_TOKEN_FILE, MCP_KUBERNETES_TOKEN_FILE,
+SHOOT_CALLBACK_SECRET_FILE), as mounted from a Kubernetes Secret. The file
+takes precedence over the plain setting and is re-read whenever its
+modification time changes, so rotated secrets are picked up without a
+restart. While a file is briefly unreadable during rotation, the last value
+read is kept.
+"""
+
+import os
+from functools import lru_cache
+from pathlib import Path
+from threading import Lock
+from typing import Literal
+
+from app_logging import logger
+from config import get_settings
+
+# Credential settings that can be read from files (setting name without _file)
+SecretName = Literal[
+    "anthropic_api_key", "admin_token", "mcp_kubernetes_token", "callback_secret"
+]
+
+
+class SecretFile:
+    """A secret file, re-read when it changes."""
+
+    def __init__(self, path: str) -> None:
+        self.path = path
+        self._lock = Lock()
+        self._mtime: float | None = None
+        self._value = ""
+
+    def read(self) -> str:
+        """Current secret value, stripped of surrounding whitespace."""
+        with self._lock:
+            try:
+                # stat() follows the symlinks Kubernetes swaps on rotation
+                mtime = os.stat(self.path).st_mtime
+                if mtime != self._mtime:
+                    self._value = Path(self.path).read_text().strip()
+                    if self._mtime is not None:
+                        logger.info(f"Reloaded secret file {self.path}")
+                    self._mtime = mtime
+            except OSError as e:
+                logger.warning(f"Cannot read secret file {self.path}: {e}")
+            return self._value
+
+
+@lru_cache()
+def _secret_file(path: str) -> SecretFile:
+    return SecretFile(path)
+
+
+def get_secret(name: SecretName) -> str:
+    """
+    Get a credential, from its secret file if one is configured.
+
+    Args:
+        name: Setting name of the credential
+    """
+    settings = get_settings()
+    path: str = getattr(settings, f"{name}_file")
+    if path:
+        return _secret_file(path).read()
+    return str(getattr(settings, name))
@@ -0,0 +1,183 @@
+"""
+Rolling summarization of long follow-up sessions.
+
+A follow-up query resumes the coordinator session of an earlier
+investigation, so the session's context grows with every turn: each
+question, the collector results, and each report. Conversations about a
+cluster that go on for days would eventually exceed the context limit.
+
+The questions and reports of every session are kept in memory. Once a
+session's estimated context exceeds SHOOT_SESSION_SUMMARY_TOKENS, the next
+follow-up does not resume it: a small model folds the older turns into the
+session's running summary, and a fresh session starts from that summary,
+the last SHOOT_SESSION_SUMMARY_KEEP_TURNS turns verbatim, and the new
+question. The fresh session's ID is returned for further follow-ups, and the
+summary rolls forward when it grows too large again.
+"""
+
+from collections import OrderedDict
+from dataclasses import dataclass, field
+from functools import lru_cache
+from threading import Lock
+from typing import Any
+
+from app_logging import logger
+from config import get_session_summary_prompt, get_settings
+from llm import complete
+from telemetry import add_event
+
+# Rough characters-per-token ratio of the conversation
+_CHARS_PER_TOKEN = 4
+_MAX_OUTPUT_TOKENS = 4096
+
+
+@dataclass
+class SessionTurn:
+    """A question of a session and the report it got."""
+
+    query: str
+    report: str
+
+
+@dataclass
+class SessionHistory:
+    """What a session's context holds, as far as it is needed to summarize it."""
+
+    # Running summary of turns no longer in the session
+    summary: str = ""
+    turns: list[SessionTurn] = field(default_factory=list)
+    # Approximate size of the session's context
+    context_chars: int = 0
+
+
+@dataclass
+class FollowUp:
+    """How a query continues its session."""
+
+    # Session to resume; None starts a fresh session from the summary
+    resume: str | None
+    # Query text sent to the coordinator
+    query: str
+    # History the new turn is added to
+    history: SessionHistory
+    # Token usage of the summarization, if one ran
+    usage: dict[str, Any] | None = None
+
+
+class SessionHistories:
+    """Histories of the most recent sessions, by session ID."""
+
+    def __init__(self, max_sessions: int) -> None:
+        self._max_sessions = max_sessions
+        self._lock = Lock()
+        self._histories: OrderedDict[str, SessionHistory] = OrderedDict()
+
+    def get(self, session_id: str) -> SessionHistory | None:
+        with self._lock:
+            return self._histories.get(session_id)
+
+    def put(self, session_id: str, history: SessionHistory) -> None:
+        with self._lock:
+            self._histories[session_id] = history
+            self._histories.move_to_end(session_id)
+            while len(self._histories) > self._max_sessions:
+                self._histories.popitem(last=False)
+
+
+@lru_cache()
+def get_session_histories() -> SessionHistories:
+    """Get the process-wide session histories."""
+    return SessionHistories(get_settings().investigation_history_size)
+
+
+def _format_turns(turns: list[SessionTurn]) -> str:
+    return "\n\n".join(
+        f"### Question\n{turn.query}\n\n### Answer\n{turn.report}" for turn in turns
+    )
+
+
+async def summarize_turns(
+    summary: str, turns: list[SessionTurn]
+) -> tuple[str, dict[str, Any]]:
+    """
+    Fold turns into a session's running summary.
+
+    Returns:
+        Tuple of (new summary, token usage)
+    """
+    settings = get_settings()
+    answer = await complete(
+        settings.collector_model,
+        get_session_summary_prompt(),
+        (
+            f"## Previous summary\n{summary or '(none)'}\n\n"
+            f"## Older turns\n{_format_turns(turns)}"
+        ),
+        _MAX_OUTPUT_TOKENS,
+    )
+    return answer.text.strip(), answer.usage
+
+
+def build_summarized_query(
+    summary: str, turns: list[SessionTurn], query: str
+) -> str:
+    """Query starting a fresh session from a summarized conversation."""
+    parts = [
+        "This continues an earlier conversation about this cluster.",
+        f"## Earlier conversation (summarized)\n{summary}",
+    ]
+    if turns:
+        parts.append(f"## Most recent turns\n{_format_turns(turns)}")
+    parts.append(f"## Current request\n{query}")
+    return "\n\n".join(parts)
+
+
+async def prepare_follow_up(session_id: str | None, query: str) -> FollowUp:
+    """
+    Decide how a query continues its session, summarizing it if it grew too large.
+
+    A session without a known history (for example one started before a
+    restart) is resumed as is. If summarizing fails, the session is resumed.
+    """
+    history = get_session_histories().get(session_id) if session_id else None
+    if session_id is None or history is None:
+        return FollowUp(session_id, query, history or SessionHistory())
+
+    settings = get_settings()
+    tokens = history.context_chars // _CHARS_PER_TOKEN
+    if not settings.session_summary_tokens or tokens < settings.session_summary_tokens:
+        return FollowUp(session_id, query, history)
+
+    keep = settings.session_summary_keep_turns
+    older = history.turns[:-keep] if keep else history.turns
+    recent = history.turns[-keep:] if keep else []
+    try:
+        summary, usage = await summarize_turns(history.summary, older)
+    except Exception as e:
+        logger.warning(f"Summarizing session {session_id} failed, resuming it: {e}")
+        return FollowUp(session_id, query, history)
+
+    logger.info(
+        f"Summarized {len(older)} turns of session {session_id} (~{tokens} tokens)"
+    )
+    add_event("session_summarized", {"turns": len(older), "estimated_tokens": tokens})
+    return FollowUp(
+        resume=None,
+        query=build_summarized_query(summary, recent, query),
+        history=SessionHistory(summary=summary, turns=list(recent)),
+        usage=usage,
+    )
+
+
+def record_turn(
+    follow_up: FollowUp,
+    session_id: str,
+    query: str,
+    report: str,
+    context_chars: int,
+) -> None:
+    """Add a completed turn to the history of the session it ran in."""
+    history = follow_up.history
+    history.turns.append(SessionTurn(query=query, report=report))
+    history.context_chars += context_chars
+    get_session_histories().put(session_id, history)
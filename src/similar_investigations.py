@@ -0,0 +1,102 @@
+"""
+Earlier investigations similar to a new query.
+
+Completed investigations of the cluster are kept in the investigation store.
+When a new investigation starts, the earlier ones are ranked by the
+similarity of their query and report to the new query (text_index.py), and
+the best SHOOT_SIMILAR_INVESTIGATIONS are given to the coordinator with the
+query. The coordinator can then recognize recurring issues ("this happened
+last Tuesday and was fixed by X") while it still verifies the current state
+with its collectors.
+
+Follow-up queries are not augmented: their session already holds the earlier
+conversation. Requests impersonating their caller (impersonation.py) only
+get earlier investigations of the same user, and requests restricted to
+namespaces (namespace_scope.py) only those restricted to the same namespaces.
+Tenants (tenancy.py) only get their own.
+"""
+
+from typing import Any
+
+from config import get_settings, get_wc_cluster
+from impersonation import impersonation_ctx
+from namespace_scope import namespace_scope_ctx
+from store import InvestigationRecord, get_investigation_store
+from tenancy import tenant_ctx
+from telemetry import add_event
+from text_index import TextIndex
+
+# Investigations scoring below this are not considered similar
+_MIN_SCORE = 0.2
+# Characters of each similar report given to the coordinator
+_MAX_REPORT_CHARS = 1500
+
+
+def find_similar_investigations(
+    query: str, limit: int
+) -> list[tuple[float, InvestigationRecord]]:
+    """Earlier investigations of this cluster most similar to a query, best first."""
+    cluster = get_wc_cluster()
+    identity = impersonation_ctx.get()
+    user = identity.user if identity else None
+    scope = namespace_scope_ctx.get()
+    namespaces = list(scope) if scope is not None else None
+    tenant = tenant_ctx.get()
+    records = [
+        record
+        for record in get_investigation_store().list()
+        # Shadow re-runs duplicate their original
+        if record.cluster == cluster
+        and record.user == user
+        and record.namespaces == namespaces
+        and record.tenant == tenant
+        and record.shadow_of is None
+        and record.result
+    ]
+    if not records:
+        return []
+    index = TextIndex([f"{record.query}\n{record.result}" for record in records])
+    return [
+        (score, records[position])
+        for score, position in index.search(query, limit, _MIN_SCORE)
+    ]
+
+
+def format_similar_investigations(
+    similar: list[tuple[float, InvestigationRecord]],
+) -> str:
+    """Context section on similar investigations, added to the query."""
+    entries = []
+    for _, record in similar:
+        report = record.result[:_MAX_REPORT_CHARS]
+        if len(record.result) > _MAX_REPORT_CHARS:
+            report += " [...]"
+        feedback = f" (rated {record.feedback.rating})" if record.feedback else ""
+        entries.append(
+            f"### {record.created_at}: {record.query}{feedback}\n{report}"
+        )
+    return (
+        "## Similar earlier investigations of this cluster\n"
+        "For context only: they may point to a recurring issue and its fix, but "
+        "they are not evidence of the current state. Verify with collectors.\n\n"
+        + "\n\n".join(entries)
+    )
+
+
+def with_similar_investigations(query: str) -> tuple[str, list[dict[str, Any]]]:
+    """
+    Add similar earlier investigations to a new query.
+
+    Returns:
+        Tuple of (query text for the coordinator, IDs and scores of the
+        similar investigations)
+    """
+    limit = get_settings().similar_investigations
+    similar = find_similar_investigations(query, limit) if limit else []
+    if not similar:
+        return query, []
+    add_event("similar_investigations", {"count": len(similar)})
+    return (
+        f"{query}\n\n{format_similar_investigations(similar)}",
+        [{"id": record.id, "score": round(score, 3)} for score, record in similar],
+    )
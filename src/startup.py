@@ -0,0 +1,128 @@
+"""
+Startup progress for the Kubernetes startup probe.
+
+Cold starts can be slow: MCP servers are started and answer their first
+handshake only after downloading or logging in. `GET /startup` reports the
+progress of the initialization steps, which run in the background once the
+app has started:
+
+- `prompts_loaded`: the prompt templates load and only reference documented
+  variables
+- `agents_constructed`: the investigation backend is ready (for the Agent
+  SDK, the coordinator and collector agents are constructed)
+- `mcp_handshake`: the mcp-kubernetes servers of the collector registry
+  answered tools/list. Other servers, e.g. optional external ones, are left
+  to the readiness probe: one that is down makes the pod unready instead of
+  having the startupProbe restart it
+
+Failed steps are retried every few seconds. The probe answers 503 until all
+steps are done, so a startupProbe with a generous failureThreshold tolerates
+slow cold starts while the readiness and liveness probes keep their tight
+thresholds.
+"""
+
+import asyncio
+import time
+from functools import lru_cache
+from typing import Any, Awaitable, Callable
+
+from app_logging import logger
+from backend import get_backend
+from collectors import KUBERNETES_SERVERS, get_collector_registry
+from config import validate_prompts
+from dependency_checks import probe_mcp_server
+from invocation import propagate_invocation_chain
+
+STARTUP_STEPS = ("prompts_loaded", "agents_constructed", "mcp_handshake")
+_RETRY_SECONDS = 5
+
+
+class StartupProgress:
+    """Progress of the initialization steps."""
+
+    def __init__(self) -> None:
+        self._started = time.monotonic()
+        self._steps: dict[str, dict[str, Any]] = {
+            step: {"done": False, "attempts": 0} for step in STARTUP_STEPS
+        }
+
+    def complete(self, step: str, duration_ms: int) -> None:
+        """Record that a step is done."""
+        entry = self._steps[step]
+        entry.update(done=True, attempts=entry["attempts"] + 1, duration_ms=duration_ms)
+        entry.pop("error", None)
+
+    def fail(self, step: str, error: str) -> None:
+        """Record a failed attempt of a step."""
+        entry = self._steps[step]
+        entry.update(attempts=entry["attempts"] + 1, error=error)
+
+    def done(self) -> bool:
+        """Whether every step is done."""
+        return all(entry["done"] for entry in self._steps.values())
+
+    def status(self) -> dict[str, Any]:
+        """Progress for the startup probe."""
+        return {
+            "status": "started" if self.done() else "starting",
+            "elapsed_seconds": int(time.monotonic() - self._started),
+            "steps": {step: dict(entry) for step, entry in self._steps.items()},
+        }
+
+
+@lru_cache()
+def get_startup_progress() -> StartupProgress:
+    """Get the process-wide startup progress."""
+    return StartupProgress()
+
+
+async def _load_prompts() -> None:
+    await asyncio.to_thread(validate_prompts)
+
+
+async def _construct_agents() -> None:
+    if not await asyncio.to_thread(get_backend().ready):
+        raise RuntimeError(f"{get_backend().name} backend is not ready")
+
+
+async def _mcp_handshake() -> None:
+    servers = propagate_invocation_chain(get_collector_registry().server_configs())
+    # In-process servers have nothing to probe
+    probes = {
+        name: probe_mcp_server(name, config)
+        for name, config in servers.items()
+        if name in KUBERNETES_SERVERS and config.get("type") != "sdk"
+    }
+    results = dict(zip(probes.keys(), await asyncio.gather(*probes.values())))
+    failed = [
+        f"{name}: {result['error']}"
+        for name, result in results.items()
+        if not result["valid"]
+    ]
+    if failed:
+        raise RuntimeError("; ".join(failed))
+
+
+_STEP_CHECKS: dict[str, Callable[[], Awaitable[None]]] = {
+    "prompts_loaded": _load_prompts,
+    "agents_constructed": _construct_agents,
+    "mcp_handshake": _mcp_handshake,
+}
+
+
+async def run_startup() -> None:
+    """Run the initialization steps in order, retrying each until it succeeds."""
+    progress = get_startup_progress()
+    for step in STARTUP_STEPS:
+        while True:
+            started = time.monotonic()
+            try:
+                await _STEP_CHECKS[step]()
+            except Exception as e:
+                progress.fail(step, str(e))
+                logger.warning(f"Startup step {step} failed, retrying: {e}")
+                await asyncio.sleep(_RETRY_SECONDS)
+                continue
+            progress.complete(step, int((time.monotonic() - started) * 1000))
+            break
+    logger.info(f"Startup complete in {progress.status()['elapsed_seconds']}s")
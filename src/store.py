@@ -0,0 +1,252 @@
+"""
+In-memory investigation history for the Shoot agent system.
+
+Completed investigations are kept in a bounded, insertion-ordered store so
+they can be looked up by request ID and compared against each other
+(e.g. the same query run against different models or prompt versions).
+"""
+
+import hashlib
+from collections import OrderedDict
+from datetime import datetime, timezone
+from functools import lru_cache
+from threading import Lock
+from typing import Any, Literal
+
+from pydantic import BaseModel, Field
+
+from config import get_org_ns, get_prompt_version, get_settings, get_wc_cluster
+from generation import GenerationOverrides
+from impersonation import impersonation_ctx
+from namespace_scope import namespace_scope_ctx
+from report_markdown import REPORT_ARTIFACT, markdown_report
+from schemas import InvestigationResult, parse_report
+from tenancy import tenant_ctx
+
+
+class Feedback(BaseModel):
+    """A user's rating of an investigation report."""
+
+    rating: Literal["up", "down"]
+    comment: str | None = Field(default=None, max_length=2000)
+    created_at: str = Field(
+        default_factory=lambda: datetime.now(timezone.utc).isoformat(),
+        description="Feedback timestamp (ISO 8601, UTC)",
+    )
+
+
+class InvestigationRecord(BaseModel):
+    """A completed investigation together with the versions that produced it."""
+
+    id: str = Field(..., description="Request ID of the investigation")
+    query: str = Field(..., description="Original failure description")
+    cluster: str = Field(default="", description="Workload cluster investigated")
+    cluster_namespace: str = Field(
+        default="", description="Organization namespace of the workload cluster"
+    )
+    user: str | None = Field(
+        default=None, description="Kubernetes user impersonated for the caller"
+    )
+    namespaces: list[str] | None = Field(
+        default=None, description="Namespaces the investigation was restricted to"
+    )
+    tenant: str | None = Field(default=None, description="Tenant that requested it")
+    created_at: str = Field(
+        default_factory=lambda: datetime.now(timezone.utc).isoformat(),
+        description="Completion timestamp (ISO 8601, UTC)",
+    )
+    coordinator_model: str = Field(..., description="Coordinator model used")
+    collector_model: str = Field(..., description="Collector model used")
+    prompt_version: str = Field(..., description="Hash of the prompt templates used")
+    generation: dict[str, Any] | None = Field(
+        default=None,
+        description="Per-request coordinator model and generation overrides",
+    )
+    instructions: str | None = Field(
+        default=None,
+        description="Per-request instructions appended to the coordinator prompt",
+    )
+    result: str = Field(..., description="Raw coordinator output")
+    structured: dict[str, Any] | None = Field(
+        default=None, description="Parsed DiagnosticReport, if the output was parseable"
+    )
+    duration_ms: int = 0
+    num_turns: int = 0
+    total_cost_usd: float | None = None
+    usage: dict[str, Any] | None = None
+    breakdown: dict[str, dict[str, Any]] | None = None
+    model_upgrade: str | None = Field(
+        default=None, description="Model the coordinator was upgraded to mid-run"
+    )
+    findings: str | None = Field(
+        default=None,
+        description="Coordinator findings the report was written from, if the report writer ran",
+    )
+    review: dict[str, Any] | None = Field(
+        default=None, description="Critic verdict on the report, if a review ran"
+    )
+    shadow_of: str | None = Field(
+        default=None,
+        description="ID of the original investigation if this is a shadow re-run",
+    )
+    collector_instructions: dict[str, str] | None = Field(
+        default=None,
+        description="Digests of per-request collector instruction overrides, by collector",
+    )
+    truncated: bool = Field(
+        default=False,
+        description="The investigation was stopped at the cost ceiling; the report is partial",
+    )
+    artifacts: dict[str, str] = Field(
+        default_factory=dict,
+        description="Collector results and tool outputs behind the report, by name",
+    )
+    debug_trace: list[dict[str, Any]] | None = Field(
+        default=None,
+        description="Trace of the agent conversation, if the request asked for debug output",
+    )
+    validation: dict[str, Any] | None = Field(
+        default=None,
+        description="Report post-validation against the collected evidence",
+    )
+    triage: dict[str, Any] | None = Field(
+        default=None,
+        description="Severity, affected component, and probable cause category",
+    )
+    feedback: Feedback | None = Field(
+        default=None, description="Latest user rating of the report"
+    )
+
+
+def instructions_digest(instructions: str) -> str:
+    """Short content hash identifying a collector instruction override."""
+    return hashlib.sha256(instructions.encode("utf-8")).hexdigest()[:12]
+
+
+def record_from_result(
+    investigation_id: str,
+    query: str,
+    investigation_result: InvestigationResult,
+    shadow_of: str | None = None,
+    collector_instructions: dict[str, str] | None = None,
+    generation: GenerationOverrides | None = None,
+    instructions: str | None = None,
+) -> InvestigationRecord:
+    """Build an InvestigationRecord from a coordinator result and current versions."""
+    settings = get_settings()
+    structured = parse_report(
+        investigation_result["result"], investigation_result.get("alert_rules")
+    )
+    identity = impersonation_ctx.get()
+    namespaces = namespace_scope_ctx.get()
+    record = InvestigationRecord(
+        id=investigation_id,
+        query=query,
+        cluster=get_wc_cluster(),
+        cluster_namespace=get_org_ns(),
+        user=identity.user if identity else None,
+        namespaces=list(namespaces) if namespaces is not None else None,
+        tenant=tenant_ctx.get(),
+        coordinator_model=(
+            generation.model
+            if generation and generation.model
+            else settings.coordinator_model
+        ),
+        collector_model=settings.collector_model,
+        prompt_version=get_prompt_version(),
+        generation=generation.model_dump(exclude_none=True) if generation else None,
+        instructions=instructions,
+        result=investigation_result["result"],
+        structured=structured.model_dump() if structured else None,
+        duration_ms=investigation_result["duration_ms"],
+        num_turns=investigation_result["num_turns"],
+        total_cost_usd=investigation_result["total_cost_usd"],
+        usage=investigation_result["usage"],
+        breakdown=investigation_result.get("breakdown"),
+        model_upgrade=investigation_result.get("model_upgrade"),
+        review=investigation_result.get("review"),
+        findings=investigation_result.get("findings"),
+        validation=investigation_result.get("validation"),
+        triage=investigation_result.get("triage"),
+        debug_trace=investigation_result.get("debug_trace"),
+        artifacts=investigation_result.get("artifacts") or {},
+        truncated=investigation_result.get("truncated", False),
+        shadow_of=shadow_of,
+        collector_instructions=(
+            {
+                name: instructions_digest(text)
+                for name, text in collector_instructions.items()
+            }
+            if collector_instructions
+            else None
+        ),
+    )
+    record.artifacts[REPORT_ARTIFACT] = markdown_report(record)
+    return record
+
+
+# Query characters kept in investigation summaries
+SUMMARY_QUERY_LENGTH = 200
+
+
+def record_summary(record: InvestigationRecord) -> dict[str, Any]:
+    """Summary of an investigation for listings."""
+    return {
+        "id": record.id,
+        "query": record.query[:SUMMARY_QUERY_LENGTH],
+        "cluster": record.cluster,
+        "created_at": record.created_at,
+        "duration_ms": record.duration_ms,
+        "total_cost_usd": record.total_cost_usd,
+        "truncated": record.truncated,
+        "severity": record.triage["severity"] if record.triage else None,
+        "rating": record.feedback.rating if record.feedback else None,
+        "shadow_of": record.shadow_of,
+    }
+
+
+class InvestigationStore:
+    """
+    Bounded in-memory store of completed investigations.
+
+    Oldest records are evicted once the configured capacity is reached.
+    """
+
+    def __init__(self, max_size: int) -> None:
+        self._max_size = max_size
+        self._records: OrderedDict[str, InvestigationRecord] = OrderedDict()
+        self._lock = Lock()
+
+    def add(self, record: InvestigationRecord) -> None:
+        """Add or replace a record, evicting the oldest if over capacity."""
+        with self._lock:
+            self._records[record.id] = record
+            self._records.move_to_end(record.id)
+            while len(self._records) > self._max_size:
+                self._records.popitem(last=False)
+
+    def get(self, investigation_id: str) -> InvestigationRecord | None:
+        """Return the record for an investigation ID, or None if unknown."""
+        with self._lock:
+            return self._records.get(investigation_id)
+
+    def set_feedback(
+        self, investigation_id: str, feedback: Feedback
+    ) -> InvestigationRecord | None:
+        """Attach feedback to a record, replacing earlier feedback."""
+        with self._lock:
+            record = self._records.get(investigation_id)
+            if record is not None:
+                record.feedback = feedback
+            return record
+
+    def list(self) -> list[InvestigationRecord]:
+        """Return all records, oldest first."""
+        with self._lock:
+            return list(self._records.values())
+
+
+@lru_cache()
+def get_investigation_store() -> InvestigationStore:
+    """Get the process-wide investigation store."""
+    return InvestigationStore(get_settings().investigation_history_size)
@@ -0,0 +1,218 @@
+"""
+Microsoft Teams integration.
+
+Teams channels can start investigations and get their reports as Adaptive
+Cards:
+
+- an outgoing webhook of the team (Apps > Create an outgoing webhook) posts
+  messages mentioning it to `POST /teams`; shoot checks their HMAC signature
+  with the webhook's security token (SHOOT_TEAMS_OUTGOING_WEBHOOK_SECRET),
+  answers at once that it is investigating, and runs the investigation of
+  the message text in the background
+- the report, or the error, is posted as an Adaptive Card to
+  SHOOT_TEAMS_WEBHOOK_URL (an incoming webhook or Workflows webhook of the
+  channel), as Teams gives outgoing webhooks only seconds to answer
+
+Investigations are admitted and kept like A2A ones (delegation.py). Teams
+messages carry no Kubernetes identity, so they are refused with
+SHOOT_IMPERSONATION_ENABLED; with SHOOT_TENANTS_CONFIG they run as the
+tenant SHOOT_TEAMS_TENANT.
+"""
+
+import asyncio
+import base64
+import binascii
+import hashlib
+import hmac
+import html
+import re
+import uuid
+from typing import Any
+
+import httpx
+
+from app_logging import audit, logger
+from background import spawn_background
+from config import get_settings
+from delegation import admission_refusal, run_delegated_investigation
+from query_policy import QueryPolicyViolation, check_query
+from store import InvestigationRecord
+from telemetry import add_event
+from tenancy import get_tenant_registry, tenancy_enabled, tenant_ctx
+
+_WEBHOOK_TIMEOUT_SECONDS = 10
+# Teams messages are limited to about 28 KB
+_MAX_REPORT_CHARS = 20000
+_MENTION_PATTERN = re.compile(r"<at>.*?</at>", re.DOTALL)
+_TAG_PATTERN = re.compile(r"<[^>]+>")
+
+def teams_enabled() -> bool:
+    """Whether Teams may start investigations."""
+    return bool(get_settings().teams_outgoing_webhook_secret)
+
+
+def verify_teams_signature(body: bytes, authorization: str | None) -> bool:
+    """Whether a request carries the HMAC signature of the outgoing webhook."""
+    scheme, _, signature = (authorization or "").partition(" ")
+    if scheme != "HMAC" or not signature:
+        return False
+    try:
+        key = base64.b64decode(get_settings().teams_outgoing_webhook_secret)
+    except binascii.Error:
+        logger.error("SHOOT_TEAMS_OUTGOING_WEBHOOK_SECRET is not valid base64")
+        return False
+    expected = base64.b64encode(hmac.new(key, body, hashlib.sha256).digest())
+    return hmac.compare_digest(expected.decode(), signature.strip())
+
+
+def message_query(activity: dict[str, Any]) -> str:
+    """The text of a Teams message, without the mention of shoot and markup."""
+    text = activity.get("text")
+    if not isinstance(text, str):
+        return ""
+    text = _MENTION_PATTERN.sub("", text)
+    text = _TAG_PATTERN.sub(" ", text.replace("<br>", "\n"))
+    return html.unescape(text).strip()
+
+
+def teams_caller_refusal() -> str | None:
+    """
+    Adopt the tenant of Teams requests for the current context.
+
+    Returns:
+        None if Teams may investigate, otherwise why not
+    """
+    settings = get_settings()
+    if settings.impersonation_enabled:
+        return "Teams messages carry no caller identity to impersonate"
+    if not tenancy_enabled():
+        return None
+    registry = get_tenant_registry()
+    if registry is None or settings.teams_tenant not in registry.tenants:
+        return "SHOOT_TEAMS_TENANT must name a tenant"
+    tenant_ctx.set(settings.teams_tenant)
+    return None
+
+
+def _text_block(text: str, **fields: Any) -> dict[str, Any]:
+    return {"type": "TextBlock", "text": text, "wrap": True, **fields}
+
+
+def adaptive_card_message(body: list[dict[str, Any]]) -> dict[str, Any]:
+    """A Teams message holding an Adaptive Card with the given body."""
+    return {
+        "type": "message",
+        "attachments": [
+            {
+                "contentType": "application/vnd.microsoft.card.adaptive",
+                "contentUrl": None,
+                "content": {
+                    "$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+                    "type": "AdaptiveCard",
+                    "version": "1.4",
+                    "body": body,
+                    "msteams": {"width": "Full"},
+                },
+            }
+        ],
+    }
+
+
+def report_card(record: InvestigationRecord) -> dict[str, Any]:
+    """Adaptive Card message with the report of an investigation."""
+    facts = [
+        {"title": "Cluster", "value": record.cluster or "-"},
+        {"title": "Duration", "value": f"{record.duration_ms / 1000:.0f}s"},
+        {"title": "Investigation", "value": record.id},
+    ]
+    if record.triage:
+        facts.insert(1, {"title": "Severity", "value": record.triage["severity"]})
+    if record.total_cost_usd is not None:
+        facts.append({"title": "Cost", "value": f"${record.total_cost_usd:.2f}"})
+    report = record.result
+    if len(report) > _MAX_REPORT_CHARS:
+        report = report[:_MAX_REPORT_CHARS] + "\n\n[Report truncated]"
+    body = [
+        _text_block("shoot investigation", weight="Bolder", size="Medium"),
+        _text_block(record.query, isSubtle=True),
+        {"type": "FactSet", "facts": facts},
+        _text_block(report, separator=True),
+    ]
+    if record.truncated:
+        body.append(
+            _text_block("Stopped at the cost ceiling; the report is partial.")
+        )
+    return adaptive_card_message(body)
+
+
+def error_card(request_id: str, query: str, error: str) -> dict[str, Any]:
+    """Adaptive Card message telling that an investigation failed."""
+    return adaptive_card_message(
+        [
+            _text_block(
+                "shoot investigation failed", weight="Bolder", color="Attention"
+            ),
+            _text_block(query, isSubtle=True),
+            _text_block(f"{error} (investigation {request_id})"),
+        ]
+    )
+
+
+async def post_teams_message(message: dict[str, Any]) -> None:
+    """Post a message to the Teams channel webhook, if configured."""
+    url = get_settings().teams_webhook_url
+    if not url:
+        return
+    try:
+        async with httpx.AsyncClient(timeout=_WEBHOOK_TIMEOUT_SECONDS) as client:
+            response = await client.post(url, json=message)
+            response.raise_for_status()
+    except httpx.HTTPError as e:
+        logger.warning(f"Teams webhook failed: {e}")
+
+
+async def _investigate_for_teams(request_id: str, query: str) -> None:
+    """Run an investigation and post its report to the Teams channel."""
+    try:
+        record, _ = await run_delegated_investigation(request_id, query)
+    except asyncio.TimeoutError:
+        await post_teams_message(error_card(request_id, query, "Timed out"))
+        return
+    except Exception as e:
+        logger.exception(f"Teams investigation failed request_id={request_id}")
+        await post_teams_message(error_card(request_id, query, str(e)))
+        return
+    await post_teams_message(report_card(record))
+
+
+def handle_teams_message(activity: dict[str, Any]) -> dict[str, Any]:
+    """
+    Answer a message of the outgoing webhook, starting its investigation.
+
+    Returns:
+        The reply shown in the channel right away
+    """
+    query = message_query(activity)
+    if not query:
+        return {"type": "message", "text": "Describe the issue to investigate."}
+    sender = activity.get("from") or {}
+    refusal = teams_caller_refusal()
+    if refusal is not None:
+        return {"type": "message", "text": f"Cannot investigate: {refusal}"}
+    # Refused queries don't count against the tenant's quotas
+    try:
+        query = check_query(query)
+    except QueryPolicyViolation as e:
+        return {"type": "message", "text": f"Cannot investigate: {e.message}"}
+    refusal = admission_refusal(None)
+    if refusal is not None:
+        return {"type": "message", "text": f"Cannot investigate: {refusal}"}
+
+    request_id = str(uuid.uuid4())
+    audit("teams_investigation", request_id=request_id, sender=sender.get("name"))
+    add_event("teams_investigation", {})
+    spawn_background(_investigate_for_teams(request_id, query))
+    reply = f"Investigating (investigation {request_id})."
+    if get_settings().teams_webhook_url:
+        reply += " The report will be posted to this channel."
+    return {"type": "message", "text": reply}
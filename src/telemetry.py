@@ -7,6 +7,9 @@ This module configures distributed tracing for:
 - MCP tool calls
 - API request handling
 
+Metrics (gauges of in-flight investigations) are exported to the same OTLP
+endpoint.
+
 Environment variables:
 - OTEL_EXPORTER_OTLP_ENDPOINT: OTLP endpoint URL (e.g., http://localhost:4317)
 - OTEL_SERVICE_NAME: Service name (default: "shoot")
@@ -17,7 +20,9 @@ import os
 from contextlib import contextmanager
 from typing import Any, Generator
 
-from opentelemetry import trace
+from opentelemetry import metrics, trace
+from opentelemetry.sdk.metrics import MeterProvider
+from opentelemetry.sdk.metrics.export import PeriodicExportingMetricReader
 from opentelemetry.sdk.trace import TracerProvider
 from opentelemetry.sdk.trace.export import BatchSpanProcessor, ConsoleSpanExporter
 from opentelemetry.sdk.resources import Resource, SERVICE_NAME
@@ -25,6 +30,9 @@ from opentelemetry.trace import Status, StatusCode, Span
 
 # Conditionally import OTLP exporter (may not be available in all environments)
 try:
+    from opentelemetry.exporter.otlp.proto.grpc.metric_exporter import (
+        OTLPMetricExporter,
+    )
     from opentelemetry.exporter.otlp.proto.grpc.trace_exporter import OTLPSpanExporter
 
     OTLP_AVAILABLE = True
@@ -78,6 +86,42 @@ def get_tracer() -> trace.Tracer:
     return _tracer
 
 
+def init_metrics() -> metrics.Meter:
+    """
+    Initialize OpenTelemetry metrics.
+
+    Metrics are exported over OTLP if OTEL_EXPORTER_OTLP_ENDPOINT is set;
+    otherwise instruments are recorded but not exported.
+    """
+    resource = Resource.create(
+        {SERVICE_NAME: os.environ.get("OTEL_SERVICE_NAME", "shoot")}
+    )
+    otlp_endpoint = os.environ.get("OTEL_EXPORTER_OTLP_ENDPOINT")
+    readers = []
+    if otlp_endpoint and OTLP_AVAILABLE:
+        readers.append(
+            PeriodicExportingMetricReader(
+                OTLPMetricExporter(endpoint=otlp_endpoint, insecure=True)
+            )
+        )
+    metrics.set_meter_provider(
+        MeterProvider(resource=resource, metric_readers=readers)
+    )
+    return metrics.get_meter(__name__)
+
+
+# Global meter instance
+_meter: metrics.Meter | None = None
+
+
+def get_meter() -> metrics.Meter:
+    """Get or create the global meter instance."""
+    global _meter
+    if _meter is None:
+        _meter = init_metrics()
+    return _meter
+
+
 @contextmanager
 def trace_operation(
     name: str, attributes: dict[str, Any] | None = None
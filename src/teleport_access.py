@@ -0,0 +1,128 @@
+"""
+Workload cluster access through Teleport.
+
+Giant Swarm engineers reach workload clusters through Teleport rather than
+with long-lived kubeconfigs. With SHOOT_WC_ACCESS=teleport, shoot does the
+same: before the workload cluster MCP server is started, `tsh kube login`
+writes a kubeconfig for the cluster's Teleport Kubernetes cluster
+(SHOOT_TELEPORT_KUBE_CLUSTER) to a file only shoot can read, and that file is
+used in place of KUBECONFIG. Its credentials come from the Teleport Machine ID
+identity file (SHOOT_TELEPORT_IDENTITY_FILE) renewed by tbot, or from the
+current tsh login for local development.
+
+The kubeconfig of WC_CLUSTER is written at startup, before the pooled MCP
+servers start, and renewed every SHOOT_TELEPORT_LOGIN_INTERVAL_SECONDS;
+per-request clusters (cluster_kubeconfig.py) are logged in to when they are
+targeted.
+"""
+
+import asyncio
+import os
+
+from app_logging import logger
+from config import get_settings
+from private_files import PrivateDirectory
+from telemetry import add_event, trace_operation
+
+# Time a tsh kube login may take
+_LOGIN_TIMEOUT_SECONDS = 60
+# Characters of tsh's error output kept in errors
+_MAX_ERROR_CHARS = 500
+# Kubeconfigs written by tsh kube login
+_KUBECONFIGS = PrivateDirectory("shoot-teleport-")
+
+
+class TeleportLoginError(Exception):
+    """tsh kube login failed."""
+
+
+def teleport_enabled() -> bool:
+    """Whether workload cluster credentials are obtained through Teleport."""
+    return get_settings().wc_access == "teleport"
+
+
+def teleport_kube_cluster(cluster: str) -> str:
+    """Teleport Kubernetes cluster name of a workload cluster."""
+    return get_settings().teleport_kube_cluster.replace("{cluster}", cluster)
+
+
+def teleport_kubeconfig_path(cluster: str) -> str:
+    """Path of the kubeconfig tsh writes for a workload cluster."""
+    return str(_KUBECONFIGS.path / f"{cluster}.kubeconfig")
+
+
+def wc_kubeconfig() -> str:
+    """Kubeconfig of the configured workload cluster (KUBECONFIG, or Teleport's)."""
+    settings = get_settings()
+    if teleport_enabled():
+        return teleport_kubeconfig_path(settings.wc_cluster)
+    return settings.kubeconfig
+
+
+def tsh_login_args(cluster: str) -> list[str]:
+    """Command line of tsh kube login for a workload cluster."""
+    settings = get_settings()
+    args = [settings.tsh_path, "kube", "login", teleport_kube_cluster(cluster)]
+    if settings.teleport_proxy:
+        args.append(f"--proxy={settings.teleport_proxy}")
+    if settings.teleport_identity_file:
+        args.append(f"--identity={settings.teleport_identity_file}")
+    return args
+
+
+async def tsh_kube_login(cluster: str) -> str:
+    """
+    Write a kubeconfig for a workload cluster with tsh kube login.
+
+    Returns:
+        Path of the kubeconfig
+
+    Raises:
+        TeleportLoginError: tsh failed, timed out, or is not installed
+    """
+    path = teleport_kubeconfig_path(cluster)
+    with trace_operation("teleport.kube_login"):
+        try:
+            process = await asyncio.create_subprocess_exec(
+                *tsh_login_args(cluster),
+                env={**os.environ, "KUBECONFIG": path},
+                stdout=asyncio.subprocess.DEVNULL,
+                stderr=asyncio.subprocess.PIPE,
+            )
+        except OSError as e:
+            raise TeleportLoginError(f"Cannot run tsh: {e}") from e
+        try:
+            async with asyncio.timeout(_LOGIN_TIMEOUT_SECONDS):
+                _, stderr = await process.communicate()
+        except TimeoutError:
+            process.kill()
+            await process.wait()
+            raise TeleportLoginError(
+                f"tsh kube login timed out after {_LOGIN_TIMEOUT_SECONDS}s"
+            )
+        if process.returncode != 0:
+            error = stderr.decode("utf-8", "replace").strip()[-_MAX_ERROR_CHARS:]
+            raise TeleportLoginError(f"tsh kube login failed: {error}")
+        add_event(
+            "teleport_kube_login", {"kube_cluster": teleport_kube_cluster(cluster)}
+        )
+    return path
+
+
+async def login_wc_cluster() -> None:
+    """Write the kubeconfig of the configured workload cluster, logging failures."""
+    cluster = get_settings().wc_cluster
+    try:
+        await tsh_kube_login(cluster)
+    except TeleportLoginError as e:
+        # A previous kubeconfig stays in place until its credentials expire
+        logger.error(f"Teleport login to {cluster} failed: {e}")
+        return
+    logger.info(f"Wrote Teleport kubeconfig of {cluster}")
+
+
+async def run_teleport_login(interval_seconds: int) -> None:
+    """Renew the workload cluster's kubeconfig periodically, until cancelled."""
+    while True:
+        await asyncio.sleep(interval_seconds)
+        await login_wc_cluster()
@@ -0,0 +1,206 @@
+"""
+Teams sharing a shoot deployment.
+
+With SHOOT_TENANTS_CONFIG, a single deployment serves several teams. The
+file maps callers to tenants and sets what each may do:
+
+    tenants:
+      payments:
+        api_key_sha256: [<hex SHA-256 of an API key>, ...]
+        groups: [payments-oncall]    # caller groups from the auth proxy
+        clusters: [prod-eu, prod-us] # default: WC_CLUSTER only
+        namespaces: [payments]       # optional, default: all
+        daily_budget_usd: 25         # optional quotas (tenant_quotas.py)
+
+A request belongs to the first tenant whose API key it carries
+(`Authorization: Bearer <key>`) or, failing that, one of whose groups the
+auth proxy set in SHOOT_IMPERSONATION_GROUPS_HEADER. The groups header is
+only trusted with SHOOT_IMPERSONATION_ENABLED, which declares that shoot sits
+behind an auth proxy setting it; otherwise any caller could set it. Requests
+of no tenant are refused, except those with the admin token, which are not restricted.
+The tenant is set for the request's context:
+
+- its investigations may only target its clusters and are restricted to its
+  namespaces (namespace_scope.py), or to a subset named by the request
+- its investigations count against its quotas (tenant_quotas.py)
+- the investigation history, similar investigations, and the A2A and MCP
+  lookups only show the tenant's own investigations
+"""
+
+import hashlib
+import secrets
+from contextvars import ContextVar
+from functools import lru_cache
+from pathlib import Path
+from typing import Mapping
+
+import yaml
+from fastapi import HTTPException, Request
+from pydantic import BaseModel, ConfigDict, Field, ValidationError
+
+from app_logging import logger
+from auth import is_admin_token
+from config import get_settings
+
+
+class TenantSpec(BaseModel):
+    """Callers of a tenant and what they may investigate."""
+
+    model_config = ConfigDict(extra="forbid")
+
+    api_key_sha256: list[str] = Field(default_factory=list)
+    groups: list[str] = Field(default_factory=list)
+    clusters: list[str] = Field(default_factory=list)
+    namespaces: list[str] | None = Field(default=None, min_length=1)
+    daily_budget_usd: float | None = Field(default=None, ge=0)
+    monthly_budget_usd: float | None = Field(default=None, ge=0)
+    daily_requests: int | None = Field(default=None, ge=0)
+    monthly_requests: int | None = Field(default=None, ge=0)
+
+
+class TenantRegistry(BaseModel):
+    """Tenants by name, in the order callers are matched."""
+
+    model_config = ConfigDict(extra="forbid")
+
+    tenants: dict[str, TenantSpec] = Field(..., min_length=1)
+
+
+# Tenant of the current request, None without tenancy or with the admin token
+tenant_ctx: ContextVar[str | None] = ContextVar("tenant", default=None)
+
+
+def load_tenant_registry(path: Path) -> TenantRegistry:
+    """
+    Load and validate a tenants file.
+
+    Raises:
+        ValueError: The file is not a valid tenants file
+    """
+    try:
+        data = yaml.safe_load(path.read_text())
+        return TenantRegistry.model_validate(data or {})
+    except (OSError, yaml.YAMLError, ValidationError) as e:
+        raise ValueError(f"Invalid tenants config {path}: {e}") from e
+
+
+@lru_cache()
+def get_tenant_registry() -> TenantRegistry | None:
+    """Get the tenants configured by SHOOT_TENANTS_CONFIG, None if unset."""
+    path = get_settings().tenants_config
+    if not path:
+        return None
+    registry = load_tenant_registry(Path(path))
+    logger.info(f"Loaded {len(registry.tenants)} tenants from {path}")
+    return registry
+
+
+def tenancy_enabled() -> bool:
+    """Whether callers are mapped to tenants."""
+    return bool(get_settings().tenants_config)
+
+
+def current_tenant_spec() -> TenantSpec | None:
+    """Spec of the current request's tenant, None if it has none."""
+    name = tenant_ctx.get()
+    registry = get_tenant_registry()
+    if name is None or registry is None:
+        return None
+    return registry.tenants[name]
+
+
+def resolve_tenant(headers: Mapping[str, str]) -> str | None:
+    """The tenant a request belongs to, None if it matches none."""
+    registry = get_tenant_registry()
+    if registry is None:
+        return None
+    scheme, _, key = (headers.get("authorization") or "").partition(" ")
+    if scheme.lower() == "bearer" and key.strip():
+        digest = hashlib.sha256(key.strip().encode()).hexdigest()
+        for name, spec in registry.tenants.items():
+            hashes = [value.lower() for value in spec.api_key_sha256]
+            if any(secrets.compare_digest(digest, value) for value in hashes):
+                return name
+    settings = get_settings()
+    if not settings.impersonation_enabled:
+        # Without the auth proxy the groups header is set by the caller
+        return None
+    groups_header = headers.get(settings.impersonation_groups_header) or ""
+    groups = {group.strip() for group in groups_header.split(",") if group.strip()}
+    for name, spec in registry.tenants.items():
+        if groups.intersection(spec.groups):
+            return name
+    return None
+
+
+def enter_tenant(headers: Mapping[str, str]) -> str | None:
+    """
+    Adopt the tenant of a request for the current context.
+
+    Returns:
+        None if the request may proceed, otherwise why it is refused
+    """
+    if not tenancy_enabled():
+        return None
+    if is_admin_token(headers.get("authorization")):
+        return None
+    tenant = resolve_tenant(headers)
+    if tenant is None:
+        return "Unknown caller: the request belongs to no tenant"
+    tenant_ctx.set(tenant)
+    return None
+
+
+async def check_tenant(request: Request) -> None:
+    """
+    FastAPI dependency mapping the caller to its tenant.
+
+    Raises:
+        HTTPException: 401 if tenancy is enabled and the caller belongs to no
+            tenant
+    """
+    refusal = enter_tenant(request.headers)
+    if refusal is not None:
+        raise HTTPException(status_code=401, detail=refusal)
+    # For the access log
+    request.state.tenant = tenant_ctx.get()
+
+
+def tenant_cluster_refusal(cluster: str) -> str | None:
+    """Why the current tenant may not investigate a cluster, None if it may."""
+    spec = current_tenant_spec()
+    if spec is None:
+        return None
+    allowed = spec.clusters or [get_settings().wc_cluster]
+    if cluster in allowed:
+        return None
+    return f"Tenant {tenant_ctx.get()} may not investigate cluster {cluster}"
+
+
+def tenant_namespaces(requested: tuple[str, ...] | None) -> tuple[str, ...] | None:
+    """
+    Namespaces an investigation of the current tenant is restricted to.
+
+    Args:
+        requested: Namespaces named by the request (sorted), None for all
+
+    Raises:
+        ValueError: The request names namespaces outside the tenant's
+    """
+    spec = current_tenant_spec()
+    if spec is None or spec.namespaces is None:
+        return requested
+    if requested is None:
+        return tuple(sorted(set(spec.namespaces)))
+    outside = sorted(set(requested) - set(spec.namespaces))
+    if outside:
+        raise ValueError(
+            f"Tenant {tenant_ctx.get()} may not investigate {', '.join(outside)}"
+        )
+    return requested
+
+
+def visible_to_caller(record_tenant: str | None) -> bool:
+    """Whether an investigation of a tenant is visible to the current caller."""
+    tenant = tenant_ctx.get()
+    return tenant is None or tenant == record_tenant
@@ -0,0 +1,335 @@
+"""
+Cost and request quotas of tenants.
+
+The investigations of every tenant (tenancy.py) are counted, and their model
+cost summed, per UTC day and calendar month. A tenant's quotas limit both:
+
+- `daily_requests`, `monthly_requests`: investigations started; once
+  reached, further ones are refused with 429 and Retry-After until the
+  period resets
+- `daily_budget_usd`, `monthly_budget_usd`: model spend; once spent,
+  further investigations are refused with 402, and each one stops at the
+  budget left. Every attempt is charged, including stalled and failed ones,
+  and a retried attempt may only spend what the earlier ones left; single
+  Messages API requests (llm.py) are charged as they are made
+
+Quotas are checked when an investigation starts, and usage is kept in
+memory per replica. Admission is atomic: the request is counted and the
+investigation's budget reserved in one step, so concurrent requests cannot
+all see the same remaining budget. The reservation is
+SHOOT_MAX_COST_USD_PER_QUERY, or all the budget left without that ceiling;
+charges draw it down, and what is left is released when the investigation
+ends. `GET /quota` shows the caller's tenant its usage and
+quotas, `GET /admin/tenants` those of every tenant.
+"""
+
+import math
+import threading
+from contextvars import ContextVar
+from datetime import datetime, timedelta, timezone
+from functools import lru_cache
+from typing import Any, Literal
+
+from fastapi import HTTPException
+
+from app_logging import audit, logger
+from config import get_settings
+from tenancy import TenantSpec, current_tenant_spec, get_tenant_registry, tenant_ctx
+from telemetry import add_event
+
+Period = Literal["daily", "monthly"]
+PERIODS: tuple[Period, ...] = ("daily", "monthly")
+
+
+class QuotaExceededError(Exception):
+    """A tenant reached one of its quotas."""
+
+    def __init__(
+        self,
+        tenant: str,
+        quota: str,
+        limit: float,
+        used: float,
+        resets_at: datetime,
+        status_code: int,
+    ) -> None:
+        super().__init__(f"Tenant {tenant} reached its {quota} quota of {limit}")
+        self.tenant = tenant
+        self.quota = quota
+        self.limit = limit
+        self.used = used
+        self.resets_at = resets_at
+        self.status_code = status_code
+
+    def retry_after_seconds(self) -> int:
+        """Seconds until the quota resets."""
+        delta = self.resets_at - datetime.now(timezone.utc)
+        return max(1, math.ceil(delta.total_seconds()))
+
+    def detail(self) -> dict[str, Any]:
+        """Response detail naming the quota, its usage, and when it resets."""
+        return {
+            "error": str(self),
+            "tenant": self.tenant,
+            "quota": self.quota,
+            "limit": self.limit,
+            "used": self.used,
+            "resets_at": self.resets_at.isoformat(),
+        }
+
+
+def _period_key(period: Period, now: datetime) -> str:
+    return now.strftime("%Y-%m-%d" if period == "daily" else "%Y-%m")
+
+
+def period_end(period: Period, now: datetime) -> datetime:
+    """When the current period ends (the next midnight or month, UTC)."""
+    start = now.replace(hour=0, minute=0, second=0, microsecond=0)
+    if period == "daily":
+        return start + timedelta(days=1)
+    if start.month == 12:
+        return start.replace(year=start.year + 1, month=1, day=1)
+    return start.replace(month=start.month + 1, day=1)
+
+
+def _limits(spec: TenantSpec, period: Period) -> tuple[int | None, float | None]:
+    """Request and cost quotas of a tenant for a period."""
+    if period == "daily":
+        return spec.daily_requests, spec.daily_budget_usd
+    return spec.monthly_requests, spec.monthly_budget_usd
+
+
+class Reservation:
+    """Budget held for a running investigation of a tenant."""
+
+    def __init__(self, tenant: str, held_usd: float) -> None:
+        self.tenant = tenant
+        # Reserved budget not yet drawn down by charges
+        self.held_usd = held_usd
+
+
+# Reservation of the current investigation, None without a budget
+reservation_ctx: ContextVar[Reservation | None] = ContextVar(
+    "tenant_reservation", default=None
+)
+
+
+class TenantUsage:
+    """Investigations and model cost of each tenant in the current periods."""
+
+    def __init__(self) -> None:
+        # (tenant, period) -> [period key, requests, cost, reserved in USD]
+        self._usage: dict[tuple[str, Period], list[Any]] = {}
+        self._lock = threading.Lock()
+
+    def _current(self, tenant: str, period: Period, now: datetime) -> list[Any]:
+        key = _period_key(period, now)
+        entry = self._usage.get((tenant, period))
+        if entry is None or entry[0] != key:
+            entry = self._usage[(tenant, period)] = [key, 0, 0.0, 0.0]
+        return entry
+
+    def admit(
+        self, tenant: str, spec: TenantSpec, max_cost_usd: float | None
+    ) -> Reservation | None:
+        """
+        Check the quotas, count an investigation, and reserve its budget.
+
+        Returns:
+            The reservation, None if the tenant has no budget
+
+        Raises:
+            QuotaExceededError: A request quota (429) or budget (402) is reached
+        """
+        now = datetime.now(timezone.utc)
+        with self._lock:
+            left = None
+            for period in PERIODS:
+                _, requests, cost, reserved = self._current(tenant, period, now)
+                max_requests, budget = _limits(spec, period)
+                if max_requests is not None and requests >= max_requests:
+                    raise QuotaExceededError(
+                        tenant,
+                        f"{period}_requests",
+                        max_requests,
+                        requests,
+                        period_end(period, now),
+                        429,
+                    )
+                if budget is None:
+                    continue
+                if cost + reserved >= budget:
+                    raise QuotaExceededError(
+                        tenant,
+                        f"{period}_budget_usd",
+                        budget,
+                        round(cost + reserved, 4),
+                        period_end(period, now),
+                        402,
+                    )
+                period_left = budget - cost - reserved
+                left = period_left if left is None else min(left, period_left)
+            held = min(max_cost_usd or left, left) if left is not None else 0.0
+            for period in PERIODS:
+                entry = self._current(tenant, period, now)
+                entry[1] += 1
+                entry[3] += held
+        return Reservation(tenant, held) if left is not None else None
+
+    def add_cost(
+        self, tenant: str, cost_usd: float, reservation: Reservation | None = None
+    ) -> None:
+        """Add the model cost of an investigation, drawing down its reservation."""
+        now = datetime.now(timezone.utc)
+        with self._lock:
+            drawn = 0.0
+            if reservation is not None:
+                drawn = min(reservation.held_usd, cost_usd)
+                reservation.held_usd -= drawn
+            for period in PERIODS:
+                entry = self._current(tenant, period, now)
+                entry[2] += cost_usd
+                entry[3] = max(0.0, entry[3] - drawn)
+
+    def release(self, reservation: Reservation) -> None:
+        """Release what is left of a reservation."""
+        now = datetime.now(timezone.utc)
+        with self._lock:
+            held, reservation.held_usd = reservation.held_usd, 0.0
+            for period in PERIODS:
+                entry = self._current(reservation.tenant, period, now)
+                entry[3] = max(0.0, entry[3] - held)
+
+    def get(self, tenant: str, period: Period) -> tuple[int, float, float]:
+        """Investigations, cost, and reserved budget of the current period."""
+        with self._lock:
+            _, requests, cost, reserved = self._current(
+                tenant, period, datetime.now(timezone.utc)
+            )
+            return requests, cost, reserved
+
+
+@lru_cache()
+def get_tenant_usage() -> TenantUsage:
+    """Get the process-wide tenant usage."""
+    return TenantUsage()
+
+
+def admit_investigation() -> None:
+    """
+    Count an investigation of the current tenant against its quotas and
+    reserve its budget for the current context.
+
+    Callers release the reservation with settle_reservation() once the
+    investigation ends.
+
+    Raises:
+        QuotaExceededError: The tenant reached one of its quotas
+    """
+    tenant = tenant_ctx.get()
+    spec = current_tenant_spec()
+    if tenant is None or spec is None:
+        return
+    try:
+        reservation = get_tenant_usage().admit(
+            tenant, spec, get_settings().max_cost_usd_per_query or None
+        )
+    except QuotaExceededError as e:
+        add_event("tenant_quota_exceeded", {"tenant": tenant, "quota": e.quota})
+        raise
+    reservation_ctx.set(reservation)
+
+
+def settle_reservation() -> None:
+    """Release the budget the current investigation did not spend."""
+    reservation = reservation_ctx.get()
+    if reservation is not None and reservation.held_usd:
+        get_tenant_usage().release(reservation)
+
+
+async def check_tenant_quota() -> None:
+    """
+    Count an investigation against the tenant's quotas.
+
+    Endpoints call this once the request is validated, so refused queries
+    don't use up the tenant's requests.
+
+    Raises:
+        HTTPException: 429 if a request quota is reached, 402 if a budget is
+            spent
+    """
+    try:
+        admit_investigation()
+    except QuotaExceededError as e:
+        raise HTTPException(
+            status_code=e.status_code,
+            detail=e.detail(),
+            headers={"Retry-After": str(e.retry_after_seconds())},
+        )
+
+
+def remaining_budget() -> float | None:
+    """Budget the current tenant has left, None if unlimited."""
+    tenant = tenant_ctx.get()
+    spec = current_tenant_spec()
+    if tenant is None or spec is None:
+        return None
+    # Budget reserved by other investigations is not available
+    reservation = reservation_ctx.get()
+    held = reservation.held_usd if reservation is not None else 0.0
+    remaining = None
+    for period in PERIODS:
+        _, budget = _limits(spec, period)
+        if budget is not None:
+            _, cost, reserved = get_tenant_usage().get(tenant, period)
+            left = budget - cost - reserved + held
+            remaining = left if remaining is None else min(remaining, left)
+    return remaining
+
+
+def charge_tenant(cost_usd: float | None) -> None:
+    """Charge the cost of an investigation to the current tenant, if any."""
+    tenant = tenant_ctx.get()
+    if tenant is None or not cost_usd:
+        return
+    get_tenant_usage().add_cost(tenant, cost_usd, reservation_ctx.get())
+    remaining = remaining_budget()
+    if remaining is not None and remaining <= 0:
+        logger.warning(f"Tenant {tenant} spent its budget")
+        audit("tenant_budget_exhausted", tenant=tenant)
+
+
+def quota_status(tenant: str) -> dict[str, Any]:
+    """Usage and quotas of a tenant in the current periods."""
+    registry = get_tenant_registry()
+    assert registry is not None
+    spec = registry.tenants[tenant]
+    now = datetime.now(timezone.utc)
+    status: dict[str, Any] = {"tenant": tenant}
+    for period in PERIODS:
+        requests, cost, reserved = get_tenant_usage().get(tenant, period)
+        max_requests, budget = _limits(spec, period)
+        status[period] = {
+            "requests": {
+                "used": requests,
+                "limit": max_requests,
+                "remaining": (
+                    max(0, max_requests - requests)
+                    if max_requests is not None
+                    else None
+                ),
+            },
+            "cost_usd": {
+                "used": round(cost, 4),
+                # Held for running investigations
+                "reserved": round(reserved, 4),
+                "limit": budget,
+                "remaining": (
+                    round(max(0.0, budget - cost - reserved), 4)
+                    if budget is not None
+                    else None
+                ),
+            },
+            "resets_at": period_end(period, now).isoformat(),
+        }
+    return status
@@ -0,0 +1,67 @@
+"""
+Similarity search over short texts.
+
+Texts are embedded as sparse TF-IDF vectors over hashed terms and ranked by
+cosine similarity to the query. This needs no embedding service and suits
+the precise vocabulary of Kubernetes troubleshooting: resource kinds, error
+messages, component names. Used for runbooks (runbooks.py) and earlier
+investigations (similar_investigations.py).
+"""
+
+import math
+import re
+import zlib
+from collections import Counter
+
+# Dimensions of the hashed term space
+_DIMENSIONS = 1 << 20
+_TERM_PATTERN = re.compile(r"[a-z0-9][a-z0-9_.-]*[a-z0-9]|[a-z0-9]")
+
+
+def _terms(text: str) -> Counter[int]:
+    return Counter(
+        zlib.crc32(term.encode()) % _DIMENSIONS
+        for term in _TERM_PATTERN.findall(text.lower())
+    )
+
+
+def _normalize(vector: dict[int, float]) -> dict[int, float]:
+    norm = math.sqrt(sum(value * value for value in vector.values()))
+    return {key: value / norm for key, value in vector.items()} if norm else {}
+
+
+class TextIndex:
+    """TF-IDF embeddings of a list of texts."""
+
+    def __init__(self, texts: list[str]) -> None:
+        counts = [_terms(text) for text in texts]
+        document_frequency: Counter[int] = Counter()
+        for terms in counts:
+            document_frequency.update(terms.keys())
+        self._idf = {
+            term: math.log((1 + len(texts)) / (1 + frequency)) + 1
+            for term, frequency in document_frequency.items()
+        }
+        self._vectors = [self._embed(terms) for terms in counts]
+
+    def _embed(self, terms: Counter[int]) -> dict[int, float]:
+        return _normalize(
+            {
+                term: (1 + math.log(count)) * self._idf.get(term, 0.0)
+                for term, count in terms.items()
+            }
+        )
+
+    def search(
+        self, query: str, limit: int, min_score: float
+    ) -> list[tuple[float, int]]:
+        """(score, text position) of the texts most similar to the query, best first."""
+        query_vector = self._embed(_terms(query))
+        scored = []
+        for position, vector in enumerate(self._vectors):
+            score = sum(
+                value * vector.get(term, 0.0) for term, value in query_vector.items()
+            )
+            if score >= min_score:
+                scored.append((score, position))
+        return sorted(scored, key=lambda entry: entry[0], reverse=True)[:limit]
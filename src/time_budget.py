@@ -0,0 +1,61 @@
+"""
+Investigation time budget surfaced to the coordinator.
+
+The coordinator cannot see the investigation deadline, so it may start a new
+collection round it cannot finish before the request times out. After every
+collector result, a PostToolUse hook on the Task tool adds a short note with
+the remaining time to the coordinator's context; once the budget runs low the
+note asks it to wrap up with the evidence it already has.
+"""
+
+import time
+from typing import Any
+
+from claude_agent_sdk import HookContext, HookMatcher
+
+from telemetry import add_event
+
+# Ask the coordinator to wrap up below this fraction of the budget or time
+_WRAP_UP_FRACTION = 0.25
+_WRAP_UP_SECONDS = 60
+
+
+def time_budget_note(remaining_seconds: float, total_seconds: int) -> str:
+    """Build the note added to the coordinator's context."""
+    remaining = max(0, int(remaining_seconds))
+    note = (
+        f"[time budget] About {remaining}s of {total_seconds}s remain "
+        "for this investigation."
+    )
+    if remaining < max(total_seconds * _WRAP_UP_FRACTION, _WRAP_UP_SECONDS):
+        note += (
+            " Do not start new collection rounds: write the final answer now "
+            "with the evidence already collected, and name any open questions "
+            "as next steps."
+        )
+    return note
+
+
+def create_time_budget_hooks(timeout_seconds: int) -> dict[str, list[HookMatcher]]:
+    """
+    Create coordinator hooks reporting the remaining time after each Task result.
+
+    The deadline starts when the hooks are created, right before the run.
+    """
+    deadline = time.monotonic() + timeout_seconds
+
+    async def _add_time_budget(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        remaining = deadline - time.monotonic()
+        add_event("time_budget_note", {"remaining_seconds": int(remaining)})
+        return {
+            "hookSpecificOutput": {
+                "hookEventName": "PostToolUse",
+                "additionalContext": time_budget_note(remaining, timeout_seconds),
+            }
+        }
+
+    return {
+        "PostToolUse": [HookMatcher(matcher="Task", hooks=[_add_time_budget])],  # type: ignore[list-item]
+    }
@@ -0,0 +1,117 @@
+"""
+Latency, result size, and error metrics of collectors and MCP tools.
+
+Every collector delegation (Task call of the coordinator) and every MCP tool
+call inside the collectors is measured from the model's tool use to its
+result in the session's message stream, and recorded as OpenTelemetry
+histograms labeled by collector, or by tool and MCP server (the cluster it
+reads):
+
+- `shoot.collector.duration`, `shoot.collector.result_size`,
+  `shoot.collector.errors`
+- `shoot.tool_call.duration`, `shoot.tool_call.result_size`,
+  `shoot.tool_call.errors`
+
+so slow Kubernetes reads and hot tools are visible across investigations.
+"""
+
+import time
+from dataclasses import dataclass
+from functools import lru_cache
+from typing import Any
+
+from claude_agent_sdk import (
+    AssistantMessage,
+    ToolResultBlock,
+    ToolUseBlock,
+    UserMessage,
+)
+from opentelemetry.metrics import Counter, Histogram
+
+from config import get_wc_cluster
+from debug_trace import content_text
+from telemetry import get_meter
+
+
+@dataclass
+class _Instruments:
+    duration: Histogram
+    result_size: Histogram
+    errors: Counter
+
+
+def _create_instruments(prefix: str, subject: str) -> _Instruments:
+    meter = get_meter()
+    return _Instruments(
+        duration=meter.create_histogram(
+            f"shoot.{prefix}.duration",
+            unit="s",
+            description=f"Duration of {subject}",
+        ),
+        result_size=meter.create_histogram(
+            f"shoot.{prefix}.result_size",
+            unit="By",
+            description=f"Result size of {subject}",
+        ),
+        errors=meter.create_counter(
+            f"shoot.{prefix}.errors",
+            description=f"Failed {subject}",
+        ),
+    )
+
+
+@lru_cache()
+def _collector_instruments() -> _Instruments:
+    return _create_instruments("collector", "collector delegations")
+
+
+@lru_cache()
+def _tool_instruments() -> _Instruments:
+    return _create_instruments("tool_call", "MCP tool calls of collectors")
+
+
+def _measured(name: str) -> bool:
+    return name == "Task" or name.startswith("mcp__")
+
+
+def _labels(
+    name: str, tool_input: dict[str, Any]
+) -> tuple[_Instruments, dict[str, str]]:
+    """Instruments and labels of a Task or MCP tool call."""
+    cluster = get_wc_cluster()
+    if name == "Task":
+        collector = str(tool_input.get("subagent_type", "unknown"))
+        return _collector_instruments(), {"collector": collector, "cluster": cluster}
+    _, server, tool = name.split("__", 2)
+    return _tool_instruments(), {"tool": tool, "server": server, "cluster": cluster}
+
+
+class ToolCallTimer:
+    """Measures the tool calls of one session from its message stream."""
+
+    def __init__(self) -> None:
+        # tool_use_id -> (monotonic start time, instruments, labels)
+        self._started: dict[str, tuple[float, _Instruments, dict[str, str]]] = {}
+
+    def observe(self, message: Any) -> None:
+        """Start timing the tool uses, or record the results, of a message."""
+        if isinstance(message, AssistantMessage):
+            for block in message.content:
+                if isinstance(block, ToolUseBlock) and _measured(block.name):
+                    instruments, labels = _labels(block.name, block.input)
+                    self._started[block.id] = (time.monotonic(), instruments, labels)
+        elif isinstance(message, UserMessage) and not isinstance(message.content, str):
+            for block in message.content:
+                if isinstance(block, ToolResultBlock):
+                    self._record(block)
+
+    def _record(self, block: ToolResultBlock) -> None:
+        started = self._started.pop(block.tool_use_id, None)
+        if started is None:
+            return
+        started_at, instruments, labels = started
+        instruments.duration.record(time.monotonic() - started_at, labels)
+        size = len(content_text(block.content).encode())
+        instruments.result_size.record(size, labels)
+        if block.is_error:
+            instruments.errors.add(1, labels)
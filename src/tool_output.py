@@ -0,0 +1,77 @@
+"""
+Processing of collector MCP tool output before it reaches the model.
+
+A single PostToolUse hook on all MCP tools applies, in order:
+- log sampling of `logs` output (log_sampling.py),
+- redaction of Secret data and credentials (redaction.py),
+- flagging or stripping of prompt injections (injection_scan.py), and
+- the size limit of oversized output (output_limit.py).
+
+All steps replace the tool output, so they share one hook: with separate
+hooks only one replacement would take effect.
+"""
+
+from typing import Any, Awaitable, Callable
+
+from claude_agent_sdk import HookContext, HookMatcher
+
+from app_logging import logger
+from collector_cache import tool_response_text
+from config import InjectionScanMode
+from injection_scan import neutralize_injections
+from log_sampling import LOGS_TOOLS_PATTERN
+from redaction import redact_tool_output
+from telemetry import add_event
+
+
+def create_tool_output_hooks(
+    log_sampler: Callable[[str], str] | None,
+    redact: bool,
+    output_limiter: Callable[[str, str], Awaitable[str]] | None = None,
+    injection_scan: InjectionScanMode = "off",
+) -> dict[str, list[HookMatcher]]:
+    """Create session hooks processing MCP tool output before the model sees it."""
+
+    async def _process_output(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        tool_name = input_data.get("tool_name", "")
+        original = tool_response_text(input_data.get("tool_response"))
+        if not original:
+            return {}
+
+        text = original
+        if log_sampler is not None and LOGS_TOOLS_PATTERN.fullmatch(tool_name):
+            text = log_sampler(text)
+        if redact:
+            text, redactions = redact_tool_output(text)
+            if redactions:
+                add_event(
+                    "tool_output_redacted",
+                    {"tool": tool_name, "redactions": redactions},
+                )
+        text, injections = neutralize_injections(text, injection_scan)
+        if injections:
+            logger.warning(
+                f"{injections} instruction-like passage(s) in {tool_name} output "
+                f"({injection_scan})"
+            )
+            add_event(
+                "tool_output_injection",
+                {"tool": tool_name, "passages": injections, "mode": injection_scan},
+            )
+        if output_limiter is not None:
+            text = await output_limiter(tool_name, text)
+        if text == original:
+            return {}
+
+        return {
+            "hookSpecificOutput": {
+                "hookEventName": "PostToolUse",
+                "updatedMCPToolOutput": [{"type": "text", "text": text}],
+            }
+        }
+
+    return {
+        "PostToolUse": [HookMatcher(matcher=r"mcp__.*", hooks=[_process_output])],  # type: ignore[list-item]
+    }
@@ -0,0 +1,253 @@
+"""
+Tool call policy for collector MCP tools.
+
+Collectors only see the tools listed for them in the registry, and the
+built-in mcp-kubernetes servers run with --non-destructive. As defense in
+depth, every MCP tool call is also checked when it is made by a PreToolUse
+hook, whatever the model asks for:
+
+- Read-only guardrail: calls with a mutating verb (create, patch, delete,
+  exec, ...) in the tool name or in a verb/command/action argument are
+  refused independently of any server flags or registry settings, and
+  recorded in the audit log.
+- Allowlist: calls to tools that no collector is given for that server, and
+  to tools on the registry's denylist, are refused.
+- Namespace restriction: in investigations restricted to namespaces
+  (namespace_scope.py), Kubernetes and remediation calls must name one of
+  them, and built-in tools must be scoped to them or have no cluster access;
+  calls across all namespaces, of cluster-scoped resources, and to other MCP
+  servers are refused.
+- Management cluster Secrets: the management cluster server runs with
+  shoot's service account, which can read the `<cluster>-kubeconfig`
+  Secrets of workload clusters (cluster_kubeconfig.py), so collectors
+  cannot read Secrets there at all.
+
+A refused call is reported back to the model as the reason of the denied
+tool call.
+
+The only exception are the remediator's write tools (remediation.py) of
+investigations that confirmed remediation; they are passed in as write tools
+and are always held for approval instead.
+
+The hook sees the tool, not the calling subagent, so the allowlist is
+enforced per MCP server; the per-collector lists are enforced by the SDK
+through the subagents' tool lists.
+"""
+
+import re
+from typing import TYPE_CHECKING, Any
+
+from claude_agent_sdk import HookContext, HookMatcher
+
+from app_logging import audit, logger
+from telemetry import add_event
+
+if TYPE_CHECKING:
+    from collectors import CollectorRegistry
+
+# Verbs that change cluster state
+MUTATING_VERBS = frozenset(
+    {
+        "annotate",
+        "apply",
+        "attach",
+        "cordon",
+        "cp",
+        "create",
+        "delete",
+        "drain",
+        "edit",
+        "evict",
+        "exec",
+        "install",
+        "label",
+        "patch",
+        "replace",
+        "restart",
+        "rollback",
+        "rollout",
+        "scale",
+        "set",
+        "taint",
+        "uncordon",
+        "uninstall",
+        "update",
+        "upgrade",
+    }
+)
+# Tool arguments naming the operation of generic tools (kubectl/helm runners)
+_VERB_ARGUMENTS = ("verb", "command", "action", "operation", "subcommand")
+_WORD_PATTERN = re.compile(r"[a-z]+")
+
+# Servers whose calls name their namespace (mcp-kubernetes and remediation)
+_NAMESPACED_SERVERS = frozenset({"kubernetes_wc", "kubernetes_mc", "shoot_remediation"})
+_BUILTIN_SERVER = "shoot_tools"
+# Built-in tools without cluster access, allowed in restricted investigations
+_UNSCOPED_BUILTIN_TOOLS = frozenset(
+    {"compare_release_manifest", "fetch_more", "search_runbooks"}
+)
+_NAMESPACE_RESOURCE_TYPES = frozenset({"namespace", "namespaces", "ns"})
+# Server whose credentials can read workload cluster kubeconfigs
+_MC_SERVER = "kubernetes_mc"
+_SECRET_RESOURCE_TYPES = frozenset({"secret", "secrets"})
+
+
+def mutating_verb(tool: str, tool_input: dict[str, Any] | None = None) -> str | None:
+    """The mutating verb of a tool call, or None if the call is read-only."""
+    for word in _WORD_PATTERN.findall(tool.lower()):
+        if word in MUTATING_VERBS:
+            return word
+    for argument in _VERB_ARGUMENTS:
+        value = (tool_input or {}).get(argument)
+        if isinstance(value, list):
+            value = " ".join(str(item) for item in value)
+        if isinstance(value, str):
+            words = _WORD_PATTERN.findall(value.lower())
+            if words and words[0] in MUTATING_VERBS:
+                return words[0]
+    return None
+
+
+def namespace_violation(
+    tool_name: str, tool_input: dict[str, Any], namespaces: tuple[str, ...]
+) -> str | None:
+    """Why a tool call leaves the allowed namespaces, or None if it stays in them."""
+    _, server, tool = (tool_name.split("__", 2) + ["", ""])[:3]
+    if server == _BUILTIN_SERVER and tool in _UNSCOPED_BUILTIN_TOOLS:
+        return None
+    if server not in _NAMESPACED_SERVERS and server != _BUILTIN_SERVER:
+        return "its server cannot be restricted to namespaces"
+    if tool_input.get("allNamespaces"):
+        return "it reads all namespaces"
+    requested = tool_input.get("namespaces")
+    if isinstance(requested, list):
+        if not requested:
+            return "it names no namespace"
+        outside = sorted(str(n) for n in requested if n not in namespaces)
+        return f"{', '.join(outside)} is not allowed" if outside else None
+    namespace = tool_input.get("namespace")
+    if not namespace:
+        # The allowed namespaces themselves can be read
+        resource = str(tool_input.get("resourceType", "")).lower()
+        name = tool_input.get("name")
+        if resource in _NAMESPACE_RESOURCE_TYPES and name in namespaces:
+            return None
+        return "it names no namespace (cluster-scoped or default)"
+    if namespace not in namespaces:
+        return f"namespace {namespace} is not allowed"
+    return None
+
+
+def reads_secrets(tool_input: dict[str, Any]) -> bool:
+    """Whether a Kubernetes tool call reads Secrets."""
+    for argument in ("resourceType", "kind", "resource"):
+        value = str(tool_input.get(argument, "")).lower()
+        if value.split(".", 1)[0] in _SECRET_RESOURCE_TYPES:
+            return True
+    for argument in _VERB_ARGUMENTS:
+        value = tool_input.get(argument)
+        if isinstance(value, list):
+            value = " ".join(str(item) for item in value)
+        if isinstance(value, str):
+            words = set(_WORD_PATTERN.findall(value.lower()))
+            if words & _SECRET_RESOURCE_TYPES:
+                return True
+    return False
+
+
+def _deny(reason: str) -> dict[str, Any]:
+    return {
+        "hookSpecificOutput": {
+            "hookEventName": "PreToolUse",
+            "permissionDecision": "deny",
+            "permissionDecisionReason": reason,
+        }
+    }
+
+
+def create_tool_policy_hooks(
+    registry: "CollectorRegistry",
+    write_tools: set[str] | None = None,
+    namespaces: tuple[str, ...] | None = None,
+) -> dict[str, list[HookMatcher]]:
+    """
+    Create session hooks enforcing the read-only guardrail, tool allowlist,
+    and namespace restriction.
+
+    Args:
+        registry: Collectors whose tools are allowed
+        write_tools: Qualified names of write tools exempt from the
+            guardrail (the remediation tools)
+        namespaces: Namespaces the calls are restricted to (None: all)
+    """
+    allowed = registry.allowed_tools()
+    denied = set(registry.denied_tools)
+    write_tools = write_tools or set()
+
+    async def _check_tool_call(
+        input_data: dict[str, Any], tool_use_id: str | None, context: HookContext
+    ) -> dict[str, Any]:
+        tool_name = input_data.get("tool_name", "")
+        tool_input = input_data.get("tool_input", {})
+        _, server, tool = (tool_name.split("__", 2) + ["", ""])[:3]
+        if namespaces is not None:
+            violation = namespace_violation(tool_name, tool_input, namespaces)
+            if violation is not None:
+                logger.warning(f"Refused MCP tool call outside namespaces: {tool_name}")
+                add_event("namespace_violation", {"tool": tool_name})
+                audit(
+                    "namespace_violation",
+                    session_id=input_data.get("session_id"),
+                    tool=tool_name,
+                    namespace=tool_input.get("namespace"),
+                )
+                return _deny(
+                    f"{tool_name} was refused: {violation}. This investigation "
+                    f"is restricted to the namespaces {', '.join(namespaces)}."
+                )
+        if server == _MC_SERVER and reads_secrets(tool_input):
+            logger.warning(f"Refused management cluster Secret read: {tool_name}")
+            add_event("secret_read_denied", {"tool": tool_name})
+            audit(
+                "secret_read_denied",
+                session_id=input_data.get("session_id"),
+                tool=tool_name,
+                namespace=tool_input.get("namespace"),
+            )
+            return _deny(
+                f"{tool_name} was refused: Secrets on the management cluster "
+                "hold workload cluster credentials and cannot be read."
+            )
+        if tool_name in write_tools:
+            return {}
+
+        verb = mutating_verb(tool, tool_input)
+        if verb is not None:
+            logger.warning(f"Refused mutating MCP tool call: {tool_name} ({verb})")
+            add_event("read_only_violation", {"tool": tool_name, "verb": verb})
+            audit(
+                "read_only_violation",
+                session_id=input_data.get("session_id"),
+                tool=tool_name,
+                verb=verb,
+                arguments=sorted(tool_input),
+            )
+            return _deny(
+                f"{tool_name} was refused: '{verb}' changes cluster state and "
+                "shoot is read-only. Collect the data with get, list, describe, "
+                "logs, or events instead."
+            )
+
+        if tool_name in allowed and tool not in denied:
+            return {}
+
+        logger.warning(f"Refused MCP tool call outside the collector policy: {tool_name}")
+        add_event("tool_call_denied", {"tool": tool_name})
+        return _deny(
+            f"{tool_name} is not permitted for collectors. "
+            "Use only the read tools you were given."
+        )
+
+    return {
+        "PreToolUse": [HookMatcher(matcher=r"mcp__.*", hooks=[_check_tool_call])],  # type: ignore[list-item]
+    }
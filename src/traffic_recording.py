@@ -0,0 +1,320 @@
+"""
+Record and replay of the model and tool traffic of investigations.
+
+An investigation requested with `"record": true` captures its traffic into a
+recording bundle, kept as the `recording.json` artifact of the
+investigation:
+
+- Model traffic: the coordinator session's claude process is pointed at a
+  loopback proxy (ANTHROPIC_BASE_URL) that forwards every API request to the
+  real endpoint and keeps the request and response bodies.
+- Tool traffic: a PostToolUse hook keeps the arguments and output of every
+  MCP tool call of the collectors, redacted like cached results.
+
+In replay mode the proxy answers from the recorded responses instead, and the
+collectors' MCP servers are replaced by recorded ones (recorded_tools.py), so
+the investigation runs again without network or cluster access
+(replay_recording.py). Requests are answered with the recorded response of an
+identical request if there is one, otherwise with the next recorded response
+for the same endpoint, so replays stay deterministic as long as the
+investigation takes the same path. The proxy answers a scripted model
+(scripted_model.py) the same way.
+
+Only the coordinator session is covered: the critic, report writer, and
+summarization models are called directly and are not recorded.
+"""
+
+import asyncio
+import json
+import os
+import threading
+import time
+from datetime import datetime, timezone
+from typing import Any, Protocol
+
+import httpx
+import uvicorn
+from claude_agent_sdk import HookContext, HookMatcher
+from pydantic import BaseModel, Field
+from starlette.applications import Starlette
+from starlette.requests import Request
+from starlette.responses import Response
+from starlette.routing import Route
+
+from app_logging import logger
+from collector_cache import tool_response_text
+from collectors import CLUSTER_BUILTIN_TOOLS, SHOOT_TOOLS_SERVER, CollectorRegistry
+from config import get_prompt_version, get_settings
+from mcp_pool import free_port
+from recorded_tools import RecordedCall, RecordedTools, recorded_server_configs
+from redaction import redact_tool_output
+from secret_files import get_secret
+
+# Artifact name of the recording bundle
+RECORDING_ARTIFACT = "recording.json"
+_DEFAULT_UPSTREAM = "https://api.anthropic.com"
+_UPSTREAM_TIMEOUT_SECONDS = 600
+_STARTUP_TIMEOUT_SECONDS = 10
+# Request headers not forwarded upstream; compressed responses could not be
+# kept as text
+_DROPPED_HEADERS = {"host", "content-length", "accept-encoding", "connection"}
+
+
+class ModelExchange(BaseModel):
+    """A recorded model API request and its response."""
+
+    method: str
+    path: str
+    request: str
+    status: int
+    content_type: str = ""
+    response: str
+
+
+class RecordingBundle(BaseModel):
+    """The model and tool traffic of one investigation."""
+
+    query: str
+    created_at: str = Field(
+        default_factory=lambda: datetime.now(timezone.utc).isoformat()
+    )
+    coordinator_model: str
+    collector_model: str
+    prompt_version: str
+    model_exchanges: list[ModelExchange] = Field(default_factory=list)
+    tool_calls: list[RecordedCall] = Field(default_factory=list)
+
+
+class ModelResponder(Protocol):
+    """Answers model API requests in place of the real endpoint."""
+
+    def respond(self, method: str, path: str, body: str) -> ModelExchange | None:
+        """Exchange answering a request, or None if there is no answer."""
+        ...
+
+
+class RecordedExchanges:
+    """Answers model API requests from recorded exchanges."""
+
+    def __init__(self, exchanges: list[ModelExchange]) -> None:
+        self._exchanges = exchanges
+        self._used: set[int] = set()
+        self._lock = threading.Lock()
+
+    def respond(self, method: str, path: str, body: str) -> ModelExchange | None:
+        """Recorded response to an identical request, else the next one recorded."""
+        with self._lock:
+            candidates = [
+                (position, exchange)
+                for position, exchange in enumerate(self._exchanges)
+                if position not in self._used
+                and exchange.method == method
+                and exchange.path == path
+            ]
+            if not candidates:
+                return None
+            identical = [entry for entry in candidates if entry[1].request == body]
+            position, exchange = (identical or candidates)[0]
+            self._used.add(position)
+            return exchange
+
+
+class ModelProxy:
+    """
+    Loopback proxy recording model API traffic, or answering it from a
+    responder (a recording or a scripted model).
+
+    Served by uvicorn in its own thread, so it installs no signal handlers
+    and the service's own shutdown is unaffected.
+    """
+
+    def __init__(self, responder: ModelResponder | None = None) -> None:
+        self._responder = responder
+        self.exchanges: list[ModelExchange] = []
+        self.unmatched = 0
+        self._lock = threading.Lock()
+        self.port = free_port()
+        app = Starlette(
+            routes=[Route("/{path:path}", self._handle, methods=["GET", "POST"])]
+        )
+        config = uvicorn.Config(
+            app, host="127.0.0.1", port=self.port, log_level="warning", lifespan="off"
+        )
+        self._server = uvicorn.Server(config)
+        self._thread: threading.Thread | None = None
+
+    @property
+    def base_url(self) -> str:
+        return f"http://127.0.0.1:{self.port}"
+
+    def start(self) -> None:
+        """
+        Start serving and wait until the proxy accepts connections.
+
+        Raises:
+            RuntimeError: The proxy did not come up in time
+        """
+        self._thread = threading.Thread(target=self._server.run, daemon=True)
+        self._thread.start()
+        deadline = time.monotonic() + _STARTUP_TIMEOUT_SECONDS
+        while not self._server.started:
+            if time.monotonic() > deadline or not self._thread.is_alive():
+                raise RuntimeError("Model traffic proxy did not start")
+            time.sleep(0.05)
+
+    def stop(self) -> None:
+        self._server.should_exit = True
+        if self._thread is not None:
+            self._thread.join(timeout=_STARTUP_TIMEOUT_SECONDS)
+
+    async def _handle(self, request: Request) -> Response:
+        body = (await request.body()).decode(errors="replace")
+        if self._responder is not None:
+            return self._answer(request.method, request.url.path, body)
+        return await self._forward(request, body)
+
+    async def _forward(self, request: Request, body: str) -> Response:
+        headers = {
+            key: value
+            for key, value in request.headers.items()
+            if key.lower() not in _DROPPED_HEADERS
+        }
+        path = request.url.path
+        if request.url.query:
+            path = f"{path}?{request.url.query}"
+        async with httpx.AsyncClient(
+            base_url=os.environ.get("ANTHROPIC_BASE_URL", _DEFAULT_UPSTREAM),
+            timeout=_UPSTREAM_TIMEOUT_SECONDS,
+        ) as client:
+            upstream = await client.request(
+                request.method, path, content=body.encode(), headers=headers
+            )
+        exchange = ModelExchange(
+            method=request.method,
+            path=request.url.path,
+            request=body,
+            status=upstream.status_code,
+            content_type=upstream.headers.get("content-type", ""),
+            response=upstream.text,
+        )
+        with self._lock:
+            self.exchanges.append(exchange)
+        return Response(
+            upstream.content,
+            status_code=upstream.status_code,
+            media_type=exchange.content_type or None,
+        )
+
+    def _answer(self, method: str, path: str, body: str) -> Response:
+        assert self._responder is not None
+        exchange = self._responder.respond(method, path, body)
+        if exchange is None:
+            with self._lock:
+                self.unmatched += 1
+            error = {
+                "type": "error",
+                "error": {
+                    "type": "not_found_error",
+                    "message": "No recorded response",
+                },
+            }
+            return Response(
+                json.dumps(error), status_code=404, media_type="application/json"
+            )
+        return Response(
+            exchange.response,
+            status_code=exchange.status,
+            media_type=exchange.content_type or None,
+        )
+
+
+class TrafficSession:
+    """
+    Records the traffic of one investigation, or answers it from a responder
+    and recorded tool calls.
+    """
+
+    def __init__(
+        self,
+        responder: ModelResponder | None = None,
+        tool_calls: list[RecordedCall] | None = None,
+    ) -> None:
+        self.recording = responder is None
+        self.tool_calls: list[RecordedCall] = []
+        self.proxy = ModelProxy(responder)
+        self.recorded_tools = (
+            RecordedTools(tool_calls) if tool_calls is not None else None
+        )
+
+    @classmethod
+    def replaying(cls, bundle: RecordingBundle) -> "TrafficSession":
+        """Session replaying a recording bundle."""
+        return cls(RecordedExchanges(bundle.model_exchanges), bundle.tool_calls)
+
+    async def __aenter__(self) -> "TrafficSession":
+        await asyncio.to_thread(self.proxy.start)
+        return self
+
+    async def __aexit__(self, *exc_info: Any) -> None:
+        await asyncio.to_thread(self.proxy.stop)
+
+    def env(self) -> dict[str, str]:
+        """Environment routing the claude process's model traffic via the proxy."""
+        env = {"ANTHROPIC_BASE_URL": self.proxy.base_url}
+        if not self.recording and not get_secret("anthropic_api_key"):
+            # Answered traffic needs no credentials, but the claude process
+            # expects a key
+            env["ANTHROPIC_API_KEY"] = "replay"
+        return env
+
+    def mcp_servers(self, registry: CollectorRegistry) -> dict[str, Any] | None:
+        """Recorded MCP servers if tool calls are answered, else None."""
+        if self.recorded_tools is None:
+            return None
+        return recorded_server_configs(registry, self.recorded_tools)
+
+    async def _record_tool_call(
+        self,
+        input_data: dict[str, Any],
+        tool_use_id: str | None,
+        context: HookContext,
+    ) -> dict[str, Any]:
+        """PostToolUse hook: keep the arguments and output of an MCP tool call."""
+        name = input_data.get("tool_name", "")
+        prefix = f"mcp__{SHOOT_TOOLS_SERVER}__"
+        # Built-in tools are kept on replay, unless they read the cluster
+        if name.startswith(prefix) and name[len(prefix) :] not in CLUSTER_BUILTIN_TOOLS:
+            return {}
+        output = tool_response_text(input_data.get("tool_response")) or ""
+        if get_settings().redaction_enabled:
+            output, _ = redact_tool_output(output)
+        self.tool_calls.append(
+            RecordedCall(tool=name, input=input_data.get("tool_input"), output=output)
+        )
+        return {}
+
+    def hooks(self) -> dict[str, list[HookMatcher]]:
+        """Session hooks recording tool calls; none unless recording."""
+        if not self.recording:
+            return {}
+        return {
+            "PostToolUse": [
+                HookMatcher(matcher="mcp__.*", hooks=[self._record_tool_call])  # type: ignore[list-item]
+            ]
+        }
+
+    def bundle(self, query: str) -> RecordingBundle:
+        """The recorded traffic as a bundle."""
+        settings = get_settings()
+        logger.info(
+            f"Recorded {len(self.proxy.exchanges)} model exchanges and "
+            f"{len(self.tool_calls)} tool calls"
+        )
+        return RecordingBundle(
+            query=query,
+            coordinator_model=settings.coordinator_model,
+            collector_model=settings.collector_model,
+            prompt_version=get_prompt_version(),
+            model_exchanges=list(self.proxy.exchanges),
+            tool_calls=list(self.tool_calls),
+        )
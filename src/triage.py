@@ -0,0 +1,122 @@
+"""
+Severity classification and triage labels of investigations.
+
+With SHOOT_TRIAGE_ENABLED set, every investigation's report is classified
+after it is written:
+
+- severity: `critical`, `degraded`, `healthy`, or `inconclusive`
+- component: the main affected component, e.g. `coredns`
+- cause category: the probable cause, e.g. `resources` or `certificates`
+
+The labels are returned with the investigation, kept in its record, and
+counted as an OpenTelemetry metric (`shoot.investigations.triage`), so fleet
+dashboards can aggregate outcomes without parsing reports. Like the critic,
+the classifier has no tools and calls the Anthropic Messages API directly
+with a single request (llm.py).
+"""
+
+import re
+from functools import lru_cache
+from typing import Any, Literal
+
+from opentelemetry.metrics import Counter
+from pydantic import BaseModel
+
+from app_logging import logger
+from config import get_settings, get_triage_prompt
+from llm import complete, parse_json_answer
+from telemetry import get_meter
+
+Severity = Literal["critical", "degraded", "healthy", "inconclusive"]
+CauseCategory = Literal[
+    "configuration",
+    "image",
+    "resources",
+    "scheduling",
+    "networking",
+    "dns",
+    "certificates",
+    "storage",
+    "dependency",
+    "upgrade",
+    "infrastructure",
+    "application",
+    "none",
+    "unknown",
+]
+
+# Reports are truncated to this many characters for classification
+_MAX_REPORT_CHARS = 30000
+_MAX_OUTPUT_TOKENS = 256
+_COMPONENT_PATTERN = re.compile(r"[^a-z0-9.-]+")
+_MAX_COMPONENT_LENGTH = 63
+
+
+class Triage(BaseModel):
+    """Triage labels of an investigation."""
+
+    severity: Severity
+    component: str = "unknown"
+    cause_category: CauseCategory = "unknown"
+
+
+def _normalize_component(component: str) -> str:
+    """Lowercase label value, so metric series do not multiply on spelling."""
+    normalized = _COMPONENT_PATTERN.sub("-", component.strip().lower()).strip("-")
+    return normalized[:_MAX_COMPONENT_LENGTH] or "unknown"
+
+
+def parse_triage(text: str) -> Triage | None:
+    """Parse the classifier's JSON answer, tolerating surrounding prose or fences."""
+    triage = parse_json_answer(text, Triage)
+    if triage is None:
+        return None
+    triage.component = _normalize_component(triage.component)
+    return triage
+
+
+async def classify_investigation(
+    query: str, report: str, truncated: bool = False
+) -> tuple[Triage | None, dict[str, Any]]:
+    """
+    Classify the outcome of an investigation.
+
+    Args:
+        query: Original failure description
+        report: Final report
+        truncated: The report was cut short by the cost ceiling
+
+    Returns:
+        Tuple of (labels or None if the answer could not be parsed, token
+        usage)
+    """
+    settings = get_settings()
+    if len(report) > _MAX_REPORT_CHARS:
+        report = report[:_MAX_REPORT_CHARS] + "\n[... truncated]"
+    if truncated:
+        report += "\n\n[The investigation was stopped early; this report is partial]"
+    answer = await complete(
+        settings.triage_model or settings.collector_model,
+        get_triage_prompt(),
+        f"## Failure description\n{query}\n\n## Report\n{report}",
+        _MAX_OUTPUT_TOKENS,
+    )
+    triage = parse_triage(answer.text)
+    if triage is None:
+        logger.warning(f"Could not parse triage labels: {answer.text[:200]}")
+    return triage, answer.usage
+
+
+@lru_cache()
+def _triage_counter() -> Counter:
+    return get_meter().create_counter(
+        "shoot.investigations.triage",
+        description="Investigations by severity, component, and cause category",
+    )
+
+
+def record_triage_metric(cluster: str, triage: dict[str, Any] | None) -> None:
+    """Count a classified investigation of a cluster."""
+    if triage is None:
+        return
+    _triage_counter().add(1, {"cluster": cluster, **triage})